@@ -2,11 +2,11 @@ package main
 
 import (
 	"context"
-	"grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
 	"time"
 
-	"grpc-connection-manager/internal/manager"
-	"grpc-connection-manager/internal/metrics"
+	"github.com/begenov/grpc-connection-manager/pkg/manager"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
 )
 
 func main() {
@@ -3,11 +3,11 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
 	"time"
 
-	"grpc-connection-manager/internal/manager"
-	"grpc-connection-manager/internal/metrics"
+	"github.com/begenov/grpc-connection-manager/pkg/manager"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
 
 	"google.golang.org/grpc/credentials"
 )
@@ -0,0 +1,115 @@
+package testutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+)
+
+// FakeClock is a clock.Clock whose time only moves when Advance is called.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	at      time.Time
+	period  time.Duration // zero for one-shot timers
+	ch      chan time.Time
+	stopped bool
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements clock.Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since implements clock.Clock.
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After implements clock.Clock.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.addWaiter(d, 0).ch
+}
+
+// NewTicker implements clock.Clock.
+func (c *FakeClock) NewTicker(d time.Duration) clock.Ticker {
+	return &fakeTicker{clock: c, waiter: c.addWaiter(d, d)}
+}
+
+func (c *FakeClock) addWaiter(d, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &fakeWaiter{at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+// Advance moves the clock forward by d and fires every timer and ticker that became due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.stopped {
+			continue
+		}
+		if !w.at.After(c.now) {
+			select {
+			case w.ch <- c.now:
+			default:
+			}
+			if w.period == 0 {
+				continue
+			}
+			for !w.at.After(c.now) {
+				w.at = w.at.Add(w.period)
+			}
+		}
+		pending = append(pending, w)
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of pending timers and tickers.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n timers or tickers are pending.
+// It is used to synchronize with goroutines that are about to wait on the clock.
+func (c *FakeClock) BlockUntil(n int) {
+	for c.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.waiter.stopped = true
+}
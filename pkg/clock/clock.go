@@ -0,0 +1,48 @@
+package clock
+
+import "time"
+
+// Clock abstracts time so that time-based components can be tested deterministically.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// Since returns the time elapsed since t
+	Since(t time.Time) time.Duration
+	// After waits for the duration to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a Ticker that ticks every d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered
+	C() <-chan time.Time
+	// Stop turns off the ticker
+	Stop()
+}
+
+// Real is a Clock backed by the time package.
+var Real Clock = realClock{}
+
+// OrReal returns c, or Real if c is nil.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
@@ -0,0 +1,21 @@
+// Package compression provides zstd and snappy gRPC compressors.
+//
+// Importing the package registers both with gRPC using default settings, so they can be
+// selected by name with Config.Compression or grpc.UseCompressor. The constructors allow
+// building compressors with other settings.
+package compression
+
+import (
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+func init() {
+	encoding.RegisterCompressor(NewZstdCompressor(zstd.SpeedDefault))
+	encoding.RegisterCompressor(NewSnappyCompressor())
+}
+
+// Registered reports whether a compressor with the given name is registered with gRPC.
+func Registered(name string) bool {
+	return encoding.GetCompressor(name) != nil
+}
@@ -0,0 +1,53 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+)
+
+func TestCompressorsRoundTrip(t *testing.T) {
+	payload := []byte(strings.Repeat("grpc-connection-manager ", 1000))
+
+	for _, name := range []string{Zstd, Snappy} {
+		t.Run(name, func(t *testing.T) {
+			c := encoding.GetCompressor(name)
+			if c == nil {
+				t.Fatalf("compressor %s is not registered", name)
+			}
+
+			// Run twice so pooled encoders and decoders are reused.
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				w, err := c.Compress(&buf)
+				if err != nil {
+					t.Fatalf("Compress failed: %v", err)
+				}
+				if _, err := w.Write(payload); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+				if buf.Len() >= len(payload) {
+					t.Errorf("compressed size %d is not smaller than %d", buf.Len(), len(payload))
+				}
+
+				r, err := c.Decompress(&buf)
+				if err != nil {
+					t.Fatalf("Decompress failed: %v", err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("ReadAll failed: %v", err)
+				}
+				if !bytes.Equal(got, payload) {
+					t.Fatal("decompressed payload does not match")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package compression
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/grpc/encoding"
+)
+
+// Snappy is the name of the snappy compressor.
+const Snappy = "snappy"
+
+type snappyCompressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewSnappyCompressor creates a snappy encoding.Compressor using the snappy framing format.
+func NewSnappyCompressor() encoding.Compressor {
+	return &snappyCompressor{}
+}
+
+func (c *snappyCompressor) Name() string {
+	return Snappy
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw, ok := c.writers.Get().(*snappy.Writer)
+	if ok {
+		sw.Reset(w)
+	} else {
+		sw = snappy.NewBufferedWriter(w)
+	}
+	return &snappyWriter{Writer: sw, pool: &c.writers}, nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	sr, ok := c.readers.Get().(*snappy.Reader)
+	if ok {
+		sr.Reset(r)
+	} else {
+		sr = snappy.NewReader(r)
+	}
+	return &snappyReader{Reader: sr, pool: &c.readers}, nil
+}
+
+// snappyWriter returns its writer to the pool when closed.
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+func (w *snappyWriter) Close() error {
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	return err
+}
+
+// snappyReader returns its reader to the pool once the stream is fully read.
+type snappyReader struct {
+	*snappy.Reader
+	pool *sync.Pool
+}
+
+func (r *snappyReader) Read(p []byte) (int, error) {
+	if r.Reader == nil {
+		return 0, io.EOF
+	}
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.Reader)
+		r.Reader = nil
+	}
+	return n, err
+}
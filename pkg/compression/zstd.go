@@ -0,0 +1,91 @@
+package compression
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Zstd is the name of the zstd compressor.
+const Zstd = "zstd"
+
+type zstdCompressor struct {
+	level    zstd.EncoderLevel
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+// NewZstdCompressor creates a zstd encoding.Compressor with the given level.
+func NewZstdCompressor(level zstd.EncoderLevel) encoding.Compressor {
+	return &zstdCompressor{level: level}
+}
+
+// RegisterZstd registers a zstd compressor with the given level in place of the default one.
+// Like encoding.RegisterCompressor, it must only be called during initialization.
+func RegisterZstd(level zstd.EncoderLevel) {
+	encoding.RegisterCompressor(NewZstdCompressor(level))
+}
+
+func (c *zstdCompressor) Name() string {
+	return Zstd
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+	}
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(c.level), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if dec, ok := c.decoders.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			c.decoders.Put(dec)
+			return nil, err
+		}
+		return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+}
+
+// zstdWriter returns its encoder to the pool when closed.
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// zstdReader returns its decoder to the pool once the stream is fully read.
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.Decoder == nil {
+		return 0, io.EOF
+	}
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		_ = r.Decoder.Reset(nil)
+		r.pool.Put(r.Decoder)
+		r.Decoder = nil
+	}
+	return n, err
+}
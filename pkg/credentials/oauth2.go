@@ -0,0 +1,123 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+)
+
+// StaticToken is a TokenSource that always returns the same token, which never expires.
+type StaticToken string
+
+// Token implements TokenSource.
+func (t StaticToken) Token(context.Context) (*Token, error) {
+	return &Token{AccessToken: string(t)}, nil
+}
+
+// ClientCredentialsConfig holds configuration for an OAuth2 client credentials token source.
+type ClientCredentialsConfig struct {
+	// TokenURL is the authorization server's token endpoint
+	TokenURL string
+	// ClientID identifies the client
+	ClientID string
+	// ClientSecret authenticates the client
+	ClientSecret string
+	// Scopes are the requested scopes (default: nil)
+	Scopes []string
+	// EndpointParams are additional form parameters sent to the token endpoint (default: nil)
+	EndpointParams url.Values
+	// Client sends token requests. If nil, a client with a 10s timeout is used
+	Client *http.Client
+	// Clock computes token expiry from expires_in. If nil, the real clock is used
+	Clock clock.Clock
+}
+
+// ClientCredentialsSource fetches tokens with the OAuth2 client credentials grant (RFC 6749 section 4.4).
+type ClientCredentialsSource struct {
+	cfg    *ClientCredentialsConfig
+	client *http.Client
+	clock  clock.Clock
+}
+
+var _ TokenSource = (*ClientCredentialsSource)(nil)
+
+// NewClientCredentialsSource creates a ClientCredentialsSource.
+func NewClientCredentialsSource(cfg *ClientCredentialsConfig) (*ClientCredentialsSource, error) {
+	if cfg == nil || cfg.TokenURL == "" {
+		return nil, errors.New("TokenURL must be set")
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("ClientID must be set")
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &ClientCredentialsSource{cfg: cfg, client: client, clock: clock.OrReal(cfg.Clock)}, nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token implements TokenSource by requesting a new token from the token endpoint.
+func (s *ClientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	for key, values := range s.cfg.EndpointParams {
+		form[key] = values
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+
+	start := s.clock.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil && resp.StatusCode < http.StatusBadRequest {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		if tr.Error != "" {
+			return nil, fmt.Errorf("token endpoint returned status %d: %s %s", resp.StatusCode, tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	token := &Token{AccessToken: tr.AccessToken}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = start.Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
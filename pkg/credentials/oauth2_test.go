@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+)
+
+func TestClientCredentialsSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_request"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	clk := testutil.NewFakeClock(time.Now())
+	source, err := NewClientCredentialsSource(&ClientCredentialsConfig{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+		Clock:        clk,
+	})
+	if err != nil {
+		t.Fatalf("NewClientCredentialsSource failed: %v", err)
+	}
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if token.AccessToken != "abc" {
+		t.Errorf("expected access token abc, got %q", token.AccessToken)
+	}
+	if want := clk.Now().Add(time.Hour); !token.Expiry.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, token.Expiry)
+	}
+
+	source.cfg.ClientSecret = "wrong"
+	if _, err := source.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("expected invalid_client error, got %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package credentials
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ReloadingTLSConfig holds configuration for ReloadingTLS.
+type ReloadingTLSConfig struct {
+	// CertFile and KeyFile are the PEM-encoded client certificate and key presented for mutual TLS.
+	// If both are empty, no client certificate is sent
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle of CAs trusted to sign server certificates. If empty, the system roots are used
+	CAFile string
+	// ServerName overrides the name used to verify server certificates (default: the dialed host)
+	ServerName string
+	// ReloadInterval is how often the files are checked for changes. Zero disables reloading (default: 1m)
+	ReloadInterval time.Duration
+	// Clock schedules the checks. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives reload failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultReloadingTLSConfig returns a ReloadingTLSConfig with sensible defaults for the given files.
+func DefaultReloadingTLSConfig(certFile, keyFile, caFile string) *ReloadingTLSConfig {
+	return &ReloadingTLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		CAFile:         caFile,
+		ReloadInterval: time.Minute,
+	}
+}
+
+// ReloadingTLS builds TLS transport credentials from certificate files and reloads them when
+// the files change, so rotated certificates are picked up by new connections without restarting
+// the process or recreating the manager. Existing connections keep the certificates they were
+// established with.
+type ReloadingTLS struct {
+	cfg    *ReloadingTLSConfig
+	clock  clock.Clock
+	logger logger.Logger
+
+	cert  atomic.Pointer[tls.Certificate]
+	roots atomic.Pointer[x509.CertPool]
+
+	// mu serializes reloads. stamps are the modification times and sizes of the loaded files,
+	// used to detect changes
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloadingTLS loads the certificate files and starts watching them for changes.
+// Call Close to stop watching.
+func NewReloadingTLS(cfg *ReloadingTLSConfig) (*ReloadingTLS, error) {
+	if cfg == nil {
+		return nil, errors.New("TLS config must be set")
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("CertFile and KeyFile must be set together")
+	}
+	if cfg.ReloadInterval < 0 {
+		return nil, errors.New("ReloadInterval must not be negative")
+	}
+
+	r := &ReloadingTLS{
+		cfg:    cfg,
+		clock:  clock.OrReal(cfg.Clock),
+		logger: logger.OrDefault(cfg.Logger),
+		done:   make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if cfg.ReloadInterval > 0 {
+		r.wg.Add(1)
+		go r.watch()
+	}
+	return r, nil
+}
+
+// TransportCredentials returns credentials that use the most recently loaded certificates
+// for every handshake.
+func (r *ReloadingTLS) TransportCredentials() credentials.TransportCredentials {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.cert.Load(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+	if r.cfg.CAFile != "" {
+		// RootCAs cannot be swapped after the config is built, so the chain is verified in
+		// VerifyConnection against the current pool instead.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = r.verify
+	}
+	return credentials.NewTLS(tlsConfig)
+}
+
+func (r *ReloadingTLS) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.roots.Load(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Reload loads the files now. On error the previously loaded certificates are kept.
+func (r *ReloadingTLS) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	var roots *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", r.cfg.CAFile)
+		}
+	}
+
+	r.cert.Store(cert)
+	r.roots.Store(roots)
+	r.stamps = stamps
+	return nil
+}
+
+// Close stops watching the files.
+func (r *ReloadingTLS) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.wg.Wait()
+}
+
+func (r *ReloadingTLS) files() []string {
+	var files []string
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (r *ReloadingTLS) statFiles() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// changed reports whether any file differs from when it was last loaded.
+func (r *ReloadingTLS) changed() bool {
+	stamps, err := r.statFiles()
+	if err != nil {
+		// A file missing mid-rotation is treated as a change so that the error is logged.
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for f, stamp := range stamps {
+		if r.stamps[f] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ReloadingTLS) watch() {
+	defer r.wg.Done()
+
+	ticker := r.clock.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C():
+		}
+
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			r.logger.Warnf("Failed to reload TLS certificates, keeping the previous ones: %v", err)
+			continue
+		}
+		r.logger.Infof("Reloaded TLS certificates")
+	}
+}
@@ -0,0 +1,216 @@
+package credentials
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startMTLSServer starts a health server that requires client certificates signed by ca.
+func startMTLSServer(t *testing.T, ca *testCA) string {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+func checkHealth(addr string, creds credentials.TransportCredentials) error {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestReloadingTLS_HotReload(t *testing.T) {
+	serverCA := newTestCA(t)
+	otherCA := newTestCA(t)
+	addr := startMTLSServer(t, serverCA)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	// Start with a client certificate and CA from the wrong authority.
+	certPEM, keyPEM := otherCA.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, otherCA.pem)
+
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultReloadingTLSConfig(certFile, keyFile, caFile)
+	cfg.ServerName = "localhost"
+	cfg.Clock = clk
+	cfg.Logger = logger.Nop
+
+	reloading, err := NewReloadingTLS(cfg)
+	if err != nil {
+		t.Fatalf("NewReloadingTLS failed: %v", err)
+	}
+	defer reloading.Close()
+	creds := reloading.TransportCredentials()
+
+	if err := checkHealth(addr, creds); err == nil {
+		t.Fatal("expected handshake with the wrong CA to fail")
+	}
+
+	// Rotate to certificates from the server's authority and let the watcher pick them up.
+	certPEM, keyPEM = serverCA.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, serverCA.pem)
+
+	clk.BlockUntil(1)
+	clk.Advance(cfg.ReloadInterval)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := checkHealth(addr, creds)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated certificates were not picked up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadingTLS_KeepsCertificatesOnBadReload(t *testing.T) {
+	ca := newTestCA(t)
+	addr := startMTLSServer(t, ca)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	writeFile(t, caFile, ca.pem)
+
+	cfg := DefaultReloadingTLSConfig(certFile, keyFile, caFile)
+	cfg.ServerName = "localhost"
+	cfg.ReloadInterval = 0
+
+	reloading, err := NewReloadingTLS(cfg)
+	if err != nil {
+		t.Fatalf("NewReloadingTLS failed: %v", err)
+	}
+	defer reloading.Close()
+
+	writeFile(t, certFile, []byte("not a certificate"))
+	if err := reloading.Reload(); err == nil {
+		t.Fatal("expected Reload to fail for an invalid certificate")
+	}
+	if err := checkHealth(addr, reloading.TransportCredentials()); err != nil {
+		t.Errorf("expected previous certificates to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// Token is an access token with its expiry time. A zero Expiry means the token does not expire.
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// TokenSource fetches new access tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// RefreshingCredentialsConfig holds configuration for RefreshingCredentials.
+type RefreshingCredentialsConfig struct {
+	// Source fetches new tokens
+	Source TokenSource
+	// Name identifies the credentials in metrics and logs (default: "default")
+	Name string
+	// RefreshFraction is the fraction of a token's lifetime after which it is refreshed (default: 0.8)
+	RefreshFraction float64
+	// Jitter randomizes the refresh time by up to this fraction of the lifetime (default: 0.1)
+	Jitter float64
+	// RetryBackoff is the initial delay before retrying a failed refresh, doubled on each failure (default: 1s)
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between retries of a failed refresh (default: 1m)
+	MaxRetryBackoff time.Duration
+	// RefreshBefore is how long before its Expiry a token is no longer sent. It is refreshed in the
+	// background before then, and fetched during the call if that refresh has not succeeded (default: 0)
+	RefreshBefore time.Duration
+	// MinRefreshDelay is the shortest delay before a refresh, so that tokens that are about to expire,
+	// or already have, are not fetched in a tight loop (default: 1s)
+	MinRefreshDelay time.Duration
+	// RequireTransportSecurity reports whether the token may only be sent over secure transports (default: false)
+	RequireTransportSecurity bool
+	// Metrics records refresh latency and failures. If nil, no metrics are recorded
+	Metrics metrics.MetricsRecorder
+	// Clock schedules refreshes. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives refresh failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultRefreshingCredentialsConfig returns a RefreshingCredentialsConfig with sensible defaults for source.
+func DefaultRefreshingCredentialsConfig(source TokenSource) *RefreshingCredentialsConfig {
+	return &RefreshingCredentialsConfig{
+		Source:          source,
+		Name:            "default",
+		RefreshFraction: 0.8,
+		Jitter:          0.1,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: time.Minute,
+		MinRefreshDelay: time.Second,
+	}
+}
+
+// RefreshingCredentials is a PerRPCCredentials that sends a bearer token and refreshes it in the
+// background before it expires, instead of waiting for calls to fail with Unauthenticated.
+type RefreshingCredentials struct {
+	cfg    *RefreshingCredentialsConfig
+	clock  clock.Clock
+	logger logger.Logger
+
+	mu    sync.RWMutex
+	token *Token
+
+	// fetchMu makes concurrent calls that find no usable token share a single fetch.
+	fetchMu sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+var _ credentials.PerRPCCredentials = (*RefreshingCredentials)(nil)
+
+// NewRefreshingCredentials fetches an initial token and starts refreshing it in the background.
+// Call Close to stop refreshing.
+func NewRefreshingCredentials(ctx context.Context, cfg *RefreshingCredentialsConfig) (*RefreshingCredentials, error) {
+	if cfg == nil || cfg.Source == nil {
+		return nil, errors.New("token source must be set")
+	}
+	if cfg.RefreshFraction <= 0 || cfg.RefreshFraction >= 1 {
+		return nil, errors.New("RefreshFraction must be between 0 and 1")
+	}
+	if cfg.RefreshBefore < 0 {
+		return nil, errors.New("RefreshBefore must not be negative")
+	}
+
+	c := &RefreshingCredentials{
+		cfg:    cfg,
+		clock:  clock.OrReal(cfg.Clock),
+		logger: logger.OrDefault(cfg.Logger),
+		done:   make(chan struct{}),
+	}
+
+	token, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+
+	c.wg.Add(1)
+	go c.refreshLoop(token)
+
+	return c, nil
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *RefreshingCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token.AccessToken}, nil
+}
+
+// currentToken returns the token to send, fetching one if the current token is about to expire or
+// was invalidated.
+func (c *RefreshingCredentials) currentToken(ctx context.Context) (*Token, error) {
+	if token := c.loadToken(); c.usable(token) {
+		return token, nil
+	}
+
+	// Background refresh has not caught up; fetch synchronously rather than send an expired token.
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	if token := c.loadToken(); c.usable(token) {
+		return token, nil
+	}
+	fresh, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.setToken(fresh)
+	return fresh, nil
+}
+
+// usable reports whether token may still be sent.
+func (c *RefreshingCredentials) usable(token *Token) bool {
+	return token != nil && (token.Expiry.IsZero() || c.clock.Now().Add(c.cfg.RefreshBefore).Before(token.Expiry))
+}
+
+// Invalidate drops the current token if it is accessToken, e.g. after a server rejected it, so
+// that the next call fetches a new one.
+func (c *RefreshingCredentials) Invalidate(accessToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && c.token.AccessToken == accessToken {
+		c.token = nil
+	}
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *RefreshingCredentials) RequireTransportSecurity() bool {
+	return c.cfg.RequireTransportSecurity
+}
+
+// Close stops the background refresh.
+func (c *RefreshingCredentials) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+	c.wg.Wait()
+}
+
+func (c *RefreshingCredentials) loadToken() *Token {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+func (c *RefreshingCredentials) setToken(token *Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *RefreshingCredentials) fetch(ctx context.Context) (*Token, error) {
+	start := c.clock.Now()
+	token, err := c.cfg.Source.Token(ctx)
+	if err == nil && token == nil {
+		err = errors.New("token source returned nil token")
+	}
+
+	if m := c.cfg.Metrics; m != nil {
+		m.RecordCredentialsRefresh(c.cfg.Name, c.clock.Since(start), err)
+	}
+	return token, err
+}
+
+// refreshDelay returns how long to wait before refreshing a token fetched now, and false if the
+// token does not expire and needs no refresh.
+func (c *RefreshingCredentials) refreshDelay(token *Token) (time.Duration, bool) {
+	if token.Expiry.IsZero() {
+		return 0, false
+	}
+	minDelay := c.cfg.MinRefreshDelay
+	if minDelay <= 0 {
+		minDelay = time.Second
+	}
+	lifetime := token.Expiry.Sub(c.clock.Now())
+	fraction := c.cfg.RefreshFraction + c.cfg.Jitter*(2*rand.Float64()-1)
+	fraction = min(max(fraction, 0), 1)
+	delay := min(time.Duration(float64(lifetime)*fraction), lifetime-c.cfg.RefreshBefore)
+	return max(delay, minDelay), true
+}
+
+func (c *RefreshingCredentials) refreshLoop(token *Token) {
+	defer c.wg.Done()
+
+	initialBackoff := c.cfg.RetryBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = time.Second
+	}
+	maxBackoff := c.cfg.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Minute
+	}
+	initialBackoff = min(initialBackoff, maxBackoff)
+
+	delay, ok := c.refreshDelay(token)
+	backoff := initialBackoff
+	for ok {
+		select {
+		case <-c.done:
+			return
+		case <-c.clock.After(delay):
+		}
+
+		fresh, err := c.fetch(context.Background())
+		if err != nil {
+			c.logger.Warnf("Failed to refresh credentials %s: %v (retrying in %v)", c.cfg.Name, err, backoff)
+			delay = backoff
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+
+		c.setToken(fresh)
+		delay, ok = c.refreshDelay(fresh)
+		backoff = initialBackoff
+	}
+}
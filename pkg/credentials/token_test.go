@@ -0,0 +1,145 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+)
+
+type countingSource struct {
+	clock *testutil.FakeClock
+	calls atomic.Int32
+}
+
+func (s *countingSource) Token(context.Context) (*Token, error) {
+	n := s.calls.Add(1)
+	return &Token{
+		AccessToken: string(rune('a' + n - 1)),
+		Expiry:      s.clock.Now().Add(100 * time.Second),
+	}, nil
+}
+
+type funcSource func(context.Context) (*Token, error)
+
+func (f funcSource) Token(ctx context.Context) (*Token, error) { return f(ctx) }
+
+// waitForCalls waits for calls to reach n, and reports whether it did.
+func waitForCalls(calls *atomic.Int32, n int32) bool {
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return calls.Load() == n
+}
+
+func TestRefreshingCredentials_NonExpiringToken(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	var calls atomic.Int32
+	cfg := DefaultRefreshingCredentialsConfig(funcSource(func(context.Context) (*Token, error) {
+		calls.Add(1)
+		return &Token{AccessToken: "static"}, nil
+	}))
+	cfg.Clock = clk
+
+	creds, err := NewRefreshingCredentials(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewRefreshingCredentials failed: %v", err)
+	}
+	defer creds.Close()
+
+	for range 3 {
+		if md, err := creds.GetRequestMetadata(context.Background()); err != nil || md["authorization"] != "Bearer static" {
+			t.Fatalf("GetRequestMetadata = %v, %v", md, err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if calls.Load() != 1 || clk.Waiters() != 0 {
+		t.Errorf("Expected a token without expiry to be fetched once and never refreshed, got %d fetches and %d timers", calls.Load(), clk.Waiters())
+	}
+}
+
+func TestRefreshingCredentials_MinRefreshDelayAndMaxBackoff(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	var calls atomic.Int32
+	cfg := DefaultRefreshingCredentialsConfig(funcSource(func(context.Context) (*Token, error) {
+		if calls.Add(1) == 1 {
+			// Already expired, e.g. because of clock skew with the issuer.
+			return &Token{AccessToken: "a", Expiry: clk.Now().Add(-time.Second)}, nil
+		}
+		return nil, errors.New("unavailable")
+	}))
+	cfg.Clock = clk
+	cfg.MinRefreshDelay = 5 * time.Second
+	cfg.RetryBackoff = time.Second
+	cfg.MaxRetryBackoff = 2 * time.Second
+
+	creds, err := NewRefreshingCredentials(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewRefreshingCredentials failed: %v", err)
+	}
+	defer creds.Close()
+
+	clk.BlockUntil(1)
+	clk.Advance(4 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Fatalf("Expected no refresh before MinRefreshDelay, got %d fetches", calls.Load())
+	}
+	clk.Advance(time.Second)
+	if !waitForCalls(&calls, 2) {
+		t.Fatalf("Expected a refresh after MinRefreshDelay, got %d fetches", calls.Load())
+	}
+
+	// Retries back off 1s, then 2s, and stay at MaxRetryBackoff.
+	for i, backoff := range []time.Duration{time.Second, 2 * time.Second, 2 * time.Second} {
+		clk.BlockUntil(1)
+		clk.Advance(backoff - time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		if calls.Load() != int32(i+2) {
+			t.Fatalf("Expected retry %d to wait %v, got %d fetches", i+1, backoff, calls.Load())
+		}
+		clk.Advance(time.Millisecond)
+		if !waitForCalls(&calls, int32(i+3)) {
+			t.Fatalf("Expected retry %d after %v, got %d fetches", i+1, backoff, calls.Load())
+		}
+	}
+}
+
+func TestRefreshingCredentials_PreRefresh(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	source := &countingSource{clock: clk}
+
+	cfg := DefaultRefreshingCredentialsConfig(source)
+	cfg.RefreshFraction = 0.5
+	cfg.Jitter = 0
+	cfg.Clock = clk
+
+	creds, err := NewRefreshingCredentials(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewRefreshingCredentials failed: %v", err)
+	}
+	defer creds.Close()
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("GetRequestMetadata failed: %v", err)
+	}
+	if md["authorization"] != "Bearer a" {
+		t.Errorf("Expected initial token, got %q", md["authorization"])
+	}
+
+	clk.BlockUntil(1)
+	clk.Advance(50 * time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for source.calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if source.calls.Load() != 2 {
+		t.Fatalf("Expected token to be refreshed at half its lifetime, source called %d times", source.calls.Load())
+	}
+}
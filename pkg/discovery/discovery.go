@@ -0,0 +1,187 @@
+// Package discovery looks up the addresses of services in service discovery systems and feeds
+// them to gRPC connections.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC target scheme handled by Builder.
+const Scheme = "discovery"
+
+// resolveTimeout bounds each Resolve call made by a Builder.
+const resolveTimeout = 10 * time.Second
+
+// Resolver looks up the addresses of services.
+type Resolver interface {
+	// Resolve returns the current addresses of the service as host:port.
+	Resolve(ctx context.Context, service string) ([]string, error)
+	// Watch calls fn with the service's addresses whenever they change, until stop is called.
+	// Resolvers that cannot observe changes return a stop function that does nothing.
+	Watch(service string, fn func(addresses []string)) (stop func())
+}
+
+// Static is a Resolver with a fixed list of addresses per service.
+type Static map[string][]string
+
+// Resolve implements Resolver.
+func (s Static) Resolve(_ context.Context, service string) ([]string, error) {
+	addresses := s[service]
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no addresses for service %s", service)
+	}
+	return slices.Clone(addresses), nil
+}
+
+// Watch implements Resolver. Static addresses never change.
+func (s Static) Watch(string, func([]string)) func() {
+	return func() {}
+}
+
+// Callback is a Resolver backed by functions, for discovery systems without a built-in resolver.
+type Callback struct {
+	// ResolveFunc returns the addresses of a service
+	ResolveFunc func(ctx context.Context, service string) ([]string, error)
+	// WatchFunc calls fn whenever the addresses of a service change, until the returned function
+	// is called. If nil, changes are only seen when connections resolve their target again (default: nil)
+	WatchFunc func(service string, fn func(addresses []string)) (stop func())
+}
+
+// Resolve implements Resolver.
+func (c *Callback) Resolve(ctx context.Context, service string) ([]string, error) {
+	return c.ResolveFunc(ctx, service)
+}
+
+// Watch implements Resolver.
+func (c *Callback) Watch(service string, fn func([]string)) func() {
+	if c.WatchFunc == nil {
+		return func() {}
+	}
+	return c.WatchFunc(service, fn)
+}
+
+// Builder is a gRPC resolver.Builder for the discovery scheme: a connection to Target(service)
+// resolves the service through a Resolver and follows its changes, balancing across all its
+// addresses according to the connection's load balancing policy.
+type Builder struct {
+	resolver Resolver
+}
+
+// NewBuilder creates a Builder that resolves services through r.
+func NewBuilder(r Resolver) *Builder {
+	return &Builder{resolver: r}
+}
+
+// Target returns the gRPC target of a service resolved by a Builder.
+func Target(service string) string {
+	return Scheme + ":///" + service
+}
+
+// Scheme implements resolver.Builder.
+func (b *Builder) Scheme() string {
+	return Scheme
+}
+
+// Build implements resolver.Builder.
+func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &serviceResolver{
+		resolver:   b.resolver,
+		service:    target.Endpoint(),
+		cc:         cc,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	r.stopWatch = b.resolver.Watch(r.service, r.update)
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+type serviceResolver struct {
+	resolver Resolver
+	service  string
+	cc       resolver.ClientConn
+
+	// mu serializes updates from Resolve and Watch and keeps them from reaching cc after Close
+	mu     sync.Mutex
+	closed bool
+
+	stopWatch  func()
+	resolveNow chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// ResolveNow implements resolver.Resolver.
+func (r *serviceResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close implements resolver.Resolver.
+func (r *serviceResolver) Close() {
+	r.stopWatch()
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *serviceResolver) watch() {
+	defer r.wg.Done()
+
+	for {
+		r.resolve()
+
+		select {
+		case <-r.done:
+			return
+		case <-r.resolveNow:
+		}
+	}
+}
+
+func (r *serviceResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	addresses, err := r.resolver.Resolve(ctx, r.service)
+	if err != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !r.closed {
+			r.cc.ReportError(fmt.Errorf("failed to resolve %s: %w", r.service, err))
+		}
+		return
+	}
+	r.update(addresses)
+}
+
+// update pushes the service's addresses to gRPC.
+func (r *serviceResolver) update(addresses []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if len(addresses) == 0 {
+		r.cc.ReportError(fmt.Errorf("no addresses for service %s", r.service))
+		return
+	}
+
+	addrs := make([]resolver.Address, 0, len(addresses))
+	for _, address := range addresses {
+		addrs = append(addrs, resolver.Address{Addr: address})
+	}
+	_ = r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
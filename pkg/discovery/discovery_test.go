@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+)
+
+func TestStatic(t *testing.T) {
+	r := Static{"orders": {"10.0.0.1:50051", "10.0.0.2:50051"}}
+
+	addresses, err := r.Resolve(context.Background(), "orders")
+	if err != nil || len(addresses) != 2 {
+		t.Fatalf("Expected two addresses, got %v, %v", addresses, err)
+	}
+	if _, err := r.Resolve(context.Background(), "payments"); err == nil {
+		t.Error("Expected an error for an unknown service")
+	}
+}
+
+func TestSRV(t *testing.T) {
+	var records atomic.Pointer[[]*net.SRV]
+	records.Store(&[]*net.SRV{
+		{Target: "orders-0.orders.svc.cluster.local.", Port: 50051},
+		{Target: "orders-1.orders.svc.cluster.local.", Port: 50051},
+	})
+	var looked atomic.Value
+	clk := testutil.NewFakeClock(time.Now())
+
+	cfg := DefaultSRVConfig()
+	cfg.Domain = "svc.cluster.local"
+	cfg.Clock = clk
+	cfg.LookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		looked.Store("_" + service + "._" + proto + "." + name)
+		if r := *records.Load(); r != nil {
+			return "", r, nil
+		}
+		return "", nil, errors.New("no such host")
+	}
+	r := NewSRV(cfg)
+
+	addresses, err := r.Resolve(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"orders-0.orders.svc.cluster.local:50051", "orders-1.orders.svc.cluster.local:50051"}; !slices.Equal(addresses, want) {
+		t.Errorf("Expected %v, got %v", want, addresses)
+	}
+	if got := looked.Load(); got != "_grpc._tcp.orders.svc.cluster.local" {
+		t.Errorf("Unexpected SRV name %v", got)
+	}
+
+	updates := make(chan []string, 1)
+	stop := r.Watch("orders", func(addresses []string) { updates <- addresses })
+	defer stop()
+
+	clk.BlockUntil(1)
+	clk.Advance(cfg.RefreshInterval)
+	<-updates
+
+	records.Store(&[]*net.SRV{{Target: "orders-2.orders.svc.cluster.local.", Port: 50051}})
+	clk.Advance(cfg.RefreshInterval)
+	if got := <-updates; len(got) != 1 || got[0] != "orders-2.orders.svc.cluster.local:50051" {
+		t.Errorf("Expected the changed addresses, got %v", got)
+	}
+}
@@ -0,0 +1,230 @@
+// Package etcd resolves services from instances registered in etcd.
+//
+// Instances are stored as JSON Endpoint records under <prefix>/<service>/<instance>, usually
+// attached to a lease so that they disappear when an instance stops renewing it.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Endpoint is the record stored for a registered instance.
+type Endpoint struct {
+	// Address is the instance's host:port
+	Address string `json:"address"`
+	// Metadata holds arbitrary attributes of the instance, such as its zone or version
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Client is the part of the etcd client used by Resolver, implemented by *clientv3.Client.
+type Client interface {
+	clientv3.KV
+	clientv3.Watcher
+	clientv3.Lease
+}
+
+// Config holds configuration for the etcd resolver.
+type Config struct {
+	// Client is the etcd client to use, usually a *clientv3.Client
+	Client Client
+	// Prefix is the key prefix that services are registered under (default: "/services")
+	Prefix string
+	// RetryInterval is how long to wait before watching again after a watch fails (default: 1s)
+	RetryInterval time.Duration
+	// Clock is used to wait between watch retries. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives invalid records and watch failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultConfig returns a Config with sensible defaults and no Client.
+func DefaultConfig() *Config {
+	return &Config{
+		Prefix:        "/services",
+		RetryInterval: time.Second,
+	}
+}
+
+// Resolver is a discovery.Resolver that reads services from etcd and watches their key prefix,
+// so that instances registering, deregistering or losing their lease are picked up right away.
+type Resolver struct {
+	cfg    *Config
+	clock  clock.Clock
+	logger logger.Logger
+}
+
+// New creates a Resolver. Unset Prefix and RetryInterval take their defaults. Returns an error if
+// cfg has no Client.
+func New(cfg *Config) (*Resolver, error) {
+	if cfg == nil || cfg.Client == nil {
+		return nil, errors.New("etcd client must be set")
+	}
+	c := *cfg
+	defaults := DefaultConfig()
+	if c.Prefix == "" {
+		c.Prefix = defaults.Prefix
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = defaults.RetryInterval
+	}
+	return &Resolver{
+		cfg:    &c,
+		clock:  clock.OrReal(cfg.Clock),
+		logger: logger.OrDefault(cfg.Logger),
+	}, nil
+}
+
+// key returns the key prefix of the service's instances.
+func (r *Resolver) key(service string) string {
+	return strings.TrimSuffix(r.cfg.Prefix, "/") + "/" + service + "/"
+}
+
+// Resolve implements discovery.Resolver.
+func (r *Resolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	endpoints, _, err := r.load(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no instances of %s registered under %s", service, r.key(service))
+	}
+	return addresses(endpoints), nil
+}
+
+// load returns the service's instances keyed by etcd key, and the revision they were read at.
+func (r *Resolver) load(ctx context.Context, service string) (map[string]string, int64, error) {
+	resp, err := r.cfg.Client.Get(ctx, r.key(service), clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s from etcd: %w", service, err)
+	}
+	endpoints := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if address, ok := r.parse(kv); ok {
+			endpoints[string(kv.Key)] = address
+		}
+	}
+	return endpoints, resp.Header.Revision, nil
+}
+
+// parse returns the address in an Endpoint record, logging records that are not valid.
+func (r *Resolver) parse(kv *mvccpb.KeyValue) (string, bool) {
+	var endpoint Endpoint
+	if err := json.Unmarshal(kv.Value, &endpoint); err != nil || endpoint.Address == "" {
+		r.logger.Warnf("Ignoring invalid endpoint record %s: %q", kv.Key, kv.Value)
+		return "", false
+	}
+	return endpoint.Address, true
+}
+
+// Watch implements discovery.Resolver. It reads the service's instances and then follows their
+// changes; if the watch fails, for example after a compaction, the instances are read again.
+func (r *Resolver) Watch(service string, fn func([]string)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.watch(ctx, service, fn)
+	return cancel
+}
+
+func (r *Resolver) watch(ctx context.Context, service string, fn func([]string)) {
+	for {
+		err := r.follow(ctx, service, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warnf("Watching %s in etcd failed, retrying in %v: %v", service, r.cfg.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(r.cfg.RetryInterval):
+		}
+	}
+}
+
+// follow reads the service's instances, reports them and then reports every change until the
+// watch ends.
+func (r *Resolver) follow(ctx context.Context, service string, fn func([]string)) error {
+	endpoints, revision, err := r.load(ctx, service)
+	if err != nil {
+		return err
+	}
+	fn(addresses(endpoints))
+
+	for resp := range r.cfg.Client.Watch(ctx, r.key(service), clientv3.WithPrefix(), clientv3.WithRev(revision+1)) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			key := string(ev.Kv.Key)
+			switch ev.Type {
+			case mvccpb.PUT:
+				if address, ok := r.parse(ev.Kv); ok {
+					endpoints[key] = address
+				} else {
+					delete(endpoints, key)
+				}
+			case mvccpb.DELETE:
+				// Also reported when the instance's lease expires.
+				delete(endpoints, key)
+			}
+		}
+		fn(addresses(endpoints))
+	}
+	return errors.New("watch closed")
+}
+
+// addresses returns the distinct addresses of endpoints in sorted order.
+func addresses(endpoints map[string]string) []string {
+	return slices.Compact(slices.Sorted(maps.Values(endpoints)))
+}
+
+// Register stores endpoint as an instance of the service under id, attached to a lease with the
+// given TTL that is kept alive in the background. If the process dies, the lease expires and the
+// instance is removed. deregister revokes the lease, removing the instance right away.
+func (r *Resolver) Register(ctx context.Context, service, id string, endpoint Endpoint, ttl time.Duration) (deregister func() error, err error) {
+	value, err := json.Marshal(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := r.cfg.Client.Grant(ctx, max(int64(ttl/time.Second), 1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant lease: %w", err)
+	}
+	if _, err := r.cfg.Client.Put(ctx, r.key(service)+id, string(value), clientv3.WithLease(lease.ID)); err != nil {
+		return nil, fmt.Errorf("failed to register %s: %w", service, err)
+	}
+
+	// The keepalive outlives ctx, which only bounds registering.
+	keepAliveCtx, stop := context.WithCancel(context.Background())
+	responses, err := r.cfg.Client.KeepAlive(keepAliveCtx, lease.ID)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to keep lease alive: %w", err)
+	}
+	go func() {
+		for range responses {
+		}
+		if keepAliveCtx.Err() == nil {
+			r.logger.Warnf("Lease of %s instance %s was lost", service, id)
+		}
+	}()
+
+	return func() error {
+		stop()
+		ctx, cancel := context.WithTimeout(context.Background(), ttl)
+		defer cancel()
+		_, err := r.cfg.Client.Revoke(ctx, lease.ID)
+		return err
+	}, nil
+}
@@ -0,0 +1,212 @@
+package etcd
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const fakeLease clientv3.LeaseID = 7
+
+// fakeClient is an in-memory etcd with the calls used by Resolver. Other calls panic.
+type fakeClient struct {
+	clientv3.KV
+	clientv3.Watcher
+	clientv3.Lease
+
+	mu       sync.Mutex
+	kvs      map[string]string
+	leases   map[string]clientv3.LeaseID
+	revision int64
+	history  []*clientv3.Event // history[i] happened at revision i+2
+	watches  []chan clientv3.WatchResponse
+}
+
+// Close resolves the ambiguity between the embedded Watcher and Lease.
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{kvs: make(map[string]string), leases: make(map[string]clientv3.LeaseID), revision: 1}
+}
+
+func (f *fakeClient) Get(_ context.Context, key string, _ ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.revision}}
+	for _, k := range slices.Sorted(maps.Keys(f.kvs)) {
+		if strings.HasPrefix(k, key) {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(f.kvs[k])})
+		}
+	}
+	return resp, nil
+}
+
+// Put attaches the key to the granted lease if given any options, the only one used being WithLease.
+func (f *fakeClient) Put(_ context.Context, key, value string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.put(key, value)
+	if len(opts) > 0 {
+		f.mu.Lock()
+		f.leases[key] = fakeLease
+		f.mu.Unlock()
+	}
+	return &clientv3.PutResponse{}, nil
+}
+
+// put stores a key and reports it to watches.
+func (f *fakeClient) put(key, value string) {
+	f.event(&clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value)}}, func() {
+		f.kvs[key] = value
+	})
+}
+
+// delete removes a key and reports it to watches.
+func (f *fakeClient) delete(key string) {
+	f.event(&clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key)}}, func() {
+		delete(f.kvs, key)
+	})
+}
+
+func (f *fakeClient) event(ev *clientv3.Event, apply func()) {
+	f.mu.Lock()
+	apply()
+	f.revision++
+	f.history = append(f.history, ev)
+	watches := slices.Clone(f.watches)
+	f.mu.Unlock()
+	for _, w := range watches {
+		w <- clientv3.WatchResponse{Events: []*clientv3.Event{ev}}
+	}
+}
+
+// fail ends the watches with a compaction error.
+func (f *fakeClient) fail() {
+	f.mu.Lock()
+	watches := f.watches
+	f.watches = nil
+	f.mu.Unlock()
+	for _, w := range watches {
+		w <- clientv3.WatchResponse{CompactRevision: f.revision}
+		close(w)
+	}
+}
+
+// Watch reports the events since the requested revision and then the new ones.
+func (f *fakeClient) Watch(_ context.Context, _ string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w := make(chan clientv3.WatchResponse, 10)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rev := clientv3.OpGet("", opts...).Rev(); rev >= 2 {
+		for _, ev := range f.history[rev-2:] {
+			w <- clientv3.WatchResponse{Events: []*clientv3.Event{ev}}
+		}
+	}
+	f.watches = append(f.watches, w)
+	return w
+}
+
+func (f *fakeClient) Grant(context.Context, int64) (*clientv3.LeaseGrantResponse, error) {
+	return &clientv3.LeaseGrantResponse{ID: fakeLease}, nil
+}
+
+func (f *fakeClient) KeepAlive(ctx context.Context, _ clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (f *fakeClient) Revoke(_ context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	var keys []string
+	for key, lease := range f.leases {
+		if lease == id {
+			keys = append(keys, key)
+		}
+	}
+	f.mu.Unlock()
+	for _, key := range keys {
+		f.delete(key)
+	}
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func TestResolver(t *testing.T) {
+	client := newFakeClient()
+	client.put("/services/orders/a", `{"address":"10.0.0.1:50051"}`)
+	client.put("/services/orders/b", `{"address":"10.0.0.2:50051","metadata":{"zone":"b"}}`)
+	client.put("/services/orders/c", `not json`)
+	client.put("/services/payments/a", `{"address":"10.0.1.1:50051"}`)
+
+	if _, err := New(&Config{}); err == nil {
+		t.Error("Expected an error without a client")
+	}
+	r, err := New(&Config{Client: client, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	addresses, err := r.Resolve(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"10.0.0.1:50051", "10.0.0.2:50051"}; !slices.Equal(addresses, want) {
+		t.Errorf("Expected %v, got %v", want, addresses)
+	}
+	if _, err := r.Resolve(context.Background(), "inventory"); err == nil {
+		t.Error("Expected an error for a service without instances")
+	}
+
+	updates := make(chan []string, 10)
+	stop := r.Watch("orders", func(addresses []string) { updates <- addresses })
+	defer stop()
+	next := func() []string {
+		t.Helper()
+		select {
+		case got := <-updates:
+			return got
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an update")
+			return nil
+		}
+	}
+
+	if got := next(); len(got) != 2 {
+		t.Errorf("Expected the registered addresses first, got %v", got)
+	}
+	client.delete("/services/orders/a")
+	if got := next(); !slices.Equal(got, []string{"10.0.0.2:50051"}) {
+		t.Errorf("Expected the deleted instance to be gone, got %v", got)
+	}
+
+	// Failed watches read the instances again.
+	client.fail()
+	if got := next(); !slices.Equal(got, []string{"10.0.0.2:50051"}) {
+		t.Errorf("Expected the instances to be read again, got %v", got)
+	}
+
+	deregister, err := r.Register(context.Background(), "orders", "d", Endpoint{Address: "10.0.0.4:50051"}, 10*time.Second)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if got := next(); !slices.Equal(got, []string{"10.0.0.2:50051", "10.0.0.4:50051"}) {
+		t.Errorf("Expected the registered instance, got %v", got)
+	}
+	if err := deregister(); err != nil {
+		t.Fatalf("Deregister failed: %v", err)
+	}
+	if got := next(); !slices.Equal(got, []string{"10.0.0.2:50051"}) {
+		t.Errorf("Expected the deregistered instance to be gone, got %v", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Package kubernetes resolves Kubernetes Services to the addresses of their ready pods, read from
+// the Services' EndpointSlices.
+//
+// Connecting to pods directly lets gRPC balance calls across them. Through a ClusterIP Service,
+// kube-proxy balances connections instead, so a long-lived connection sticks to a single pod.
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Config holds configuration for the Kubernetes resolver.
+type Config struct {
+	// Client is the Kubernetes client to use, e.g. from kubernetes.NewForConfig(rest.InClusterConfig())
+	Client kubernetes.Interface
+	// Namespace is the namespace of services given without one (default: "default")
+	Namespace string
+	// PortName is the name of the Service port to connect to. If empty, the first port is used (default: "")
+	PortName string
+	// ResyncInterval is how often watched EndpointSlices are re-listed, as a safety net for missed events (default: 0, never)
+	ResyncInterval time.Duration
+	// Logger receives failed watches. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultConfig returns a Config with sensible defaults and no Client.
+func DefaultConfig() *Config {
+	return &Config{
+		Namespace: "default",
+	}
+}
+
+// Resolver is a discovery.Resolver for Kubernetes Services. Services are named "name" for a
+// Service in Config.Namespace, or "name.namespace". Only ready endpoints are returned, so pods
+// that fail their readiness probe or are shutting down stop receiving calls.
+type Resolver struct {
+	cfg    *Config
+	logger logger.Logger
+}
+
+// New creates a Resolver. An unset Namespace takes its default. Returns an error if cfg has no
+// Client.
+func New(cfg *Config) (*Resolver, error) {
+	if cfg == nil || cfg.Client == nil {
+		return nil, errors.New("kubernetes client must be set")
+	}
+	c := *cfg
+	if c.Namespace == "" {
+		c.Namespace = DefaultConfig().Namespace
+	}
+	return &Resolver{
+		cfg:    &c,
+		logger: logger.OrDefault(cfg.Logger),
+	}, nil
+}
+
+// split returns the name and namespace of a service.
+func (r *Resolver) split(service string) (name, namespace string) {
+	if name, namespace, ok := strings.Cut(service, "."); ok {
+		return name, namespace
+	}
+	return service, r.cfg.Namespace
+}
+
+// selector selects the EndpointSlices of the Service name.
+func selector(name string) string {
+	return labels.Set{discoveryv1.LabelServiceName: name}.String()
+}
+
+// Resolve implements discovery.Resolver.
+func (r *Resolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	name, namespace := r.split(service)
+	list, err := r.cfg.Client.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector(name)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoints of %s/%s: %w", namespace, name, err)
+	}
+	items := make([]*discoveryv1.EndpointSlice, 0, len(list.Items))
+	for i := range list.Items {
+		items = append(items, &list.Items[i])
+	}
+	addresses := r.addresses(items)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no ready endpoints for %s/%s", namespace, name)
+	}
+	return addresses, nil
+}
+
+// Watch implements discovery.Resolver by following the Service's EndpointSlices with an informer.
+// fn is called whenever the ready addresses change.
+func (r *Resolver) Watch(service string, fn func([]string)) func() {
+	name, namespace := r.split(service)
+	factory := informers.NewSharedInformerFactoryWithOptions(r.cfg.Client, r.cfg.ResyncInterval,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = selector(name) }),
+	)
+	informer := factory.Discovery().V1().EndpointSlices()
+
+	// Handlers are called one at a time, so last needs no lock.
+	var (
+		last     []string
+		reported bool
+	)
+	update := func() {
+		list, err := informer.Lister().EndpointSlices(namespace).List(labels.Everything())
+		if err != nil {
+			r.logger.Warnf("Failed to list endpoints of %s/%s: %v", namespace, name, err)
+			return
+		}
+		addresses := r.addresses(list)
+		if !reported || !slices.Equal(addresses, last) {
+			last, reported = addresses, true
+			fn(addresses)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { update() },
+		UpdateFunc: func(any, any) { update() },
+		DeleteFunc: func(any) { update() },
+	})
+	if err != nil {
+		r.logger.Warnf("Failed to watch endpoints of %s/%s: %v", namespace, name, err)
+		return func() {}
+	}
+	_ = informer.Informer().SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		r.logger.Warnf("Watching endpoints of %s/%s failed: %v", namespace, name, err)
+	})
+
+	stop := make(chan struct{})
+	factory.Start(stop)
+	return func() {
+		close(stop)
+		factory.Shutdown()
+	}
+}
+
+// addresses returns the distinct host:port addresses of the ready endpoints in the EndpointSlices,
+// in sorted order.
+func (r *Resolver) addresses(endpointSlices []*discoveryv1.EndpointSlice) []string {
+	addresses := make(map[string]struct{})
+	for _, s := range endpointSlices {
+		port, ok := r.port(s)
+		if !ok {
+			continue
+		}
+		for _, ep := range s.Endpoints {
+			// A nil Ready means the endpoint is ready.
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, ip := range ep.Addresses {
+				addresses[net.JoinHostPort(ip, port)] = struct{}{}
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(addresses))
+}
+
+// port returns the port to connect to on the endpoints of s: the one named PortName, or the first.
+func (r *Resolver) port(s *discoveryv1.EndpointSlice) (string, bool) {
+	for _, p := range s.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if r.cfg.PortName == "" || (p.Name != nil && *p.Name == r.cfg.PortName) {
+			return strconv.Itoa(int(*p.Port)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func endpointSlice(name, service string, ready []bool, ips ...string) *discoveryv1.EndpointSlice {
+	grpcName, metricsName := "grpc", "metrics"
+	grpcPort, metricsPort := int32(50051), int32(9090)
+	s := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "shop",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports: []discoveryv1.EndpointPort{
+			{Name: &metricsName, Port: &metricsPort},
+			{Name: &grpcName, Port: &grpcPort},
+		},
+	}
+	for i, ip := range ips {
+		s.Endpoints = append(s.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready[i]},
+		})
+	}
+	return s
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(
+		endpointSlice("orders-a", "orders", []bool{true, false}, "10.0.0.1", "10.0.0.2"),
+		endpointSlice("orders-b", "orders", []bool{true}, "10.0.0.3"),
+		endpointSlice("payments-a", "payments", []bool{true}, "10.0.1.1"),
+	)
+
+	if _, err := New(&Config{}); err == nil {
+		t.Error("Expected an error without a client")
+	}
+	r, err := New(&Config{Client: client, Namespace: "shop", PortName: "grpc"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	addresses, err := r.Resolve(ctx, "orders")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"10.0.0.1:50051", "10.0.0.3:50051"}; !slices.Equal(addresses, want) {
+		t.Errorf("Expected the ready endpoints %v, got %v", want, addresses)
+	}
+	if _, err := r.Resolve(ctx, "orders.other"); err == nil {
+		t.Error("Expected an error for a service in another namespace")
+	}
+
+	updates := make(chan []string, 10)
+	stop := r.Watch("orders.shop", func(addresses []string) { updates <- addresses })
+	defer stop()
+
+	deadline := time.After(5 * time.Second)
+	waitFor := func(want []string) {
+		t.Helper()
+		for {
+			select {
+			case got := <-updates:
+				if slices.Equal(got, want) {
+					return
+				}
+			case <-deadline:
+				t.Fatalf("Timed out waiting for %v", want)
+			}
+		}
+	}
+	waitFor([]string{"10.0.0.1:50051", "10.0.0.3:50051"})
+
+	// The pod behind 10.0.0.2 becomes ready and the one behind 10.0.0.3 goes away.
+	_, err = client.DiscoveryV1().EndpointSlices("shop").Update(ctx,
+		endpointSlice("orders-a", "orders", []bool{true, true}, "10.0.0.1", "10.0.0.2"), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := client.DiscoveryV1().EndpointSlices("shop").Delete(ctx, "orders-b", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	waitFor([]string{"10.0.0.1:50051", "10.0.0.2:50051"})
+}
@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+)
+
+// SRVConfig holds configuration for the DNS SRV resolver.
+type SRVConfig struct {
+	// Service is the service label of the SRV records looked up, as in _grpc._tcp.orders (default: "grpc")
+	Service string
+	// Proto is the protocol label of the SRV records looked up (default: "tcp")
+	Proto string
+	// Domain is appended to service names, e.g. "svc.cluster.local" (default: "")
+	Domain string
+	// RefreshInterval is how often watched services are looked up again (default: 30s)
+	RefreshInterval time.Duration
+	// LookupSRV looks up SRV records. If nil, net.DefaultResolver.LookupSRV is used
+	LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	// Clock is used for refreshes. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives failed refreshes. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultSRVConfig returns an SRVConfig with sensible defaults.
+func DefaultSRVConfig() *SRVConfig {
+	return &SRVConfig{
+		Service:         "grpc",
+		Proto:           "tcp",
+		RefreshInterval: 30 * time.Second,
+	}
+}
+
+// SRV is a Resolver that looks up services as DNS SRV records, ordered by priority and weight.
+type SRV struct {
+	cfg       *SRVConfig
+	lookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	clock     clock.Clock
+	logger    logger.Logger
+}
+
+// NewSRV creates an SRV resolver. If cfg is nil, DefaultSRVConfig() is used.
+func NewSRV(cfg *SRVConfig) *SRV {
+	if cfg == nil {
+		cfg = DefaultSRVConfig()
+	}
+	lookupSRV := cfg.LookupSRV
+	if lookupSRV == nil {
+		lookupSRV = net.DefaultResolver.LookupSRV
+	}
+	return &SRV{
+		cfg:       cfg,
+		lookupSRV: lookupSRV,
+		clock:     clock.OrReal(cfg.Clock),
+		logger:    logger.OrDefault(cfg.Logger),
+	}
+}
+
+// Resolve implements Resolver.
+func (s *SRV) Resolve(ctx context.Context, service string) ([]string, error) {
+	name := service
+	if s.cfg.Domain != "" {
+		name += "." + s.cfg.Domain
+	}
+	_, records, err := s.lookupSRV(ctx, s.cfg.Service, s.cfg.Proto, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no SRV records for %s", name)
+	}
+
+	addresses := make([]string, 0, len(records))
+	for _, r := range records {
+		addresses = append(addresses, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+	}
+	return addresses, nil
+}
+
+// Watch implements Resolver by looking the service up every RefreshInterval. fn is called when
+// the set of addresses changes; failed lookups are logged and keep the previous addresses.
+func (s *SRV) Watch(service string, fn func([]string)) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := s.clock.NewTicker(s.cfg.RefreshInterval)
+		defer ticker.Stop()
+
+		var last []string
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C():
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), s.cfg.RefreshInterval)
+			addresses, err := s.Resolve(ctx, service)
+			cancel()
+			if err != nil {
+				s.logger.Warnf("Failed to refresh SRV records for %s: %v", service, err)
+				continue
+			}
+			// Records of equal priority come back in random order, so compare them sorted.
+			sorted := slices.Sorted(slices.Values(addresses))
+			if !slices.Equal(sorted, last) {
+				last = sorted
+				fn(addresses)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
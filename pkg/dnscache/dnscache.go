@@ -0,0 +1,268 @@
+package dnscache
+
+import (
+	"context"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the gRPC target scheme handled by the caching resolver.
+const Scheme = "cached-dns"
+
+// defaultPort is used for targets without a port, matching gRPC's dns resolver.
+const defaultPort = "443"
+
+// DefaultSystemLookupTTL is how long results are cached when Config.Lookup is nil, since the
+// system resolver does not expose record TTLs.
+const DefaultSystemLookupTTL = 30 * time.Second
+
+// Config holds configuration for the caching DNS resolver.
+type Config struct {
+	// Lookup resolves host names. If nil, SystemLookup(DefaultSystemLookupTTL) is used; set it to
+	// TTLLookup to honor the TTLs of the records
+	Lookup LookupFunc
+	// MinTTL is the minimum time a result is cached, regardless of its TTL (default: 5s)
+	MinTTL time.Duration
+	// MaxTTL is the maximum time a result is cached, regardless of its TTL (default: 5m)
+	MaxTTL time.Duration
+	// ServeStale serves expired entries when a lookup fails, so DNS outages don't take down
+	// connectivity to already-known backends (default: true)
+	ServeStale bool
+	// RetryInterval is how long to wait before retrying a failed lookup (default: 5s)
+	RetryInterval time.Duration
+	// LookupTimeout bounds each lookup (default: 5s)
+	LookupTimeout time.Duration
+	// Clock is used for TTL expiry. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives lookup failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultConfig returns a Config with sensible defaults.
+func DefaultConfig() *Config {
+	return &Config{
+		MinTTL:        5 * time.Second,
+		MaxTTL:        5 * time.Minute,
+		ServeStale:    true,
+		RetryInterval: 5 * time.Second,
+		LookupTimeout: 5 * time.Second,
+	}
+}
+
+type entry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// Cache caches DNS lookups honoring their TTLs. It is shared by all resolvers of a Builder.
+type Cache struct {
+	cfg    *Config
+	lookup LookupFunc
+	clock  clock.Clock
+	logger logger.Logger
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewCache creates a Cache. If cfg is nil, DefaultConfig() is used.
+func NewCache(cfg *Config) *Cache {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	lookup := cfg.Lookup
+	if lookup == nil {
+		lookup = SystemLookup(DefaultSystemLookupTTL)
+	}
+	return &Cache{
+		cfg:     cfg,
+		lookup:  lookup,
+		clock:   clock.OrReal(cfg.Clock),
+		logger:  logger.OrDefault(cfg.Logger),
+		entries: make(map[string]*entry),
+	}
+}
+
+// Lookup returns the addresses for host and when they should be looked up again.
+// Cached results are returned until their TTL expires. If a lookup fails and ServeStale is set,
+// the previous result is returned and retried after RetryInterval.
+func (c *Cache) Lookup(ctx context.Context, host string) ([]net.IP, time.Time, error) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	e := c.entries[host]
+	c.mu.Unlock()
+
+	if e != nil && now.Before(e.expires) {
+		return e.ips, e.expires, nil
+	}
+
+	ips, ttl, err := c.lookup(ctx, host)
+	if err != nil {
+		if e != nil && c.cfg.ServeStale {
+			c.logger.Warnf("DNS lookup for %s failed, serving stale addresses: %v", host, err)
+			return e.ips, now.Add(c.cfg.RetryInterval), nil
+		}
+		return nil, now.Add(c.cfg.RetryInterval), err
+	}
+
+	ttl = min(max(ttl, c.cfg.MinTTL), c.cfg.MaxTTL)
+	e = &entry{ips: ips, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	c.entries[host] = e
+	c.mu.Unlock()
+
+	return e.ips, e.expires, nil
+}
+
+// Expire marks the cached addresses of host as expired, so that the next Lookup queries DNS again.
+// They are still served as stale addresses if that lookup fails.
+func (c *Cache) Expire(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[host]; e != nil {
+		c.entries[host] = &entry{ips: e.ips}
+	}
+}
+
+// Builder is a gRPC resolver.Builder for the cached-dns scheme.
+type Builder struct {
+	cache *Cache
+
+	mu sync.Mutex
+	// resolvers holds the resolvers built and not yet closed
+	resolvers map[*cachingResolver]struct{}
+}
+
+// NewBuilder creates a Builder with its own cache. If cfg is nil, DefaultConfig() is used.
+func NewBuilder(cfg *Config) *Builder {
+	return &Builder{cache: NewCache(cfg), resolvers: make(map[*cachingResolver]struct{})}
+}
+
+// ResolveNow expires the cached addresses of host and makes every resolver for it look them up
+// again, e.g. when the backends behind a headless service are known to have changed.
+func (b *Builder) ResolveNow(host string) {
+	b.cache.Expire(host)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for r := range b.resolvers {
+		if r.host == host {
+			r.ResolveNow(resolver.ResolveNowOptions{})
+		}
+	}
+}
+
+// Scheme implements resolver.Builder.
+func (b *Builder) Scheme() string {
+	return Scheme
+}
+
+// Build implements resolver.Builder.
+func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	host, port, err := net.SplitHostPort(target.Endpoint())
+	if err != nil {
+		host, port = target.Endpoint(), defaultPort
+	}
+
+	r := &cachingResolver{
+		builder:    b,
+		cache:      b.cache,
+		host:       host,
+		port:       port,
+		cc:         cc,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.resolvers[r] = struct{}{}
+	b.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+// Target rewrites a plain host:port address to use the cached-dns scheme.
+// Addresses that already carry a scheme, including unix sockets such as "unix:/run/app.sock", are
+// returned unchanged.
+func Target(address string) string {
+	if strings.Contains(address, "://") || strings.HasPrefix(address, "unix:") || strings.HasPrefix(address, "unix-abstract:") {
+		return address
+	}
+	return Scheme + ":///" + address
+}
+
+type cachingResolver struct {
+	builder *Builder
+	cache   *Cache
+	host    string
+	port    string
+	cc      resolver.ClientConn
+
+	resolveNow chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// ResolveNow implements resolver.Resolver.
+func (r *cachingResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// Close implements resolver.Resolver.
+func (r *cachingResolver) Close() {
+	r.builder.mu.Lock()
+	delete(r.builder.resolvers, r)
+	r.builder.mu.Unlock()
+
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *cachingResolver) watch() {
+	defer r.wg.Done()
+
+	for {
+		next := r.resolve()
+
+		select {
+		case <-r.done:
+			return
+		case <-r.resolveNow:
+		case <-r.cache.clock.After(next.Sub(r.cache.clock.Now())):
+		}
+	}
+}
+
+// resolve looks up the host and pushes the addresses to gRPC. It returns when to resolve again.
+func (r *cachingResolver) resolve() time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cache.cfg.LookupTimeout)
+	defer cancel()
+
+	ips, next, err := r.cache.Lookup(ctx, r.host)
+	if err != nil {
+		r.cc.ReportError(err)
+		return next
+	}
+
+	addrs := make([]resolver.Address, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, resolver.Address{Addr: net.JoinHostPort(ip.String(), r.port)})
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		r.cache.logger.Debugf("Resolver state update for %s rejected: %v", r.host, err)
+	}
+	return next
+}
@@ -0,0 +1,99 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+)
+
+func TestCache_TTLAndStale(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	lookups := 0
+	var lookupErr error
+
+	cfg := DefaultConfig()
+	cfg.Clock = clk
+	cfg.Lookup = func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		lookups++
+		if lookupErr != nil {
+			return nil, 0, lookupErr
+		}
+		return []net.IP{net.ParseIP("10.0.0.1")}, 30 * time.Second, nil
+	}
+	cache := NewCache(cfg)
+	ctx := context.Background()
+
+	if _, _, err := cache.Lookup(ctx, "orders.internal"); err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	clk.Advance(10 * time.Second)
+	if _, _, err := cache.Lookup(ctx, "orders.internal"); err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if lookups != 1 {
+		t.Errorf("Expected cached result within TTL, got %d lookups", lookups)
+	}
+
+	// After the TTL expires with DNS down, the stale entry is served
+	lookupErr = errors.New("dns down")
+	clk.Advance(30 * time.Second)
+	ips, _, err := cache.Lookup(ctx, "orders.internal")
+	if err != nil {
+		t.Fatalf("Expected stale result, got error: %v", err)
+	}
+	if lookups != 2 || len(ips) != 1 {
+		t.Errorf("Expected stale entry after failed refresh, got %d lookups and %v", lookups, ips)
+	}
+
+	cfg.ServeStale = false
+	if _, _, err := cache.Lookup(ctx, "orders.internal"); err == nil {
+		t.Error("Expected error when serving stale entries is disabled")
+	}
+}
+
+func TestCache_Expire(t *testing.T) {
+	lookups := 0
+	cfg := DefaultConfig()
+	cfg.Clock = testutil.NewFakeClock(time.Now())
+	cfg.Lookup = func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		lookups++
+		if lookups > 2 {
+			return nil, 0, errors.New("dns down")
+		}
+		return []net.IP{net.ParseIP("10.0.0.1")}, time.Minute, nil
+	}
+	cache := NewCache(cfg)
+	ctx := context.Background()
+
+	_, _, _ = cache.Lookup(ctx, "orders.internal")
+	cache.Expire("orders.internal")
+	_, _, _ = cache.Lookup(ctx, "orders.internal")
+	if lookups != 2 {
+		t.Errorf("Expected a lookup after Expire, got %d lookups", lookups)
+	}
+
+	// Expired entries are still served while DNS is down
+	cache.Expire("orders.internal")
+	if ips, _, err := cache.Lookup(ctx, "orders.internal"); err != nil || len(ips) != 1 {
+		t.Errorf("Expected the stale entry, got %v, %v", ips, err)
+	}
+}
+
+func TestNewCache_SystemLookupByDefault(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = clk
+	cache := NewCache(cfg)
+
+	ips, expires, err := cache.Lookup(context.Background(), "localhost")
+	if err != nil || len(ips) == 0 {
+		t.Fatalf("Expected localhost to be resolved by the system resolver, got %v, %v", ips, err)
+	}
+	if want := clk.Now().Add(DefaultSystemLookupTTL); !expires.Equal(want) {
+		t.Errorf("Expected the result to be cached for %v, expires at %v, want %v", DefaultSystemLookupTTL, expires, want)
+	}
+}
@@ -0,0 +1,180 @@
+package dnscache
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// LookupFunc resolves host to IP addresses and returns how long the result may be cached.
+type LookupFunc func(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+
+// SystemLookup returns a LookupFunc backed by net.DefaultResolver. The system resolver does not
+// expose record TTLs, so every result is cached for ttl.
+func SystemLookup(ttl time.Duration) LookupFunc {
+	return func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, 0, err
+		}
+		ips := make([]net.IP, 0, len(addrs))
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+		return ips, ttl, nil
+	}
+}
+
+// TTLLookup returns a LookupFunc that queries the DNS server directly for A and AAAA records
+// and honors the lowest record TTL. If server is empty, the first nameserver in
+// /etc/resolv.conf is used.
+func TTLLookup(server string) LookupFunc {
+	return func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			return []net.IP{ip}, 0, nil
+		}
+
+		addr := server
+		if addr == "" {
+			var err error
+			if addr, err = systemNameserver(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		var (
+			ips    []net.IP
+			minTTL uint32
+			errs   []error
+		)
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			found, ttl, err := query(ctx, addr, host, qtype)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if len(found) > 0 && (len(ips) == 0 || ttl < minTTL) {
+				minTTL = ttl
+			}
+			ips = append(ips, found...)
+		}
+
+		if len(ips) == 0 {
+			if err := errors.Join(errs...); err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, fmt.Errorf("no addresses found for %s", host)
+		}
+		return ips, time.Duration(minTTL) * time.Second, nil
+	}
+}
+
+// query sends a single DNS question over UDP and returns the matching addresses and their lowest TTL.
+func query(ctx context.Context, server, host string, qtype dnsmessage.Type) ([]net.IP, uint32, error) {
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// A random ID makes spoofed responses harder to match to the query.
+	var idBytes [2]byte
+	_, _ = rand.Read(idBytes[:])
+	id := binary.BigEndian.Uint16(idBytes[:])
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return nil, 0, err
+	}
+	if resp.Header.ID != id {
+		return nil, 0, errors.New("dns response id mismatch")
+	}
+	if resp.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("dns query for %s failed: %s", host, resp.Header.RCode)
+	}
+
+	var (
+		ips    []net.IP
+		minTTL uint32
+	)
+	for _, ans := range resp.Answers {
+		var ip net.IP
+		switch body := ans.Body.(type) {
+		case *dnsmessage.AResource:
+			ip = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			ip = net.IP(body.AAAA[:])
+		default:
+			continue
+		}
+		if len(ips) == 0 || ans.Header.TTL < minTTL {
+			minTTL = ans.Header.TTL
+		}
+		ips = append(ips, ip)
+	}
+	return ips, minTTL, nil
+}
+
+func dnsName(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf as host:port.
+func systemNameserver() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("failed to read resolv.conf: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	return "", errors.New("no nameserver found in resolv.conf")
+}
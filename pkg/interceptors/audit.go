@@ -0,0 +1,320 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// AuditRecord describes a single audited gRPC call.
+type AuditRecord struct {
+	Time     time.Time       `json:"time"`
+	Who      string          `json:"who"`
+	Service  string          `json:"service"`
+	Method   string          `json:"method"`
+	Target   string          `json:"target"`
+	Code     string          `json:"code"`
+	Error    string          `json:"error,omitempty"`
+	Duration time.Duration   `json:"duration"`
+	Request  json.RawMessage `json:"request,omitempty"`
+}
+
+// AuditSink receives audit records. Implementations must be safe for concurrent use.
+type AuditSink interface {
+	Write(ctx context.Context, record *AuditRecord) error
+}
+
+// AuditConfig holds configuration for audit logging.
+type AuditConfig struct {
+	// Sink receives the audit records
+	Sink AuditSink
+	// Methods are the full method names to audit. If empty, all methods are audited
+	Methods []string
+	// IncludePayload adds the JSON-encoded request to the record (default: false)
+	IncludePayload bool
+	// Identity returns who is making the call. If nil, the caller from WithCaller is used
+	Identity func(ctx context.Context) string
+	// Logger receives sink failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// auditor writes the audit records of the calls to the configured methods.
+type auditor struct {
+	serviceName string
+	cfg         *AuditConfig
+	methods     map[string]struct{}
+	identity    func(ctx context.Context) string
+	log         logger.Logger
+}
+
+func newAuditor(serviceName string, cfg *AuditConfig) *auditor {
+	methods := make(map[string]struct{}, len(cfg.Methods))
+	for _, method := range cfg.Methods {
+		methods[method] = struct{}{}
+	}
+
+	identity := cfg.Identity
+	if identity == nil {
+		identity = CallerFromContext
+	}
+	return &auditor{serviceName: serviceName, cfg: cfg, methods: methods, identity: identity, log: logger.OrDefault(cfg.Logger)}
+}
+
+// audits reports whether calls to method are audited.
+func (a *auditor) audits(method string) bool {
+	if len(a.methods) == 0 {
+		return true
+	}
+	_, ok := a.methods[method]
+	return ok
+}
+
+// write writes the record of a call to method that started at start and ended with err. Sink
+// failures are logged.
+func (a *auditor) write(ctx context.Context, method string, cc *grpc.ClientConn, req interface{}, start time.Time, err error) {
+	record := &AuditRecord{
+		Time:     start,
+		Who:      a.identity(ctx),
+		Service:  a.serviceName,
+		Method:   method,
+		Code:     status.Code(err).String(),
+		Duration: time.Since(start),
+	}
+	if cc != nil {
+		record.Target = cc.Target()
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if msg, ok := req.(proto.Message); ok && a.cfg.IncludePayload {
+		if payload, mErr := protojson.Marshal(msg); mErr == nil {
+			record.Request = payload
+		}
+	}
+
+	if wErr := a.cfg.Sink.Write(ctx, record); wErr != nil {
+		a.log.Errorf("Failed to write audit record: method=%s, error=%v", method, wErr)
+	}
+}
+
+// AuditInterceptor creates an interceptor that writes an audit record for each call to one of
+// the configured methods. Sink failures are logged and never fail the call.
+func AuditInterceptor(serviceName string, cfg *AuditConfig) grpc.UnaryClientInterceptor {
+	a := newAuditor(serviceName, cfg)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !a.audits(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		a.write(ctx, method, cc, req, start, err)
+		return err
+	}
+}
+
+// AuditStreamInterceptor is the stream counterpart of AuditInterceptor. The record of a stream is
+// written when it ends, with the status of the final RecvMsg, or of the stream's context if it is
+// abandoned. With IncludePayload, the record holds the first message sent.
+func AuditStreamInterceptor(serviceName string, cfg *AuditConfig) grpc.StreamClientInterceptor {
+	a := newAuditor(serviceName, cfg)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !a.audits(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			a.write(ctx, method, cc, nil, start, err)
+			return stream, err
+		}
+
+		var (
+			mu    sync.Mutex
+			first interface{}
+		)
+		observed := &observedStream{
+			ClientStream:   stream,
+			singleResponse: !desc.ServerStreams,
+			onSend: func(msg interface{}) {
+				mu.Lock()
+				defer mu.Unlock()
+				if first == nil {
+					first = msg
+				}
+			},
+			onFinish: func(err error) {
+				mu.Lock()
+				req := first
+				mu.Unlock()
+				a.write(ctx, method, cc, req, start, err)
+			},
+		}
+		go func() {
+			<-stream.Context().Done()
+			observed.finish(status.FromContextError(stream.Context().Err()).Err())
+		}()
+		return observed, nil
+	}
+}
+
+// FileAuditSink writes audit records as JSON lines to a file.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileAuditSink opens (or creates) the file at path in append mode for audit records.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &FileAuditSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write appends the record to the file.
+func (s *FileAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(record)
+}
+
+// Close closes the underlying file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// DefaultAuditQueueSize is the number of records an HTTPAuditSink queues if QueueSize is zero.
+const DefaultAuditQueueSize = 1000
+
+// errAuditQueueFull is returned by HTTPAuditSink.Write for records dropped because the queue is full.
+var errAuditQueueFull = errors.New("audit queue is full, record dropped")
+
+// HTTPAuditSinkConfig holds configuration for an HTTPAuditSink.
+type HTTPAuditSinkConfig struct {
+	// URL is the endpoint the records are posted to
+	URL string
+	// Client posts the records. If nil, a client with a 5s timeout is used
+	Client *http.Client
+	// QueueSize bounds the records waiting to be posted. Records that do not fit are dropped
+	// rather than delaying calls (default: 1000)
+	QueueSize int
+	// Logger receives post failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// HTTPAuditSink posts each audit record as JSON to an HTTP endpoint. Records are queued and posted
+// in the background, so that a slow endpoint does not delay calls.
+type HTTPAuditSink struct {
+	url    string
+	client *http.Client
+	log    logger.Logger
+	done   chan struct{}
+
+	mu     sync.Mutex
+	queue  chan *AuditRecord
+	closed bool
+}
+
+// NewHTTPAuditSink creates a sink that posts records to cfg.URL, and starts posting them.
+func NewHTTPAuditSink(cfg *HTTPAuditSinkConfig) *HTTPAuditSink {
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = DefaultAuditQueueSize
+	}
+	s := &HTTPAuditSink{
+		url:    cfg.URL,
+		client: client,
+		log:    logger.OrDefault(cfg.Logger),
+		done:   make(chan struct{}),
+		queue:  make(chan *AuditRecord, size),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues the record to be posted. It fails if the queue is full or the sink is closed.
+func (s *HTTPAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("audit sink is closed")
+	}
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		return errAuditQueueFull
+	}
+}
+
+// Close stops accepting records and waits until the queued ones are posted.
+func (s *HTTPAuditSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+// run posts the queued records until the sink is closed.
+func (s *HTTPAuditSink) run() {
+	defer close(s.done)
+	for record := range s.queue {
+		if err := s.post(record); err != nil {
+			s.log.Errorf("Failed to post audit record: method=%s, error=%v", record.Method, err)
+		}
+	}
+}
+
+// post posts the record to the configured URL.
+func (s *HTTPAuditSink) post(record *AuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("audit sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
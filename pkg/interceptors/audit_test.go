@@ -0,0 +1,185 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+func (s *memoryAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestAuditInterceptor(t *testing.T) {
+	sink := &memoryAuditSink{}
+	interceptor := AuditInterceptor("test-service", &AuditConfig{
+		Sink:    sink,
+		Methods: []string{"/admin.Admin/Delete"},
+	})
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+
+	ctx := WithCaller(context.Background(), "admin-cli")
+	_ = interceptor(ctx, "/admin.Admin/Delete", nil, nil, nil, invoker)
+	_ = interceptor(ctx, "/admin.Admin/List", nil, nil, nil, invoker)
+
+	if len(sink.records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(sink.records))
+	}
+	record := sink.records[0]
+	if record.Who != "admin-cli" {
+		t.Errorf("Expected who=admin-cli, got %q", record.Who)
+	}
+	if record.Code != codes.PermissionDenied.String() {
+		t.Errorf("Expected code=%s, got %s", codes.PermissionDenied, record.Code)
+	}
+}
+
+// recorded returns the records written so far.
+func (s *memoryAuditSink) recorded() []*AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records)
+}
+
+func TestAuditStreamInterceptor(t *testing.T) {
+	sink := &memoryAuditSink{}
+	interceptor := AuditStreamInterceptor("health", &AuditConfig{
+		Sink:           sink,
+		Methods:        []string{"/grpc.health.v1.Health/Watch"},
+		IncludePayload: true,
+	})
+
+	// The record of a stream is written once it ends, with the first message sent.
+	ctx := WithCaller(context.Background(), "admin-cli")
+	serving := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &replayStream{ctx: ctx, responses: []proto.Message{serving}}, nil
+	}
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := interceptor(ctx, desc, nil, "/grpc.health.v1.Health/Watch", streamer)
+	if err != nil {
+		t.Fatalf("stream creation failed: %v", err)
+	}
+	if err := stream.SendMsg(&healthpb.HealthCheckRequest{Service: "orders"}); err != nil {
+		t.Fatalf("SendMsg failed: %v", err)
+	}
+	if got := len(sink.recorded()); got != 0 {
+		t.Fatalf("Expected no record while the stream is open, got %d", got)
+	}
+	for {
+		if err := stream.RecvMsg(&healthpb.HealthCheckResponse{}); err != nil {
+			break
+		}
+	}
+	records := sink.recorded()
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 audit record, got %d", len(records))
+	}
+	if r := records[0]; r.Who != "admin-cli" || r.Code != codes.OK.String() || !strings.Contains(string(r.Request), "orders") {
+		t.Errorf("Expected an OK record by admin-cli with the request, got %+v", r)
+	}
+
+	// Streams that fail to open, or are abandoned, are audited with their error.
+	failing := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+	_, _ = interceptor(ctx, desc, nil, "/grpc.health.v1.Health/Watch", failing)
+	abandonCtx, cancel := context.WithCancel(ctx)
+	if _, err := interceptor(abandonCtx, desc, nil, "/grpc.health.v1.Health/Watch", streamer); err != nil {
+		t.Fatalf("stream creation failed: %v", err)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for len(sink.recorded()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 audit records, got %d", len(sink.recorded()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	records = sink.recorded()
+	if records[1].Code != codes.PermissionDenied.String() || records[2].Code != codes.Canceled.String() {
+		t.Errorf("Expected PermissionDenied and Canceled records, got %s and %s", records[1].Code, records[2].Code)
+	}
+
+	// Other methods are not audited.
+	if _, err := interceptor(ctx, desc, nil, "/grpc.health.v1.Health/List", failing); err == nil {
+		t.Fatal("Expected the stream to fail")
+	}
+	if got := len(sink.recorded()); got != 3 {
+		t.Errorf("Expected unaudited methods not to be recorded, got %d records", got)
+	}
+}
+
+func TestHTTPAuditSink(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var record AuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			t.Errorf("failed to decode the posted record: %v", err)
+		}
+		mu.Lock()
+		methods = append(methods, record.Method)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	sink := NewHTTPAuditSink(&HTTPAuditSinkConfig{URL: server.URL, QueueSize: 2})
+
+	// The first record is being posted and the next two fill the queue, while the endpoint hangs.
+	start := time.Now()
+	for _, method := range []string{"/a", "/b", "/c"} {
+		if err := sink.Write(context.Background(), &AuditRecord{Method: method}); err != nil {
+			t.Errorf("Write(%s) failed: %v", method, err)
+		}
+		if method == "/a" {
+			time.Sleep(50 * time.Millisecond) // let the sink pick up the first record
+		}
+	}
+	if err := sink.Write(context.Background(), &AuditRecord{Method: "/d"}); err == nil {
+		t.Error("expected a record that does not fit in the queue to be dropped")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Write not to wait for the endpoint, took %v", elapsed)
+	}
+
+	close(release)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(methods) != 3 || methods[0] != "/a" || methods[1] != "/b" || methods[2] != "/c" {
+		t.Errorf("expected the queued records to be posted before Close returns, got %v", methods)
+	}
+	if err := sink.Write(context.Background(), &AuditRecord{Method: "/e"}); err == nil {
+		t.Error("expected Write to fail after Close")
+	}
+}
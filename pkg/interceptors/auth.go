@@ -0,0 +1,192 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/credentials"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TokenProvider supplies access tokens for TokenAuth. Every credentials.TokenSource, such as
+// credentials.StaticToken and credentials.ClientCredentialsSource, is a TokenProvider.
+type TokenProvider interface {
+	Token(ctx context.Context) (*credentials.Token, error)
+}
+
+// AuthConfig holds configuration for token-based authentication.
+type AuthConfig struct {
+	// Provider fetches access tokens
+	Provider TokenProvider
+	// RefreshBefore is how long before expiry a cached token is replaced. Tokens with a zero
+	// Expiry never expire (default: 30s)
+	RefreshBefore time.Duration
+	// AllowInsecure lets tokens be sent over connections without transport security, such as
+	// plaintext connections to a local sidecar. Otherwise such calls fail with Unauthenticated
+	// (default: false)
+	AllowInsecure bool
+	// Clock is used to check token expiry. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives background refresh failures. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// DefaultAuthConfig returns an AuthConfig with sensible defaults for provider.
+func DefaultAuthConfig(provider TokenProvider) *AuthConfig {
+	return &AuthConfig{
+		Provider:      provider,
+		RefreshBefore: 30 * time.Second,
+	}
+}
+
+// TokenAuth attaches an "authorization: Bearer <token>" header to calls, from a
+// credentials.RefreshingCredentials created on the first call, which refreshes the token in the
+// background before it expires. A call failing with Unauthenticated invalidates the token and is
+// retried once with a fresh one. The interceptors of one TokenAuth share its token.
+type TokenAuth struct {
+	cfg *credentials.RefreshingCredentialsConfig
+
+	mu     sync.Mutex
+	creds  *credentials.RefreshingCredentials
+	closed bool
+}
+
+// NewTokenAuth creates a TokenAuth. Call Close to stop refreshing its token.
+func NewTokenAuth(cfg *AuthConfig) (*TokenAuth, error) {
+	if cfg == nil || cfg.Provider == nil {
+		return nil, errors.New("token provider must be set")
+	}
+	if cfg.RefreshBefore < 0 {
+		return nil, errors.New("RefreshBefore must not be negative")
+	}
+	credsCfg := credentials.DefaultRefreshingCredentialsConfig(cfg.Provider)
+	credsCfg.Name = "auth"
+	credsCfg.RefreshBefore = cfg.RefreshBefore
+	credsCfg.RequireTransportSecurity = !cfg.AllowInsecure
+	credsCfg.Clock = cfg.Clock
+	credsCfg.Logger = cfg.Logger
+	return &TokenAuth{cfg: credsCfg}, nil
+}
+
+// credentials returns the refreshing credentials, fetching the first token if this is the first
+// call. The lock is held during the fetch so that concurrent calls share a single request.
+func (a *TokenAuth) credentials(ctx context.Context) (*credentials.RefreshingCredentials, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, status.Error(codes.Unauthenticated, "token authentication is closed")
+	}
+	if a.creds == nil {
+		creds, err := credentials.NewRefreshingCredentials(ctx, a.cfg)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "failed to fetch access token: %v", err)
+		}
+		a.creds = creds
+	}
+	return a.creds, nil
+}
+
+// Close stops refreshing the token. Calls made afterwards fail with Unauthenticated.
+func (a *TokenAuth) Close() {
+	a.mu.Lock()
+	creds := a.creds
+	a.creds, a.closed = nil, true
+	a.mu.Unlock()
+	if creds != nil {
+		creds.Close()
+	}
+}
+
+// sentToken sends the token of creds on one attempt and remembers it, so that the token can be
+// invalidated if the server rejects it. Passing it as a call option, rather than adding the header
+// directly, lets gRPC refuse to send it over insecure connections.
+type sentToken struct {
+	creds *credentials.RefreshingCredentials
+
+	mu    sync.Mutex
+	token string
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (t *sentToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md, err := t.creds.GetRequestMetadata(ctx, uri...)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to fetch access token: %v", err)
+	}
+	t.mu.Lock()
+	t.token = strings.TrimPrefix(md["authorization"], "Bearer ")
+	t.mu.Unlock()
+	return md, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (t *sentToken) RequireTransportSecurity() bool {
+	return t.creds.RequireTransportSecurity()
+}
+
+// rejected invalidates the token sent if err rejects it, and reports whether a fresh token is
+// worth trying. Calls refused before a token was sent, e.g. over an insecure connection, are not.
+func (t *sentToken) rejected(err error) bool {
+	if status.Code(err) != codes.Unauthenticated {
+		return false
+	}
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+	if token == "" {
+		return false
+	}
+	t.creds.Invalidate(token)
+	return true
+}
+
+// UnaryInterceptor returns a unary interceptor that authenticates calls.
+func (a *TokenAuth) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		creds, err := a.credentials(ctx)
+		if err != nil {
+			return err
+		}
+
+		sent := &sentToken{creds: creds}
+		err = invoker(ctx, method, req, reply, cc, append(opts, grpc.PerRPCCredentials(sent))...)
+		if !sent.rejected(err) {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, append(opts, grpc.PerRPCCredentials(&sentToken{creds: creds}))...)
+	}
+}
+
+// StreamInterceptor returns a stream interceptor that authenticates streams. Only a failure
+// to create the stream is retried; an Unauthenticated status received later on the stream
+// still invalidates the token for subsequent calls.
+func (a *TokenAuth) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		creds, err := a.credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		sent := &sentToken{creds: creds}
+		stream, err := streamer(ctx, desc, cc, method, append(opts, grpc.PerRPCCredentials(sent))...)
+		if sent.rejected(err) {
+			sent = &sentToken{creds: creds}
+			stream, err = streamer(ctx, desc, cc, method, append(opts, grpc.PerRPCCredentials(sent))...)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &observedStream{ClientStream: stream, singleResponse: !desc.ServerStreams, onFinish: func(err error) {
+			sent.rejected(err)
+		}}, nil
+	}
+}
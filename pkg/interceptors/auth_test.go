@@ -0,0 +1,141 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+	"github.com/begenov/grpc-connection-manager/pkg/credentials"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type sequenceProvider struct {
+	clock *testutil.FakeClock
+	calls int
+}
+
+func (p *sequenceProvider) Token(context.Context) (*credentials.Token, error) {
+	p.calls++
+	return &credentials.Token{
+		AccessToken: fmt.Sprintf("token-%d", p.calls),
+		Expiry:      p.clock.Now().Add(time.Minute),
+	}, nil
+}
+
+// authorization returns the authorization header that the PerRPCCredentials call option in opts
+// sends, as gRPC would over a secure connection.
+func authorization(ctx context.Context, opts []grpc.CallOption) string {
+	for _, opt := range opts {
+		if c, ok := opt.(grpc.PerRPCCredsCallOption); ok {
+			md, err := c.Creds.GetRequestMetadata(ctx)
+			if err != nil {
+				return ""
+			}
+			return md["authorization"]
+		}
+	}
+	return ""
+}
+
+func TestTokenAuth_RefreshesBeforeExpiry(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	provider := &sequenceProvider{clock: clk}
+	cfg := DefaultAuthConfig(provider)
+	cfg.Clock = clk
+
+	auth, err := NewTokenAuth(cfg)
+	if err != nil {
+		t.Fatalf("NewTokenAuth failed: %v", err)
+	}
+	interceptor := auth.UnaryInterceptor()
+
+	var got string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		got = authorization(ctx, opts)
+		return nil
+	}
+
+	for range 2 {
+		if err := interceptor(context.Background(), "/svc/M", nil, nil, nil, invoker); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if got != "Bearer token-1" || provider.calls != 1 {
+		t.Errorf("expected cached token-1, got %q after %d fetches", got, provider.calls)
+	}
+
+	// Within RefreshBefore of expiry the token is replaced.
+	clk.Advance(45 * time.Second)
+	if err := interceptor(context.Background(), "/svc/M", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if got != "Bearer token-2" {
+		t.Errorf("expected refreshed token-2, got %q", got)
+	}
+}
+
+func TestTokenAuth_RetriesOnceOnUnauthenticated(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	provider := &sequenceProvider{clock: clk}
+	cfg := DefaultAuthConfig(provider)
+	cfg.Clock = clk
+
+	auth, err := NewTokenAuth(cfg)
+	if err != nil {
+		t.Fatalf("NewTokenAuth failed: %v", err)
+	}
+	interceptor := auth.UnaryInterceptor()
+
+	var seen []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		auth := authorization(ctx, opts)
+		seen = append(seen, auth)
+		if auth == "Bearer token-1" {
+			return status.Error(codes.Unauthenticated, "revoked")
+		}
+		return nil
+	}
+
+	if err := interceptor(context.Background(), "/svc/M", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("expected retry with a fresh token to succeed, got %v", err)
+	}
+	if len(seen) != 2 || seen[1] != "Bearer token-2" {
+		t.Errorf("expected one retry with token-2, got %v", seen)
+	}
+
+	// A second rejection is returned to the caller.
+	always := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		authorization(ctx, opts)
+		return status.Error(codes.Unauthenticated, "denied")
+	}
+	if err := interceptor(context.Background(), "/svc/M", nil, nil, nil, always); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("expected 3 token fetches, got %d", provider.calls)
+	}
+}
+
+func TestTokenAuth_StaticToken(t *testing.T) {
+	auth, err := NewTokenAuth(DefaultAuthConfig(credentials.StaticToken("secret")))
+	if err != nil {
+		t.Fatalf("NewTokenAuth failed: %v", err)
+	}
+
+	var got string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		got = authorization(ctx, opts)
+		return nil
+	}
+	if err := auth.UnaryInterceptor()(context.Background(), "/svc/M", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if got != "Bearer secret" {
+		t.Errorf("expected static token, got %q", got)
+	}
+}
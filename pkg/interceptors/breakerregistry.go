@@ -0,0 +1,103 @@
+package interceptors
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CircuitBreakerRegistry gives access to the circuit breakers of many services, so that they can
+// be inspected, tripped and reset from outside the interceptors and state changes can be observed
+// in one place.
+type CircuitBreakerRegistry struct {
+	mu        sync.RWMutex
+	groups    map[string]*CircuitBreakerGroup
+	listeners []func(service, method string, from, to CircuitBreakerState)
+}
+
+// NewCircuitBreakerRegistry creates an empty CircuitBreakerRegistry.
+func NewCircuitBreakerRegistry() *CircuitBreakerRegistry {
+	return &CircuitBreakerRegistry{groups: make(map[string]*CircuitBreakerGroup)}
+}
+
+// Register adds g to the registry, replacing any group previously registered for its service.
+func (r *CircuitBreakerRegistry) Register(g *CircuitBreakerGroup) {
+	g.registry.Store(r)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[g.serviceName] = g
+}
+
+// Unregister removes the service's group from the registry.
+func (r *CircuitBreakerRegistry) Unregister(service string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.groups, service)
+}
+
+// Group returns the group registered for the service.
+func (r *CircuitBreakerRegistry) Group(service string) (*CircuitBreakerGroup, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	g, ok := r.groups[service]
+	return g, ok
+}
+
+// Services returns the names of the services with registered groups.
+func (r *CircuitBreakerRegistry) Services() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	services := make([]string, 0, len(r.groups))
+	for service := range r.groups {
+		services = append(services, service)
+	}
+	return services
+}
+
+// State returns the state of a method's breaker. ok is false if the service has no breakers
+// or the method has not been called yet.
+func (r *CircuitBreakerRegistry) State(service, method string) (state CircuitBreakerState, ok bool) {
+	g, ok := r.Group(service)
+	if !ok {
+		return StateClosed, false
+	}
+	return g.State(method)
+}
+
+// Trip opens a method's breaker and holds it open until Reset.
+func (r *CircuitBreakerRegistry) Trip(service, method string) error {
+	g, ok := r.Group(service)
+	if !ok {
+		return fmt.Errorf("no circuit breakers registered for service %s", service)
+	}
+	g.Trip(method)
+	return nil
+}
+
+// Reset closes a method's breaker and clears its failures.
+func (r *CircuitBreakerRegistry) Reset(service, method string) error {
+	g, ok := r.Group(service)
+	if !ok {
+		return fmt.Errorf("no circuit breakers registered for service %s", service)
+	}
+	g.Reset(method)
+	return nil
+}
+
+// OnStateChange registers fn to be called whenever a breaker of any registered service changes
+// state. Like CircuitBreakerConfig.OnStateChange, fn is called with the breaker lock held and
+// must not block or call back into the breaker.
+func (r *CircuitBreakerRegistry) OnStateChange(fn func(service, method string, from, to CircuitBreakerState)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *CircuitBreakerRegistry) notify(service, method string, from, to CircuitBreakerState) {
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(service, method, from, to)
+	}
+}
@@ -0,0 +1,85 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type stateChange struct {
+	service, method string
+	from, to        CircuitBreakerState
+}
+
+func TestCircuitBreakerRegistry(t *testing.T) {
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.FailureThreshold = 1
+	cfg.Timeout = time.Hour
+
+	registry := NewCircuitBreakerRegistry()
+	group := NewCircuitBreakerGroup("orders", cfg, nil)
+	registry.Register(group)
+
+	var changes []stateChange
+	registry.OnStateChange(func(service, method string, from, to CircuitBreakerState) {
+		changes = append(changes, stateChange{service, method, from, to})
+	})
+
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	_ = group.UnaryInterceptor()(context.Background(), "/orders.Orders/Get", nil, nil, nil, failing)
+
+	if state, ok := registry.State("orders", "/orders.Orders/Get"); !ok || state != StateOpen {
+		t.Errorf("Expected open breaker, got %v (found %v)", state, ok)
+	}
+	if err := registry.Reset("orders", "/orders.Orders/Get"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if err := registry.Trip("orders", "/orders.Orders/List"); err != nil {
+		t.Fatalf("Trip failed: %v", err)
+	}
+	if err := registry.Trip("payments", "/payments.Payments/Pay"); err == nil {
+		t.Error("Expected Trip to fail for an unknown service")
+	}
+
+	want := []stateChange{
+		{"orders", "/orders.Orders/Get", StateClosed, StateOpen},
+		{"orders", "/orders.Orders/Get", StateOpen, StateClosed},
+		{"orders", "/orders.Orders/List", StateClosed, StateOpen},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected %d state changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+}
+
+func TestCircuitBreakerGroup_TripHoldsOpen(t *testing.T) {
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.Timeout = 0
+	group := NewCircuitBreakerGroup("orders", cfg, nil)
+	group.Trip("/orders.Orders/Get")
+
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return nil
+	}
+	interceptor := group.UnaryInterceptor()
+	if err := interceptor(context.Background(), "/orders.Orders/Get", nil, struct{}{}, nil, invoker); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected a tripped breaker to reject calls after its timeout, got %v", err)
+	}
+
+	group.Reset("/orders.Orders/Get")
+	if err := interceptor(context.Background(), "/orders.Orders/Get", nil, struct{}{}, nil, invoker); err != nil || calls != 1 {
+		t.Errorf("Expected the call to pass after Reset, got %v with %d calls", err, calls)
+	}
+}
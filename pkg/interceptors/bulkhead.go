@@ -0,0 +1,119 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BulkheadConfig holds configuration for limiting the number of in-flight calls to a service.
+type BulkheadConfig struct {
+	// MaxConcurrent is the maximum number of calls and streams in flight at once
+	MaxConcurrent int
+	// MaxWait is how long a call waits for a free slot before failing with ResourceExhausted.
+	// Zero fails immediately when the bulkhead is full (default: 0)
+	MaxWait time.Duration
+	// Clock is used for the wait timeout. If nil, the real clock is used
+	Clock clock.Clock
+}
+
+// Bulkhead is a semaphore bounding the in-flight calls to a service, so that one slow backend
+// cannot tie up every goroutine and stream in the process.
+type Bulkhead struct {
+	slots   chan struct{}
+	maxWait time.Duration
+	clock   clock.Clock
+}
+
+// NewBulkhead creates a Bulkhead.
+func NewBulkhead(cfg *BulkheadConfig) *Bulkhead {
+	return &Bulkhead{
+		slots:   make(chan struct{}, cfg.MaxConcurrent),
+		maxWait: cfg.MaxWait,
+		clock:   clock.OrReal(cfg.Clock),
+	}
+}
+
+// Acquire takes a slot, waiting up to MaxWait or until ctx is done. The returned function
+// releases the slot; it is safe to call more than once.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case b.slots <- struct{}{}:
+		return b.releaser(), nil
+	default:
+	}
+
+	if b.maxWait <= 0 {
+		return nil, status.Error(codes.ResourceExhausted, "bulkhead is full")
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return b.releaser(), nil
+	case <-b.clock.After(b.maxWait):
+		return nil, status.Errorf(codes.ResourceExhausted, "bulkhead is full after waiting %v", b.maxWait)
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// InFlight returns the number of slots currently taken.
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+func (b *Bulkhead) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-b.slots })
+	}
+}
+
+// BulkheadInterceptor creates an interceptor that holds a bulkhead slot for the duration of each call.
+func BulkheadInterceptor(serviceName string, b *Bulkhead, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		release, err := b.Acquire(ctx)
+		if err != nil {
+			if m != nil && status.Code(err) == codes.ResourceExhausted {
+				m.IncrementGRPCBlocked(serviceName, method, "bulkhead")
+			}
+			return err
+		}
+		defer release()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// BulkheadStreamInterceptor creates a stream interceptor that holds a bulkhead slot until the
+// stream ends or its context is done. Streams that are neither read to the end nor canceled keep
+// their slot, so callers must cancel abandoned streams.
+func BulkheadStreamInterceptor(serviceName string, b *Bulkhead, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		release, err := b.Acquire(ctx)
+		if err != nil {
+			if m != nil && status.Code(err) == codes.ResourceExhausted {
+				m.IncrementGRPCBlocked(serviceName, method, "bulkhead")
+			}
+			return nil, err
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		stop := context.AfterFunc(ctx, release)
+		return &observedStream{ClientStream: stream, singleResponse: !desc.ServerStreams, onFinish: func(error) {
+			stop()
+			release()
+		}}, nil
+	}
+}
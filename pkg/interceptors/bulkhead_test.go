@@ -0,0 +1,87 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBulkheadInterceptor(t *testing.T) {
+	b := NewBulkhead(&BulkheadConfig{MaxConcurrent: 1})
+	interceptor := BulkheadInterceptor("test-service", b, nil)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	slow := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		close(started)
+		<-unblock
+		return nil
+	}
+	fast := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- interceptor(context.Background(), "/svc/Slow", nil, nil, nil, slow) }()
+	<-started
+
+	if err := interceptor(context.Background(), "/svc/Fast", nil, nil, nil, fast); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted while the bulkhead is full, got %v", err)
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("slow call failed: %v", err)
+	}
+	if err := interceptor(context.Background(), "/svc/Fast", nil, nil, nil, fast); err != nil {
+		t.Errorf("Expected call to succeed once the slot is released, got %v", err)
+	}
+	if n := b.InFlight(); n != 0 {
+		t.Errorf("Expected no calls in flight, got %d", n)
+	}
+}
+
+func TestBulkhead_MaxWait(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	b := NewBulkhead(&BulkheadConfig{MaxConcurrent: 1, MaxWait: time.Second, Clock: clk})
+
+	release, err := b.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	// A waiter gets the slot when it is released within MaxWait.
+	acquired := make(chan error, 1)
+	go func() {
+		r, err := b.Acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		acquired <- err
+	}()
+	clk.BlockUntil(1)
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("Expected waiter to get the released slot, got %v", err)
+	}
+
+	// A waiter gives up after MaxWait.
+	release, _ = b.Acquire(context.Background())
+	defer release()
+	go func() {
+		_, err := b.Acquire(context.Background())
+		acquired <- err
+	}()
+	// The first waiter's timer is still pending, so wait for the second one as well.
+	clk.BlockUntil(2)
+	clk.Advance(time.Second)
+	if err := <-acquired; status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted after MaxWait, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package interceptors
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// CacheConfig holds configuration for caching the responses of idempotent unary methods.
+type CacheConfig struct {
+	// Methods maps full method names, or prefixes ending in "*", to how long their responses are
+	// cached; the most specific entry wins. Only the methods listed are cached, so list only reads
+	// whose responses may be stale for that long
+	Methods map[string]time.Duration
+	// MaxEntries bounds the number of responses cached, evicting the least recently used
+	// (default: 1000)
+	MaxEntries int
+	// KeyMetadata are outgoing metadata keys whose values are part of the cache key, such as
+	// "authorization", so that callers with different identities do not share responses
+	// (default: nil)
+	KeyMetadata []string
+	// Clock is used to expire responses. If nil, the real clock is used
+	Clock clock.Clock
+}
+
+// DefaultCacheMaxEntries is the number of responses a ResponseCache holds if MaxEntries is zero.
+const DefaultCacheMaxEntries = 1000
+
+// ResponseCache is a bounded LRU cache of unary responses, keyed by method, request and the
+// CacheConfig.KeyMetadata of the call.
+type ResponseCache struct {
+	methods     map[string]time.Duration
+	maxEntries  int
+	keyMetadata []string
+	clock       clock.Clock
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key     [sha256.Size]byte
+	value   []byte
+	expires time.Time
+}
+
+// NewResponseCache creates a ResponseCache.
+func NewResponseCache(cfg *CacheConfig) *ResponseCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &ResponseCache{
+		methods:     cfg.Methods,
+		maxEntries:  maxEntries,
+		keyMetadata: cfg.KeyMetadata,
+		clock:       clock.OrReal(cfg.Clock),
+		lru:         list.New(),
+		entries:     make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// ttl returns how long the responses of method are cached, or zero if they are not.
+func (c *ResponseCache) ttl(method string) time.Duration {
+	_, ttl, _ := lookupMethodKey(c.methods, method)
+	return ttl
+}
+
+// requestKey hashes the method, the deterministically marshaled request and the values of the
+// keyMetadata keys in the outgoing metadata of ctx.
+func requestKey(ctx context.Context, method string, req proto.Message, keyMetadata []string) ([sha256.Size]byte, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write(data)
+	if len(keyMetadata) > 0 {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		for _, k := range keyMetadata {
+			for _, v := range md.Get(k) {
+				h.Write([]byte{0})
+				h.Write([]byte(v))
+			}
+			h.Write([]byte{1})
+		}
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key, nil
+}
+
+// get returns the unexpired response cached under key.
+func (c *ResponseCache) get(key [sha256.Size]byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.clock.Now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+// put caches value under key for ttl, evicting the least recently used response if full.
+func (c *ResponseCache) put(key [sha256.Size]byte, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.clock.Now().Add(ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value, entry.expires = value, expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of responses cached, including expired ones not evicted yet.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Purge drops every cached response, e.g. after a write that invalidates them.
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	clear(c.entries)
+}
+
+// CacheInterceptor creates an interceptor answering the calls of the cache's methods from the
+// responses of earlier identical calls, for as long as the method's TTL. Only successful responses
+// are cached, and only calls whose request and reply are protocol buffer messages.
+func CacheInterceptor(serviceName string, c *ResponseCache, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ttl := c.ttl(method)
+		reqMsg, reqOK := req.(proto.Message)
+		replyMsg, replyOK := reply.(proto.Message)
+		if ttl <= 0 || !reqOK || !replyOK {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := requestKey(ctx, method, reqMsg, c.keyMetadata)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		if value, ok := c.get(key); ok && proto.Unmarshal(value, replyMsg) == nil {
+			if m != nil {
+				m.RecordGRPCCache(serviceName, method, true)
+			}
+			return nil
+		}
+		if m != nil {
+			m.RecordGRPCCache(serviceName, method, false)
+		}
+
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		if value, err := proto.Marshal(replyMsg); err == nil {
+			c.put(key, value, ttl)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCacheInterceptor(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cache := NewResponseCache(&CacheConfig{
+		Methods:     map[string]time.Duration{"/grpc.health.v1.Health/*": time.Minute},
+		MaxEntries:  2,
+		KeyMetadata: []string{"authorization"},
+		Clock:       clk,
+	})
+	interceptor := CacheInterceptor("health", cache, nil)
+
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		if req.(*healthpb.HealthCheckRequest).Service == "broken" {
+			return status.Error(codes.Unavailable, "down")
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+	call := func(ctx context.Context, method, service string) *healthpb.HealthCheckResponse {
+		t.Helper()
+		reply := &healthpb.HealthCheckResponse{}
+		_ = interceptor(ctx, method, &healthpb.HealthCheckRequest{Service: service}, reply, nil, invoker)
+		return reply
+	}
+	ctx := context.Background()
+
+	call(ctx, "/grpc.health.v1.Health/Check", "orders")
+	if reply := call(ctx, "/grpc.health.v1.Health/Check", "orders"); invoked != 1 || reply.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected the second call to be served from the cache, got %d invocations and %v", invoked, reply.Status)
+	}
+
+	// Other requests, other identities and failures are not served from the cache.
+	call(ctx, "/grpc.health.v1.Health/Check", "users")
+	call(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer other"), "/grpc.health.v1.Health/Check", "orders")
+	call(ctx, "/grpc.health.v1.Health/Check", "broken")
+	call(ctx, "/grpc.health.v1.Health/Check", "broken")
+	if invoked != 5 {
+		t.Errorf("Expected 5 invocations, got %d", invoked)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected the cache to be bounded to 2 entries, got %d", cache.Len())
+	}
+
+	// "orders" without metadata was the least recently used entry and has been evicted.
+	call(ctx, "/grpc.health.v1.Health/Check", "orders")
+	if invoked != 6 {
+		t.Errorf("Expected the evicted response to be fetched again, got %d invocations", invoked)
+	}
+
+	clk.Advance(time.Minute)
+	call(ctx, "/grpc.health.v1.Health/Check", "orders")
+	if invoked != 7 {
+		t.Errorf("Expected the expired response to be fetched again, got %d invocations", invoked)
+	}
+
+	// Methods that are not listed are never cached.
+	call(ctx, "/orders.Orders/Check", "orders")
+	call(ctx, "/orders.Orders/Check", "orders")
+	if invoked != 9 {
+		t.Errorf("Expected unlisted methods to be invoked every time, got %d invocations", invoked)
+	}
+
+	cache.Purge()
+	if cache.Len() != 0 {
+		t.Errorf("Expected Purge to empty the cache, got %d entries", cache.Len())
+	}
+}
@@ -0,0 +1,17 @@
+package interceptors
+
+import "context"
+
+type callerKey struct{}
+
+// WithCaller returns a copy of ctx tagged with the name of the calling component.
+// The caller is recorded as a label on request metrics.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the calling component stored in ctx, or an empty string if none is set.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
@@ -0,0 +1,591 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CircuitBreakerState represents the state of a circuit breaker.
+type CircuitBreakerState int
+
+const (
+	// StateClosed means the circuit breaker is closed and requests are allowed.
+	StateClosed CircuitBreakerState = iota
+	// StateOpen means the circuit breaker is open and requests are rejected.
+	StateOpen
+	// StateHalfOpen means the circuit breaker is testing if the service has recovered.
+	StateHalfOpen
+)
+
+// String returns the lower-case name of the state.
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerScope selects which calls of a service share a circuit breaker.
+type CircuitBreakerScope int
+
+const (
+	// BreakerScopeMethod gives every method its own breaker.
+	BreakerScopeMethod CircuitBreakerScope = iota
+	// BreakerScopeService shares one breaker between all methods of the service, for backends
+	// where any failure affects every method.
+	BreakerScopeService
+	// BreakerScopeMethodGroup shares a breaker between the methods matching each entry of
+	// CircuitBreakerConfig.MethodGroups; other methods get their own.
+	BreakerScopeMethodGroup
+)
+
+// CircuitBreakerConfig holds configuration for a circuit breaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of failures before opening the circuit (default: 5)
+	FailureThreshold int
+	// FailureRate opens the circuit when the share of failed calls in a rolling window reaches a
+	// threshold, instead of counting failures against FailureThreshold. This copes better with
+	// bursty traffic (default: nil)
+	FailureRate *FailureRateConfig
+	// SuccessThreshold is the number of successes needed to close from half-open state (default: 2)
+	SuccessThreshold int
+	// Timeout is how long to wait before attempting to transition from open to half-open (default: 30s)
+	Timeout time.Duration
+	// Scope selects which calls share a breaker (default: BreakerScopeMethod)
+	Scope CircuitBreakerScope
+	// MethodGroups are full method names or prefixes ending in "*" whose matching methods share
+	// a breaker with BreakerScopeMethodGroup; the most specific entry wins (default: nil)
+	MethodGroups []string
+	// MaxHalfOpenRequests is the number of probe calls allowed in flight while half-open; further
+	// calls are rejected until a probe finishes, so a recovering backend is not flooded.
+	// Zero allows any number (default: 1)
+	MaxHalfOpenRequests int
+	// RetryableCodes are the gRPC codes that should be counted as failures
+	RetryableCodes []codes.Code
+	// Fallbacks answer unary calls rejected by an open or half-open breaker instead of failing
+	// them with Unavailable, keyed by full method name or by a prefix ending in "*"; the most
+	// specific entry wins. Rejected streams always fail (default: nil)
+	Fallbacks map[string]FallbackFunc
+	// OnStateChange is called with the breaker lock held whenever a breaker changes state.
+	// It must not block or call back into the breaker (default: nil)
+	OnStateChange func(method string, from, to CircuitBreakerState)
+	// Clock is used to track the open timeout. If nil, the real clock is used
+	Clock clock.Clock
+	// ResetPolicy controls when the failure count is reset after successes (default: immediate)
+	ResetPolicy ResetPolicy
+	// Events receives an event for every state change (default: nil)
+	Events EventSink
+	// Logger receives state change logs. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// FallbackFunc synthesizes a degraded response for a call to method rejected by a circuit breaker
+// with err, e.g. a cached value or an empty result. It fills reply and returns nil, or returns an
+// error to fail the call, such as err itself when it has nothing to offer.
+type FallbackFunc func(ctx context.Context, method string, req, reply interface{}, err error) error
+
+// DefaultCircuitBreakerConfig returns a CircuitBreakerConfig with sensible defaults.
+func DefaultCircuitBreakerConfig() *CircuitBreakerConfig {
+	return &CircuitBreakerConfig{
+		FailureThreshold:    5,
+		SuccessThreshold:    2,
+		Timeout:             30 * time.Second,
+		MaxHalfOpenRequests: 1,
+		RetryableCodes: []codes.Code{
+			codes.Unavailable,
+			codes.DeadlineExceeded,
+			codes.ResourceExhausted,
+		},
+	}
+}
+
+// CircuitBreaker implements the circuit breaker pattern for gRPC calls.
+type CircuitBreaker struct {
+	mu          sync.Mutex
+	state       CircuitBreakerState
+	failures    *failureCounter
+	window      *slidingWindow
+	successes   int
+	lastFailure time.Time
+	config      *CircuitBreakerConfig
+	clock       clock.Clock
+	logger      logger.Logger
+	service     string
+	// forcedOpen holds the breaker open after Trip until Reset
+	forcedOpen bool
+	// onStateChange is called after config.OnStateChange, e.g. by the breaker's group
+	onStateChange func(method string, from, to CircuitBreakerState)
+	// probes is the number of calls in flight since the breaker last became half-open, which
+	// was its halfOpens-th time doing so
+	probes    int
+	halfOpens uint64
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker with the given configuration.
+// If cfg is nil, DefaultCircuitBreakerConfig() is used.
+func NewCircuitBreaker(cfg *CircuitBreakerConfig) *CircuitBreaker {
+	if cfg == nil {
+		cfg = DefaultCircuitBreakerConfig()
+	}
+	cb := &CircuitBreaker{
+		state:    StateClosed,
+		failures: newFailureCounter(cfg.ResetPolicy),
+		config:   cfg,
+		clock:    clock.OrReal(cfg.Clock),
+		logger:   logger.OrDefault(cfg.Logger),
+	}
+	if cfg.FailureRate != nil {
+		cb.window = newSlidingWindow(cfg.FailureRate)
+	}
+	return cb
+}
+
+// resetFailures forgets recorded failures. Must be called with cb.mu held.
+func (cb *CircuitBreaker) resetFailures() {
+	cb.failures.reset()
+	if cb.window != nil {
+		cb.window.reset()
+	}
+}
+
+// shouldOpen reports whether the recorded failures at now warrant opening a closed breaker.
+// Must be called with cb.mu held.
+func (cb *CircuitBreaker) shouldOpen(now time.Time) bool {
+	if cb.window != nil {
+		return cb.window.tripped(now)
+	}
+	return cb.failures.count(now) >= float64(cb.config.FailureThreshold)
+}
+
+// setState transitions the breaker to the given state. Must be called with cb.mu held.
+func (cb *CircuitBreaker) setState(ctx context.Context, method string, to CircuitBreakerState) {
+	from := cb.state
+	cb.state = to
+	if from == to {
+		return
+	}
+	if to == StateHalfOpen {
+		cb.halfOpens++
+		cb.probes = 0
+	}
+	if cb.config.OnStateChange != nil {
+		cb.config.OnStateChange(method, from, to)
+	}
+	if cb.onStateChange != nil {
+		cb.onStateChange(method, from, to)
+	}
+	if cb.config.Events != nil {
+		cb.config.Events.Emit(ctx, Event{
+			Kind:    EventCircuitBreakerTransition,
+			Service: cb.service,
+			Method:  method,
+			From:    from,
+			To:      to,
+		})
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitBreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// trip opens the breaker and holds it open, rejecting every call, until reset.
+func (cb *CircuitBreaker) trip(ctx context.Context, method string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forcedOpen = true
+	cb.lastFailure = cb.clock.Now()
+	cb.setState(ctx, method, StateOpen)
+	cb.logger.Warnf("Circuit breaker tripped manually: method=%s", method)
+}
+
+// reset closes the breaker and forgets its failures.
+func (cb *CircuitBreaker) reset(ctx context.Context, method string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.forcedOpen = false
+	cb.resetFailures()
+	cb.successes = 0
+	cb.setState(ctx, method, StateClosed)
+	cb.logger.Infof("Circuit breaker reset manually: method=%s", method)
+}
+
+// Call runs a unary call through the circuit breaker.
+func (cb *CircuitBreaker) Call(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	probe, err := cb.allow(ctx, method)
+	if err != nil {
+		cb.mu.Lock()
+		fallbacks := cb.config.Fallbacks
+		cb.mu.Unlock()
+		return callFallback(ctx, fallbacks, cb.service, method, req, reply, err, nil)
+	}
+
+	doneBefore := ctx.Err() != nil
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	cb.record(ctx, method, err, doneBefore, probe)
+	return err
+}
+
+// allow returns an error if the breaker rejects a call, moving it from open to half-open
+// once the open timeout has passed. A non-zero probe identifies a half-open probe call and
+// must be passed to record.
+func (cb *CircuitBreaker) allow(ctx context.Context, method string) (probe uint64, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == StateOpen {
+		if cb.forcedOpen || cb.clock.Since(cb.lastFailure) < cb.config.Timeout {
+			cb.logger.Warnf("Circuit breaker is OPEN, rejecting call: method=%s", method)
+			return 0, status.Error(codes.Unavailable, "circuit breaker is open")
+		}
+
+		cb.setState(ctx, method, StateHalfOpen)
+		cb.successes = 0
+		cb.logger.Infof("Circuit breaker transitioning to HALF-OPEN: method=%s", method)
+	}
+
+	if cb.state == StateHalfOpen && cb.config.MaxHalfOpenRequests > 0 {
+		if cb.probes >= cb.config.MaxHalfOpenRequests {
+			cb.logger.Warnf("Circuit breaker is HALF-OPEN with probes in flight, rejecting call: method=%s", method)
+			return 0, status.Error(codes.Unavailable, "circuit breaker is half-open")
+		}
+		cb.probes++
+		return cb.halfOpens, nil
+	}
+	return 0, nil
+}
+
+// record updates the breaker with the outcome of a call. doneBefore reports whether the
+// caller's context was already done when the call started; probe is the value returned by allow.
+func (cb *CircuitBreaker) record(ctx context.Context, method string, err error, doneBefore bool, probe uint64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe != 0 && probe == cb.halfOpens && cb.probes > 0 {
+		cb.probes--
+	}
+
+	if callerAbortReason(ctx, err, doneBefore) != "" {
+		// The caller gave up; this says nothing about the health of the backend.
+		return
+	}
+
+	if err != nil {
+		st, _ := status.FromError(err)
+
+		retryable := false
+		for _, code := range cb.config.RetryableCodes {
+			if st.Code() == code {
+				retryable = true
+				break
+			}
+		}
+
+		if retryable {
+			now := cb.clock.Now()
+			cb.failures.recordFailure(now)
+			if cb.window != nil {
+				cb.window.record(now, true)
+			}
+			cb.lastFailure = now
+
+			if cb.state == StateHalfOpen {
+				cb.setState(ctx, method, StateOpen)
+				cb.resetFailures()
+				cb.logger.Warnf("Circuit breaker transitioning to OPEN: method=%s", method)
+			} else if cb.state == StateClosed && cb.shouldOpen(now) {
+				cb.setState(ctx, method, StateOpen)
+				cb.logger.Warnf("Circuit breaker opened: method=%s, failures=%.0f", method, cb.failures.count(now))
+			}
+		} else if cb.window != nil {
+			// The backend answered; for the failure rate this counts like a success.
+			cb.window.record(cb.clock.Now(), false)
+		}
+
+		return
+	}
+
+	now := cb.clock.Now()
+	cb.failures.recordSuccess(now)
+	if cb.window != nil {
+		cb.window.record(now, false)
+	}
+
+	if cb.state == StateHalfOpen {
+		cb.successes++
+		if cb.successes >= cb.config.SuccessThreshold {
+			cb.setState(ctx, method, StateClosed)
+			cb.resetFailures()
+			cb.logger.Infof("Circuit breaker closed: method=%s", method)
+		}
+	}
+}
+
+// callFallback answers a call rejected with err by the matching entry of fallbacks, or returns err
+// if there is none.
+func callFallback(ctx context.Context, fallbacks map[string]FallbackFunc, serviceName, method string, req, reply interface{}, err error, m metrics.MetricsRecorder) error {
+	_, fallback, ok := lookupMethodKey(fallbacks, method)
+	if !ok || fallback == nil {
+		return err
+	}
+	err = fallback(ctx, method, req, reply, err)
+	if m != nil {
+		m.RecordGRPCFallback(serviceName, method, err == nil)
+	}
+	return err
+}
+
+// CircuitBreakerGroup holds per-method circuit breakers for a service, shared by the unary and
+// stream interceptors it creates so both kinds of call trip the same breaker.
+type CircuitBreakerGroup struct {
+	serviceName string
+	scope       CircuitBreakerScope
+	metrics     metrics.MetricsRecorder
+
+	// methodGroups holds cfg.MethodGroups as a set for lookupMethodKey
+	methodGroups map[string]struct{}
+
+	mu       sync.RWMutex
+	cfg      *CircuitBreakerConfig
+	breakers map[string]*CircuitBreaker
+	// registry is the registry the group belongs to, if any
+	registry atomic.Pointer[CircuitBreakerRegistry]
+}
+
+// NewCircuitBreakerGroup creates a CircuitBreakerGroup for the service.
+func NewCircuitBreakerGroup(serviceName string, cfg *CircuitBreakerConfig, m metrics.MetricsRecorder) *CircuitBreakerGroup {
+	g := &CircuitBreakerGroup{
+		serviceName:  serviceName,
+		scope:        cfg.Scope,
+		cfg:          cfg,
+		metrics:      m,
+		methodGroups: make(map[string]struct{}, len(cfg.MethodGroups)),
+		breakers:     make(map[string]*CircuitBreaker),
+	}
+	for _, pattern := range cfg.MethodGroups {
+		g.methodGroups[pattern] = struct{}{}
+	}
+	return g
+}
+
+// Key returns the key of the breaker that guards method according to the configured scope:
+// the method itself, "*" for the whole service, or the matching entry of MethodGroups. The
+// key is used in place of the method in metrics, logs and state change callbacks.
+func (g *CircuitBreakerGroup) Key(method string) string {
+	switch g.scope {
+	case BreakerScopeService:
+		return "*"
+	case BreakerScopeMethodGroup:
+		if key, _, ok := lookupMethodKey(g.methodGroups, method); ok {
+			return key
+		}
+	}
+	return method
+}
+
+// breaker returns the circuit breaker with the given key, creating it on first use.
+func (g *CircuitBreakerGroup) breaker(method string) *CircuitBreaker {
+	g.mu.RLock()
+	breaker, exists := g.breakers[method]
+	g.mu.RUnlock()
+
+	if exists {
+		return breaker
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// Double-check after acquiring write lock
+	if breaker, exists := g.breakers[method]; exists {
+		return breaker
+	}
+	breaker = NewCircuitBreaker(g.cfg)
+	breaker.service = g.serviceName
+	breaker.onStateChange = func(method string, from, to CircuitBreakerState) {
+		if r := g.registry.Load(); r != nil {
+			r.notify(g.serviceName, method, from, to)
+		}
+	}
+	g.breakers[method] = breaker
+	return breaker
+}
+
+// UpdateConfig changes the FailureThreshold, SuccessThreshold, Timeout, MaxHalfOpenRequests,
+// RetryableCodes and Fallbacks of the group's breakers, keeping their state. The other fields keep the values
+// the group was created with, since they decide which calls share a breaker and how failures are
+// counted.
+func (g *CircuitBreakerGroup) UpdateConfig(cfg *CircuitBreakerConfig) {
+	g.mu.Lock()
+	updated := *g.cfg
+	updated.FailureThreshold = cfg.FailureThreshold
+	updated.SuccessThreshold = cfg.SuccessThreshold
+	updated.Timeout = cfg.Timeout
+	updated.MaxHalfOpenRequests = cfg.MaxHalfOpenRequests
+	updated.RetryableCodes = cfg.RetryableCodes
+	updated.Fallbacks = cfg.Fallbacks
+	g.cfg = &updated
+	breakers := slices.Collect(maps.Values(g.breakers))
+	g.mu.Unlock()
+
+	// g.mu is never held together with a breaker's lock.
+	for _, breaker := range breakers {
+		breaker.mu.Lock()
+		breaker.config = &updated
+		breaker.mu.Unlock()
+	}
+}
+
+// Service returns the name of the service the group belongs to.
+func (g *CircuitBreakerGroup) Service() string {
+	return g.serviceName
+}
+
+// State returns the state of the breaker guarding method. Breakers that have not been used yet are
+// reported as closed with ok false.
+func (g *CircuitBreakerGroup) State(method string) (state CircuitBreakerState, ok bool) {
+	g.mu.RLock()
+	breaker, ok := g.breakers[g.Key(method)]
+	g.mu.RUnlock()
+	if !ok {
+		return StateClosed, false
+	}
+	return breaker.State(), true
+}
+
+// States returns the state of every breaker in the group, keyed by breaker key.
+func (g *CircuitBreakerGroup) States() map[string]CircuitBreakerState {
+	g.mu.RLock()
+	breakers := maps.Clone(g.breakers)
+	g.mu.RUnlock()
+
+	states := make(map[string]CircuitBreakerState, len(breakers))
+	for method, breaker := range breakers {
+		states[method] = breaker.State()
+	}
+	return states
+}
+
+// Trip opens the breaker guarding method and holds it open until Reset, regardless of the open timeout.
+func (g *CircuitBreakerGroup) Trip(method string) {
+	key := g.Key(method)
+	breaker := g.breaker(key)
+	breaker.trip(context.Background(), key)
+	g.updateMetrics(key, breaker)
+}
+
+// Reset closes the breaker guarding method and clears its failures.
+func (g *CircuitBreakerGroup) Reset(method string) {
+	key := g.Key(method)
+	breaker := g.breaker(key)
+	breaker.reset(context.Background(), key)
+	g.updateMetrics(key, breaker)
+}
+
+func (g *CircuitBreakerGroup) updateMetrics(method string, breaker *CircuitBreaker) {
+	if g.metrics == nil {
+		return
+	}
+	breaker.mu.Lock()
+	state := breaker.state
+	breaker.mu.Unlock()
+	g.metrics.UpdateGRPCCircuitBreaker(g.serviceName, method, int(state))
+}
+
+// UnaryInterceptor returns a unary interceptor using the group's breakers.
+func (g *CircuitBreakerGroup) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		key := g.Key(method)
+		breaker := g.breaker(key)
+		probe, err := breaker.allow(ctx, key)
+		if err != nil {
+			g.updateMetrics(key, breaker)
+			g.mu.RLock()
+			fallbacks := g.cfg.Fallbacks
+			g.mu.RUnlock()
+			return callFallback(ctx, fallbacks, g.serviceName, method, req, reply, err, g.metrics)
+		}
+
+		doneBefore := ctx.Err() != nil
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		breaker.record(ctx, key, err, doneBefore, probe)
+		g.updateMetrics(key, breaker)
+
+		if err == nil && reply == nil {
+			return status.Error(codes.Internal, "grpc reply is nil (circuit breaker interceptor bug)")
+		}
+
+		return err
+	}
+}
+
+// StreamInterceptor returns a stream interceptor using the group's breakers. A stream counts
+// as a failure if it cannot be created or ends with a failure status; it counts as a success
+// once it ends cleanly. A stream whose context is done before it ends counts like any call the
+// caller gave up on.
+func (g *CircuitBreakerGroup) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		key := g.Key(method)
+		breaker := g.breaker(key)
+		probe, err := breaker.allow(ctx, key)
+		if err != nil {
+			g.updateMetrics(key, breaker)
+			return nil, err
+		}
+
+		doneBefore := ctx.Err() != nil
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			breaker.record(ctx, key, err, doneBefore, probe)
+			g.updateMetrics(key, breaker)
+			return nil, err
+		}
+
+		// A stream that is canceled or abandoned before it ends must still release its half-open
+		// probe, or the breaker would reject every later call.
+		var once sync.Once
+		finish := func(err error) {
+			once.Do(func() {
+				breaker.record(ctx, key, err, doneBefore, probe)
+				g.updateMetrics(key, breaker)
+			})
+		}
+		stop := context.AfterFunc(ctx, func() { finish(status.FromContextError(ctx.Err()).Err()) })
+		return &observedStream{ClientStream: stream, singleResponse: !desc.ServerStreams, onFinish: func(err error) {
+			stop()
+			finish(err)
+		}}, nil
+	}
+}
+
+// CircuitBreakerInterceptor creates a circuit breaker interceptor for gRPC unary calls.
+// It creates a separate circuit breaker for each method, or as selected by cfg.Scope.
+func CircuitBreakerInterceptor(serviceName string, cfg *CircuitBreakerConfig, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return NewCircuitBreakerGroup(serviceName, cfg, m).UnaryInterceptor()
+}
+
+// CircuitBreakerStreamInterceptor creates a circuit breaker interceptor for gRPC stream calls.
+// It creates a separate circuit breaker for each method, or as selected by cfg.Scope.
+func CircuitBreakerStreamInterceptor(serviceName string, cfg *CircuitBreakerConfig, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	return NewCircuitBreakerGroup(serviceName, cfg, m).StreamInterceptor()
+}
@@ -0,0 +1,488 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDefaultCircuitBreakerConfig(t *testing.T) {
+	cfg := DefaultCircuitBreakerConfig()
+	if cfg == nil {
+		t.Fatal("DefaultCircuitBreakerConfig returned nil")
+	}
+	if cfg.FailureThreshold <= 0 {
+		t.Error("FailureThreshold should be positive")
+	}
+	if cfg.SuccessThreshold <= 0 {
+		t.Error("SuccessThreshold should be positive")
+	}
+	if cfg.Timeout <= 0 {
+		t.Error("Timeout should be positive")
+	}
+}
+
+func TestNewCircuitBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(nil)
+	if cb == nil {
+		t.Fatal("NewCircuitBreaker returned nil")
+	}
+
+	cfg := DefaultCircuitBreakerConfig()
+	cb = NewCircuitBreaker(cfg)
+	if cb == nil {
+		t.Fatal("NewCircuitBreaker returned nil")
+	}
+}
+
+func TestCircuitBreaker_StateTransitions(t *testing.T) {
+	cfg := &CircuitBreakerConfig{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		Timeout:          time.Second,
+		RetryableCodes:   []codes.Code{codes.Unavailable},
+	}
+	cb := NewCircuitBreaker(cfg)
+
+	// Test initial state
+	if cb.state != StateClosed {
+		t.Errorf("Expected initial state to be Closed, got %v", cb.state)
+	}
+
+	// Simulate failures to open circuit
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "service unavailable")
+	}
+
+	ctx := context.Background()
+	for i := 0; i < cfg.FailureThreshold; i++ {
+		_ = cb.Call(ctx, "test", nil, nil, nil, invoker)
+	}
+
+	// Circuit should be open now
+	if cb.state != StateOpen {
+		t.Errorf("Expected circuit to be Open after %d failures, got %v", cfg.FailureThreshold, cb.state)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAfterTimeout(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := &CircuitBreakerConfig{
+		FailureThreshold: 1,
+		SuccessThreshold: 1,
+		Timeout:          time.Minute,
+		RetryableCodes:   []codes.Code{codes.Unavailable},
+		Clock:            clk,
+	}
+	cb := NewCircuitBreaker(cfg)
+
+	calls := 0
+	fail := true
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if fail {
+			return status.Error(codes.Unavailable, "service unavailable")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	_ = cb.Call(ctx, "test", nil, nil, nil, invoker)
+	if cb.state != StateOpen {
+		t.Fatalf("Expected circuit to be Open, got %v", cb.state)
+	}
+
+	// Calls are rejected until the timeout elapses
+	clk.Advance(30 * time.Second)
+	_ = cb.Call(ctx, "test", nil, nil, nil, invoker)
+	if calls != 1 {
+		t.Errorf("Expected open circuit to reject call, invoker called %d times", calls)
+	}
+
+	fail = false
+	clk.Advance(30 * time.Second)
+	if err := cb.Call(ctx, "test", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Expected probe call to succeed, got %v", err)
+	}
+	if cb.state != StateClosed {
+		t.Errorf("Expected circuit to be Closed after successful probe, got %v", cb.state)
+	}
+}
+
+func TestCircuitBreaker_IgnoresCallerAborts(t *testing.T) {
+	cfg := &CircuitBreakerConfig{
+		FailureThreshold: 1,
+		SuccessThreshold: 1,
+		Timeout:          time.Second,
+		RetryableCodes:   []codes.Code{codes.DeadlineExceeded},
+	}
+	cb := NewCircuitBreaker(cfg)
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_ = cb.Call(ctx, "test", nil, nil, nil, invoker)
+
+	if cb.state != StateClosed {
+		t.Errorf("Expected caller deadline not to open circuit, got %v", cb.state)
+	}
+}
+
+// failingStream is a client stream whose RecvMsg fails with err.
+type failingStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *failingStream) RecvMsg(m interface{}) error { return s.err }
+
+func TestCircuitBreakerGroup_StreamFailuresShareBreaker(t *testing.T) {
+	cfg := &CircuitBreakerConfig{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		Timeout:          time.Minute,
+		RetryableCodes:   []codes.Code{codes.Unavailable},
+	}
+	group := NewCircuitBreakerGroup("test", cfg, nil)
+	streamInterceptor := group.StreamInterceptor()
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &failingStream{err: status.Error(codes.Unavailable, "unavailable")}, nil
+	}
+	desc := &grpc.StreamDesc{ServerStreams: true}
+
+	for i := 0; i < 2; i++ {
+		stream, err := streamInterceptor(context.Background(), desc, nil, "/test.Service/Watch", streamer)
+		if err != nil {
+			t.Fatalf("stream creation failed: %v", err)
+		}
+		_ = stream.RecvMsg(nil)
+	}
+
+	// The unary interceptor shares the breaker, so it must now reject calls.
+	invoked := false
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked = true
+		return nil
+	}
+	err := group.UnaryInterceptor()(context.Background(), "/test.Service/Watch", nil, struct{}{}, nil, invoker)
+	if status.Code(err) != codes.Unavailable || invoked {
+		t.Errorf("expected the open breaker to reject the call, got err=%v invoked=%v", err, invoked)
+	}
+}
+
+func TestCircuitBreaker_ResetPolicy(t *testing.T) {
+	ok := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	tests := []struct {
+		name   string
+		policy ResetPolicy
+		want   CircuitBreakerState
+	}{
+		{"immediate", ResetPolicy{Mode: ResetImmediate}, StateClosed},
+		{"after successes", ResetPolicy{Mode: ResetAfterSuccesses, Successes: 2}, StateOpen},
+		{"decay", ResetPolicy{Mode: ResetDecay, HalfLife: time.Hour}, StateOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCircuitBreakerConfig()
+			cfg.FailureThreshold = 3
+			cfg.ResetPolicy = tt.policy
+			cfg.Clock = testutil.NewFakeClock(time.Now())
+			cb := NewCircuitBreaker(cfg)
+
+			// A success in the middle of an outage resets the failures only with ResetImmediate.
+			for _, invoker := range []grpc.UnaryInvoker{failing, failing, ok, failing} {
+				_ = cb.Call(context.Background(), "test", nil, nil, nil, invoker)
+			}
+			if got := cb.State(); got != tt.want {
+				t.Errorf("State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_FailureRate(t *testing.T) {
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.FailureThreshold = 0
+	cfg.FailureRate = &FailureRateConfig{Threshold: 0.5, MinimumRequests: 4, WindowSize: 4}
+	cb := NewCircuitBreaker(cfg)
+
+	ok := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	ctx := context.Background()
+	// Interleaved failures never reach a count threshold, but half the calls fail.
+	for _, invoker := range []grpc.UnaryInvoker{ok, failing, ok} {
+		_ = cb.Call(ctx, "test", nil, nil, nil, invoker)
+	}
+	if cb.State() != StateClosed {
+		t.Fatalf("Expected breaker to stay closed below MinimumRequests, got %v", cb.State())
+	}
+	_ = cb.Call(ctx, "test", nil, nil, nil, failing)
+	if cb.State() != StateOpen {
+		t.Errorf("Expected breaker to open at a 50%% failure rate, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreaker_FailureRateTimeWindow(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.Clock = clk
+	cfg.FailureRate = &FailureRateConfig{Threshold: 0.5, MinimumRequests: 2, WindowDuration: 10 * time.Second}
+	cb := NewCircuitBreaker(cfg)
+
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	ctx := context.Background()
+	_ = cb.Call(ctx, "test", nil, nil, nil, failing)
+	clk.Advance(time.Minute)
+	_ = cb.Call(ctx, "test", nil, nil, nil, failing)
+	if cb.State() != StateClosed {
+		t.Fatalf("Expected failures outside the window to be forgotten, got %v", cb.State())
+	}
+	_ = cb.Call(ctx, "test", nil, nil, nil, failing)
+	if cb.State() != StateOpen {
+		t.Errorf("Expected breaker to open with two failures in the window, got %v", cb.State())
+	}
+}
+
+func TestCircuitBreaker_MaxHalfOpenRequests(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.FailureThreshold = 1
+	cfg.SuccessThreshold = 2
+	cfg.Timeout = time.Minute
+	cfg.Clock = clk
+	cb := NewCircuitBreaker(cfg)
+
+	ctx := context.Background()
+	_ = cb.Call(ctx, "test", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "service unavailable")
+	})
+	clk.Advance(time.Minute)
+
+	// Hold the single probe in flight and check that a concurrent call is rejected.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	probeDone := make(chan error)
+	go func() {
+		probeDone <- cb.Call(ctx, "test", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ok := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	if err := cb.Call(ctx, "test", nil, nil, nil, ok); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected a second half-open call to be rejected, got %v", err)
+	}
+
+	close(release)
+	if err := <-probeDone; err != nil {
+		t.Fatalf("Expected probe to succeed, got %v", err)
+	}
+	if err := cb.Call(ctx, "test", nil, nil, nil, ok); err != nil {
+		t.Errorf("Expected the next probe to be allowed once the first finished, got %v", err)
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("Expected breaker to close after %d probes, got %v", cfg.SuccessThreshold, cb.State())
+	}
+}
+
+func TestCircuitBreakerGroup_Scope(t *testing.T) {
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	tests := []struct {
+		name   string
+		scope  CircuitBreakerScope
+		groups []string
+		// method is called after "/orders.Orders/GetOrder" opened its breaker
+		method string
+		open   bool
+	}{
+		{"method", BreakerScopeMethod, nil, "/orders.Orders/GetQuote", false},
+		{"service", BreakerScopeService, nil, "/orders.Orders/CreateOrder", true},
+		{"same group", BreakerScopeMethodGroup, []string{"/orders.Orders/Get*"}, "/orders.Orders/GetQuote", true},
+		{"other group", BreakerScopeMethodGroup, []string{"/orders.Orders/Get*"}, "/orders.Orders/CreateOrder", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCircuitBreakerConfig()
+			cfg.FailureThreshold = 1
+			cfg.Scope = tt.scope
+			cfg.MethodGroups = tt.groups
+			group := NewCircuitBreakerGroup("orders", cfg, nil)
+
+			_ = group.UnaryInterceptor()(context.Background(), "/orders.Orders/GetOrder", nil, nil, nil, failing)
+			state, _ := group.State(tt.method)
+			if got := state == StateOpen; got != tt.open {
+				t.Errorf("Expected %s breaker open=%v, got state %v", tt.method, tt.open, state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerGroup_UpdateConfig(t *testing.T) {
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.FailureThreshold = 5
+	group := NewCircuitBreakerGroup("orders", cfg, nil)
+	interceptor := group.UnaryInterceptor()
+
+	_ = interceptor(context.Background(), "/orders.Orders/GetOrder", nil, nil, nil, failing)
+	_ = interceptor(context.Background(), "/orders.Orders/GetOrder", nil, nil, nil, failing)
+
+	updated := DefaultCircuitBreakerConfig()
+	updated.FailureThreshold = 3
+	group.UpdateConfig(updated)
+	if cfg.FailureThreshold != 5 {
+		t.Error("UpdateConfig must not modify the original config")
+	}
+
+	// With the two failures recorded before the update, a third reaches the new threshold.
+	_ = interceptor(context.Background(), "/orders.Orders/GetOrder", nil, nil, nil, failing)
+	if state, _ := group.State("/orders.Orders/GetOrder"); state != StateOpen {
+		t.Errorf("Expected the breaker to open with the updated threshold, got %v", state)
+	}
+}
+
+func TestCircuitBreakerGroup_Fallbacks(t *testing.T) {
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		return nil
+	}
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.Scope = BreakerScopeService
+	cfg.Fallbacks = map[string]FallbackFunc{
+		"/orders.Orders/Get*": func(ctx context.Context, method string, req, reply interface{}, err error) error {
+			*reply.(*string) = "cached"
+			return nil
+		},
+		"/orders.Orders/GetQuote": func(ctx context.Context, method string, req, reply interface{}, err error) error {
+			return status.Error(codes.Unavailable, "no cached quote")
+		},
+	}
+	reg := prometheus.NewRegistry()
+	group := NewCircuitBreakerGroup("orders", cfg, metrics.NewMetricsWithRegistry(reg, "", nil))
+	interceptor := group.UnaryInterceptor()
+	group.Trip("*")
+
+	var reply string
+	if err := interceptor(context.Background(), "/orders.Orders/GetOrder", nil, &reply, nil, invoker); err != nil || reply != "cached" {
+		t.Errorf("Expected the fallback response, got %q, %v", reply, err)
+	}
+	if err := interceptor(context.Background(), "/orders.Orders/GetQuote", nil, &reply, nil, invoker); status.Convert(err).Message() != "no cached quote" {
+		t.Errorf("Expected the most specific fallback's error, got %v", err)
+	}
+	if err := interceptor(context.Background(), "/orders.Orders/CreateOrder", nil, &reply, nil, invoker); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable without a fallback, got %v", err)
+	}
+	if invoked != 0 {
+		t.Errorf("Expected no call to reach the invoker while open, got %d", invoked)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	results := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != "grpc_client_fallbacks_total" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "result" {
+					results[l.GetValue()] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if results[metrics.FallbackServed] != 1 || results[metrics.FallbackFailed] != 1 {
+		t.Errorf("Expected one served and one failed fallback, got %v", results)
+	}
+
+	// Once the breaker closes, calls reach the backend again.
+	group.Reset("*")
+	if err := interceptor(context.Background(), "/orders.Orders/GetOrder", nil, &reply, nil, invoker); err != nil || invoked != 1 {
+		t.Errorf("Expected the call to reach the invoker once closed, got %v after %d calls", err, invoked)
+	}
+}
+
+func TestCircuitBreakerGroup_CanceledStreamProbe(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.FailureThreshold = 1
+	cfg.SuccessThreshold = 1
+	cfg.Timeout = time.Minute
+	cfg.Clock = clk
+	cfg.Scope = BreakerScopeService
+	group := NewCircuitBreakerGroup("orders", cfg, nil)
+
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	_ = group.UnaryInterceptor()(context.Background(), "/orders.Orders/Get", nil, nil, nil, failing)
+	clk.Advance(time.Minute)
+
+	// The stream takes the only half-open probe and is canceled without being read.
+	ctx, cancel := context.WithCancel(context.Background())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+	if _, err := group.StreamInterceptor()(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/orders.Orders/Watch", streamer); err != nil {
+		t.Fatalf("Expected the probe stream to be allowed, got %v", err)
+	}
+	cancel()
+
+	ok := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		var reply struct{}
+		err := group.UnaryInterceptor()(context.Background(), "/orders.Orders/Get", nil, &reply, nil, ok)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the canceled probe to be released, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if state, _ := group.State("/orders.Orders/Get"); state != StateClosed {
+		t.Errorf("Expected the breaker to recover and close, got %v", state)
+	}
+}
@@ -0,0 +1,32 @@
+package interceptors
+
+import (
+	"context"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// CompressionInterceptor creates an interceptor that compresses unary requests with the named
+// compressor only when their serialized size is at least threshold bytes. Compressing small
+// messages costs CPU and usually makes them larger. Requests that are not proto messages are
+// always compressed.
+func CompressionInterceptor(serviceName, compressor string, threshold int, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		compress := true
+		if msg, ok := req.(proto.Message); ok {
+			compress = proto.Size(msg) >= threshold
+		}
+
+		if m != nil {
+			m.RecordGRPCCompression(serviceName, method, compress)
+		}
+
+		if compress {
+			opts = append(opts, grpc.UseCompressor(compressor))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,66 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestCompressionInterceptor(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := CompressionInterceptor("health", "gzip", 16, metrics.NewMetricsWithRegistry(reg, "", nil))
+
+	// compressor returns the compressor the call was sent with, or "" if it was not compressed.
+	compressor := func(method string, req interface{}) string {
+		var name string
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			for _, opt := range opts {
+				if c, ok := opt.(grpc.CompressorCallOption); ok {
+					name = c.CompressorType
+				}
+			}
+			return nil
+		}
+		if err := interceptor(context.Background(), method, req, &healthpb.HealthCheckResponse{}, nil, invoker); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		return name
+	}
+
+	small := &healthpb.HealthCheckRequest{Service: "orders"}
+	large := &healthpb.HealthCheckRequest{Service: strings.Repeat("orders", 4)}
+	if got := compressor("/grpc.health.v1.Health/Check", small); got != "" {
+		t.Errorf("Expected a request below the threshold to be sent uncompressed, got %q", got)
+	}
+	if got := compressor("/grpc.health.v1.Health/Check", large); got != "gzip" {
+		t.Errorf("Expected a request above the threshold to be compressed with gzip, got %q", got)
+	}
+	if got := compressor("/grpc.health.v1.Health/Watch", large); got != "gzip" {
+		t.Errorf("Expected the decision to be made for every method, got %q", got)
+	}
+	// Requests whose size is unknown are always compressed.
+	if got := compressor("/grpc.health.v1.Health/Check", "raw"); got != "gzip" {
+		t.Errorf("Expected a non-proto request to be compressed, got %q", got)
+	}
+
+	want := `
+# HELP grpc_client_messages_compressed_total Total number of gRPC requests sent compressed
+# TYPE grpc_client_messages_compressed_total counter
+grpc_client_messages_compressed_total{method="/grpc.health.v1.Health/Check",service="health"} 2
+grpc_client_messages_compressed_total{method="/grpc.health.v1.Health/Watch",service="health"} 1
+# HELP grpc_client_messages_uncompressed_total Total number of gRPC requests sent uncompressed because they were below the compression threshold
+# TYPE grpc_client_messages_uncompressed_total counter
+grpc_client_messages_uncompressed_total{method="/grpc.health.v1.Health/Check",service="health"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"grpc_client_messages_compressed_total", "grpc_client_messages_uncompressed_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/rand"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// DefaultCorrelationHeader is the metadata key correlation IDs are read from and sent in.
+const DefaultCorrelationHeader = "x-request-id"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation ID of the work being done,
+// sent with every call made with it by CorrelationInterceptor.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID stored in ctx, or an empty string if none is set.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// CorrelationConfig configures correlation ID propagation.
+type CorrelationConfig struct {
+	// Header is the metadata key of the correlation ID (default: "x-request-id")
+	Header string
+	// Generate returns a new correlation ID for calls that have none. If nil, a random
+	// 26-character ID is generated
+	Generate func() string
+}
+
+// DefaultCorrelationConfig returns a CorrelationConfig with sensible defaults.
+func DefaultCorrelationConfig() *CorrelationConfig {
+	return &CorrelationConfig{
+		Header:   DefaultCorrelationHeader,
+		Generate: rand.Text,
+	}
+}
+
+// outgoing returns ctx carrying the call's correlation ID and sending it. The ID is, in order:
+// the one set with WithCorrelationID, the one already in the outgoing metadata, the one of the
+// inbound call being served, or a new one.
+func (cfg *CorrelationConfig) outgoing(ctx context.Context) context.Context {
+	header := cfg.Header
+	if header == "" {
+		header = DefaultCorrelationHeader
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	sent := md.Get(header)
+
+	id := CorrelationIDFromContext(ctx)
+	if id == "" {
+		if inbound := metadata.ValueFromIncomingContext(ctx, header); len(sent) > 0 {
+			id = sent[0]
+		} else if len(inbound) > 0 {
+			id = inbound[0]
+		} else if cfg.Generate != nil {
+			id = cfg.Generate()
+		} else {
+			id = rand.Text()
+		}
+		ctx = WithCorrelationID(ctx, id)
+	}
+	if len(sent) == 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, header, id)
+	}
+	return ctx
+}
+
+// CorrelationInterceptor creates an interceptor that sends a correlation ID with every unary call,
+// propagating the one of the inbound call being served or generating one. The ID is stored in the
+// call's context for the interceptors after it, so the logging interceptor includes it in its
+// log lines when placed after this one.
+func CorrelationInterceptor(cfg *CorrelationConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(cfg.outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// CorrelationStreamInterceptor is the stream counterpart of CorrelationInterceptor.
+func CorrelationStreamInterceptor(cfg *CorrelationConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(cfg.outgoing(ctx), desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,62 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCorrelationInterceptor(t *testing.T) {
+	interceptor := CorrelationInterceptor(&CorrelationConfig{Header: "x-correlation-id", Generate: func() string { return "generated" }})
+
+	var sent, stored string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = strings.Join(md.Get("x-correlation-id"), ",")
+		stored = CorrelationIDFromContext(ctx)
+		return nil
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"generated", context.Background(), "generated"},
+		{"inbound", metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "inbound")), "inbound"},
+		{"context", WithCorrelationID(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "inbound")), "set"), "set"},
+		{"outgoing", metadata.AppendToOutgoingContext(context.Background(), "x-correlation-id", "caller"), "caller"},
+	}
+	for _, tt := range tests {
+		_ = interceptor(tt.ctx, "/orders.Orders/Get", nil, nil, nil, invoker)
+		if sent != tt.want || stored != tt.want {
+			t.Errorf("%s: expected correlation ID %q to be sent and stored, got %q and %q", tt.name, tt.want, sent, stored)
+		}
+	}
+}
+
+func TestLoggingInterceptor_CorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	chain := func(ctx context.Context) {
+		logging := NewLoggingInterceptor(l)
+		_ = CorrelationInterceptor(DefaultCorrelationConfig())(ctx, "/orders.Orders/Get", nil, nil, nil,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return logging(ctx, method, req, reply, cc, func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+					return nil
+				}, opts...)
+			})
+	}
+
+	chain(metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultCorrelationHeader, "req-42")))
+	if !strings.Contains(buf.String(), "correlation_id=req-42") {
+		t.Errorf("expected the log line to carry the correlation ID, got %q", buf.String())
+	}
+}
@@ -0,0 +1,38 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeadlineBudgetInterceptor creates an interceptor that moves the deadline of outgoing calls,
+// usually inherited from the inbound call being served, margin earlier. This leaves the caller
+// time to handle the response or the failure before its own deadline. Calls with no more than
+// margin left are rejected with DeadlineExceeded without being sent, since their response would
+// arrive too late to be used. Calls without a deadline are left unchanged.
+func DeadlineBudgetInterceptor(serviceName string, margin time.Duration, clk clock.Clock, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	clk = clock.OrReal(clk)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if left := deadline.Sub(clk.Now()); left <= margin {
+			if m != nil {
+				m.IncrementGRPCBlocked(serviceName, method, "deadline_budget")
+			}
+			return status.Errorf(codes.DeadlineExceeded, "deadline budget of %s exhausted: %v left, %v needed as safety margin", serviceName, left.Round(time.Millisecond), margin)
+		}
+		ctx, cancel := context.WithDeadline(ctx, deadline.Add(-margin))
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,51 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineBudgetInterceptor(t *testing.T) {
+	now := time.Now()
+	clk := testutil.NewFakeClock(now)
+	interceptor := DeadlineBudgetInterceptor("reports", 50*time.Millisecond, clk, nil)
+
+	var deadline time.Time
+	var hasDeadline, invoked bool
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, hasDeadline = ctx.Deadline()
+		invoked = true
+		return nil
+	}
+
+	parent, cancel := context.WithDeadline(context.Background(), now.Add(time.Hour))
+	defer cancel()
+	if err := interceptor(parent, "/reports.Reports/Get", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := now.Add(time.Hour - 50*time.Millisecond); !hasDeadline || !deadline.Equal(want) {
+		t.Errorf("expected the deadline to move to %v, got %v (set=%v)", want, deadline, hasDeadline)
+	}
+
+	_ = interceptor(context.Background(), "/reports.Reports/Get", nil, nil, nil, invoker)
+	if hasDeadline {
+		t.Error("expected calls without a deadline to stay without one")
+	}
+
+	invoked = false
+	clk.Advance(time.Hour - 40*time.Millisecond)
+	err := interceptor(parent, "/reports.Reports/Get", nil, nil, nil, invoker)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded with less time left than the margin, got %v", err)
+	}
+	if invoked {
+		t.Error("expected the call not to be sent")
+	}
+}
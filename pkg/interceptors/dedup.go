@@ -0,0 +1,110 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// DedupConfig holds configuration for coalescing identical concurrent unary calls.
+type DedupConfig struct {
+	// Methods are full method names, or prefixes ending in "*", whose identical concurrent calls
+	// share one RPC. List only idempotent methods whose callers may share a response
+	Methods []string
+	// KeyMetadata are outgoing metadata keys whose values must also match for calls to be
+	// coalesced, such as "authorization", so that callers with different identities do not share
+	// responses (default: nil)
+	KeyMetadata []string
+}
+
+// Deduplicator coalesces identical concurrent unary calls, with the same method, request and
+// DedupConfig.KeyMetadata, into one RPC whose response is shared by all of them.
+type Deduplicator struct {
+	methods     []string
+	keyMetadata []string
+	calls       singleflight.Group
+}
+
+// NewDeduplicator creates a Deduplicator.
+func NewDeduplicator(cfg *DedupConfig) *Deduplicator {
+	return &Deduplicator{methods: cfg.Methods, keyMetadata: cfg.KeyMetadata}
+}
+
+// dedupResult is the outcome of a shared call: the marshaled response, and the token of the caller
+// whose call was sent. Tokens are bytes rather than empty structs, whose pointers may all be equal.
+type dedupResult struct {
+	value []byte
+	owner *byte
+}
+
+// DedupInterceptor creates an interceptor that sends one RPC for identical calls to the
+// deduplicator's methods made while one is in flight, such as a stampede of requests for the same
+// key after a cache expired. Every caller gets a copy of the response, or the error, of the call
+// sent. Only calls whose request and reply are protocol buffer messages are coalesced, and the
+// call options of the calls joining another, such as grpc.Header, are not applied. A caller whose
+// context is done stops waiting; if the call sent fails because its own caller's context was done,
+// the others send their call themselves.
+func DedupInterceptor(serviceName string, d *Deduplicator, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		reqMsg, reqOK := req.(proto.Message)
+		replyMsg, replyOK := reply.(proto.Message)
+		if !reqOK || !replyOK || !matchAnyMethod(d.methods, method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := requestKey(ctx, method, reqMsg, d.keyMetadata)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		// The call is made into a reply of its own, so that a caller that stops waiting does not
+		// have its reply written to afterwards.
+		owner := new(byte)
+		ch := d.calls.DoChan(string(key[:]), func() (interface{}, error) {
+			shared := replyMsg.ProtoReflect().New().Interface()
+			if err := invoker(ctx, method, req, shared, cc, opts...); err != nil {
+				return &dedupResult{owner: owner}, err
+			}
+			value, err := proto.Marshal(shared)
+			return &dedupResult{value: value, owner: owner}, err
+		})
+
+		var res singleflight.Result
+		select {
+		case res = <-ch:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		result := res.Val.(*dedupResult)
+		if result.owner != owner {
+			if m != nil {
+				m.IncrementGRPCDeduplicated(serviceName, method)
+			}
+			if isContextError(res.Err) && ctx.Err() == nil {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			}
+		}
+		if res.Err != nil {
+			return res.Err
+		}
+		if err := proto.Unmarshal(result.value, replyMsg); err != nil {
+			return status.Errorf(codes.Internal, "failed to copy shared response: %v", err)
+		}
+		return nil
+	}
+}
+
+// isContextError reports whether err is the error of a call whose context was done.
+func isContextError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Canceled || code == codes.DeadlineExceeded
+}
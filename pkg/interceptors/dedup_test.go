@@ -0,0 +1,102 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDedupInterceptor(t *testing.T) {
+	interceptor := DedupInterceptor("health", NewDeduplicator(&DedupConfig{Methods: []string{"/grpc.health.v1.Health/*"}}), nil)
+
+	var invoked atomic.Int32
+	release := make(chan struct{})
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+	call := func(ctx context.Context, service string) (*healthpb.HealthCheckResponse, error) {
+		reply := &healthpb.HealthCheckResponse{}
+		err := interceptor(ctx, "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{Service: service}, reply, nil, invoker)
+		return reply, err
+	}
+
+	var wg sync.WaitGroup
+	replies := make([]*healthpb.HealthCheckResponse, 5)
+	for i := range replies {
+		wg.Go(func() {
+			reply, err := call(context.Background(), "orders")
+			if err != nil {
+				t.Errorf("call %d failed: %v", i, err)
+			}
+			replies[i] = reply
+		})
+	}
+	// Let the calls join the first one before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := invoked.Load(); got != 1 {
+		t.Errorf("Expected one RPC for 5 identical calls, got %d", got)
+	}
+	for i, reply := range replies {
+		if reply.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("call %d got %v, want the shared SERVING response", i, reply.GetStatus())
+		}
+	}
+
+	// Calls made after the first completed send their own RPC.
+	if _, err := call(context.Background(), "orders"); err != nil || invoked.Load() != 2 {
+		t.Errorf("Expected a new RPC once the first completed, got %d RPCs, %v", invoked.Load(), err)
+	}
+}
+
+func TestDedupInterceptor_CanceledLeader(t *testing.T) {
+	interceptor := DedupInterceptor("health", NewDeduplicator(&DedupConfig{Methods: []string{"/grpc.health.v1.Health/Check"}}), nil)
+
+	var invoked atomic.Int32
+	started := make(chan struct{}, 2)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if invoked.Add(1) == 1 {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		leaderDone <- interceptor(ctx, "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}, nil, invoker)
+	}()
+	<-started
+
+	followerDone := make(chan error, 1)
+	reply := &healthpb.HealthCheckResponse{}
+	go func() {
+		followerDone <- interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{}, reply, nil, invoker)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderDone; err == nil {
+		t.Error("Expected the canceled call to fail")
+	}
+	if err := <-followerDone; err != nil || reply.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected the joined call to send its own RPC, got %v, %v", reply.Status, err)
+	}
+}
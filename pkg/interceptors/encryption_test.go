@@ -0,0 +1,44 @@
+package interceptors
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newTestAEAD(t *testing.T) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("aes.NewCipher failed: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM failed: %v", err)
+	}
+	return aead
+}
+
+func TestEncryptionCodec_RoundTrip(t *testing.T) {
+	codec := NewEncryptionCodec(newTestAEAD(t))
+
+	data, err := codec.Marshal(wrapperspb.String("secret"))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	got := &wrapperspb.StringValue{}
+	if err := codec.Unmarshal(data, got); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got.GetValue() != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", got.GetValue())
+	}
+
+	data[len(data)-1] ^= 0xff
+	if err := codec.Unmarshal(data, got); err == nil {
+		t.Error("Expected error for tampered ciphertext")
+	}
+}
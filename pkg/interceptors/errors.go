@@ -0,0 +1,34 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons returned by callerAbortReason.
+const (
+	abortCanceled         = "canceled"
+	abortDeadlineExceeded = "deadline_exceeded"
+)
+
+// callerAbortReason reports whether err was caused by the caller rather than the server:
+// a cancellation of the caller's context, or a DeadlineExceeded for a context that was already
+// done before the call was invoked. It returns the reason, or "" for genuine call failures.
+func callerAbortReason(ctx context.Context, err error, doneBefore bool) string {
+	if err == nil {
+		return ""
+	}
+	switch status.Code(err) {
+	case codes.Canceled:
+		if ctx.Err() != nil {
+			return abortCanceled
+		}
+	case codes.DeadlineExceeded:
+		if doneBefore {
+			return abortDeadlineExceeded
+		}
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EventKind identifies the kind of an interceptor event.
+type EventKind string
+
+const (
+	// EventCallFailed is emitted when a call returns an error to the caller.
+	EventCallFailed EventKind = "call_failed"
+	// EventRetry is emitted before a failed attempt is retried.
+	EventRetry EventKind = "retry"
+	// EventCircuitBreakerTransition is emitted when a circuit breaker changes state. A breaker
+	// opening is a transition with To set to StateOpen.
+	EventCircuitBreakerTransition EventKind = "circuit_breaker_transition"
+	// EventRetryExhausted is emitted when a call fails with a retryable error on its last attempt.
+	EventRetryExhausted EventKind = "retry_exhausted"
+
+	// EventConnCreated is emitted when the connection manager creates a connection for a service.
+	EventConnCreated EventKind = "conn_created"
+	// EventConnReady is emitted when a service's connection is seen becoming Ready.
+	EventConnReady EventKind = "conn_ready"
+	// EventConnTransientFailure is emitted when a service's connection is seen entering TransientFailure.
+	EventConnTransientFailure EventKind = "conn_transient_failure"
+	// EventConnClosed is emitted when the connection manager closes a service's connection.
+	EventConnClosed EventKind = "conn_closed"
+)
+
+// Event is a structured record of something notable an interceptor did.
+type Event struct {
+	Kind    EventKind
+	Service string
+	Method  string
+	// Code is the gRPC status code of the failed call or attempt
+	Code codes.Code
+	// Err is the error of the failed call or attempt
+	Err error
+	// Duration is the call duration for EventCallFailed and the backoff for EventRetry
+	Duration time.Duration
+	// Attempt is the attempt number that failed, for EventRetry and EventRetryExhausted
+	Attempt int
+	// From and To are the breaker states, for EventCircuitBreakerTransition
+	From, To CircuitBreakerState
+	// Address is the address the connection was dialed with, for connection events
+	Address string
+}
+
+// EventSink receives interceptor events. The context is the call's context, so sinks
+// can correlate events with the active trace. Emit must not block.
+type EventSink interface {
+	Emit(ctx context.Context, e Event)
+}
+
+// EventInterceptor emits an EventCallFailed event to sink for every failed call.
+func EventInterceptor(serviceName string, sink EventSink) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			sink.Emit(ctx, Event{
+				Kind:     EventCallFailed,
+				Service:  serviceName,
+				Method:   method,
+				Code:     status.Code(err),
+				Err:      err,
+				Duration: time.Since(start),
+			})
+		}
+		return err
+	}
+}
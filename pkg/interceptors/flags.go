@@ -0,0 +1,190 @@
+package interceptors
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+)
+
+// Feature flag names understood by the connection manager.
+const (
+	FlagLogging        = "logging"
+	FlagRetry          = "retry"
+	FlagCircuitBreaker = "circuit_breaker"
+	FlagCompression    = "compression"
+	FlagAudit          = "audit"
+	FlagHedging        = "hedging"
+)
+
+// Feature weight names understood by the connection manager.
+const (
+	// FlagCanaryWeight overrides ServiceConfig.CanaryWeight
+	FlagCanaryWeight = "canary_weight"
+)
+
+// FlagAllServices is the service name used for flags that apply to every service.
+const FlagAllServices = "*"
+
+// FlagProvider reports whether a feature is enabled for a service.
+// It is consulted on every call, so implementations should answer from memory.
+type FlagProvider interface {
+	// Enabled returns the flag value and whether the provider has a value for it
+	Enabled(service, flag string) (enabled bool, ok bool)
+}
+
+// WeightProvider is implemented by FlagProviders that also serve numeric values, such as canary
+// weights. Like Enabled, Weight is consulted on every call.
+type WeightProvider interface {
+	// Weight returns the value of the weight and whether the provider has a value for it
+	Weight(service, name string) (weight float64, ok bool)
+}
+
+// MemoryFlags is an in-memory FlagProvider and WeightProvider. Values can be pushed with Set,
+// SetWeight, Replace or ReplaceWeights, or flags pulled periodically with Poll. A service-specific
+// value takes precedence over FlagAllServices.
+type MemoryFlags struct {
+	// Logger receives Poll fetch failures. If nil, the default logger is used
+	Logger logger.Logger
+
+	mu      sync.RWMutex
+	flags   map[string]map[string]bool
+	weights map[string]map[string]float64
+}
+
+// NewMemoryFlags creates an empty MemoryFlags.
+func NewMemoryFlags() *MemoryFlags {
+	return &MemoryFlags{
+		flags:   make(map[string]map[string]bool),
+		weights: make(map[string]map[string]float64),
+	}
+}
+
+// Enabled implements FlagProvider.
+func (f *MemoryFlags) Enabled(service, flag string) (bool, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if enabled, ok := f.flags[service][flag]; ok {
+		return enabled, true
+	}
+	enabled, ok := f.flags[FlagAllServices][flag]
+	return enabled, ok
+}
+
+// Set sets a single flag for a service.
+func (f *MemoryFlags) Set(service, flag string, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.flags[service] == nil {
+		f.flags[service] = make(map[string]bool)
+	}
+	f.flags[service][flag] = enabled
+}
+
+// Replace replaces all flags with the given service -> flag -> value map. The map is copied, so
+// the caller may keep changing it.
+func (f *MemoryFlags) Replace(flags map[string]map[string]bool) {
+	flags = cloneFlags(flags)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags = flags
+}
+
+// Weight implements WeightProvider.
+func (f *MemoryFlags) Weight(service, name string) (float64, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if weight, ok := f.weights[service][name]; ok {
+		return weight, true
+	}
+	weight, ok := f.weights[FlagAllServices][name]
+	return weight, ok
+}
+
+// SetWeight sets a single weight for a service.
+func (f *MemoryFlags) SetWeight(service, name string, weight float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.weights[service] == nil {
+		f.weights[service] = make(map[string]float64)
+	}
+	f.weights[service][name] = weight
+}
+
+// ReplaceWeights replaces all weights with the given service -> name -> value map. The map is
+// copied, so the caller may keep changing it.
+func (f *MemoryFlags) ReplaceWeights(weights map[string]map[string]float64) {
+	weights = cloneFlags(weights)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.weights = weights
+}
+
+// cloneFlags returns a deep copy of a service -> name -> value map, never nil.
+func cloneFlags[V any](m map[string]map[string]V) map[string]map[string]V {
+	clone := make(map[string]map[string]V, len(m))
+	for service, values := range m {
+		clone[service] = maps.Clone(values)
+	}
+	return clone
+}
+
+// Poll calls fetch every interval and replaces the flags with its result until ctx is done.
+// Fetch errors are logged and the previous flags are kept.
+func (f *MemoryFlags) Poll(ctx context.Context, interval time.Duration, fetch func(ctx context.Context) (map[string]map[string]bool, error)) {
+	log := logger.OrDefault(f.Logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		flags, err := fetch(ctx)
+		if err != nil {
+			log.Warnf("Failed to fetch feature flags: %v", err)
+		} else {
+			f.Replace(flags)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FlagInterceptor wraps interceptor so that it only runs while flag is enabled for the service.
+// When the provider has no value for the flag, defaultEnabled is used.
+func FlagInterceptor(provider FlagProvider, serviceName, flag string, defaultEnabled bool, interceptor grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		enabled, ok := provider.Enabled(serviceName, flag)
+		if !ok {
+			enabled = defaultEnabled
+		}
+		if !enabled {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return interceptor(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+// FlagStreamInterceptor is the stream counterpart of FlagInterceptor.
+func FlagStreamInterceptor(provider FlagProvider, serviceName, flag string, defaultEnabled bool, interceptor grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		enabled, ok := provider.Enabled(serviceName, flag)
+		if !ok {
+			enabled = defaultEnabled
+		}
+		if !enabled {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		return interceptor(ctx, desc, cc, method, streamer, opts...)
+	}
+}
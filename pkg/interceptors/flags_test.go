@@ -0,0 +1,55 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestFlagInterceptor(t *testing.T) {
+	flags := NewMemoryFlags()
+	flags.Set(FlagAllServices, FlagRetry, true)
+	flags.Set("billing", FlagRetry, false)
+
+	wrapped := 0
+	inner := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		wrapped++
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	ctx := context.Background()
+	_ = FlagInterceptor(flags, "orders", FlagRetry, false, inner)(ctx, "test", nil, nil, nil, invoker)
+	_ = FlagInterceptor(flags, "billing", FlagRetry, true, inner)(ctx, "test", nil, nil, nil, invoker)
+
+	if wrapped != 1 {
+		t.Errorf("Expected wrapped interceptor to run once, ran %d times", wrapped)
+	}
+}
+
+func TestMemoryFlags_Replace(t *testing.T) {
+	flags := NewMemoryFlags()
+	values := map[string]map[string]bool{"orders": {FlagHedging: true}}
+	flags.Replace(values)
+	values["orders"][FlagHedging] = false
+	if enabled, ok := flags.Enabled("orders", FlagHedging); !enabled || !ok {
+		t.Errorf("expected Replace to copy the flags, got %v, %v", enabled, ok)
+	}
+
+	weights := map[string]map[string]float64{FlagAllServices: {FlagCanaryWeight: 0.1}}
+	flags.ReplaceWeights(weights)
+	weights[FlagAllServices][FlagCanaryWeight] = 1
+	flags.SetWeight("billing", FlagCanaryWeight, 0.5)
+	if weight, ok := flags.Weight("orders", FlagCanaryWeight); weight != 0.1 || !ok {
+		t.Errorf("expected ReplaceWeights to copy the weights, got %v, %v", weight, ok)
+	}
+	if weight, ok := flags.Weight("billing", FlagCanaryWeight); weight != 0.5 || !ok {
+		t.Errorf("expected the service's weight to take precedence, got %v, %v", weight, ok)
+	}
+	if _, ok := flags.Weight("orders", "other"); ok {
+		t.Error("expected no value for an unset weight")
+	}
+}
@@ -0,0 +1,55 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderConfig holds the headers added to outgoing calls, such as tenant IDs, API keys or request
+// IDs. They are appended to the call's metadata, so headers set by the caller are kept.
+type HeaderConfig struct {
+	// Static headers are added to every call, e.g. metadata.Pairs("x-tenant-id", "acme")
+	Static metadata.MD
+	// Func returns headers for each call from its context, e.g. a request ID stored by an HTTP
+	// middleware. It may return nil to add none (default: nil)
+	Func func(ctx context.Context) metadata.MD
+}
+
+// outgoing returns ctx with the headers appended to its outgoing metadata.
+func (cfg *HeaderConfig) outgoing(ctx context.Context) context.Context {
+	var kv []string
+	for _, md := range []metadata.MD{cfg.Static, cfg.dynamic(ctx)} {
+		for key, values := range md {
+			for _, v := range values {
+				kv = append(kv, key, v)
+			}
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+func (cfg *HeaderConfig) dynamic(ctx context.Context) metadata.MD {
+	if cfg.Func == nil {
+		return nil
+	}
+	return cfg.Func(ctx)
+}
+
+// HeaderInterceptor creates an interceptor that adds the configured headers to unary calls.
+func HeaderInterceptor(cfg *HeaderConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(cfg.outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// HeaderStreamInterceptor creates an interceptor that adds the configured headers to streams.
+func HeaderStreamInterceptor(cfg *HeaderConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(cfg.outgoing(ctx), desc, cc, method, opts...)
+	}
+}
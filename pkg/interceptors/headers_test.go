@@ -0,0 +1,51 @@
+package interceptors
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type requestIDKey struct{}
+
+func TestHeaderInterceptor(t *testing.T) {
+	cfg := &HeaderConfig{
+		Static: metadata.Pairs("x-tenant-id", "acme", "x-api-key", "secret"),
+		Func: func(ctx context.Context) metadata.MD {
+			if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+				return metadata.Pairs("x-request-id", id)
+			}
+			return nil
+		},
+	}
+
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	ctx := metadata.AppendToOutgoingContext(context.WithValue(context.Background(), requestIDKey{}, "req-1"), "x-tenant-id", "caller")
+	_ = HeaderInterceptor(cfg)(ctx, "/orders.Orders/Get", nil, nil, nil, invoker)
+
+	if got := md.Get("x-tenant-id"); !slices.Equal(got, []string{"caller", "acme"}) {
+		t.Errorf("expected the caller's tenant to be kept and the static one appended, got %v", got)
+	}
+	if got := md.Get("x-api-key"); !slices.Equal(got, []string{"secret"}) {
+		t.Errorf("expected the static API key, got %v", got)
+	}
+	if got := md.Get("x-request-id"); !slices.Equal(got, []string{"req-1"}) {
+		t.Errorf("expected the request ID from the context, got %v", got)
+	}
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil, nil
+	}
+	_, _ = HeaderStreamInterceptor(cfg)(context.Background(), &grpc.StreamDesc{}, nil, "/orders.Orders/Watch", streamer)
+	if got := md.Get("x-request-id"); len(got) != 0 || md.Get("x-api-key") == nil {
+		t.Errorf("expected only the static headers on a stream without a request ID, got %v", md)
+	}
+}
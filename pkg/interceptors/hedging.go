@@ -0,0 +1,134 @@
+package interceptors
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HedgingConfig holds configuration for hedging unary calls.
+type HedgingConfig struct {
+	// Methods are full method names, or prefixes ending in "*", whose calls are hedged. List only
+	// idempotent methods, as several attempts of a call may reach the backend
+	Methods []string
+	// Delay is how long an attempt is given to complete before the next one is sent (default: 100ms)
+	Delay time.Duration
+	// MaxAttempts bounds the attempts of a call, the first included (default: 2)
+	MaxAttempts int
+	// NonFatalCodes are the codes of failed attempts after which the next attempt is sent right
+	// away rather than failing the call (default: Unavailable)
+	NonFatalCodes []codes.Code
+	// Clock is used to wait between attempts. If nil, the real clock is used
+	Clock clock.Clock
+}
+
+// Hedging defaults applied by HedgingInterceptor to zero HedgingConfig fields.
+const (
+	DefaultHedgingDelay       = 100 * time.Millisecond
+	DefaultHedgingMaxAttempts = 2
+)
+
+// hedgeResult is the outcome of one attempt of a hedged call.
+type hedgeResult struct {
+	reply proto.Message
+	err   error
+}
+
+// HedgingInterceptor creates an interceptor that sends another attempt of a call to one of the
+// configured methods whenever the attempts in flight have not completed within Delay, or right
+// away after an attempt fails with one of NonFatalCodes, up to MaxAttempts. The first successful
+// attempt answers the call and the others are canceled. Only calls whose request and reply are
+// protocol buffer messages are hedged, and grpc.Header, grpc.Trailer and grpc.Peer call options
+// are only applied to the first attempt.
+func HedgingInterceptor(cfg *HedgingConfig) grpc.UnaryClientInterceptor {
+	delay := cfg.Delay
+	if delay <= 0 {
+		delay = DefaultHedgingDelay
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultHedgingMaxAttempts
+	}
+	nonFatal := cfg.NonFatalCodes
+	if nonFatal == nil {
+		nonFatal = []codes.Code{codes.Unavailable}
+	}
+	clk := clock.OrReal(cfg.Clock)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		replyMsg, ok := reply.(proto.Message)
+		if _, reqOK := req.(proto.Message); !ok || !reqOK || maxAttempts < 2 || !matchAnyMethod(cfg.Methods, method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Each attempt gets a reply of its own, as the losing attempts complete after the call.
+		results := make(chan hedgeResult, maxAttempts)
+		hedgeOpts := slices.DeleteFunc(slices.Clone(opts), perCallOutput)
+		send := func(attempt int) {
+			attemptOpts := hedgeOpts
+			if attempt == 0 {
+				attemptOpts = opts
+			}
+			attemptReply := replyMsg.ProtoReflect().New().Interface()
+			go func() {
+				err := invoker(ctx, method, req, attemptReply, cc, attemptOpts...)
+				results <- hedgeResult{reply: attemptReply, err: err}
+			}()
+		}
+
+		send(0)
+		sent, pending := 1, 1
+		var lastErr error
+		for pending > 0 {
+			var next <-chan time.Time
+			if sent < maxAttempts {
+				next = clk.After(delay)
+			}
+			select {
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					proto.Reset(replyMsg)
+					proto.Merge(replyMsg, res.reply)
+					return nil
+				}
+				lastErr = res.err
+				if !slices.Contains(nonFatal, status.Code(res.err)) {
+					return res.err
+				}
+				if sent < maxAttempts {
+					send(sent)
+					sent++
+					pending++
+				}
+			case <-next:
+				send(sent)
+				sent++
+				pending++
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		return lastErr
+	}
+}
+
+// perCallOutput reports whether opt writes the outcome of a call into the caller's variables,
+// which concurrent attempts must not share.
+func perCallOutput(opt grpc.CallOption) bool {
+	switch opt.(type) {
+	case grpc.HeaderCallOption, grpc.TrailerCallOption, grpc.PeerCallOption:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package interceptors
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHedgingInterceptor(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	interceptor := HedgingInterceptor(&HedgingConfig{
+		Methods:     []string{"/grpc.health.v1.Health/*"},
+		Delay:       time.Second,
+		MaxAttempts: 3,
+		Clock:       clk,
+	})
+
+	var attempts atomic.Int32
+	started := make(chan struct{})
+	canceled := make(chan struct{}, 1)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if attempts.Add(1) == 1 {
+			close(started)
+			<-ctx.Done()
+			canceled <- struct{}{}
+			return ctx.Err()
+		}
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return nil
+	}
+
+	reply := &healthpb.HealthCheckResponse{}
+	done := make(chan error, 1)
+	go func() {
+		done <- interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{}, reply, nil, invoker)
+	}()
+
+	// The first attempt hangs, so a second one is sent once the delay elapsed.
+	<-started
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	if err := <-done; err != nil || reply.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected the hedged attempt to answer the call, got %v, %v", reply.Status, err)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("expected the slow attempt to be canceled")
+	}
+}
+
+func TestHedgingInterceptor_FailedAttempts(t *testing.T) {
+	interceptor := HedgingInterceptor(&HedgingConfig{
+		Methods:     []string{"/grpc.health.v1.Health/Check"},
+		Delay:       time.Hour,
+		MaxAttempts: 3,
+	})
+	call := func(method string, failures ...codes.Code) (int32, error) {
+		var attempts atomic.Int32
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if n := int(attempts.Add(1)); n <= len(failures) {
+				return status.Error(failures[n-1], "failed")
+			}
+			return nil
+		}
+		err := interceptor(context.Background(), method, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}, nil, invoker)
+		return attempts.Load(), err
+	}
+
+	// A non-fatal failure sends the next attempt right away, without waiting for the delay.
+	if attempts, err := call("/grpc.health.v1.Health/Check", codes.Unavailable); err != nil || attempts != 2 {
+		t.Errorf("expected the second attempt to answer the call, got %d attempts, %v", attempts, err)
+	}
+	if attempts, err := call("/grpc.health.v1.Health/Check", codes.Unavailable, codes.Unavailable, codes.Unavailable); status.Code(err) != codes.Unavailable || attempts != 3 {
+		t.Errorf("expected the call to fail after 3 attempts, got %d attempts, %v", attempts, err)
+	}
+
+	// A fatal failure fails the call.
+	if attempts, err := call("/grpc.health.v1.Health/Check", codes.InvalidArgument); status.Code(err) != codes.InvalidArgument || attempts != 1 {
+		t.Errorf("expected the fatal failure to fail the call, got %d attempts, %v", attempts, err)
+	}
+
+	// Methods that are not listed are not hedged.
+	if attempts, err := call("/grpc.health.v1.Health/Watch", codes.Unavailable); status.Code(err) != codes.Unavailable || attempts != 1 {
+		t.Errorf("expected an unlisted method to be called once, got %d attempts, %v", attempts, err)
+	}
+}
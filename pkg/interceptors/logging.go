@@ -0,0 +1,251 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// LoggingConfig configures the logging interceptors. Calls are logged with structured fields
+// (method, duration, code, error and, if set, correlation_id) when the Logger supports them, see
+// logger.StructuredLogger, and as "key=value" pairs otherwise.
+type LoggingConfig struct {
+	// Logger receives the log lines. If nil, the default logger is used
+	Logger logger.Logger
+	// LogPayloads adds the request and response of unary calls to their log lines (default: false)
+	LogPayloads bool
+	// MaxPayloadSize is the number of bytes of each payload logged; longer ones are cut (default: 1024)
+	MaxPayloadSize int
+	// RedactFields are the names of proto fields, at any depth, whose values are replaced by
+	// "[REDACTED]" in logged payloads, e.g. "password" (default: nil)
+	RedactFields []string
+	// Redact is called with every payload before it is logged, after RedactFields, and returns
+	// what to log instead, e.g. a copy with secrets removed. Returning nil omits the payload (default: nil)
+	Redact func(method string, msg interface{}) interface{}
+	// SuccessSampleRate logs one in this many successful calls; failed and slow calls are always
+	// logged. Values below 2 log every call (default: 1)
+	SuccessSampleRate int
+	// SlowThreshold logs successful calls that take longer as warnings (default: 0, disabled)
+	SlowThreshold time.Duration
+}
+
+// DefaultLoggingConfig returns a LoggingConfig that logs every call without payloads.
+func DefaultLoggingConfig() *LoggingConfig {
+	return &LoggingConfig{
+		MaxPayloadSize:    1024,
+		SuccessSampleRate: 1,
+	}
+}
+
+// LoggingInterceptor logs gRPC unary calls with timing and error information to the default logger.
+func LoggingInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return defaultCallLogger.logUnary(ctx, method, req, reply, cc, invoker, opts...)
+}
+
+// LoggingStreamInterceptor logs gRPC stream calls with timing and error information to the default logger.
+func LoggingStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return defaultCallLogger.logStream(ctx, desc, cc, method, streamer, opts...)
+}
+
+var defaultCallLogger = newCallLogger(nil)
+
+// NewLoggingInterceptor is like LoggingInterceptor but logs to l.
+// If l is nil, the default logger is used.
+func NewLoggingInterceptor(l logger.Logger) grpc.UnaryClientInterceptor {
+	return LoggingInterceptorWithConfig(&LoggingConfig{Logger: l})
+}
+
+// NewLoggingStreamInterceptor is like LoggingStreamInterceptor but logs to l.
+// If l is nil, the default logger is used.
+func NewLoggingStreamInterceptor(l logger.Logger) grpc.StreamClientInterceptor {
+	return LoggingStreamInterceptorWithConfig(&LoggingConfig{Logger: l})
+}
+
+// LoggingInterceptorWithConfig is like LoggingInterceptor with the payload logging, redaction,
+// sampling and slow call logging of cfg. A nil cfg is DefaultLoggingConfig.
+func LoggingInterceptorWithConfig(cfg *LoggingConfig) grpc.UnaryClientInterceptor {
+	return newCallLogger(cfg).logUnary
+}
+
+// LoggingStreamInterceptorWithConfig is the stream counterpart of LoggingInterceptorWithConfig.
+// Stream payloads are not logged. Streams are logged once established, so SlowThreshold applies
+// to the time taken to open them.
+func LoggingStreamInterceptorWithConfig(cfg *LoggingConfig) grpc.StreamClientInterceptor {
+	return newCallLogger(cfg).logStream
+}
+
+// callLogger logs calls according to a LoggingConfig.
+type callLogger struct {
+	cfg       LoggingConfig
+	l         logger.StructuredLogger
+	redact    map[string]bool
+	successes atomic.Uint64
+}
+
+func newCallLogger(cfg *LoggingConfig) *callLogger {
+	if cfg == nil {
+		cfg = DefaultLoggingConfig()
+	}
+	c := &callLogger{cfg: *cfg, l: logger.Structured(logger.OrDefault(cfg.Logger))}
+	if c.cfg.MaxPayloadSize <= 0 {
+		c.cfg.MaxPayloadSize = DefaultLoggingConfig().MaxPayloadSize
+	}
+	if len(cfg.RedactFields) > 0 {
+		c.redact = make(map[string]bool, len(cfg.RedactFields))
+		for _, name := range cfg.RedactFields {
+			c.redact[name] = true
+		}
+	}
+	return c
+}
+
+func (c *callLogger) logUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	duration := time.Since(start)
+	c.log(ctx, "gRPC call", method, duration, err, func(fields []interface{}) []interface{} {
+		if !c.cfg.LogPayloads {
+			return fields
+		}
+		fields = c.appendPayload(fields, "request", method, req)
+		if err == nil {
+			fields = c.appendPayload(fields, "response", method, reply)
+		}
+		return fields
+	})
+
+	return err
+}
+
+func (c *callLogger) logStream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+
+	c.log(ctx, "gRPC stream", method, time.Since(start), err, nil)
+
+	return stream, err
+}
+
+// log logs the outcome of a call; payloads adds the payload fields of logged calls.
+func (c *callLogger) log(ctx context.Context, kind, method string, duration time.Duration, err error, payloads func([]interface{}) []interface{}) {
+	slow := c.cfg.SlowThreshold > 0 && duration > c.cfg.SlowThreshold
+	if err == nil && !slow && !c.sampled() {
+		return
+	}
+
+	fields := []interface{}{"method", method}
+	if id := CorrelationIDFromContext(ctx); id != "" {
+		fields = append(fields, "correlation_id", id)
+	}
+	fields = append(fields, "duration", duration)
+	if err != nil {
+		fields = append(fields, "code", status.Code(err).String(), "error", err.Error())
+	}
+	if payloads != nil {
+		fields = payloads(fields)
+	}
+
+	switch {
+	case err != nil:
+		c.l.Warnw(kind+" failed", fields...)
+	case slow:
+		c.l.Warnw(kind+" slow", append(fields, "threshold", c.cfg.SlowThreshold)...)
+	default:
+		c.l.Debugw(kind+" success", fields...)
+	}
+}
+
+// sampled reports whether a successful call is logged under SuccessSampleRate. The first call is.
+func (c *callLogger) sampled() bool {
+	if c.cfg.SuccessSampleRate < 2 {
+		return true
+	}
+	return (c.successes.Add(1)-1)%uint64(c.cfg.SuccessSampleRate) == 0
+}
+
+// appendPayload appends the redacted, size-capped payload to fields under key.
+func (c *callLogger) appendPayload(fields []interface{}, key, method string, msg interface{}) []interface{} {
+	if m, ok := msg.(proto.Message); ok && c.redact != nil {
+		m = proto.Clone(m)
+		redactFields(m.ProtoReflect(), c.redact)
+		msg = m
+	}
+	if c.cfg.Redact != nil {
+		if msg = c.cfg.Redact(method, msg); msg == nil {
+			return fields
+		}
+	}
+
+	var payload string
+	if m, ok := msg.(proto.Message); ok {
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			payload = fmt.Sprintf("<%v>", err)
+		} else {
+			payload = string(data)
+		}
+	} else {
+		payload = fmt.Sprintf("%+v", msg)
+	}
+	if len(payload) > c.cfg.MaxPayloadSize {
+		payload = payload[:c.cfg.MaxPayloadSize] + "...(truncated)"
+	}
+	return append(fields, key, payload)
+}
+
+// redactFields replaces the values of the named fields of m and its nested messages: strings and
+// bytes with "[REDACTED]", other fields are cleared.
+func redactFields(m protoreflect.Message, names map[string]bool) {
+	var redacted []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if names[string(fd.Name())] {
+			redacted = append(redacted, fd)
+			return true
+		}
+		if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind {
+			return true
+		}
+		switch {
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				redactFields(list.Get(i).Message(), names)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Kind() == protoreflect.MessageKind {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					redactFields(mv.Message(), names)
+					return true
+				})
+			}
+		default:
+			redactFields(v.Message(), names)
+		}
+		return true
+	})
+
+	for _, fd := range redacted {
+		switch {
+		case fd.IsList() || fd.IsMap():
+			m.Clear(fd)
+		case fd.Kind() == protoreflect.StringKind:
+			m.Set(fd, protoreflect.ValueOfString("[REDACTED]"))
+		case fd.Kind() == protoreflect.BytesKind:
+			m.Set(fd, protoreflect.ValueOfBytes([]byte("[REDACTED]")))
+		default:
+			m.Clear(fd)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestLoggingInterceptorWithConfig(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	var delay time.Duration
+	var fail error
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		time.Sleep(delay)
+		reply.(*healthpb.HealthCheckResponse).Status = healthpb.HealthCheckResponse_SERVING
+		return fail
+	}
+	call := func(interceptor grpc.UnaryClientInterceptor, service string) string {
+		buf.Reset()
+		_ = interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{Service: service}, &healthpb.HealthCheckResponse{}, nil, invoker)
+		return buf.String()
+	}
+
+	t.Run("sampling", func(t *testing.T) {
+		interceptor := LoggingInterceptorWithConfig(&LoggingConfig{Logger: l, SuccessSampleRate: 3})
+		var logged int
+		for i := 0; i < 6; i++ {
+			if call(interceptor, "orders") != "" {
+				logged++
+			}
+		}
+		if logged != 2 {
+			t.Errorf("expected 2 of 6 successful calls to be logged, got %d", logged)
+		}
+		fail = errors.New("boom")
+		defer func() { fail = nil }()
+		for i := 0; i < 3; i++ {
+			if out := call(interceptor, "orders"); !strings.Contains(out, "gRPC call failed") || !strings.Contains(out, "error=boom") {
+				t.Errorf("expected every failure to be logged, got %q", out)
+			}
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		interceptor := LoggingInterceptorWithConfig(&LoggingConfig{Logger: l, SuccessSampleRate: 1000, SlowThreshold: time.Millisecond})
+		call(interceptor, "orders") // the first call is sampled
+		delay = 5 * time.Millisecond
+		defer func() { delay = 0 }()
+		if out := call(interceptor, "orders"); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "gRPC call slow") {
+			t.Errorf("expected a slow call warning, got %q", out)
+		}
+	})
+
+	t.Run("payloads", func(t *testing.T) {
+		interceptor := LoggingInterceptorWithConfig(&LoggingConfig{Logger: l, LogPayloads: true, RedactFields: []string{"service"}})
+		out := call(interceptor, "secret-service")
+		if strings.Contains(out, "secret-service") || !strings.Contains(out, "[REDACTED]") {
+			t.Errorf("expected the service field to be redacted, got %q", out)
+		}
+		if !strings.Contains(out, "SERVING") {
+			t.Errorf("expected the response to be logged, got %q", out)
+		}
+
+		interceptor = LoggingInterceptorWithConfig(&LoggingConfig{Logger: l, LogPayloads: true, MaxPayloadSize: 16})
+		if out := call(interceptor, strings.Repeat("x", 100)); strings.Contains(out, strings.Repeat("x", 20)) || !strings.Contains(out, "(truncated)") {
+			t.Errorf("expected the request to be cut, got %q", out)
+		}
+
+		interceptor = LoggingInterceptorWithConfig(&LoggingConfig{Logger: l, LogPayloads: true, Redact: func(string, interface{}) interface{} { return nil }})
+		if out := call(interceptor, "orders"); strings.Contains(out, "request=") {
+			t.Errorf("expected the payloads to be omitted, got %q", out)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// MaintenanceWindow is a period of planned backend downtime during which calls are rejected locally.
+type MaintenanceWindow struct {
+	// Start is when the window begins
+	Start time.Time
+	// End is when the window ends
+	End time.Time
+	// Reason is an optional description included in the error
+	Reason string
+}
+
+// MaintenanceError is returned for calls made during a maintenance window.
+type MaintenanceError struct {
+	Service string
+	Until   time.Time
+	Reason  string
+
+	now time.Time
+}
+
+// Error implements the error interface.
+func (e *MaintenanceError) Error() string {
+	msg := fmt.Sprintf("service %s is in maintenance until %s", e.Service, e.Until.Format(time.RFC3339))
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// RetryAfter returns how long the caller should wait before retrying.
+func (e *MaintenanceError) RetryAfter() time.Duration {
+	return max(e.Until.Sub(e.now), 0)
+}
+
+// GRPCStatus returns an Unavailable status carrying a RetryInfo detail with the remaining window duration.
+func (e *MaintenanceError) GRPCStatus() *status.Status {
+	st := status.New(codes.Unavailable, e.Error())
+	withDetails, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(e.RetryAfter()),
+	})
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// activeMaintenanceWindow returns the window containing now, if any.
+func activeMaintenanceWindow(windows []MaintenanceWindow, now time.Time) (MaintenanceWindow, bool) {
+	for _, w := range windows {
+		if !now.Before(w.Start) && now.Before(w.End) {
+			return w, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// MaintenanceInterceptor creates an interceptor that rejects calls during any of the given maintenance
+// windows with a *MaintenanceError. It must be placed before the circuit breaker and retry interceptors
+// so that planned downtime is neither retried nor counted as a failure. If clk is nil, the real clock is used.
+func MaintenanceInterceptor(serviceName string, windows []MaintenanceWindow, clk clock.Clock, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	clk = clock.OrReal(clk)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := checkMaintenance(serviceName, windows, clk, m, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// MaintenanceStreamInterceptor is the stream counterpart of MaintenanceInterceptor: streams opened
+// during a maintenance window fail with a *MaintenanceError. Streams opened before a window are
+// not closed when it begins.
+func MaintenanceStreamInterceptor(serviceName string, windows []MaintenanceWindow, clk clock.Clock, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	clk = clock.OrReal(clk)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := checkMaintenance(serviceName, windows, clk, m, method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// checkMaintenance returns a *MaintenanceError if now is within one of windows, counting the
+// blocked call.
+func checkMaintenance(serviceName string, windows []MaintenanceWindow, clk clock.Clock, m metrics.MetricsRecorder, method string) error {
+	now := clk.Now()
+	w, ok := activeMaintenanceWindow(windows, now)
+	if !ok {
+		return nil
+	}
+	if m != nil {
+		m.IncrementGRPCBlocked(serviceName, method, "maintenance")
+	}
+	return &MaintenanceError{
+		Service: serviceName,
+		Until:   w.End,
+		Reason:  w.Reason,
+		now:     now,
+	}
+}
@@ -0,0 +1,91 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMaintenanceInterceptor(t *testing.T) {
+	start := time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start.Add(-time.Minute))
+	windows := []MaintenanceWindow{{Start: start, End: start.Add(time.Hour), Reason: "database upgrade"}}
+	interceptor := MaintenanceInterceptor("orders", windows, clk, nil)
+
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		return nil
+	}
+	call := func() error {
+		return interceptor(context.Background(), "/orders.Orders/Get", nil, nil, nil, invoker)
+	}
+
+	if err := call(); err != nil || invoked != 1 {
+		t.Fatalf("Expected a call before the window to pass, got %v", err)
+	}
+
+	// 15 minutes into the window.
+	clk.Advance(16 * time.Minute)
+	err := call()
+	var merr *MaintenanceError
+	if !errors.As(err, &merr) || invoked != 1 {
+		t.Fatalf("Expected a MaintenanceError during the window, got %v", err)
+	}
+	if merr.Reason != "database upgrade" || merr.RetryAfter() != 45*time.Minute {
+		t.Errorf("Expected the window's reason and 45m left, got %q, %v", merr.Reason, merr.RetryAfter())
+	}
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable {
+		t.Errorf("Expected Unavailable, got %v", st.Code())
+	}
+	var retryDelay time.Duration
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retryDelay = info.GetRetryDelay().AsDuration()
+		}
+	}
+	if retryDelay != 45*time.Minute {
+		t.Errorf("Expected a RetryInfo delay of 45m, got %v", retryDelay)
+	}
+
+	// The window ends at End.
+	clk.Advance(45 * time.Minute)
+	if err := call(); err != nil || invoked != 2 {
+		t.Errorf("Expected a call after the window to pass, got %v", err)
+	}
+}
+
+func TestMaintenanceStreamInterceptor(t *testing.T) {
+	start := time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)
+	clk := testutil.NewFakeClock(start)
+	windows := []MaintenanceWindow{{Start: start, End: start.Add(time.Hour)}}
+	interceptor := MaintenanceStreamInterceptor("orders", windows, clk, nil)
+
+	opened := 0
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		opened++
+		return nil, nil
+	}
+	open := func() error {
+		_, err := interceptor(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/orders.Orders/Watch", streamer)
+		return err
+	}
+
+	var merr *MaintenanceError
+	if err := open(); !errors.As(err, &merr) || status.Code(err) != codes.Unavailable || opened != 0 {
+		t.Fatalf("Expected a stream opened during the window to fail locally, got %v", err)
+	}
+	clk.Advance(time.Hour)
+	if err := open(); err != nil || opened != 1 {
+		t.Errorf("Expected a stream opened after the window to pass, got %v", err)
+	}
+}
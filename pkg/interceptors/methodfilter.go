@@ -0,0 +1,115 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodFilterConfig holds the methods that may or may not be called on a service.
+// Patterns are full method names (e.g. "/pkg.Service/Method"); a trailing "*" matches any suffix.
+type MethodFilterConfig struct {
+	// Allow lists the permitted methods. If empty, all methods not denied are permitted
+	Allow []string
+	// Deny lists the blocked methods. Deny takes precedence over Allow
+	Deny []string
+	// Logger receives a warning for every blocked call. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// matchMethod reports whether method matches pattern. A trailing "*" in pattern matches any suffix.
+func matchMethod(pattern, method string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(method, prefix)
+	}
+	return pattern == method
+}
+
+// lookupMethod returns the value for method from values. Keys are full method names or patterns
+// with a trailing "*"; an exact match wins over patterns, and the longest pattern wins among patterns.
+func lookupMethod[T any](values map[string]T, method string) (T, bool) {
+	_, v, ok := lookupMethodKey(values, method)
+	return v, ok
+}
+
+// lookupMethodKey is like lookupMethod but also returns the matching key.
+func lookupMethodKey[T any](values map[string]T, method string) (string, T, bool) {
+	if v, ok := values[method]; ok {
+		return method, v, true
+	}
+
+	var (
+		bestKey string
+		best    T
+		bestLen = -1
+	)
+	for pattern, v := range values {
+		if !strings.HasSuffix(pattern, "*") || !matchMethod(pattern, method) {
+			continue
+		}
+		if len(pattern) > bestLen {
+			bestKey, best, bestLen = pattern, v, len(pattern)
+		}
+	}
+	return bestKey, best, bestLen >= 0
+}
+
+func matchAnyMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether method may be called under this configuration.
+func (c *MethodFilterConfig) Permits(method string) bool {
+	if matchAnyMethod(c.Deny, method) {
+		return false
+	}
+	return len(c.Allow) == 0 || matchAnyMethod(c.Allow, method)
+}
+
+// MethodFilterInterceptor creates an interceptor that rejects calls to methods not permitted by cfg
+// with PermissionDenied, without sending them to the server.
+func MethodFilterInterceptor(serviceName string, cfg *MethodFilterConfig, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	log := logger.OrDefault(cfg.Logger)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := checkMethod(serviceName, cfg, log, m, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// MethodFilterStreamInterceptor is the stream counterpart of MethodFilterInterceptor: streams to
+// methods not permitted by cfg fail with PermissionDenied without being opened.
+func MethodFilterStreamInterceptor(serviceName string, cfg *MethodFilterConfig, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	log := logger.OrDefault(cfg.Logger)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := checkMethod(serviceName, cfg, log, m, method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// checkMethod returns a PermissionDenied error if method is not permitted by cfg, logging and
+// counting the blocked call.
+func checkMethod(serviceName string, cfg *MethodFilterConfig, log logger.Logger, m metrics.MetricsRecorder, method string) error {
+	if cfg.Permits(method) {
+		return nil
+	}
+	log.Warnf("Blocked call to method not permitted for service: service=%s, method=%s", serviceName, method)
+	if m != nil {
+		m.IncrementGRPCBlocked(serviceName, method, "method_filter")
+	}
+	return status.Errorf(codes.PermissionDenied, "method %s is not permitted for service %s", method, serviceName)
+}
@@ -0,0 +1,82 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMethodFilterConfig_Permits(t *testing.T) {
+	cfg := &MethodFilterConfig{
+		Allow: []string{"/orders.Orders/*"},
+		Deny:  []string{"/orders.Orders/Purge"},
+	}
+
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"/orders.Orders/Get", true},
+		{"/orders.Orders/Purge", false},
+		{"/admin.Admin/Reset", false},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.Permits(tt.method); got != tt.want {
+			t.Errorf("Permits(%s) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestMethodFilterInterceptors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.NewMetricsWithRegistry(reg, "", nil)
+	cfg := &MethodFilterConfig{Deny: []string{"/admin.Admin/*"}, Logger: logger.Nop}
+	unary := MethodFilterInterceptor("shop", cfg, m)
+	stream := MethodFilterStreamInterceptor("shop", cfg, m)
+
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		return nil
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		invoked++
+		return nil, nil
+	}
+
+	if err := unary(context.Background(), "/admin.Admin/Reset", nil, nil, nil, invoker); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected the denied call to fail with PermissionDenied, got %v", err)
+	}
+	if _, err := stream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/admin.Admin/Dump", streamer); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected the denied stream to fail with PermissionDenied, got %v", err)
+	}
+	if invoked != 0 {
+		t.Errorf("Expected denied calls not to be sent, got %d sent", invoked)
+	}
+	if err := unary(context.Background(), "/orders.Orders/Get", nil, nil, nil, invoker); err != nil {
+		t.Errorf("Expected a permitted call to pass, got %v", err)
+	}
+	if _, err := stream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/orders.Orders/Watch", streamer); err != nil {
+		t.Errorf("Expected a permitted stream to pass, got %v", err)
+	}
+
+	want := `
+# HELP grpc_client_blocked_total Total number of gRPC calls rejected locally before being sent
+# TYPE grpc_client_blocked_total counter
+grpc_client_blocked_total{method="/admin.Admin/Dump",reason="method_filter",service="shop"} 1
+grpc_client_blocked_total{method="/admin.Admin/Reset",reason="method_filter",service="shop"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "grpc_client_blocked_total"); err != nil {
+		t.Error(err)
+	}
+}
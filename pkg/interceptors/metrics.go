@@ -0,0 +1,146 @@
+package interceptors
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// MetricsInterceptor creates a metrics interceptor for gRPC unary calls.
+// It records request counts, durations, error codes, the calling component and the sizes of
+// proto requests and responses to Prometheus metrics.
+// Calls aborted by the caller's own context are counted separately so they don't inflate error rates.
+func MetricsInterceptor(serviceName string, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	if m == nil {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var p peer.Peer
+		if m.TargetLabelsEnabled() {
+			opts = append(opts, grpc.Peer(&p))
+		}
+
+		start := time.Now()
+		doneBefore := ctx.Err() != nil
+		recordSize(m, serviceName, method, metrics.DirectionSent, req)
+
+		m.AddGRPCInflight(serviceName, method, 1)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		m.AddGRPCInflight(serviceName, method, -1)
+
+		if reason := callerAbortReason(ctx, err, doneBefore); reason != "" {
+			m.IncrementGRPCCallerAborted(serviceName, method, reason)
+			return err
+		}
+
+		duration := time.Since(start)
+		code := "OK"
+
+		if err != nil {
+			st, _ := status.FromError(err)
+			code = st.Code().String()
+		}
+
+		m.RecordGRPCRequest(serviceName, method, code, CallerFromContext(ctx), peerTarget(&p, cc), duration)
+		if err == nil {
+			recordSize(m, serviceName, method, metrics.DirectionReceived, reply)
+		}
+
+		return err
+	}
+}
+
+// MetricsStreamInterceptor creates a metrics interceptor for gRPC stream calls.
+// It records request counts, durations, error codes and the calling component to Prometheus metrics,
+// the number and sizes of messages sent and received on each stream, and once a stream ends, its
+// duration and message counts. Open streams count as in-flight requests.
+func MetricsStreamInterceptor(serviceName string, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	if m == nil {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+	}
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		doneBefore := ctx.Err() != nil
+
+		m.AddGRPCInflight(serviceName, method, 1)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			m.AddGRPCInflight(serviceName, method, -1)
+		}
+
+		if reason := callerAbortReason(ctx, err, doneBefore); reason != "" {
+			m.IncrementGRPCCallerAborted(serviceName, method, reason)
+			return stream, err
+		}
+
+		duration := time.Since(start)
+		code := "OK"
+
+		if err != nil {
+			st, _ := status.FromError(err)
+			code = st.Code().String()
+		}
+
+		m.RecordGRPCRequest(serviceName, method, code, CallerFromContext(ctx), peerTarget(nil, cc), duration)
+		if err != nil {
+			return stream, err
+		}
+
+		var sent, received atomic.Int64
+		observed := &observedStream{
+			ClientStream:   stream,
+			singleResponse: !desc.ServerStreams,
+			onFinish: func(err error) {
+				m.AddGRPCInflight(serviceName, method, -1)
+				m.RecordGRPCStream(serviceName, method, status.Code(err).String(), time.Since(start), int(sent.Load()), int(received.Load()))
+			},
+			onSend: func(msg interface{}) {
+				sent.Add(1)
+				m.RecordGRPCStreamMessage(serviceName, method, metrics.DirectionSent)
+				recordSize(m, serviceName, method, metrics.DirectionSent, msg)
+			},
+			onRecv: func(msg interface{}) {
+				received.Add(1)
+				m.RecordGRPCStreamMessage(serviceName, method, metrics.DirectionReceived)
+				recordSize(m, serviceName, method, metrics.DirectionReceived, msg)
+			},
+		}
+		// Streams abandoned by canceling their context end without a final RecvMsg, and are recorded
+		// with the context error's code.
+		go func() {
+			<-stream.Context().Done()
+			observed.finish(status.FromContextError(stream.Context().Err()).Err())
+		}()
+		return observed, nil
+	}
+}
+
+// recordSize records the size of a message sent or received, if it is a proto message.
+func recordSize(m metrics.MetricsRecorder, serviceName, method, direction string, msg interface{}) {
+	if pm, ok := msg.(proto.Message); ok {
+		m.RecordGRPCMessageSize(serviceName, method, direction, proto.Size(pm))
+	}
+}
+
+// peerTarget returns the resolved peer address if known, falling back to the connection's target.
+func peerTarget(p *peer.Peer, cc *grpc.ClientConn) string {
+	if p != nil && p.Addr != nil {
+		return p.Addr.String()
+	}
+	if cc != nil {
+		return cc.Target()
+	}
+	return ""
+}
@@ -0,0 +1,281 @@
+package interceptors
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// replayStream is a client stream that accepts every message sent and replays responses, then
+// ends with io.EOF.
+type replayStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	responses []proto.Message
+}
+
+func (s *replayStream) Context() context.Context    { return s.ctx }
+func (s *replayStream) SendMsg(m interface{}) error { return nil }
+
+func (s *replayStream) RecvMsg(m interface{}) error {
+	if len(s.responses) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.responses[0])
+	s.responses = s.responses[1:]
+	return nil
+}
+
+// openStream opens a server-streaming call through interceptor that replays responses.
+func openStream(t *testing.T, interceptor grpc.StreamClientInterceptor, responses ...proto.Message) grpc.ClientStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &replayStream{ctx: ctx, responses: responses}, nil
+	}
+	stream, err := interceptor(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, nil, "/grpc.health.v1.Health/Watch", streamer)
+	if err != nil {
+		t.Fatalf("stream creation failed: %v", err)
+	}
+	return stream
+}
+
+func TestMetricsStreamInterceptor_MessageCounts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsStreamInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+
+	serving := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	stream := openStream(t, interceptor, serving, serving, serving)
+	for range 2 {
+		if err := stream.SendMsg(&healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("SendMsg failed: %v", err)
+		}
+	}
+	for {
+		if err := stream.RecvMsg(&healthpb.HealthCheckResponse{}); err != nil {
+			break
+		}
+	}
+
+	want := `
+# HELP grpc_client_stream_messages_total Total number of messages sent and received on gRPC streams
+# TYPE grpc_client_stream_messages_total counter
+grpc_client_stream_messages_total{direction="received",method="/grpc.health.v1.Health/Watch",service="health"} 3
+grpc_client_stream_messages_total{direction="sent",method="/grpc.health.v1.Health/Watch",service="health"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "grpc_client_stream_messages_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+// histogram returns the sample count and sum of the series of the histogram name with labels.
+func histogram(t *testing.T, reg *prometheus.Registry, name string, labels prometheus.Labels) (uint64, float64) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range f.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue series
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestMetricsInterceptor_MessageSizes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+
+	req := &healthpb.HealthCheckRequest{Service: "orders"}
+	resp := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if method == "/grpc.health.v1.Health/Check" {
+			proto.Merge(reply.(proto.Message), resp)
+			return nil
+		}
+		return status.Error(codes.Unavailable, "down")
+	}
+	for _, method := range []string{"/grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Check", "/grpc.health.v1.Health/List"} {
+		_ = interceptor(context.Background(), method, req, &healthpb.HealthCheckResponse{}, nil, invoker)
+	}
+
+	check := labelsFor("/grpc.health.v1.Health/Check")
+	if count, sum := histogram(t, reg, "grpc_client_request_bytes", check); count != 2 || sum != float64(2*proto.Size(req)) {
+		t.Errorf("request bytes: count = %d, sum = %v, want 2 requests of %d bytes", count, sum, proto.Size(req))
+	}
+	if count, sum := histogram(t, reg, "grpc_client_response_bytes", check); count != 2 || sum != float64(2*proto.Size(resp)) {
+		t.Errorf("response bytes: count = %d, sum = %v, want 2 responses of %d bytes", count, sum, proto.Size(resp))
+	}
+
+	// Failed calls record the request sent but have no response.
+	list := labelsFor("/grpc.health.v1.Health/List")
+	if count, _ := histogram(t, reg, "grpc_client_request_bytes", list); count != 1 {
+		t.Errorf("Expected the failed call's request size to be recorded, got %d", count)
+	}
+	if count, _ := histogram(t, reg, "grpc_client_response_bytes", list); count != 0 {
+		t.Errorf("Expected no response size for the failed call, got %d", count)
+	}
+}
+
+func TestMetricsStreamInterceptor_MessageSizes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsStreamInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+
+	req := &healthpb.HealthCheckRequest{Service: "orders"}
+	resp := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}
+	stream := openStream(t, interceptor, resp, resp)
+	if err := stream.SendMsg(req); err != nil {
+		t.Fatalf("SendMsg failed: %v", err)
+	}
+	for {
+		if err := stream.RecvMsg(&healthpb.HealthCheckResponse{}); err != nil {
+			break
+		}
+	}
+
+	watch := labelsFor("/grpc.health.v1.Health/Watch")
+	if count, sum := histogram(t, reg, "grpc_client_request_bytes", watch); count != 1 || sum != float64(proto.Size(req)) {
+		t.Errorf("sent message bytes: count = %d, sum = %v, want 1 message of %d bytes", count, sum, proto.Size(req))
+	}
+	if count, sum := histogram(t, reg, "grpc_client_response_bytes", watch); count != 2 || sum != float64(2*proto.Size(resp)) {
+		t.Errorf("received message bytes: count = %d, sum = %v, want 2 messages of %d bytes", count, sum, proto.Size(resp))
+	}
+}
+
+// labelsFor returns the labels of the health service's series for method.
+func labelsFor(method string) prometheus.Labels {
+	return prometheus.Labels{"service": "health", "method": method}
+}
+
+// inflight returns the value of the in-flight gauge of the health service's method.
+func inflight(t *testing.T, reg *prometheus.Registry, method string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != "grpc_client_inflight_requests" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "method" && l.GetValue() == method {
+					return metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetricsInterceptor_Inflight(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+
+	var during float64
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		during = inflight(t, reg, method)
+		return status.Error(codes.Unavailable, "down")
+	}
+	_ = interceptor(context.Background(), "/grpc.health.v1.Health/Check", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}, nil, invoker)
+
+	if during != 1 {
+		t.Errorf("Expected 1 call in flight during the call, got %v", during)
+	}
+	if got := inflight(t, reg, "/grpc.health.v1.Health/Check"); got != 0 {
+		t.Errorf("Expected no call in flight after it failed, got %v", got)
+	}
+}
+
+func TestMetricsStreamInterceptor_StreamStats(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsStreamInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+	const watch = "/grpc.health.v1.Health/Watch"
+
+	serving := &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}
+	stream := openStream(t, interceptor, serving, serving, serving)
+	if got := inflight(t, reg, watch); got != 1 {
+		t.Errorf("Expected the open stream to be in flight, got %v", got)
+	}
+	if count, _ := histogram(t, reg, "grpc_client_stream_duration_seconds", labelsFor(watch)); count != 0 {
+		t.Errorf("Expected no stream duration before the stream ended, got %d", count)
+	}
+	if err := stream.SendMsg(&healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("SendMsg failed: %v", err)
+	}
+	for {
+		if err := stream.RecvMsg(&healthpb.HealthCheckResponse{}); err != nil {
+			break
+		}
+	}
+
+	if got := inflight(t, reg, watch); got != 0 {
+		t.Errorf("Expected the ended stream to leave the in-flight gauge, got %v", got)
+	}
+	if count, _ := histogram(t, reg, "grpc_client_stream_duration_seconds", prometheus.Labels{"method": watch, "code": "OK"}); count != 1 {
+		t.Errorf("Expected one OK stream duration, got %d", count)
+	}
+	sent := prometheus.Labels{"method": watch, "direction": metrics.DirectionSent}
+	if count, sum := histogram(t, reg, "grpc_client_stream_messages", sent); count != 1 || sum != 1 {
+		t.Errorf("sent messages per stream: count = %d, sum = %v, want 1 stream with 1 message", count, sum)
+	}
+	received := prometheus.Labels{"method": watch, "direction": metrics.DirectionReceived}
+	if count, sum := histogram(t, reg, "grpc_client_stream_messages", received); count != 1 || sum != 3 {
+		t.Errorf("received messages per stream: count = %d, sum = %v, want 1 stream with 3 messages", count, sum)
+	}
+}
+
+func TestMetricsStreamInterceptor_CanceledStream(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := MetricsStreamInterceptor("health", metrics.NewMetricsWithRegistry(reg, "", nil))
+	const watch = "/grpc.health.v1.Health/Watch"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &replayStream{ctx: ctx}, nil
+	}
+	if _, err := interceptor(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, watch, streamer); err != nil {
+		t.Fatalf("stream creation failed: %v", err)
+	}
+
+	// A stream abandoned by canceling its context ends without being read.
+	cancel()
+	canceled := prometheus.Labels{"method": watch, "code": "Canceled"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if count, _ := histogram(t, reg, "grpc_client_stream_duration_seconds", canceled); count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected one Canceled stream duration")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inflight(t, reg, watch); got != 0 {
+		t.Errorf("Expected the canceled stream to leave the in-flight gauge, got %v", got)
+	}
+}
@@ -0,0 +1,293 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// QuotaWindow is a call limit over a fixed time window (e.g. 10000 calls per 24h).
+// Windows are aligned to multiples of Period since the zero time, so a 24h window resets at UTC midnight.
+type QuotaWindow struct {
+	// Period is the window length
+	Period time.Duration
+	// Limit is the maximum number of calls allowed per window
+	Limit int64
+}
+
+// QuotaConfig holds configuration for per-service call quotas.
+// A short window (e.g. 100 per minute) can be combined with long ones to bound bursts.
+type QuotaConfig struct {
+	// Windows are the quota windows; a call is allowed only if every window has capacity
+	Windows []QuotaWindow
+	// Store persists quota counters across restarts. Counters are saved in the background, after
+	// the calls that changed them, so a slow store does not delay calls. If nil, counters are kept
+	// in memory
+	Store QuotaStore
+	// Clock determines the current window. If nil, the real clock is used
+	Clock clock.Clock
+	// Logger receives failures to save counters. If nil, the default logger is used
+	Logger logger.Logger
+}
+
+// QuotaState is the persisted state of a single quota window.
+type QuotaState struct {
+	WindowStart time.Time `json:"window_start"`
+	Count       int64     `json:"count"`
+}
+
+// QuotaStore persists quota counters. Implementations must be safe for concurrent use.
+type QuotaStore interface {
+	// Load returns the saved state for key, or a zero state if none exists
+	Load(key string) (QuotaState, error)
+	// Save stores the state for key
+	Save(key string, state QuotaState) error
+}
+
+// QuotaExceededError is returned when a call would exceed one of the service's quota windows.
+type QuotaExceededError struct {
+	Service string
+	Period  time.Duration
+	Limit   int64
+	ResetAt time.Time
+}
+
+// Error implements the error interface.
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %d calls per %v, resets at %s",
+		e.Service, e.Limit, e.Period, e.ResetAt.Format(time.RFC3339))
+}
+
+// GRPCStatus returns a ResourceExhausted status so the error is handled like other gRPC errors.
+func (e *QuotaExceededError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+type quotaCounter struct {
+	key    string
+	window QuotaWindow
+	state  QuotaState
+}
+
+// Quota tracks call counts for a service against its configured windows.
+type Quota struct {
+	mu       sync.Mutex
+	service  string
+	counters []*quotaCounter
+	store    QuotaStore
+	clock    clock.Clock
+	logger   logger.Logger
+	dirty    bool // counters changed since they were last saved
+	saving   bool // a goroutine is saving the counters
+
+	// saveMu orders saves, so that an older snapshot of the counters never overwrites a newer one.
+	saveMu sync.Mutex
+}
+
+// NewQuota creates a Quota for the service, restoring counters from cfg.Store if set.
+func NewQuota(serviceName string, cfg *QuotaConfig) (*Quota, error) {
+	q := &Quota{
+		service: serviceName,
+		store:   cfg.Store,
+		clock:   clock.OrReal(cfg.Clock),
+		logger:  logger.OrDefault(cfg.Logger),
+	}
+	for _, w := range cfg.Windows {
+		c := &quotaCounter{
+			key:    fmt.Sprintf("%s/%s", serviceName, w.Period),
+			window: w,
+		}
+		if q.store != nil {
+			state, err := q.store.Load(c.key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load quota state for %s: %w", c.key, err)
+			}
+			c.state = state
+		}
+		q.counters = append(q.counters, c)
+	}
+	return q, nil
+}
+
+// Allow consumes one call from every window, or returns a *QuotaExceededError
+// without consuming anything if any window is exhausted. The counters are saved to the store in
+// the background.
+func (q *Quota) Allow() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.clock.Now()
+	for _, c := range q.counters {
+		start := now.Truncate(c.window.Period)
+		if !c.state.WindowStart.Equal(start) {
+			c.state = QuotaState{WindowStart: start}
+		}
+		if c.state.Count >= c.window.Limit {
+			return &QuotaExceededError{
+				Service: q.service,
+				Period:  c.window.Period,
+				Limit:   c.window.Limit,
+				ResetAt: start.Add(c.window.Period),
+			}
+		}
+	}
+
+	for _, c := range q.counters {
+		c.state.Count++
+	}
+	if q.store != nil {
+		q.dirty = true
+		if !q.saving {
+			q.saving = true
+			go q.persist()
+		}
+	}
+	return nil
+}
+
+// persist saves the counters until they no longer change, logging failures, since the calls that
+// changed them have already been allowed.
+func (q *Quota) persist() {
+	for {
+		q.saveMu.Lock()
+		q.mu.Lock()
+		if !q.dirty {
+			q.saving = false
+			q.mu.Unlock()
+			q.saveMu.Unlock()
+			return
+		}
+		states := q.snapshot()
+		q.mu.Unlock()
+		err := q.save(states)
+		q.saveMu.Unlock()
+		if err != nil {
+			q.logger.Warnf("Failed to save quota counters for %s: %v", q.service, err)
+		}
+	}
+}
+
+// Flush saves the counters now, e.g. before the quota is dropped or the process exits, and
+// returns the store's error.
+func (q *Quota) Flush() error {
+	if q.store == nil {
+		return nil
+	}
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+	q.mu.Lock()
+	states := q.snapshot()
+	q.mu.Unlock()
+	return q.save(states)
+}
+
+// snapshot copies the counters and marks them saved. Must be called with q.mu held.
+func (q *Quota) snapshot() map[string]QuotaState {
+	states := make(map[string]QuotaState, len(q.counters))
+	for _, c := range q.counters {
+		states[c.key] = c.state
+	}
+	q.dirty = false
+	return states
+}
+
+func (q *Quota) save(states map[string]QuotaState) error {
+	var errs []error
+	for key, state := range states {
+		errs = append(errs, q.store.Save(key, state))
+	}
+	return errors.Join(errs...)
+}
+
+// QuotaInterceptor creates an interceptor that rejects calls once the service's quota is exhausted.
+// Quota is consumed once per logical call, so place it outside the retry interceptor.
+func QuotaInterceptor(serviceName string, q *Quota, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := allowQuota(serviceName, q, m, method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// QuotaStreamInterceptor creates a stream interceptor that consumes one call from the service's
+// quota for every new stream, rejecting streams once it is exhausted. Messages on an established
+// stream are not counted.
+func QuotaStreamInterceptor(serviceName string, q *Quota, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := allowQuota(serviceName, q, m, method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// allowQuota consumes one call from q, counting the call as blocked if the quota is exhausted.
+func allowQuota(serviceName string, q *Quota, m metrics.MetricsRecorder, method string) error {
+	err := q.Allow()
+	if err != nil && m != nil {
+		m.IncrementGRPCBlocked(serviceName, method, "quota")
+	}
+	return err
+}
+
+// FileQuotaStore persists quota counters as JSON in a single file.
+type FileQuotaStore struct {
+	mu     sync.Mutex
+	path   string
+	states map[string]QuotaState
+}
+
+// NewFileQuotaStore creates a store backed by the file at path, loading existing state if present.
+func NewFileQuotaStore(path string) (*FileQuotaStore, error) {
+	s := &FileQuotaStore{path: path, states: make(map[string]QuotaState)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return nil, fmt.Errorf("failed to parse quota file: %w", err)
+	}
+	return s, nil
+}
+
+// Load returns the saved state for key.
+func (s *FileQuotaStore) Load(key string) (QuotaState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+// Save stores the state for key and rewrites the file.
+func (s *FileQuotaStore) Save(key string, state QuotaState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[key] = state
+	data, err := json.Marshal(s.states)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,138 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQuota_Allow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	store, err := NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatalf("NewFileQuotaStore failed: %v", err)
+	}
+
+	cfg := &QuotaConfig{
+		Windows: []QuotaWindow{{Period: 24 * time.Hour, Limit: 2}},
+		Store:   store,
+	}
+	q, err := NewQuota("partner-api", cfg)
+	if err != nil {
+		t.Fatalf("NewQuota failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := q.Allow(); err != nil {
+			t.Fatalf("Expected call %d to be allowed, got %v", i+1, err)
+		}
+	}
+
+	var quotaErr *QuotaExceededError
+	if err := q.Allow(); !errors.As(err, &quotaErr) {
+		t.Fatalf("Expected QuotaExceededError, got %v", err)
+	}
+
+	if err := q.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	// A quota restored from the same file must see the persisted count
+	cfg.Store, err = NewFileQuotaStore(path)
+	if err != nil {
+		t.Fatalf("NewFileQuotaStore failed: %v", err)
+	}
+	q, err = NewQuota("partner-api", cfg)
+	if err != nil {
+		t.Fatalf("NewQuota failed: %v", err)
+	}
+	if err := q.Allow(); !errors.As(err, &quotaErr) {
+		t.Errorf("Expected persisted quota to be exhausted, got %v", err)
+	}
+}
+
+// blockingQuotaStore fails every Save, after waiting for release.
+type blockingQuotaStore struct {
+	release chan struct{}
+	saves   atomic.Int32
+}
+
+func (s *blockingQuotaStore) Load(string) (QuotaState, error) { return QuotaState{}, nil }
+
+func (s *blockingQuotaStore) Save(string, QuotaState) error {
+	<-s.release
+	s.saves.Add(1)
+	return errors.New("disk full")
+}
+
+func TestQuota_AllowDoesNotWaitForStore(t *testing.T) {
+	store := &blockingQuotaStore{release: make(chan struct{})}
+	q, err := NewQuota("partner-api", &QuotaConfig{
+		Windows: []QuotaWindow{{Period: time.Hour, Limit: 100}},
+		Store:   store,
+		Logger:  logger.Nop,
+	})
+	if err != nil {
+		t.Fatalf("NewQuota failed: %v", err)
+	}
+
+	// Calls are neither held up nor failed by a slow, failing store.
+	for i := range 10 {
+		if err := q.Allow(); err != nil {
+			t.Fatalf("Expected call %d to be allowed, got %v", i+1, err)
+		}
+	}
+	close(store.release)
+
+	// The calls made while a save was in flight are saved together.
+	deadline := time.Now().Add(time.Second)
+	for store.saves.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if got := store.saves.Load(); got == 0 || got >= 10 {
+		t.Errorf("Expected the counters of 10 calls to be saved in batches, got %d saves", got)
+	}
+	if err := q.Flush(); err == nil {
+		t.Error("Expected Flush to return the store's error")
+	}
+}
+
+func TestQuotaStreamInterceptor(t *testing.T) {
+	q, err := NewQuota("partner-api", &QuotaConfig{Windows: []QuotaWindow{{Period: time.Hour, Limit: 2}}})
+	if err != nil {
+		t.Fatalf("NewQuota failed: %v", err)
+	}
+	unary := QuotaInterceptor("partner-api", q, nil)
+	stream := QuotaStreamInterceptor("partner-api", q, nil)
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	opened := 0
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		opened++
+		return nil, nil
+	}
+
+	// Streams and calls draw from the same quota.
+	if _, err := stream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/partner.Partner/Watch", streamer); err != nil {
+		t.Fatalf("Expected the first stream to be allowed, got %v", err)
+	}
+	if err := unary(context.Background(), "/partner.Partner/Get", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Expected the call to be allowed, got %v", err)
+	}
+	_, err = stream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, "/partner.Partner/Watch", streamer)
+	if status.Code(err) != codes.ResourceExhausted || opened != 1 {
+		t.Errorf("Expected the stream over quota to fail with ResourceExhausted, got %v (%d opened)", err, opened)
+	}
+}
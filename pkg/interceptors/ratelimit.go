@@ -0,0 +1,186 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimit is a token bucket refilled at QPS tokens per second holding at most Burst tokens.
+type RateLimit struct {
+	// QPS is the sustained number of calls per second
+	QPS float64
+	// Burst is the maximum number of calls allowed at once. Zero is treated as 1
+	Burst int
+}
+
+// RateLimitConfig holds configuration for client-side rate limiting of a service.
+type RateLimitConfig struct {
+	// RateLimit is the limit shared by all methods without their own entry in Methods.
+	// A zero QPS leaves those methods unlimited
+	RateLimit
+	// Methods gives methods their own buckets, keyed by full method name or a prefix ending in "*";
+	// the most specific key wins. Methods matching the same key share a bucket (default: nil)
+	Methods map[string]RateLimit
+	// Block makes calls wait for a token, up to their deadline, instead of failing fast with
+	// ResourceExhausted (default: false)
+	Block bool
+	// Clock is used to refill the buckets and wait for tokens. If nil, the real clock is used
+	Clock clock.Clock
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// reserve takes a token and returns how long the caller must wait before using it. If the
+// bucket is empty and block is false, nothing is taken and ok is false.
+// Must be called with the limiter's lock held.
+func (b *tokenBucket) reserve(now time.Time, block bool) (wait time.Duration, ok bool) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.QPS)
+		b.last = now
+	}
+	if b.tokens < 1 && !block {
+		return 0, false
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.limit.QPS * float64(time.Second)), true
+}
+
+// RateLimiter limits the rate of calls to a service with token buckets.
+type RateLimiter struct {
+	mu      sync.Mutex
+	cfg     *RateLimitConfig
+	clock   clock.Clock
+	service *tokenBucket
+	methods map[string]*tokenBucket
+}
+
+// NewRateLimiter creates a RateLimiter.
+func NewRateLimiter(cfg *RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{
+		cfg:     cfg,
+		clock:   clock.OrReal(cfg.Clock),
+		methods: make(map[string]*tokenBucket),
+	}
+	if cfg.QPS > 0 {
+		l.service = newTokenBucket(cfg.RateLimit, l.clock.Now())
+	}
+	return l
+}
+
+// bucket returns the bucket for method, or nil if the method is unlimited.
+// Must be called with l.mu held.
+func (l *RateLimiter) bucket(method string) *tokenBucket {
+	key, limit, ok := lookupMethodKey(l.cfg.Methods, method)
+	if !ok {
+		return l.service
+	}
+	if limit.QPS <= 0 {
+		return nil
+	}
+	b := l.methods[key]
+	if b == nil {
+		b = newTokenBucket(limit, l.clock.Now())
+		l.methods[key] = b
+	}
+	return b
+}
+
+// Wait takes a token for method. With Block set it waits until the token is available or ctx
+// is done; otherwise it fails immediately with ResourceExhausted when the bucket is empty.
+// It returns how long the call waited.
+func (l *RateLimiter) Wait(ctx context.Context, method string) (time.Duration, error) {
+	l.mu.Lock()
+	b := l.bucket(method)
+	if b == nil {
+		l.mu.Unlock()
+		return 0, nil
+	}
+	wait, ok := b.reserve(l.clock.Now(), l.cfg.Block)
+	l.mu.Unlock()
+
+	if !ok {
+		return 0, status.Errorf(codes.ResourceExhausted, "client-side rate limit exceeded for %s", method)
+	}
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && l.clock.Now().Add(wait).After(deadline) {
+		l.cancel(b)
+		return 0, status.Errorf(codes.ResourceExhausted, "client-side rate limit for %s would exceed the call deadline", method)
+	}
+
+	select {
+	case <-l.clock.After(wait):
+		return wait, nil
+	case <-ctx.Done():
+		l.cancel(b)
+		return 0, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// cancel returns a reserved token that will not be used.
+func (l *RateLimiter) cancel(b *tokenBucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b.tokens = min(float64(b.limit.Burst), b.tokens+1)
+}
+
+func recordRateLimit(m metrics.MetricsRecorder, serviceName, method string, wait time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		m.IncrementGRPCBlocked(serviceName, method, "rate_limit")
+	} else if wait > 0 {
+		m.RecordGRPCThrottled(serviceName, method, wait)
+	}
+}
+
+// RateLimitInterceptor creates an interceptor that limits the rate of calls with l.
+// Tokens are taken once per logical call, so place it outside the retry interceptor.
+func RateLimitInterceptor(serviceName string, l *RateLimiter, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		wait, err := l.Wait(ctx, method)
+		recordRateLimit(m, serviceName, method, wait, err)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RateLimitStreamInterceptor creates a stream interceptor that takes a token for every new stream.
+// Messages on an established stream are not limited.
+func RateLimitStreamInterceptor(serviceName string, l *RateLimiter, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		wait, err := l.Wait(ctx, method)
+		recordRateLimit(m, serviceName, method, wait, err)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
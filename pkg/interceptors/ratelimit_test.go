@@ -0,0 +1,86 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter_FailFast(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	l := NewRateLimiter(&RateLimitConfig{
+		RateLimit: RateLimit{QPS: 10, Burst: 2},
+		Methods:   map[string]RateLimit{"/svc.Svc/Export": {QPS: 1}},
+		Clock:     clk,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Wait(ctx, "/svc.Svc/Get"); err != nil {
+			t.Fatalf("Expected call %d within burst to be allowed, got %v", i+1, err)
+		}
+	}
+	if _, err := l.Wait(ctx, "/svc.Svc/Get"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted once the burst is used, got %v", err)
+	}
+
+	// Methods with their own limit do not share the service bucket.
+	if _, err := l.Wait(ctx, "/svc.Svc/Export"); err != nil {
+		t.Fatalf("Expected first Export call to be allowed, got %v", err)
+	}
+	if _, err := l.Wait(ctx, "/svc.Svc/Export"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected second Export call to be limited, got %v", err)
+	}
+
+	// 100ms refills one token at 10 QPS.
+	clk.Advance(100 * time.Millisecond)
+	if _, err := l.Wait(ctx, "/svc.Svc/Get"); err != nil {
+		t.Errorf("Expected call after refill to be allowed, got %v", err)
+	}
+}
+
+func TestRateLimiter_Block(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	l := NewRateLimiter(&RateLimitConfig{
+		RateLimit: RateLimit{QPS: 2, Burst: 1},
+		Block:     true,
+		Clock:     clk,
+	})
+
+	if _, err := l.Wait(context.Background(), "/svc.Svc/Get"); err != nil {
+		t.Fatalf("Expected first call to be allowed, got %v", err)
+	}
+
+	type result struct {
+		wait time.Duration
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		wait, err := l.Wait(context.Background(), "/svc.Svc/Get")
+		done <- result{wait, err}
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(500 * time.Millisecond)
+	r := <-done
+	if r.err != nil || r.wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for a token, got %v, %v", r.wait, r.err)
+	}
+
+	// A call whose deadline is too close fails fast and does not consume the token.
+	ctx, cancel := context.WithDeadline(context.Background(), clk.Now().Add(100*time.Millisecond))
+	defer cancel()
+	if _, err := l.Wait(ctx, "/svc.Svc/Get"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted for a deadline shorter than the wait, got %v", err)
+	}
+	clk.Advance(500 * time.Millisecond)
+	if wait, err := l.Wait(context.Background(), "/svc.Svc/Get"); err != nil || wait != 0 {
+		t.Errorf("Expected the refilled token to be available, got %v, %v", wait, err)
+	}
+}
@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequestTooLargeError is returned when a request exceeds the configured maximum message size
+// before it is sent to the server.
+type RequestTooLargeError struct {
+	Service string
+	Method  string
+	Size    int
+	Limit   int
+}
+
+// Error implements the error interface.
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("request to %s %s is %d bytes, exceeds limit of %d bytes", e.Service, e.Method, e.Size, e.Limit)
+}
+
+// GRPCStatus returns a ResourceExhausted status so the error is handled like other gRPC errors.
+func (e *RequestTooLargeError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// RequestSizeInterceptor creates an interceptor that rejects unary requests whose serialized
+// size exceeds maxSize before they are sent. Requests that are not proto messages are passed through.
+func RequestSizeInterceptor(serviceName string, maxSize int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if msg, ok := req.(proto.Message); ok && maxSize > 0 {
+			if size := proto.Size(msg); size > maxSize {
+				return &RequestTooLargeError{
+					Service: serviceName,
+					Method:  method,
+					Size:    size,
+					Limit:   maxSize,
+				}
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
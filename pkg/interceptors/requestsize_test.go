@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRequestSizeInterceptor(t *testing.T) {
+	called := false
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		called = true
+		return nil
+	}
+
+	interceptor := RequestSizeInterceptor("test-service", 16)
+	ctx := context.Background()
+
+	if err := interceptor(ctx, "test", wrapperspb.String("small"), nil, nil, invoker); err != nil {
+		t.Fatalf("Expected small request to pass, got error: %v", err)
+	}
+	if !called {
+		t.Error("Expected invoker to be called for small request")
+	}
+
+	called = false
+	err := interceptor(ctx, "test", wrapperspb.String(strings.Repeat("x", 64)), nil, nil, invoker)
+	if called {
+		t.Error("Expected invoker not to be called for oversized request")
+	}
+
+	var sizeErr *RequestTooLargeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("Expected RequestTooLargeError, got %v", err)
+	}
+	if sizeErr.Limit != 16 || sizeErr.Size <= 16 {
+		t.Errorf("Unexpected size/limit in error: size=%d, limit=%d", sizeErr.Size, sizeErr.Limit)
+	}
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, got %v", status.Code(err))
+	}
+}
@@ -0,0 +1,88 @@
+package interceptors
+
+import (
+	"math"
+	"time"
+)
+
+// ResetMode selects how accumulated failure state is cleared after successful calls.
+type ResetMode int
+
+const (
+	// ResetImmediate clears failure state on the first success.
+	ResetImmediate ResetMode = iota
+	// ResetAfterSuccesses clears failure state after a number of consecutive successes.
+	ResetAfterSuccesses
+	// ResetDecay lets failure state decay exponentially over time; successes do not clear it.
+	ResetDecay
+)
+
+// ResetPolicy controls when failure state held by the retry and circuit breaker interceptors
+// is reset, so brief flickers of success during an outage don't fully reset protection.
+// The zero value resets immediately.
+type ResetPolicy struct {
+	// Mode selects the reset behavior
+	Mode ResetMode
+	// Successes is the number of consecutive successes required with ResetAfterSuccesses
+	Successes int
+	// HalfLife is the time for the failure count to halve with ResetDecay
+	HalfLife time.Duration
+}
+
+// failureCounter counts failures and clears them according to a ResetPolicy.
+// It is not safe for concurrent use.
+type failureCounter struct {
+	policy    ResetPolicy
+	failures  float64
+	successes int
+	updated   time.Time
+}
+
+func newFailureCounter(policy ResetPolicy) *failureCounter {
+	return &failureCounter{policy: policy}
+}
+
+// decay applies time-based decay up to now.
+func (c *failureCounter) decay(now time.Time) {
+	if c.policy.Mode != ResetDecay || c.policy.HalfLife <= 0 || c.updated.IsZero() {
+		c.updated = now
+		return
+	}
+	elapsed := now.Sub(c.updated)
+	c.failures *= math.Pow(0.5, float64(elapsed)/float64(c.policy.HalfLife))
+	c.updated = now
+}
+
+// recordFailure adds a failure at now.
+func (c *failureCounter) recordFailure(now time.Time) {
+	c.decay(now)
+	c.failures++
+	c.successes = 0
+}
+
+// recordSuccess records a success at now, clearing failures as allowed by the policy.
+func (c *failureCounter) recordSuccess(now time.Time) {
+	c.decay(now)
+	switch c.policy.Mode {
+	case ResetImmediate:
+		c.failures = 0
+	case ResetAfterSuccesses:
+		c.successes++
+		if c.successes >= c.policy.Successes {
+			c.failures = 0
+			c.successes = 0
+		}
+	}
+}
+
+// count returns the current failure count at now.
+func (c *failureCounter) count(now time.Time) float64 {
+	c.decay(now)
+	return c.failures
+}
+
+// reset clears all state.
+func (c *failureCounter) reset() {
+	c.failures = 0
+	c.successes = 0
+}
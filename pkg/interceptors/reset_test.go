@@ -0,0 +1,34 @@
+package interceptors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailureCounter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		policy ResetPolicy
+		want   float64
+	}{
+		{"immediate", ResetPolicy{Mode: ResetImmediate}, 0},
+		{"after successes", ResetPolicy{Mode: ResetAfterSuccesses, Successes: 3}, 2},
+		{"decay", ResetPolicy{Mode: ResetDecay, HalfLife: time.Minute}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFailureCounter(tt.policy)
+			c.recordFailure(now)
+			c.recordFailure(now)
+			c.recordSuccess(now)
+			c.recordSuccess(now)
+
+			if got := c.count(now.Add(time.Minute)); got != tt.want {
+				t.Errorf("count() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
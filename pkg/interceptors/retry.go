@@ -0,0 +1,403 @@
+package interceptors
+
+import (
+	"context"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryConfig holds configuration for retry logic.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of retry attempts (default: 3)
+	MaxAttempts int
+	// InitialBackoff is the initial backoff duration (default: 100ms)
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum backoff duration (default: 3s)
+	MaxBackoff time.Duration
+	// BackoffMultiplier is the multiplier for exponential backoff (default: 2.0)
+	BackoffMultiplier float64
+	// Jitter randomizes each backoff by up to this fraction in either direction, so that clients
+	// failing together do not retry in lockstep. Delays requested by the server are not jittered (default: 0.2)
+	Jitter float64
+	// MaxServerDelay caps the delays requested by the server in a RetryInfo detail, so that a
+	// misbehaving server cannot stall calls for long. If zero, MaxBackoff caps them (default: 0)
+	MaxServerDelay time.Duration
+	// PerAttemptTimeout bounds each unary attempt, so that one hung attempt does not use up the
+	// whole call deadline. Attempts that time out are retried. Zero disables it (default: 0)
+	PerAttemptTimeout time.Duration
+	// SplitDeadline divides the time left before the call deadline evenly between the remaining
+	// unary attempts. With PerAttemptTimeout also set, the shorter timeout applies (default: false)
+	SplitDeadline bool
+	// RetryableCodes are the gRPC codes that should trigger a retry
+	RetryableCodes []codes.Code
+	// Clock is used to wait between attempts. If nil, the real clock is used
+	Clock clock.Clock
+	// AdaptiveBackoff starts the retries of a method from a longer backoff while its calls keep
+	// failing, multiplying InitialBackoff by BackoffMultiplier for each recent failure (default: false)
+	AdaptiveBackoff bool
+	// ResetPolicy controls when the per-method failures learned with AdaptiveBackoff are reset
+	// after successes (default: immediate)
+	ResetPolicy ResetPolicy
+	// Events receives an event for every retried attempt (default: nil)
+	Events EventSink
+	// Logger receives retry logs. If nil, the default logger is used
+	Logger logger.Logger
+	// Budget limits retries to a fraction of calls. Share one budget between all interceptors
+	// of a service (default: nil, unlimited)
+	Budget *RetryBudget
+	// Methods overrides the policy for individual methods, keyed by full method name or a prefix
+	// ending in "*"; the most specific key wins. A nil policy disables retries for the method, so
+	// that non-idempotent calls are never applied twice. Clock, ResetPolicy, Events, Logger and
+	// Budget always come from the outer config (default: nil)
+	Methods map[string]*RetryConfig
+}
+
+// DefaultRetryConfig returns a RetryConfig with sensible defaults.
+func DefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:       3,
+		InitialBackoff:    100 * time.Millisecond,
+		MaxBackoff:        3 * time.Second,
+		BackoffMultiplier: 2.0,
+		Jitter:            0.2,
+		RetryableCodes: []codes.Code{
+			codes.Unavailable,
+			codes.DeadlineExceeded,
+			codes.ResourceExhausted,
+			codes.Aborted,
+		},
+	}
+}
+
+// allowRetry withdraws a retry from the budget, if any, recording exhaustion in m.
+func (cfg *RetryConfig) allowRetry(serviceName, method string, m metrics.MetricsRecorder) bool {
+	if cfg.Budget == nil || cfg.Budget.withdraw() {
+		return true
+	}
+	if m != nil {
+		m.IncrementGRPCRetryBudgetExhausted(serviceName, method)
+	}
+	return false
+}
+
+// retryPolicies holds the resolved per-method policies of a RetryConfig.
+type retryPolicies struct {
+	base    *RetryConfig
+	methods map[string]*RetryConfig
+}
+
+func newRetryPolicies(cfg *RetryConfig) retryPolicies {
+	p := retryPolicies{base: cfg, methods: make(map[string]*RetryConfig, len(cfg.Methods))}
+	for key, policy := range cfg.Methods {
+		resolved := *cfg
+		if policy != nil {
+			resolved = *policy
+			resolved.Clock = cfg.Clock
+			resolved.ResetPolicy = cfg.ResetPolicy
+			resolved.Events = cfg.Events
+			resolved.Logger = cfg.Logger
+			resolved.Budget = cfg.Budget
+		} else {
+			resolved.MaxAttempts = 1
+		}
+		resolved.Methods = nil
+		p.methods[key] = &resolved
+	}
+	return p
+}
+
+// forMethod returns the policy that applies to method.
+func (p retryPolicies) forMethod(method string) *RetryConfig {
+	if policy, ok := lookupMethod(p.methods, method); ok {
+		return policy
+	}
+	return p.base
+}
+
+// attemptContext derives the context for an attempt from the call context, applying
+// PerAttemptTimeout and SplitDeadline.
+func (cfg *RetryConfig) attemptContext(ctx context.Context, attempt int, now time.Time) (context.Context, context.CancelFunc) {
+	timeout := cfg.PerAttemptTimeout
+	if deadline, ok := ctx.Deadline(); ok && cfg.SplitDeadline {
+		split := deadline.Sub(now) / time.Duration(cfg.MaxAttempts-attempt+1)
+		if timeout <= 0 || split < timeout {
+			timeout = split
+		}
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// retryDelay returns how long to wait before the next attempt: the delay from a RetryInfo
+// detail on the status if the server sent one, capped at MaxServerDelay, otherwise backoff with
+// jitter applied, still capped at MaxBackoff.
+func (cfg *RetryConfig) retryDelay(st *status.Status, backoff time.Duration) time.Duration {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			maxDelay := cfg.MaxServerDelay
+			if maxDelay <= 0 {
+				maxDelay = cfg.MaxBackoff
+			}
+			return min(max(info.GetRetryDelay().AsDuration(), 0), maxDelay)
+		}
+	}
+	if cfg.Jitter <= 0 {
+		return backoff
+	}
+	jitter := min(cfg.Jitter, 1) * (2*rand.Float64() - 1)
+	return min(time.Duration(float64(backoff)*(1+jitter)), cfg.MaxBackoff)
+}
+
+// exceedsDeadline reports whether waiting delay would leave no time before the call deadline.
+func exceedsDeadline(ctx context.Context, now time.Time, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && !now.Add(delay).Before(deadline)
+}
+
+// retryState remembers recent retryable failures per method. With cfg.AdaptiveBackoff, retries
+// start from a longer backoff while failures persist; cfg.ResetPolicy controls when they are
+// forgotten.
+type retryState struct {
+	mu       sync.Mutex
+	policy   ResetPolicy
+	counters map[string]*failureCounter
+}
+
+func (s *retryState) counter(method string) *failureCounter {
+	c, ok := s.counters[method]
+	if !ok {
+		c = newFailureCounter(s.policy)
+		s.counters[method] = c
+	}
+	return c
+}
+
+// initialBackoff returns the backoff to start from for method, scaled by its recent failures if
+// cfg.AdaptiveBackoff is set.
+func (s *retryState) initialBackoff(cfg *RetryConfig, method string, now time.Time) time.Duration {
+	var failures float64
+	if cfg.AdaptiveBackoff {
+		s.mu.Lock()
+		failures = s.counter(method).count(now)
+		s.mu.Unlock()
+	}
+
+	backoff := time.Duration(float64(cfg.InitialBackoff) * math.Pow(cfg.BackoffMultiplier, failures))
+	return min(backoff, cfg.MaxBackoff)
+}
+
+func (s *retryState) recordFailure(method string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter(method).recordFailure(now)
+}
+
+func (s *retryState) recordSuccess(method string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter(method).recordSuccess(now)
+}
+
+// RetryInterceptor creates a retry interceptor for gRPC unary calls.
+// It automatically retries failed calls with exponential backoff.
+func RetryInterceptor(cfg *RetryConfig, serviceName string, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	if cfg == nil {
+		cfg = DefaultRetryConfig()
+	}
+	clk := clock.OrReal(cfg.Clock)
+	log := logger.OrDefault(cfg.Logger)
+	state := &retryState{policy: cfg.ResetPolicy, counters: make(map[string]*failureCounter)}
+	policies := newRetryPolicies(cfg)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		cfg := policies.forMethod(method)
+		var lastErr error
+		backoff := state.initialBackoff(cfg, method, clk.Now())
+
+		attempts := 0
+		if m != nil {
+			defer func() { m.RecordGRPCAttempts(serviceName, method, attempts) }()
+		}
+		if cfg.Budget != nil {
+			cfg.Budget.deposit()
+		}
+
+		for attempt := 1; attempt <= cfg.MaxAttempts; attempt++ {
+			attempts = attempt
+			attemptCtx, cancel := cfg.attemptContext(ctx, attempt, clk.Now())
+			err := invoker(attemptCtx, method, req, reply, cc, opts...)
+			attemptTimedOut := ctx.Err() == nil && attemptCtx.Err() != nil
+			cancel()
+			if m != nil {
+				m.RecordGRPCAttempt(serviceName, method, status.Code(err).String(), attempt)
+			}
+
+			if err == nil {
+				state.recordSuccess(method, clk.Now())
+				if attempt > 1 {
+					log.Infof("gRPC call succeeded after %d attempts: method=%s", attempt, method)
+				}
+				return nil
+			}
+
+			lastErr = err
+			st, ok := status.FromError(err)
+			if !ok {
+				return err
+			}
+
+			retryable := attemptTimedOut
+			for _, code := range cfg.RetryableCodes {
+				if st.Code() == code {
+					retryable = true
+					break
+				}
+			}
+
+			if !retryable {
+				return err
+			}
+
+			state.recordFailure(method, clk.Now())
+			if attempt >= cfg.MaxAttempts {
+				if m != nil && cfg.MaxAttempts > 1 {
+					m.IncrementGRPCRetryExhausted(serviceName, method)
+				}
+				if cfg.Events != nil && cfg.MaxAttempts > 1 {
+					cfg.Events.Emit(ctx, Event{
+						Kind:    EventRetryExhausted,
+						Service: serviceName,
+						Method:  method,
+						Code:    st.Code(),
+						Err:     err,
+						Attempt: attempt,
+					})
+				}
+				return err
+			}
+			delay := cfg.retryDelay(st, backoff)
+			if exceedsDeadline(ctx, clk.Now(), delay) {
+				log.Warnf("Not retrying, the call deadline expires within the %v retry delay: method=%s, code=%s", delay, method, st.Code())
+				return err
+			}
+			if !cfg.allowRetry(serviceName, method, m) {
+				log.Warnf("Retry budget exhausted, not retrying: method=%s, code=%s", method, st.Code())
+				return err
+			}
+
+			if m != nil {
+				m.IncrementGRPCRetry(serviceName, method)
+			}
+
+			log.Warnf("gRPC call failed (attempt %d/%d): method=%s, code=%s, retrying in %v",
+				attempt, cfg.MaxAttempts, method, st.Code(), delay)
+			if cfg.Events != nil {
+				cfg.Events.Emit(ctx, Event{
+					Kind:     EventRetry,
+					Service:  serviceName,
+					Method:   method,
+					Code:     st.Code(),
+					Err:      err,
+					Duration: delay,
+					Attempt:  attempt,
+				})
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clk.After(delay):
+			}
+
+			backoff = time.Duration(float64(backoff) * cfg.BackoffMultiplier)
+			if backoff > cfg.MaxBackoff {
+				backoff = cfg.MaxBackoff
+			}
+		}
+
+		return lastErr
+	}
+}
+
+// RetryStreamInterceptor creates a retry interceptor for gRPC stream calls. Only failures to
+// create the stream are retried, since no messages have been sent at that point; errors once
+// the stream is established are returned to the caller.
+func RetryStreamInterceptor(cfg *RetryConfig, serviceName string, m metrics.MetricsRecorder) grpc.StreamClientInterceptor {
+	if cfg == nil {
+		cfg = DefaultRetryConfig()
+	}
+	clk := clock.OrReal(cfg.Clock)
+	log := logger.OrDefault(cfg.Logger)
+	state := &retryState{policy: cfg.ResetPolicy, counters: make(map[string]*failureCounter)}
+	policies := newRetryPolicies(cfg)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cfg := policies.forMethod(method)
+		backoff := state.initialBackoff(cfg, method, clk.Now())
+		if cfg.Budget != nil {
+			cfg.Budget.deposit()
+		}
+
+		for attempt := 1; ; attempt++ {
+			stream, err := streamer(ctx, desc, cc, method, opts...)
+			if m != nil {
+				m.RecordGRPCAttempt(serviceName, method, status.Code(err).String(), attempt)
+			}
+			if err == nil {
+				state.recordSuccess(method, clk.Now())
+				return stream, nil
+			}
+
+			st, ok := status.FromError(err)
+			if !ok || !slices.Contains(cfg.RetryableCodes, st.Code()) {
+				return nil, err
+			}
+
+			state.recordFailure(method, clk.Now())
+			if attempt >= cfg.MaxAttempts {
+				if m != nil && cfg.MaxAttempts > 1 {
+					m.IncrementGRPCRetryExhausted(serviceName, method)
+				}
+				return nil, err
+			}
+			delay := cfg.retryDelay(st, backoff)
+			if exceedsDeadline(ctx, clk.Now(), delay) {
+				log.Warnf("Not retrying stream, the call deadline expires within the %v retry delay: method=%s, code=%s", delay, method, st.Code())
+				return nil, err
+			}
+			if !cfg.allowRetry(serviceName, method, m) {
+				log.Warnf("Retry budget exhausted, not retrying stream: method=%s, code=%s", method, st.Code())
+				return nil, err
+			}
+
+			if m != nil {
+				m.IncrementGRPCRetry(serviceName, method)
+			}
+
+			log.Warnf("gRPC stream failed to start (attempt %d/%d): method=%s, code=%s, retrying in %v",
+				attempt, cfg.MaxAttempts, method, st.Code(), delay)
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-clk.After(delay):
+			}
+
+			backoff = min(time.Duration(float64(backoff)*cfg.BackoffMultiplier), cfg.MaxBackoff)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestDefaultRetryConfig(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	if cfg == nil {
+		t.Fatal("DefaultRetryConfig returned nil")
+	}
+	if cfg.MaxAttempts <= 0 {
+		t.Error("MaxAttempts should be positive")
+	}
+	if cfg.InitialBackoff <= 0 {
+		t.Error("InitialBackoff should be positive")
+	}
+	if cfg.MaxBackoff <= 0 {
+		t.Error("MaxBackoff should be positive")
+	}
+	if cfg.BackoffMultiplier <= 0 {
+		t.Error("BackoffMultiplier should be positive")
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	cfg := &RetryConfig{
+		MaxAttempts:       3,
+		InitialBackoff:    10 * time.Millisecond,
+		MaxBackoff:        100 * time.Millisecond,
+		BackoffMultiplier: 2.0,
+		RetryableCodes:    []codes.Code{codes.Unavailable},
+	}
+
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		attempts++
+		if attempts < 3 {
+			return status.Error(codes.Unavailable, "retry")
+		}
+		return nil
+	}
+
+	interceptor := RetryInterceptor(cfg, "test-service", nil)
+	ctx := context.Background()
+	err := interceptor(ctx, "test", nil, nil, nil, invoker)
+
+	if err != nil {
+		t.Errorf("Expected success after retries, got error: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryInterceptor_Budget(t *testing.T) {
+	budget := NewRetryBudget(&RetryBudgetConfig{Ratio: 0.5, MinRetries: 1})
+	cfg := &RetryConfig{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		MaxBackoff:        time.Millisecond,
+		BackoffMultiplier: 1,
+		RetryableCodes:    []codes.Code{codes.Unavailable},
+		Budget:            budget,
+	}
+
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		attempts++
+		return status.Error(codes.Unavailable, "down")
+	}
+	interceptor := RetryInterceptor(cfg, "test-service", nil)
+
+	// The budget starts full with one retry, so the first call retries once and then stops.
+	if err := interceptor(context.Background(), "test", nil, nil, nil, invoker); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts with one retry in the budget, got %d", attempts)
+	}
+
+	// The next call deposits half a retry, which is not enough to retry.
+	attempts = 0
+	_ = interceptor(context.Background(), "test", nil, nil, nil, invoker)
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt with an exhausted budget, got %d", attempts)
+	}
+
+	// A second deposit earns another retry.
+	attempts = 0
+	_ = interceptor(context.Background(), "test", nil, nil, nil, invoker)
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts after the budget refilled, got %d", attempts)
+	}
+}
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordingSink) Emit(_ context.Context, e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+func TestRetryInterceptor_HonorsRetryInfo(t *testing.T) {
+	sink := &recordingSink{}
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Second
+	cfg.Events = sink
+
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		attempts++
+		if attempts > 1 {
+			return nil
+		}
+		st, _ := status.New(codes.Unavailable, "overloaded").WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(5 * time.Millisecond),
+		})
+		return st.Err()
+	}
+
+	if err := RetryInterceptor(cfg, "test-service", nil)(context.Background(), "test", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Expected success after retry, got %v", err)
+	}
+	if len(sink.events) != 1 || sink.events[0].Duration != 5*time.Millisecond {
+		t.Errorf("Expected one retry after the server's 5ms delay, got %+v", sink.events)
+	}
+}
+
+func TestRetryConfig_ClampsServerDelay(t *testing.T) {
+	st, _ := status.New(codes.Unavailable, "overloaded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Hour),
+	})
+
+	cfg := DefaultRetryConfig()
+	if got := cfg.retryDelay(st, cfg.InitialBackoff); got != cfg.MaxBackoff {
+		t.Errorf("Expected the server's delay to be capped at MaxBackoff %v, got %v", cfg.MaxBackoff, got)
+	}
+	cfg.MaxServerDelay = 10 * time.Second
+	if got := cfg.retryDelay(st, cfg.InitialBackoff); got != 10*time.Second {
+		t.Errorf("Expected the server's delay to be capped at MaxServerDelay 10s, got %v", got)
+	}
+}
+
+func TestRetryInterceptor_EmitsRetryExhausted(t *testing.T) {
+	sink := &recordingSink{}
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Millisecond
+	cfg.Events = sink
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	if err := RetryInterceptor(cfg, "test-service", nil)(context.Background(), "test", nil, nil, nil, invoker); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.Kind != EventRetryExhausted || last.Attempt != cfg.MaxAttempts {
+		t.Errorf("Expected EventRetryExhausted after %d attempts, got %+v", cfg.MaxAttempts, last)
+	}
+}
+
+func TestRetryInterceptor_RecordsAttempts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.NewMetricsWithRegistry(reg, "", nil)
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Millisecond
+
+	// The first call succeeds on its second attempt, the second fails all three.
+	calls := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if calls == 2 {
+			return nil
+		}
+		return status.Error(codes.Unavailable, "down")
+	}
+	interceptor := RetryInterceptor(cfg, "test-service", m)
+	if err := interceptor(context.Background(), "test", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Expected success after retry, got %v", err)
+	}
+	if err := interceptor(context.Background(), "test", nil, nil, nil, invoker); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable, got %v", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	attempts := make(map[string]float64)
+	var exhausted float64
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch f.GetName() {
+			case "grpc_client_attempts_total":
+				attempts[labels["attempt"]+" "+labels["code"]] = metric.GetCounter().GetValue()
+			case "grpc_client_retry_exhausted_total":
+				exhausted = metric.GetCounter().GetValue()
+			}
+		}
+	}
+	want := map[string]float64{"1 Unavailable": 2, "2 OK": 1, "2 Unavailable": 1, "3 Unavailable": 1}
+	if len(attempts) != len(want) {
+		t.Errorf("attempts = %v, want %v", attempts, want)
+	}
+	for k, v := range want {
+		if attempts[k] != v {
+			t.Errorf("attempts[%s] = %v, want %v", k, attempts[k], v)
+		}
+	}
+	if exhausted != 1 {
+		t.Errorf("retry_exhausted_total = %v, want 1", exhausted)
+	}
+}
+
+func TestRetryInterceptor_GivesUpWhenDelayExceedsDeadline(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Minute
+	cfg.MaxBackoff = time.Minute
+
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		attempts++
+		return status.Error(codes.Unavailable, "down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := RetryInterceptor(cfg, "test-service", nil)(ctx, "test", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable || attempts != 1 {
+		t.Errorf("Expected the Unavailable error after 1 attempt, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetryInterceptor_PerAttemptTimeout(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Millisecond
+	cfg.RetryableCodes = []codes.Code{codes.Unavailable}
+	cfg.PerAttemptTimeout = 20 * time.Millisecond
+
+	attempts := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		attempts++
+		if attempts == 1 {
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := RetryInterceptor(cfg, "test-service", nil)(ctx, "test", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Expected the timed out attempt to be retried, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryConfig_SplitDeadline(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	cfg.SplitDeadline = true
+	now := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(3*time.Second))
+	defer cancel()
+
+	attemptCtx, attemptCancel := cfg.attemptContext(ctx, 1, now)
+	defer attemptCancel()
+	deadline, _ := attemptCtx.Deadline()
+	if got := deadline.Sub(now); got > time.Second+10*time.Millisecond || got < time.Second-10*time.Millisecond {
+		t.Errorf("Expected the first of 3 attempts to get about 1s, got %v", got)
+	}
+}
+
+func TestRetryConfig_Jitter(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	st := status.New(codes.Unavailable, "down")
+	for range 100 {
+		delay := cfg.retryDelay(st, time.Second)
+		if delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("Expected delay within 20%% of 1s, got %v", delay)
+		}
+	}
+}
+
+func TestRetryInterceptor_MethodPolicies(t *testing.T) {
+	cfg := DefaultRetryConfig()
+	cfg.InitialBackoff = time.Millisecond
+	cfg.MaxAttempts = 1
+	readPolicy := *cfg
+	readPolicy.MaxAttempts = 3
+	cfg.Methods = map[string]*RetryConfig{
+		"/orders.Orders/Get*":     &readPolicy,
+		"/orders.Orders/GetQuote": nil,
+	}
+
+	interceptor := RetryInterceptor(cfg, "test-service", nil)
+	tests := []struct {
+		method   string
+		attempts int
+	}{
+		{"/orders.Orders/GetOrder", 3},
+		{"/orders.Orders/GetQuote", 1},
+		{"/orders.Orders/CreateOrder", 1},
+	}
+	for _, tt := range tests {
+		attempts := 0
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			attempts++
+			return status.Error(codes.DeadlineExceeded, "slow")
+		}
+		_ = interceptor(context.Background(), tt.method, nil, nil, nil, invoker)
+		if attempts != tt.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tt.method, tt.attempts, attempts)
+		}
+	}
+}
+
+func TestRetryState_AdaptiveBackoff(t *testing.T) {
+	now := time.Now()
+	for _, adaptive := range []bool{false, true} {
+		cfg := &RetryConfig{
+			InitialBackoff:    10 * time.Millisecond,
+			MaxBackoff:        time.Second,
+			BackoffMultiplier: 2,
+			AdaptiveBackoff:   adaptive,
+		}
+		state := &retryState{policy: ResetPolicy{Mode: ResetAfterSuccesses, Successes: 2}, counters: make(map[string]*failureCounter)}
+		state.recordFailure("/svc/Method", now)
+		state.recordFailure("/svc/Method", now)
+		state.recordSuccess("/svc/Method", now)
+
+		want := 10 * time.Millisecond
+		if adaptive {
+			// One success is not enough to forget the failures under the ResetPolicy.
+			want = 40 * time.Millisecond
+		}
+		if got := state.initialBackoff(cfg, "/svc/Method", now); got != want {
+			t.Errorf("AdaptiveBackoff=%v: initialBackoff() = %v, want %v", adaptive, got, want)
+		}
+		if got := state.initialBackoff(cfg, "/svc/Other", now); got != 10*time.Millisecond {
+			t.Errorf("AdaptiveBackoff=%v: initialBackoff() of another method = %v, want 10ms", adaptive, got)
+		}
+
+		state.recordSuccess("/svc/Method", now)
+		if got := state.initialBackoff(cfg, "/svc/Method", now); got != 10*time.Millisecond {
+			t.Errorf("AdaptiveBackoff=%v: initialBackoff() after the failures were reset = %v, want 10ms", adaptive, got)
+		}
+	}
+}
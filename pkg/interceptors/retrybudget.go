@@ -0,0 +1,65 @@
+package interceptors
+
+import "sync"
+
+// RetryBudgetConfig holds configuration for a retry budget.
+type RetryBudgetConfig struct {
+	// Ratio is the maximum number of retries per call, e.g. 0.2 lets retries add at most 20% to
+	// the traffic a service receives (default: 0.2)
+	Ratio float64
+	// MinRetries is the number of retries available when the budget is created and the most that
+	// can be saved up, so that services with little traffic can still retry (default: 10)
+	MinRetries float64
+}
+
+// DefaultRetryBudgetConfig returns a RetryBudgetConfig with sensible defaults.
+func DefaultRetryBudgetConfig() *RetryBudgetConfig {
+	return &RetryBudgetConfig{
+		Ratio:      0.2,
+		MinRetries: 10,
+	}
+}
+
+// RetryBudget limits retries to a fraction of calls, as recommended by the Google SRE book, so that
+// retries do not multiply the load on a backend that is already failing. Every call deposits Ratio
+// tokens and every retry withdraws one. It is safe for concurrent use and is meant to be shared
+// by all retry interceptors of a service.
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+// NewRetryBudget creates a RetryBudget. If cfg is nil, DefaultRetryBudgetConfig() is used.
+func NewRetryBudget(cfg *RetryBudgetConfig) *RetryBudget {
+	if cfg == nil {
+		cfg = DefaultRetryBudgetConfig()
+	}
+	return &RetryBudget{ratio: cfg.Ratio, max: cfg.MinRetries, tokens: cfg.MinRetries}
+}
+
+// deposit credits the budget for a new call.
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.max, b.tokens+b.ratio)
+}
+
+// withdraw takes one retry from the budget, reporting false if it is exhausted.
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Available returns the number of retries currently allowed.
+func (b *RetryBudget) Available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
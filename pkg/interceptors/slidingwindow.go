@@ -0,0 +1,119 @@
+package interceptors
+
+import "time"
+
+// FailureRateConfig configures a breaker that opens on the share of failed calls in a rolling
+// window rather than on a failure count.
+type FailureRateConfig struct {
+	// Threshold is the failure ratio, between 0 and 1, at which the breaker opens
+	Threshold float64
+	// MinimumRequests is the number of calls the window must hold before the breaker can open,
+	// so that a handful of failures at low traffic does not trip it (default: 20)
+	MinimumRequests int
+	// WindowSize computes the rate over this many most recent calls. Ignored if WindowDuration is set (default: 100)
+	WindowSize int
+	// WindowDuration computes the rate over the calls in this trailing period instead of a fixed
+	// number of calls (default: 0, count based)
+	WindowDuration time.Duration
+}
+
+// DefaultFailureRateConfig returns a FailureRateConfig that opens at a 50% failure rate over the
+// last 100 calls.
+func DefaultFailureRateConfig() *FailureRateConfig {
+	return &FailureRateConfig{
+		Threshold:       0.5,
+		MinimumRequests: 20,
+		WindowSize:      100,
+	}
+}
+
+// windowBuckets is the number of buckets a time-based window is divided into.
+const windowBuckets = 10
+
+type windowBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// slidingWindow tracks call outcomes over the last WindowSize calls or the last WindowDuration.
+// It is not safe for concurrent use.
+type slidingWindow struct {
+	cfg *FailureRateConfig
+
+	// outcomes is a ring of the most recent results of a count-based window, true for failures
+	outcomes []bool
+	next     int
+	filled   int
+	failures int
+
+	// buckets divide a time-based window into windowBuckets slots of width each
+	buckets []windowBucket
+	width   time.Duration
+}
+
+func newSlidingWindow(cfg *FailureRateConfig) *slidingWindow {
+	w := &slidingWindow{cfg: cfg}
+	if cfg.WindowDuration > 0 {
+		w.buckets = make([]windowBucket, windowBuckets)
+		w.width = max(cfg.WindowDuration/windowBuckets, 1)
+	} else {
+		w.outcomes = make([]bool, max(cfg.WindowSize, 1))
+	}
+	return w
+}
+
+// record adds the outcome of a call at now.
+func (w *slidingWindow) record(now time.Time, failed bool) {
+	if w.buckets == nil {
+		if w.filled == len(w.outcomes) {
+			if w.outcomes[w.next] {
+				w.failures--
+			}
+		} else {
+			w.filled++
+		}
+		w.outcomes[w.next] = failed
+		if failed {
+			w.failures++
+		}
+		w.next = (w.next + 1) % len(w.outcomes)
+		return
+	}
+
+	start := now.Truncate(w.width)
+	b := &w.buckets[int(start.UnixNano()/int64(w.width))%len(w.buckets)]
+	if !b.start.Equal(start) {
+		*b = windowBucket{start: start}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+// counts returns the number of calls and failures in the window at now.
+func (w *slidingWindow) counts(now time.Time) (total, failures int) {
+	if w.buckets == nil {
+		return w.filled, w.failures
+	}
+	for _, b := range w.buckets {
+		if !b.start.IsZero() && now.Sub(b.start) < w.cfg.WindowDuration {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+// tripped reports whether the failure rate at now has reached the threshold with enough calls.
+func (w *slidingWindow) tripped(now time.Time) bool {
+	total, failures := w.counts(now)
+	return total > 0 && total >= w.cfg.MinimumRequests && float64(failures)/float64(total) >= w.cfg.Threshold
+}
+
+func (w *slidingWindow) reset() {
+	clear(w.outcomes)
+	w.next, w.filled, w.failures = 0, 0, 0
+	clear(w.buckets)
+}
@@ -0,0 +1,60 @@
+package interceptors
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// observedStream wraps a client stream and reports how it finished. onFinish is called once,
+// with nil when the stream ends cleanly (io.EOF from RecvMsg) or the error that ended it.
+// The optional onSend and onRecv callbacks are called with every message sent and received.
+// For streams without server streaming, the single response also ends the stream.
+type observedStream struct {
+	grpc.ClientStream
+	singleResponse bool
+	onFinish       func(err error)
+	onSend         func(msg interface{})
+	onRecv         func(msg interface{})
+
+	once sync.Once
+}
+
+func (s *observedStream) finish(err error) {
+	if s.onFinish != nil {
+		s.once.Do(func() { s.onFinish(err) })
+	}
+}
+
+func (s *observedStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		if s.onSend != nil {
+			s.onSend(m)
+		}
+	} else if !errors.Is(err, io.EOF) {
+		// io.EOF means the stream ended; its status is returned by RecvMsg.
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *observedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		if s.onRecv != nil {
+			s.onRecv(m)
+		}
+		if s.singleResponse {
+			s.finish(nil)
+		}
+	case errors.Is(err, io.EOF):
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+)
+
+// TimeoutInterceptor creates an interceptor that applies a deadline from timeouts to calls whose
+// context has none. Keys are full method names (e.g. "/reports.Reports/Export") or patterns with a
+// trailing "*" (e.g. "/reports.Reports/*"); the most specific key wins. Deadlines set by the caller
+// are left unchanged.
+func TimeoutInterceptor(timeouts map[string]time.Duration) grpc.UnaryClientInterceptor {
+	return DefaultTimeoutInterceptor("", 0, timeouts, nil)
+}
+
+// DefaultTimeoutInterceptor is TimeoutInterceptor with a fallback: calls to methods without a key
+// in timeouts get defaultTimeout, unless it is zero. Every deadline applied is counted in m, if
+// not nil, so that callers relying on it can be found.
+func DefaultTimeoutInterceptor(serviceName string, defaultTimeout time.Duration, timeouts map[string]time.Duration, m metrics.MetricsRecorder) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			timeout, ok := lookupMethod(timeouts, method)
+			if !ok {
+				timeout = defaultTimeout
+			}
+			if timeout > 0 {
+				if m != nil {
+					m.IncrementGRPCDefaultTimeout(serviceName, method)
+				}
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
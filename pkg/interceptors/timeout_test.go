@@ -0,0 +1,91 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestLookupMethod(t *testing.T) {
+	timeouts := map[string]time.Duration{
+		"/reports.Reports/*":      time.Minute,
+		"/reports.Reports/Export": 10 * time.Minute,
+		"/reports.*":              30 * time.Second,
+	}
+
+	tests := []struct {
+		method string
+		want   time.Duration
+		found  bool
+	}{
+		{"/reports.Reports/Export", 10 * time.Minute, true},
+		{"/reports.Reports/Get", time.Minute, true},
+		{"/reports.Archive/Get", 30 * time.Second, true},
+		{"/users.Users/Get", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, found := lookupMethod(timeouts, tt.method)
+		if got != tt.want || found != tt.found {
+			t.Errorf("lookupMethod(%q) = %v, %v; want %v, %v", tt.method, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	interceptor := TimeoutInterceptor(map[string]time.Duration{"/reports.Reports/*": time.Minute})
+
+	var deadline time.Time
+	var hasDeadline bool
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, hasDeadline = ctx.Deadline()
+		return nil
+	}
+
+	_ = interceptor(context.Background(), "/reports.Reports/Export", nil, nil, nil, invoker)
+	if !hasDeadline || time.Until(deadline) < 59*time.Second {
+		t.Errorf("expected a deadline about a minute away, got %v (set=%v)", deadline, hasDeadline)
+	}
+
+	_ = interceptor(context.Background(), "/users.Users/Get", nil, nil, nil, invoker)
+	if hasDeadline {
+		t.Error("expected no deadline for an unconfigured method")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_ = interceptor(ctx, "/reports.Reports/Export", nil, nil, nil, invoker)
+	if time.Until(deadline) < 59*time.Minute {
+		t.Errorf("caller deadline was overridden: %v", deadline)
+	}
+}
+
+func TestDefaultTimeoutInterceptor(t *testing.T) {
+	interceptor := DefaultTimeoutInterceptor("reports", time.Second, map[string]time.Duration{"/reports.Reports/Export": time.Minute}, nil)
+
+	var deadline time.Time
+	var hasDeadline bool
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, hasDeadline = ctx.Deadline()
+		return nil
+	}
+
+	_ = interceptor(context.Background(), "/reports.Reports/Get", nil, nil, nil, invoker)
+	if !hasDeadline || time.Until(deadline) > time.Second {
+		t.Errorf("expected the default deadline about a second away, got %v (set=%v)", deadline, hasDeadline)
+	}
+
+	_ = interceptor(context.Background(), "/reports.Reports/Export", nil, nil, nil, invoker)
+	if !hasDeadline || time.Until(deadline) < 59*time.Second {
+		t.Errorf("expected the method timeout to take precedence, got %v (set=%v)", deadline, hasDeadline)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_ = interceptor(ctx, "/reports.Reports/Get", nil, nil, nil, invoker)
+	if time.Until(deadline) < 59*time.Minute {
+		t.Errorf("caller deadline was overridden: %v", deadline)
+	}
+}
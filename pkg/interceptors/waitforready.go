@@ -0,0 +1,22 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// WaitForReadyInterceptor creates an interceptor that sets grpc.WaitForReady on calls according to
+// methods, keyed by full method name or a pattern with a trailing "*"; the most specific key wins.
+// Calls to other methods keep the connection's default.
+//
+// gRPC passes the connection's default call options ahead of the call's own, so the option is
+// appended to take precedence over the default; it also overrides a grpc.WaitForReady at the call site.
+func WaitForReadyInterceptor(methods map[string]bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if waitForReady, ok := lookupMethod(methods, method); ok {
+			opts = append(opts, grpc.WaitForReady(waitForReady))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,46 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestWaitForReadyInterceptor(t *testing.T) {
+	interceptor := WaitForReadyInterceptor(map[string]bool{
+		"/orders.Orders/*":      true,
+		"/orders.Orders/Create": false,
+	})
+
+	// waitForReady returns the wait-for-ready setting the call ends up with, as gRPC applies options
+	// in order, and whether any was set.
+	waitForReady := func(method string, opts ...grpc.CallOption) (bool, bool) {
+		var got, set bool
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			for _, opt := range opts {
+				if o, ok := opt.(grpc.FailFastCallOption); ok {
+					got, set = !o.FailFast, true
+				}
+			}
+			return nil
+		}
+		if err := interceptor(context.Background(), method, nil, nil, nil, invoker, opts...); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		return got, set
+	}
+
+	if got, set := waitForReady("/orders.Orders/Get"); !set || !got {
+		t.Errorf("Expected the pattern to set wait-for-ready, got %v (set %v)", got, set)
+	}
+	if got, set := waitForReady("/orders.Orders/Create"); !set || got {
+		t.Errorf("Expected the exact method to override the pattern, got %v (set %v)", got, set)
+	}
+	if _, set := waitForReady("/billing.Billing/Charge"); set {
+		t.Error("Expected other methods to keep the connection's default")
+	}
+	if got, _ := waitForReady("/orders.Orders/Get", grpc.WaitForReady(false)); !got {
+		t.Error("Expected the configured setting to override the call site's")
+	}
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// NewSlog adapts a slog logger to Logger. Messages are formatted before being passed to l, and
+// the key/value pairs of structured messages become attributes.
+func NewSlog(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) log(level slog.Level, template string, args []interface{}) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(template, args...))
+}
+
+func (s slogLogger) Debugf(template string, args ...interface{}) {
+	s.log(slog.LevelDebug, template, args)
+}
+
+func (s slogLogger) Infof(template string, args ...interface{}) {
+	s.log(slog.LevelInfo, template, args)
+}
+
+func (s slogLogger) Warnf(template string, args ...interface{}) {
+	s.log(slog.LevelWarn, template, args)
+}
+
+func (s slogLogger) Errorf(template string, args ...interface{}) {
+	s.log(slog.LevelError, template, args)
+}
+
+func (s slogLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	s.l.Debug(msg, keysAndValues...)
+}
+
+func (s slogLogger) Infow(msg string, keysAndValues ...interface{}) {
+	s.l.Info(msg, keysAndValues...)
+}
+
+func (s slogLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	s.l.Warn(msg, keysAndValues...)
+}
+
+func (s slogLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	s.l.Error(msg, keysAndValues...)
+}
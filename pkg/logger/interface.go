@@ -0,0 +1,210 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger is the logging interface used by the connection manager and its interceptors.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Debugf(template string, args ...interface{})
+	Infof(template string, args ...interface{})
+	Warnf(template string, args ...interface{})
+	Errorf(template string, args ...interface{})
+}
+
+// StructuredLogger is a Logger that also logs messages with key/value pairs as separate fields,
+// like zap's SugaredLogger. The zap, slog and zerolog adapters implement it.
+type StructuredLogger interface {
+	Logger
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// Structured returns l as a StructuredLogger. Loggers that do not implement it get the key/value
+// pairs appended to the message as "key=value".
+func Structured(l Logger) StructuredLogger {
+	if s, ok := l.(StructuredLogger); ok {
+		return s
+	}
+	return formattedLogger{l}
+}
+
+type formattedLogger struct {
+	Logger
+}
+
+// format returns msg followed by the key/value pairs.
+func format(msg string, keysAndValues []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&b, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", keysAndValues[i])
+		}
+	}
+	return b.String()
+}
+
+func (f formattedLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	f.Debugf("%s", format(msg, keysAndValues))
+}
+
+func (f formattedLogger) Infow(msg string, keysAndValues ...interface{}) {
+	f.Infof("%s", format(msg, keysAndValues))
+}
+
+func (f formattedLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	f.Warnf("%s", format(msg, keysAndValues))
+}
+
+func (f formattedLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	f.Errorf("%s", format(msg, keysAndValues))
+}
+
+// Default returns the package-level zap logger as a Logger.
+func Default() Logger {
+	return defaultLogger
+}
+
+// OrDefault returns l, or Default() if l is nil.
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
+
+// Nop is a Logger that discards everything.
+var Nop Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// Level is a log severity. The zero value is DebugLevel.
+type Level int8
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// String returns the lower-case name of the level.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// ParseLevel parses a level name such as "info" or "WARN".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler so levels can be read from config files.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// WithLevel returns a Logger that drops messages below level before passing them to l.
+// Filtering only ever removes messages; l may still discard messages above level.
+func WithLevel(l Logger, level Level) Logger {
+	if level <= DebugLevel {
+		return l
+	}
+	return &levelLogger{next: l, level: level}
+}
+
+type levelLogger struct {
+	next  Logger
+	level Level
+}
+
+func (l *levelLogger) Debugf(template string, args ...interface{}) {
+	if l.level <= DebugLevel {
+		l.next.Debugf(template, args...)
+	}
+}
+
+func (l *levelLogger) Infof(template string, args ...interface{}) {
+	if l.level <= InfoLevel {
+		l.next.Infof(template, args...)
+	}
+}
+
+func (l *levelLogger) Warnf(template string, args ...interface{}) {
+	if l.level <= WarnLevel {
+		l.next.Warnf(template, args...)
+	}
+}
+
+func (l *levelLogger) Errorf(template string, args ...interface{}) {
+	if l.level <= ErrorLevel {
+		l.next.Errorf(template, args...)
+	}
+}
+
+func (l *levelLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.level <= DebugLevel {
+		Structured(l.next).Debugw(msg, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Infow(msg string, keysAndValues ...interface{}) {
+	if l.level <= InfoLevel {
+		Structured(l.next).Infow(msg, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	if l.level <= WarnLevel {
+		Structured(l.next).Warnw(msg, keysAndValues...)
+	}
+}
+
+func (l *levelLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	if l.level <= ErrorLevel {
+		Structured(l.next).Errorw(msg, keysAndValues...)
+	}
+}
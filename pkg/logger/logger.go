@@ -7,7 +7,11 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-var appLogger *zap.SugaredLogger
+var (
+	appLogger *zap.SugaredLogger
+	// defaultLogger is appLogger without the caller skip for the package-level functions
+	defaultLogger *zap.SugaredLogger
+)
 
 func init() {
 	writerSyncer := getLogWriter()
@@ -15,6 +19,7 @@ func init() {
 	core := zapcore.NewCore(encoder, writerSyncer, zapcore.DebugLevel)
 	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zap.FatalLevel))
 	appLogger = logger.Sugar()
+	defaultLogger = logger.WithOptions(zap.AddCallerSkip(-1)).Sugar()
 	// Note: defer in init() doesn't work as expected, but logger will flush on program exit
 }
 
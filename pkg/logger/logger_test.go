@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := WithLevel(NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))), WarnLevel)
+
+	l.Debugf("debug %d", 1)
+	l.Infof("info %d", 2)
+	l.Warnf("warn %d", 3)
+	l.Errorf("error %d", 4)
+
+	out := buf.String()
+	if strings.Contains(out, "debug 1") || strings.Contains(out, "info 2") {
+		t.Errorf("messages below warn were logged: %s", out)
+	}
+	if !strings.Contains(out, "warn 3") || !strings.Contains(out, "error 4") {
+		t.Errorf("expected warn and error messages, got: %s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel} {
+		parsed, err := ParseLevel(level.String())
+		if err != nil || parsed != level {
+			t.Errorf("ParseLevel(%q) = %v, %v", level.String(), parsed, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestStructured(t *testing.T) {
+	var buf bytes.Buffer
+	Structured(NewSlog(slog.New(slog.NewTextHandler(&buf, nil)))).Infow("call done", "method", "/a.B/C", "code", "OK")
+	if out := buf.String(); !strings.Contains(out, `msg="call done" method=/a.B/C code=OK`) {
+		t.Errorf("expected the pairs as slog attributes, got: %s", out)
+	}
+
+	buf.Reset()
+	Structured(WithLevel(unstructured{NewSlog(slog.New(slog.NewTextHandler(&buf, nil)))}, InfoLevel)).Warnw("call failed", "code", "Unavailable")
+	if out := buf.String(); !strings.Contains(out, `msg="call failed code=Unavailable"`) {
+		t.Errorf("expected the pairs appended to the message, got: %s", out)
+	}
+}
+
+// unstructured hides the structured methods of a Logger.
+type unstructured struct {
+	Logger
+}
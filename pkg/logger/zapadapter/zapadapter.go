@@ -0,0 +1,13 @@
+// Package zapadapter routes the connection manager's logs through a zap logger.
+package zapadapter
+
+import (
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// New adapts a zap logger to logger.Logger.
+func New(l *zap.Logger) logger.Logger {
+	return l.Sugar()
+}
@@ -0,0 +1,18 @@
+module github.com/begenov/grpc-connection-manager/pkg/logger/zerologadapter
+
+go 1.25.5
+
+require (
+	github.com/begenov/grpc-connection-manager v0.0.0
+	github.com/rs/zerolog v1.34.0
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	go.uber.org/zap v1.27.1 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
+
+replace github.com/begenov/grpc-connection-manager => ../../..
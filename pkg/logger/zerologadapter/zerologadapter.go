@@ -0,0 +1,50 @@
+// Package zerologadapter routes the connection manager's logs through a zerolog logger. It is a
+// module of its own, so that applications that do not use zerolog do not depend on it.
+package zerologadapter
+
+import (
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"github.com/rs/zerolog"
+)
+
+// New adapts a zerolog logger to logger.Logger.
+func New(l zerolog.Logger) logger.Logger {
+	return zerologLogger{l: l}
+}
+
+type zerologLogger struct {
+	l zerolog.Logger
+}
+
+func (z zerologLogger) Debugf(template string, args ...interface{}) {
+	z.l.Debug().Msgf(template, args...)
+}
+
+func (z zerologLogger) Infof(template string, args ...interface{}) {
+	z.l.Info().Msgf(template, args...)
+}
+
+func (z zerologLogger) Warnf(template string, args ...interface{}) {
+	z.l.Warn().Msgf(template, args...)
+}
+
+func (z zerologLogger) Errorf(template string, args ...interface{}) {
+	z.l.Error().Msgf(template, args...)
+}
+
+func (z zerologLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	z.l.Debug().Fields(keysAndValues).Msg(msg)
+}
+
+func (z zerologLogger) Infow(msg string, keysAndValues ...interface{}) {
+	z.l.Info().Fields(keysAndValues).Msg(msg)
+}
+
+func (z zerologLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	z.l.Warn().Fields(keysAndValues).Msg(msg)
+}
+
+func (z zerologLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	z.l.Error().Fields(keysAndValues).Msg(msg)
+}
@@ -0,0 +1,25 @@
+package zerologadapter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	l.Debugf("hidden")
+	l.Warnf("shown %s", "here")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("debug message was logged: %s", out)
+	}
+	if !strings.Contains(out, `"level":"warn"`) || !strings.Contains(out, "shown here") {
+		t.Errorf("expected warn message, got: %s", out)
+	}
+}
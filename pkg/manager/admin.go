@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AdminHandler returns the handler of the admin server, for mounting on an existing mux instead
+// of setting Config.AdminListenAddr. It serves:
+//
+//   - /metrics: the Prometheus metrics of the manager's *metrics.Metrics registry, or of the
+//     default registry for other recorders.
+//   - /healthz: HealthCheck as JSON, with status 503 if any connection is unhealthy.
+//   - /connections: DebugState as JSON.
+func (cm *ConnectionManager) AdminHandler() http.Handler {
+	gatherer := prometheus.DefaultGatherer
+	if pm, ok := cm.prometheusMetrics(); ok {
+		gatherer = pm.Gatherer()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := cm.HealthCheck(r.Context())
+		healthy := true
+		for _, h := range health {
+			healthy = healthy && h.Healthy
+		}
+		status := http.StatusOK
+		if !healthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, struct {
+			Healthy  bool                        `json:"healthy"`
+			Services map[string]ConnectionHealth `json:"services"`
+		}{healthy, health})
+	})
+	mux.HandleFunc("GET /connections", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, cm.DebugState())
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// startAdmin serves AdminHandler on Config.AdminListenAddr until the manager is closed.
+func (cm *ConnectionManager) startAdmin(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on AdminListenAddr %s: %w", addr, err)
+	}
+	cm.admin = &http.Server{
+		Handler:           cm.AdminHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	cm.adminAddr = lis.Addr()
+
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		if err := cm.admin.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			cm.logger.Errorf("Admin server on %s failed: %v", lis.Addr(), err)
+		}
+	}()
+	return nil
+}
+
+// AdminAddr returns the address the admin server listens on, e.g. to find the port chosen for
+// an AdminListenAddr of ":0", or nil if it is not running.
+func (cm *ConnectionManager) AdminAddr() net.Addr {
+	return cm.adminAddr
+}
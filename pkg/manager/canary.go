@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"context"
+	"math/rand/v2"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ensureCanary dials the service's canary address if one is configured and not yet connected.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) ensureCanary(ctx context.Context, serviceName string) error {
+	address := cm.config().Services[serviceName].CanaryAddress
+	if address == "" || cm.canaries[serviceName] != nil {
+		return nil
+	}
+
+	conn, err := cm.createConnection(ctx, address, serviceName)
+	if err != nil {
+		return err
+	}
+	conn.Connect()
+
+	cm.canaries[serviceName] = conn
+	cm.publish(serviceName)
+	cm.serviceLogger(serviceName).Infof("Created canary gRPC connection for service: %s", serviceName)
+	return nil
+}
+
+// dropCanary closes the service's canary connection, if any. Must be called with cm.mu held.
+func (cm *ConnectionManager) dropCanary(serviceName string) {
+	if canary := cm.canaries[serviceName]; canary != nil {
+		_ = canary.Close()
+		delete(cm.canaries, serviceName)
+		cm.publish(serviceName)
+	}
+}
+
+// canaryWeight returns the fraction of GetConnection calls for the service answered with its
+// canary connection: the FlagCanaryWeight weight of Config.Flags, or else ServiceConfig.CanaryWeight.
+func (cm *ConnectionManager) canaryWeight(serviceName string) float64 {
+	if weights, ok := cm.config().Flags.(interceptors.WeightProvider); ok {
+		if weight, ok := weights.Weight(serviceName, interceptors.FlagCanaryWeight); ok {
+			return weight
+		}
+	}
+	return cm.config().Services[serviceName].CanaryWeight
+}
+
+// useCanary reports whether this GetConnection call for the service should get its canary
+// connection. A canary that is not Ready or Idle gets no calls.
+func (cm *ConnectionManager) useCanary(serviceName string, canary *grpc.ClientConn) bool {
+	weight := cm.canaryWeight(serviceName)
+	if weight <= 0 {
+		return false
+	}
+	if state := canary.GetState(); state != connectivity.Ready && state != connectivity.Idle {
+		return false
+	}
+	return weight >= 1 || rand.Float64() < weight
+}
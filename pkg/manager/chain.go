@@ -0,0 +1,580 @@
+package manager
+
+import (
+	"slices"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+
+	"google.golang.org/grpc"
+)
+
+// circuitBreakers returns the circuit breakers shared by the unary and stream interceptors of a
+// connection to the service at address, or nil if circuit breaking is disabled. The primary, pooled
+// and fallback connections of a service share one group, registered in cm.breakers so that it
+// outlives reconnects until the service fails over to its next address; a standby connection gets
+// a group of its own so that it can take traffic while the primary's breakers are open, and so does
+// a canary connection so that its failures do not open the primary's breakers. Must be called with
+// cm.mu held.
+func (cm *ConnectionManager) circuitBreakers(serviceName, address string) *interceptors.CircuitBreakerGroup {
+	if !cm.config().EnableCircuitBreaker && cm.config().Flags == nil {
+		return nil
+	}
+	// The standby and canary are recognized by their address, since they are dialed before they
+	// are in cm.standbys and cm.canaries.
+	sb := cm.standbys[serviceName]
+	sc := cm.config().Services[serviceName]
+	standby := address != "" && (address == sc.StandbyAddress || address == sc.CanaryAddress)
+	if !standby {
+		if group, ok := cm.breakers.Group(serviceName); ok {
+			return group
+		}
+	}
+
+	cbConfig := cm.config().circuitBreaker()
+	if cbConfig.Clock == nil {
+		cbConfig.Clock = cm.clock
+	}
+	if cbConfig.ResetPolicy == (interceptors.ResetPolicy{}) {
+		cbConfig.ResetPolicy = cm.config().ResetPolicy
+	}
+	if cbConfig.Events == nil {
+		cbConfig.Events = &cm.events
+	}
+	if cbConfig.Logger == nil {
+		cbConfig.Logger = cm.serviceLogger(serviceName)
+	}
+	if standby {
+		return interceptors.NewCircuitBreakerGroup(serviceName, cbConfig, cm.metrics)
+	}
+	if fo := cm.failover(serviceName); sb != nil || fo != nil {
+		onStateChange := cbConfig.OnStateChange
+		cbConfig.OnStateChange = func(method string, from, to interceptors.CircuitBreakerState) {
+			if onStateChange != nil {
+				onStateChange(method, from, to)
+			}
+			if to != interceptors.StateOpen {
+				return
+			}
+			if sb != nil {
+				sb.activate(serviceName, "circuit breaker opened for "+method)
+			}
+			if fo != nil {
+				fo.tripped.Store(true)
+			}
+		}
+	}
+	group := interceptors.NewCircuitBreakerGroup(serviceName, cbConfig, cm.metrics)
+	cm.breakers.Register(group)
+	return group
+}
+
+// unaryInterceptors builds the unary interceptor chain for a connection to the service.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) unaryInterceptors(serviceName string, maxMsgSize int, breakers *interceptors.CircuitBreakerGroup) ([]grpc.UnaryClientInterceptor, error) {
+	var unaryInterceptors []grpc.UnaryClientInterceptor
+
+	// Correlation IDs are set first so that every interceptor, logging included, sees them.
+	if cm.config().Correlation != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.CorrelationInterceptor(cm.config().Correlation),
+		)
+	}
+
+	start := len(unaryInterceptors)
+	if cm.config().EnableLogging || cm.config().Flags != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagLogging, cm.config().EnableLogging,
+				interceptors.LoggingInterceptorWithConfig(cm.loggingConfig(serviceName))),
+		)
+	}
+	stages := []stageSpan{{InterceptorLogging, start, len(unaryInterceptors)}}
+
+	unaryInterceptors = append(unaryInterceptors,
+		interceptors.EventInterceptor(serviceName, &cm.events),
+	)
+
+	for _, headers := range cm.config().headers(serviceName) {
+		unaryInterceptors = append(unaryInterceptors, interceptors.HeaderInterceptor(headers))
+	}
+
+	if cm.config().Audit != nil {
+		auditConfig := *cm.config().Audit
+		if auditConfig.Logger == nil {
+			auditConfig.Logger = cm.serviceLogger(serviceName)
+		}
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagAudit, true,
+				interceptors.AuditInterceptor(serviceName, &auditConfig)),
+		)
+	}
+
+	start = len(unaryInterceptors)
+	if cm.config().EnableMetrics && cm.metrics != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.MetricsInterceptor(serviceName, cm.metrics),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorMetrics, start, len(unaryInterceptors)})
+
+	// The budget only shrinks deadlines set by the caller, not the defaults applied below.
+	if cm.config().DeadlineMargin > 0 {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.DeadlineBudgetInterceptor(serviceName, cm.config().DeadlineMargin, cm.clock, cm.metrics),
+		)
+	}
+
+	if len(cm.config().MethodTimeouts) > 0 || cm.config().DefaultRPCTimeout > 0 {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.DefaultTimeoutInterceptor(serviceName, cm.config().DefaultRPCTimeout, cm.config().MethodTimeouts, cm.metrics),
+		)
+	}
+
+	if methods := cm.config().Services[serviceName].MethodWaitForReady; len(methods) > 0 {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.WaitForReadyInterceptor(methods),
+		)
+	}
+
+	if methods := cm.config().Services[serviceName].Methods; methods != nil {
+		filterConfig := *methods
+		if filterConfig.Logger == nil {
+			filterConfig.Logger = cm.serviceLogger(serviceName)
+		}
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.MethodFilterInterceptor(serviceName, &filterConfig, cm.metrics),
+		)
+	}
+
+	// Cached responses are served before maintenance windows, quotas and limits apply, as they
+	// never reach the backend, and so are calls coalesced with another in flight.
+	if cache := cm.responseCache(serviceName); cache != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.CacheInterceptor(serviceName, cache, cm.metrics),
+		)
+	}
+
+	if dedup := cm.deduplicator(serviceName); dedup != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.DedupInterceptor(serviceName, dedup, cm.metrics),
+		)
+	}
+
+	if windows := cm.config().Services[serviceName].MaintenanceWindows; len(windows) > 0 {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.MaintenanceInterceptor(serviceName, windows, cm.clock, cm.metrics),
+		)
+	}
+
+	if quotaCfg := cm.config().Services[serviceName].Quota; quotaCfg != nil {
+		// Quotas outlive individual connections so that reconnecting does not reset the counters.
+		quota := cm.quotas[serviceName]
+		if quota == nil {
+			cfg := *quotaCfg
+			if cfg.Clock == nil {
+				cfg.Clock = cm.clock
+			}
+			if cfg.Logger == nil {
+				cfg.Logger = cm.serviceLogger(serviceName)
+			}
+			var err error
+			if quota, err = interceptors.NewQuota(serviceName, &cfg); err != nil {
+				return nil, err
+			}
+			cm.quotas[serviceName] = quota
+		}
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.QuotaInterceptor(serviceName, quota, cm.metrics),
+		)
+	}
+
+	if limiter := cm.rateLimiter(serviceName); limiter != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.RateLimitInterceptor(serviceName, limiter, cm.metrics),
+		)
+	}
+
+	if bulkhead := cm.bulkhead(serviceName); bulkhead != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.BulkheadInterceptor(serviceName, bulkhead, cm.metrics),
+		)
+	}
+
+	if cm.config().EnableRequestSizeCheck {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.RequestSizeInterceptor(serviceName, maxMsgSize),
+		)
+	}
+
+	if cm.config().Compression != "" {
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagCompression, true,
+				interceptors.CompressionInterceptor(
+					serviceName,
+					cm.config().Compression,
+					cm.config().CompressionThreshold,
+					cm.metrics,
+				)),
+		)
+	}
+
+	if enc := cm.config().Services[serviceName].Encryption; enc != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptors.EncryptionInterceptor(serviceName, enc, cm.metrics),
+		)
+	}
+
+	start = len(unaryInterceptors)
+	if breakers != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagCircuitBreaker, cm.config().EnableCircuitBreaker,
+				breakers.UnaryInterceptor()),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorCircuitBreaker, start, len(unaryInterceptors)})
+
+	start = len(unaryInterceptors)
+	if cm.config().EnableRetry || cm.config().Flags != nil {
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagRetry, cm.config().EnableRetry,
+				cm.retrier(serviceName).unaryInterceptor()),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorRetry, start, len(unaryInterceptors)})
+
+	// Each retry attempt is hedged, and every hedged attempt reports to the outlier detector.
+	if hedging := cm.config().hedging(serviceName); hedging != nil {
+		hedgingConfig := *hedging
+		if hedgingConfig.Clock == nil {
+			hedgingConfig.Clock = cm.clock
+		}
+		unaryInterceptors = append(unaryInterceptors,
+			cm.withFlag(serviceName, interceptors.FlagHedging, true,
+				interceptors.HedgingInterceptor(&hedgingConfig)),
+		)
+	}
+
+	if outliers := cm.outlierDetector(serviceName); outliers != nil {
+		unaryInterceptors = append(unaryInterceptors, outliers.unaryInterceptor())
+	}
+
+	if loads := cm.poolLoad(serviceName); loads != nil {
+		unaryInterceptors = append(unaryInterceptors, loads.unaryInterceptor())
+	}
+
+	if cm.auth != nil {
+		unaryInterceptors = append(unaryInterceptors, cm.auth.UnaryInterceptor())
+	}
+
+	start = len(unaryInterceptors)
+	unaryInterceptors = append(unaryInterceptors, cm.config().ExtraUnaryInterceptors...)
+	stages = append(stages, stageSpan{InterceptorExtra, start, len(unaryInterceptors)})
+
+	return reorderStages(unaryInterceptors, stages, cm.config().InterceptorOrder), nil
+}
+
+// streamInterceptors builds the stream interceptor chain for a connection to the service.
+// Interceptors that only make sense for unary calls, such as request size checks and
+// compression thresholds, are not applied to streams. Quotas count each stream as one call.
+// Must be called with cm.mu held, after unaryInterceptors.
+func (cm *ConnectionManager) streamInterceptors(serviceName string, breakers *interceptors.CircuitBreakerGroup) []grpc.StreamClientInterceptor {
+	var streamInterceptors []grpc.StreamClientInterceptor
+
+	if cm.config().Correlation != nil {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.CorrelationStreamInterceptor(cm.config().Correlation),
+		)
+	}
+
+	start := len(streamInterceptors)
+	if cm.config().EnableLogging || cm.config().Flags != nil {
+		streamInterceptors = append(streamInterceptors,
+			cm.withStreamFlag(serviceName, interceptors.FlagLogging, cm.config().EnableLogging,
+				interceptors.LoggingStreamInterceptorWithConfig(cm.loggingConfig(serviceName))),
+		)
+	}
+	stages := []stageSpan{{InterceptorLogging, start, len(streamInterceptors)}}
+
+	for _, headers := range cm.config().headers(serviceName) {
+		streamInterceptors = append(streamInterceptors, interceptors.HeaderStreamInterceptor(headers))
+	}
+
+	if cm.config().Audit != nil {
+		auditConfig := *cm.config().Audit
+		if auditConfig.Logger == nil {
+			auditConfig.Logger = cm.serviceLogger(serviceName)
+		}
+		streamInterceptors = append(streamInterceptors,
+			cm.withStreamFlag(serviceName, interceptors.FlagAudit, true,
+				interceptors.AuditStreamInterceptor(serviceName, &auditConfig)),
+		)
+	}
+
+	start = len(streamInterceptors)
+	if cm.config().EnableMetrics && cm.metrics != nil {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.MetricsStreamInterceptor(serviceName, cm.metrics),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorMetrics, start, len(streamInterceptors)})
+
+	if methods := cm.config().Services[serviceName].Methods; methods != nil {
+		filterConfig := *methods
+		if filterConfig.Logger == nil {
+			filterConfig.Logger = cm.serviceLogger(serviceName)
+		}
+		streamInterceptors = append(streamInterceptors,
+			interceptors.MethodFilterStreamInterceptor(serviceName, &filterConfig, cm.metrics),
+		)
+	}
+
+	if windows := cm.config().Services[serviceName].MaintenanceWindows; len(windows) > 0 {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.MaintenanceStreamInterceptor(serviceName, windows, cm.clock, cm.metrics),
+		)
+	}
+
+	// The quota is created with the unary chain, which is built first, and shared with it.
+	if quota := cm.quotas[serviceName]; quota != nil {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.QuotaStreamInterceptor(serviceName, quota, cm.metrics),
+		)
+	}
+
+	if limiter := cm.rateLimiter(serviceName); limiter != nil {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.RateLimitStreamInterceptor(serviceName, limiter, cm.metrics),
+		)
+	}
+
+	if bulkhead := cm.bulkhead(serviceName); bulkhead != nil {
+		streamInterceptors = append(streamInterceptors,
+			interceptors.BulkheadStreamInterceptor(serviceName, bulkhead, cm.metrics),
+		)
+	}
+
+	start = len(streamInterceptors)
+	if breakers != nil {
+		streamInterceptors = append(streamInterceptors,
+			cm.withStreamFlag(serviceName, interceptors.FlagCircuitBreaker, cm.config().EnableCircuitBreaker,
+				breakers.StreamInterceptor()),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorCircuitBreaker, start, len(streamInterceptors)})
+
+	start = len(streamInterceptors)
+	if cm.config().EnableRetry || cm.config().Flags != nil {
+		streamInterceptors = append(streamInterceptors,
+			cm.withStreamFlag(serviceName, interceptors.FlagRetry, cm.config().EnableRetry,
+				cm.retrier(serviceName).streamInterceptor()),
+		)
+	}
+	stages = append(stages, stageSpan{InterceptorRetry, start, len(streamInterceptors)})
+
+	if outliers := cm.outlierDetector(serviceName); outliers != nil {
+		streamInterceptors = append(streamInterceptors, outliers.streamInterceptor())
+	}
+
+	if loads := cm.poolLoad(serviceName); loads != nil {
+		streamInterceptors = append(streamInterceptors, loads.streamInterceptor())
+	}
+
+	if cm.auth != nil {
+		streamInterceptors = append(streamInterceptors, cm.auth.StreamInterceptor())
+	}
+
+	start = len(streamInterceptors)
+	streamInterceptors = append(streamInterceptors, cm.config().ExtraStreamInterceptors...)
+	stages = append(stages, stageSpan{InterceptorExtra, start, len(streamInterceptors)})
+
+	return reorderStages(streamInterceptors, stages, cm.config().InterceptorOrder)
+}
+
+// loggingConfig returns the call logging configuration of the service, logging to its logger
+// unless Config.Logging names another.
+func (cm *ConnectionManager) loggingConfig(serviceName string) *interceptors.LoggingConfig {
+	cfg := interceptors.DefaultLoggingConfig()
+	if cm.config().Logging != nil {
+		*cfg = *cm.config().Logging
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = cm.serviceLogger(serviceName)
+	}
+	return cfg
+}
+
+// rateLimiter returns the service's rate limiter, or nil if it is unlimited. Limiters outlive
+// individual connections so that reconnecting does not refill the buckets, and are shared by the
+// connections of a pool. Must be called with cm.mu held.
+func (cm *ConnectionManager) rateLimiter(serviceName string) *interceptors.RateLimiter {
+	if limiter := cm.limiters[serviceName]; limiter != nil {
+		return limiter
+	}
+	cfg := cm.config().rateLimit(serviceName)
+	if cfg == nil {
+		return nil
+	}
+	limitConfig := *cfg
+	if limitConfig.Clock == nil {
+		limitConfig.Clock = cm.clock
+	}
+	limiter := interceptors.NewRateLimiter(&limitConfig)
+	cm.limiters[serviceName] = limiter
+	return limiter
+}
+
+// bulkhead returns the service's bulkhead, or nil if it is unlimited. Like rate limiters,
+// bulkheads are shared by all connections to the service. Must be called with cm.mu held.
+func (cm *ConnectionManager) bulkhead(serviceName string) *interceptors.Bulkhead {
+	if bulkhead := cm.bulkheads[serviceName]; bulkhead != nil {
+		return bulkhead
+	}
+	cfg := cm.config().bulkhead(serviceName)
+	if cfg == nil {
+		return nil
+	}
+	bulkheadConfig := *cfg
+	if bulkheadConfig.Clock == nil {
+		bulkheadConfig.Clock = cm.clock
+	}
+	bulkhead := interceptors.NewBulkhead(&bulkheadConfig)
+	cm.bulkheads[serviceName] = bulkhead
+	return bulkhead
+}
+
+// responseCache returns the service's response cache, or nil if responses are not cached. The
+// cache is shared by all connections to the service and outlives reconnects. Must be called with
+// cm.mu held.
+func (cm *ConnectionManager) responseCache(serviceName string) *interceptors.ResponseCache {
+	if cache := cm.caches[serviceName]; cache != nil {
+		return cache
+	}
+	cfg := cm.config().cache(serviceName)
+	if cfg == nil {
+		return nil
+	}
+	cacheConfig := *cfg
+	if cacheConfig.Clock == nil {
+		cacheConfig.Clock = cm.clock
+	}
+	cache := interceptors.NewResponseCache(&cacheConfig)
+	cm.caches[serviceName] = cache
+	return cache
+}
+
+// deduplicator returns the service's deduplicator, or nil if calls are not coalesced. It is shared
+// by all connections to the service, so that identical calls are coalesced across a pool. Must be
+// called with cm.mu held.
+func (cm *ConnectionManager) deduplicator(serviceName string) *interceptors.Deduplicator {
+	if dedup := cm.dedups[serviceName]; dedup != nil {
+		return dedup
+	}
+	cfg := cm.config().dedup(serviceName)
+	if cfg == nil {
+		return nil
+	}
+	dedup := interceptors.NewDeduplicator(cfg)
+	cm.dedups[serviceName] = dedup
+	return dedup
+}
+
+// retryBudget returns the service's retry budget, or nil if retries are unlimited. The budget is
+// shared by the unary and stream retry interceptors of every connection to the service.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) retryBudget(serviceName string) *interceptors.RetryBudget {
+	if budget := cm.budgets[serviceName]; budget != nil {
+		return budget
+	}
+	cfg := cm.config().retryBudget(serviceName)
+	if cfg == nil {
+		return nil
+	}
+	budget := interceptors.NewRetryBudget(cfg)
+	cm.budgets[serviceName] = budget
+	return budget
+}
+
+// retryConfig returns the retry configuration for new connections to the service.
+func (cm *ConnectionManager) retryConfig(serviceName string) *interceptors.RetryConfig {
+	retryConfig := interceptors.DefaultRetryConfig()
+	if cm.config().Retry != nil {
+		*retryConfig = *cm.config().Retry
+	}
+	if retryConfig.Clock == nil {
+		retryConfig.Clock = cm.clock
+	}
+	if retryConfig.ResetPolicy == (interceptors.ResetPolicy{}) {
+		retryConfig.ResetPolicy = cm.config().ResetPolicy
+	}
+	if retryConfig.Events == nil {
+		retryConfig.Events = &cm.events
+	}
+	if retryConfig.Logger == nil {
+		retryConfig.Logger = cm.serviceLogger(serviceName)
+	}
+	if retryConfig.Budget == nil {
+		retryConfig.Budget = cm.retryBudget(serviceName)
+	}
+	return retryConfig
+}
+
+// retrier returns the service's retry interceptors, creating them on first use. They are shared by
+// all connections to the service so that ApplyConfig can update them. Must be called with cm.mu held.
+func (cm *ConnectionManager) retrier(serviceName string) *retrier {
+	if r := cm.retriers[serviceName]; r != nil {
+		return r
+	}
+	r := &retrier{}
+	r.update(cm.retryConfig(serviceName), serviceName, cm.metrics)
+	cm.retriers[serviceName] = r
+	return r
+}
+
+// withFlag makes interceptor toggleable at runtime through Config.Flags.
+// enabled is the value used when the flag provider has no value for the flag.
+func (cm *ConnectionManager) withFlag(serviceName, flag string, enabled bool, interceptor grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	if cm.config().Flags == nil {
+		return interceptor
+	}
+	return interceptors.FlagInterceptor(cm.config().Flags, serviceName, flag, enabled, interceptor)
+}
+
+// withStreamFlag is the stream counterpart of withFlag.
+func (cm *ConnectionManager) withStreamFlag(serviceName, flag string, enabled bool, interceptor grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	if cm.config().Flags == nil {
+		return interceptor
+	}
+	return interceptors.FlagStreamInterceptor(cm.config().Flags, serviceName, flag, enabled, interceptor)
+}
+
+// stageSpan is the part [start, end) of an interceptor chain built for stage, empty if the stage
+// is disabled.
+type stageSpan struct {
+	stage      InterceptorStage
+	start, end int
+}
+
+// reorderStages applies Config.InterceptorOrder to chain: the stages of order fill the places of
+// their spans in chain, ordered by position, in the order given. spans must be sorted by position.
+func reorderStages[T any](chain []T, spans []stageSpan, order []InterceptorStage) []T {
+	if len(order) == 0 {
+		return chain
+	}
+	byStage := make(map[InterceptorStage]stageSpan, len(spans))
+	for _, span := range spans {
+		byStage[span.stage] = span
+	}
+
+	reordered := make([]T, 0, len(chain))
+	pos, next := 0, 0
+	for _, slot := range spans {
+		if !slices.Contains(order, slot.stage) {
+			continue
+		}
+		span := byStage[order[next]]
+		next++
+		reordered = append(reordered, chain[pos:slot.start]...)
+		reordered = append(reordered, chain[span.start:span.end]...)
+		pos = slot.end
+	}
+	return append(reordered, chain[pos:]...)
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client returns a generated client for the service, so that callers do not have to handle the
+// *grpc.ClientConn themselves:
+//
+//	users, err := manager.Client(ctx, cm, "users", userspb.NewUsersClient)
+//
+// The client is bound to ServiceConn, so it keeps working when the manager replaces the service's
+// connection. The service must have been registered or used with an address before, and Client
+// fails if no connection can be obtained for it now.
+func Client[T any](ctx context.Context, cm *ConnectionManager, serviceName string, newClient func(grpc.ClientConnInterface) T) (T, error) {
+	if _, err := cm.GetConnection(ctx, serviceName, ""); err != nil {
+		var zero T
+		return zero, err
+	}
+	return newClient(cm.ServiceConn(serviceName)), nil
+}
+
+// serviceConn is a grpc.ClientConnInterface that gets the service's connection from the manager
+// for every call.
+type serviceConn struct {
+	cm          *ConnectionManager
+	serviceName string
+}
+
+// ServiceConn returns a grpc.ClientConnInterface for the service whose Invoke and NewStream call
+// GetConnection, so generated clients created once keep working after the manager closes,
+// resets or fails over the service's connection. Failures to get a connection are returned as
+// Unavailable, or as the context's error if it is done.
+func (cm *ConnectionManager) ServiceConn(serviceName string) grpc.ClientConnInterface {
+	return &serviceConn{cm: cm, serviceName: serviceName}
+}
+
+func (c *serviceConn) conn(ctx context.Context) (*grpc.ClientConn, error) {
+	conn, err := c.cm.GetConnection(ctx, c.serviceName, "")
+	if err == nil {
+		return conn, nil
+	}
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return nil, status.Error(codes.Unavailable, err.Error())
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (c *serviceConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (c *serviceConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.NewStream(ctx, desc, method, opts...)
+}
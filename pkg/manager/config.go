@@ -0,0 +1,1116 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/discovery"
+	"github.com/begenov/grpc-connection-manager/pkg/dnscache"
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/stats"
+
+	_ "github.com/begenov/grpc-connection-manager/pkg/compression" // registers the "zstd" and "snappy" compressors
+	_ "google.golang.org/grpc/encoding/gzip"                       // registers the "gzip" compressor
+)
+
+// DialMode selects how connections are created.
+type DialMode int
+
+const (
+	// DialModeDialContext gives connections the semantics of the deprecated grpc.DialContext:
+	// addresses without a scheme use the passthrough resolver and connecting starts immediately.
+	// Connections are created with grpc.NewClient either way, so the semantics do not change
+	// when grpc-go drops grpc.DialContext.
+	DialModeDialContext DialMode = iota
+	// DialModeNewClient gives connections the semantics of grpc.NewClient: addresses without a
+	// scheme use the dns resolver and connections stay Idle until the first call.
+	DialModeNewClient
+)
+
+// PoolStrategy selects which pooled connection GetConnection returns when PoolSize > 1.
+type PoolStrategy int
+
+const (
+	// PoolStrategyRoundRobin returns the pooled connections in turn.
+	PoolStrategyRoundRobin PoolStrategy = iota
+	// PoolStrategyLeastRequest returns the connection with the fewest calls in flight.
+	PoolStrategyLeastRequest
+	// PoolStrategyLatency picks connections at random, weighted by the inverse of their EWMA
+	// latency times their calls in flight, so that slow or busy connections get fewer calls
+	// without being starved of the calls that would show they are fast again.
+	PoolStrategyLatency
+	// PoolStrategyPowerOfTwoChoices picks two connections at random and returns the one with
+	// fewer calls in flight, spreading load almost as evenly as PoolStrategyLeastRequest without
+	// sending every concurrent caller to the same connection.
+	PoolStrategyPowerOfTwoChoices
+)
+
+// ConnectMode selects whether GetConnection waits for the connection to become Ready.
+type ConnectMode int
+
+const (
+	// ConnectModeLazy returns connections as soon as they are created, whatever their state.
+	// Calls on a connection that is still connecting wait or fail according to WaitForReady.
+	ConnectModeLazy ConnectMode = iota
+	// ConnectModeWaitForReady makes GetConnection block until the connection is Ready or the
+	// context is done, so that callers fail fast when acquiring a connection. Connections in
+	// TransientFailure keep reconnecting until then. Without a context deadline the wait is
+	// bounded by MinConnectTimeout.
+	ConnectModeWaitForReady
+)
+
+// InterceptorStage names a part of the interceptor chain that Config.InterceptorOrder can move.
+type InterceptorStage string
+
+const (
+	// InterceptorLogging logs each call, with EnableLogging.
+	InterceptorLogging InterceptorStage = "logging"
+	// InterceptorMetrics records call metrics, with EnableMetrics.
+	InterceptorMetrics InterceptorStage = "metrics"
+	// InterceptorCircuitBreaker rejects calls while the circuit is open, with EnableCircuitBreaker.
+	InterceptorCircuitBreaker InterceptorStage = "circuit_breaker"
+	// InterceptorRetry retries failed calls, with EnableRetry.
+	InterceptorRetry InterceptorStage = "retry"
+	// InterceptorExtra is ExtraUnaryInterceptors, or ExtraStreamInterceptors for streams.
+	InterceptorExtra InterceptorStage = "extra"
+)
+
+// Config holds configuration for the ConnectionManager.
+type Config struct {
+	// MaxMsgSize is the maximum message size in bytes for gRPC calls (default: 1GB)
+	MaxMsgSize int
+
+	// KeepAliveTime is the interval between keepalive pings (default: 30s)
+	KeepAliveTime time.Duration
+
+	// KeepAliveTimeout is the timeout for keepalive pings (default: 5s)
+	KeepAliveTimeout time.Duration
+
+	// KeepAlivePermitWithoutStream allows keepalive pings even when there are no active streams (default: true)
+	KeepAlivePermitWithoutStream bool
+
+	// MaxReconnectDelay is the maximum delay between reconnection attempts (default: 3s)
+	MaxReconnectDelay time.Duration
+
+	// ReconnectBaseDelay is the delay before the first reconnection attempt after a connection
+	// fails. Zero is treated as 100ms (default: 100ms)
+	ReconnectBaseDelay time.Duration
+
+	// ReconnectMultiplier is the factor the delay grows by after each failed attempt, up to
+	// MaxReconnectDelay. Zero is treated as 1.6 (default: 1.6)
+	ReconnectMultiplier float64
+
+	// ReconnectJitter randomizes each delay by up to this fraction of it, so that clients do not
+	// reconnect in lockstep after an outage (default: 0.2)
+	ReconnectJitter float64
+
+	// MinConnectTimeout is the minimum time to wait before attempting to reconnect (default: 10s)
+	MinConnectTimeout time.Duration
+
+	// PoolSize is the number of connections kept per service. GetConnection spreads calls over
+	// them according to PoolStrategy, using several HTTP/2 connections. Zero is treated as 1 (default: 1)
+	PoolSize int
+
+	// PoolStrategy selects the pooled connection GetConnection returns. Strategies other than
+	// round-robin count the calls in flight on each pooled connection and time its unary calls
+	// (default: PoolStrategyRoundRobin)
+	PoolStrategy PoolStrategy
+
+	// LoadBalancingPolicy is the gRPC load balancing policy that spreads a connection's calls over
+	// the addresses its target resolves to: "pick_first", "round_robin" or the name of a policy
+	// registered with balancer.Register. Addresses resolved through the passthrough resolver, as
+	// with DialModeDialContext and no DNSCache, name a single backend, so the policy only matters
+	// for dns targets and Discovery (default: "", gRPC's pick_first)
+	LoadBalancingPolicy string
+
+	// PreconnectOnRegister makes RegisterService start connecting to the service immediately
+	// instead of on the first GetConnection (default: false)
+	PreconnectOnRegister bool
+
+	// DialMode selects grpc.DialContext or grpc.NewClient semantics for new connections
+	// (default: DialModeDialContext)
+	DialMode DialMode
+
+	// ConnectMode selects whether GetConnection waits for connections to become Ready. It can be
+	// overridden per call with WithConnectMode (default: ConnectModeLazy)
+	ConnectMode ConnectMode
+
+	// IdleTimeout is how long a channel may go without RPCs before it drops to Idle and releases
+	// its transport. Idle connections reconnect on the next call. Zero disables idleness (default: 30m)
+	IdleTimeout time.Duration
+
+	// MaxIdleTime closes a service's connections once they have gone this long without calls, so
+	// that the next GetConnection dials them again. Unlike IdleTimeout it frees the channel itself.
+	// Zero disables idle eviction (default: 0)
+	MaxIdleTime time.Duration
+
+	// MaxConnectionAge replaces a service's connections once they are this old, re-resolving the
+	// target and rebalancing across backends behind L4 load balancers. Zero disables it (default: 0)
+	MaxConnectionAge time.Duration
+
+	// MaxConnectionAgeGrace is how long a connection replaced because of MaxConnectionAge or
+	// RebalanceInterval stays open for the calls still in flight on it (default: 1m)
+	MaxConnectionAgeGrace time.Duration
+
+	// RebalanceInterval replaces a service's connections about this often, give or take 10%, so
+	// that long-lived connections pinned to one backend behind an L4 load balancer spread over its
+	// backends over time. Unlike MaxConnectionAge, the new connection is dialed first and takes
+	// over once it is Ready. Zero disables it (default: 0)
+	RebalanceInterval time.Duration
+
+	// EnableLogging enables request/response logging (default: true)
+	EnableLogging bool
+
+	// Logging configures the call logs of EnableLogging: payloads, redaction, sampling of successful
+	// calls and slow call warnings (default: nil, every call without payloads)
+	Logging *interceptors.LoggingConfig
+
+	// EnableMetrics enables Prometheus metrics collection (default: false)
+	EnableMetrics bool
+
+	// MaxCallerLabels is the maximum number of distinct caller label values on request metrics.
+	// Additional callers are recorded as "other" (default: 50)
+	MaxCallerLabels int
+
+	// MaxTargetLabels enables a "target" label (resolved peer or configured address) on request
+	// and connection metrics with at most this many distinct values. Zero disables it (default: 0)
+	MaxTargetLabels int
+
+	// AsyncMetricsQueueSize enables asynchronous request metrics: observations are queued and
+	// recorded by a background goroutine, and dropped when the queue is full. Zero records
+	// synchronously on the call path. Only applies to *metrics.Metrics (default: 0)
+	AsyncMetricsQueueSize int
+
+	// MethodTimeouts sets the deadline for calls made without one, keyed by full method name
+	// (e.g. "/reports.Reports/Export") or a prefix ending in "*"; the most specific key wins (default: nil)
+	MethodTimeouts map[string]time.Duration
+
+	// DefaultRPCTimeout is the deadline of unary calls made without one to methods not in
+	// MethodTimeouts, so that they cannot hang forever. Streams are left alone, as they are often
+	// meant to stay open (default: 0, none)
+	DefaultRPCTimeout time.Duration
+
+	// DeadlineMargin moves the deadline of unary calls, such as one inherited from the inbound call
+	// being served, this much earlier, leaving time to handle the outcome. Calls with no more time
+	// left are rejected with DeadlineExceeded without being sent (default: 0, disabled)
+	DeadlineMargin time.Duration
+
+	// DefaultWaitForReady makes calls wait for the connection to become ready instead of failing
+	// immediately with Unavailable while it is reconnecting (default: false)
+	DefaultWaitForReady bool
+
+	// EnableRetry enables automatic retry on transient failures (default: true)
+	EnableRetry bool
+
+	// Retry configures the retry interceptor. Clock, ResetPolicy, Events and Logger fall back to
+	// the manager's when unset (default: nil, interceptors.DefaultRetryConfig())
+	Retry *interceptors.RetryConfig
+
+	// RetryBudget caps retries at a fraction of the calls to each service, with a separate budget
+	// per service shared by all its connections (default: nil, unlimited)
+	RetryBudget *interceptors.RetryBudgetConfig
+
+	// EnableCircuitBreaker enables circuit breaker pattern (default: true)
+	EnableCircuitBreaker bool
+
+	// CircuitBreaker configures the circuit breakers. Clock, ResetPolicy, Events and Logger fall back
+	// to the manager's when unset (default: nil, interceptors.DefaultCircuitBreakerConfig())
+	CircuitBreaker *interceptors.CircuitBreakerConfig
+
+	// EnableRequestSizeCheck rejects requests larger than the service's MaxMsgSize
+	// before they are sent (default: true)
+	EnableRequestSizeCheck bool
+
+	// Compression is the name of a registered compressor ("gzip", "zstd", "snappy" or a custom one) used for requests.
+	// Empty disables compression (default: "")
+	Compression string
+
+	// CompressionThreshold is the minimum serialized request size in bytes for a request
+	// to be compressed when Compression is set (default: 1KB)
+	CompressionThreshold int
+
+	// Pushgateway pushes the final metrics to a Prometheus Pushgateway when the manager is closed,
+	// for batch jobs that are never scraped. Without a Gatherer, the registry of the manager's
+	// *metrics.Metrics is pushed. Push failures are logged (default: nil)
+	Pushgateway *metrics.PushConfig
+
+	// AdminListenAddr starts an HTTP server on this address, e.g. ":9090", serving /metrics,
+	// /healthz and /connections until the manager is closed; see ConnectionManager.AdminHandler.
+	// Empty disables it (default: "")
+	AdminListenAddr string
+
+	// ChannelzListenAddr starts a gRPC server on this address serving the grpc.channelz.v1 service
+	// until the manager is closed, for inspecting the manager's channels, subchannels and sockets
+	// with tools such as grpcdebug. Empty disables it (default: "")
+	ChannelzListenAddr string
+
+	// Events receives interceptor and connection lifecycle events (call failures, retries, circuit
+	// breaker transitions, connections created and closed), e.g. an otlplog.Exporter shipping
+	// them as OTLP logs. See also ConnectionManager.Subscribe (default: nil)
+	Events interceptors.EventSink
+
+	// RateLimit limits the rate of calls to each service, with a separate limiter per service
+	// (default: nil, unlimited)
+	RateLimit *interceptors.RateLimitConfig
+
+	// Bulkhead limits the number of in-flight calls to each service, with a separate limit per
+	// service (default: nil, unlimited)
+	Bulkhead *interceptors.BulkheadConfig
+
+	// Cache caches the responses of idempotent unary methods, with a separate cache per service
+	// (default: nil, no caching)
+	Cache *interceptors.CacheConfig
+
+	// Dedup coalesces identical concurrent calls to idempotent unary methods into one RPC, across
+	// the connections to each service (default: nil, no coalescing)
+	Dedup *interceptors.DedupConfig
+
+	// Hedging sends extra attempts of slow calls to idempotent unary methods, answering with the
+	// first that succeeds (default: nil, no hedging)
+	Hedging *interceptors.HedgingConfig
+
+	// OutlierDetection temporarily ejects pooled connections with high error rates or latency
+	// from rotation. Requires PoolSize > 1 (default: nil, disabled)
+	OutlierDetection *OutlierDetectionConfig
+
+	// Audit enables audit logging of calls and streams to sensitive methods to a dedicated sink
+	// (default: nil)
+	Audit *interceptors.AuditConfig
+
+	// TransportCredentials specifies the transport credentials to use.
+	// If nil, insecure credentials are used.
+	TransportCredentials credentials.TransportCredentials
+
+	// PerRPCCredentials are attached to every call, e.g. credentials.RefreshingCredentials
+	// for tokens that are refreshed before they expire. If nil, no per-RPC credentials are sent
+	PerRPCCredentials credentials.PerRPCCredentials
+
+	// ContextDialer creates the network connections of gRPC connections, e.g. through an SSH tunnel
+	// or an in-memory listener in tests. It is given the resolved address, such as "10.0.0.1:50051",
+	// or the unresolved one with DialModeDialContext. Addresses such as "unix:///run/app.sock" and
+	// "unix:app.sock" connect over unix sockets without one. If nil, gRPC's dialer is used (default: nil)
+	ContextDialer func(ctx context.Context, address string) (net.Conn, error)
+
+	// StatsHandler is installed on every connection, e.g. otelgrpc.NewClientHandler() for
+	// OpenTelemetry traces and metrics. It sees what interceptors cannot, such as every attempt of
+	// a retried call, message sizes on the wire, compression and connection events. Health check
+	// probes of FallbackAddresses are not reported (default: nil)
+	StatsHandler stats.Handler
+
+	// ExtraDialOptions are appended after the manager's own dial options, so they take precedence
+	// where options conflict (default: nil)
+	ExtraDialOptions []grpc.DialOption
+
+	// ExtraUnaryInterceptors run after the built-in unary interceptors, closest to the transport,
+	// so they run once per retry attempt, unless moved by InterceptorOrder (default: nil)
+	ExtraUnaryInterceptors []grpc.UnaryClientInterceptor
+
+	// ExtraStreamInterceptors run after the built-in stream interceptors (default: nil)
+	ExtraStreamInterceptors []grpc.StreamClientInterceptor
+
+	// InterceptorOrder reorders stages of the interceptor chain, outermost first. The listed
+	// stages trade places so that they run in the given order, and the rest of the chain stays as
+	// it is. By default, logging runs before metrics, then the circuit breaker, retry and the Extra
+	// interceptors: {InterceptorRetry, InterceptorCircuitBreaker} makes every retry attempt a
+	// circuit breaker sample, and {InterceptorExtra, InterceptorLogging} runs the Extra
+	// interceptors before logging, which then logs every attempt (default: nil, the default order)
+	InterceptorOrder []InterceptorStage
+
+	// Correlation sends a correlation ID with every call: the one of the inbound call being served,
+	// or a new one. It is included in the log lines of EnableLogging (default: nil, disabled)
+	Correlation *interceptors.CorrelationConfig
+
+	// Headers are added to the metadata of every call, e.g. a tenant ID or the request ID of the
+	// inbound request being served (default: nil)
+	Headers *interceptors.HeaderConfig
+
+	// Auth attaches a bearer token from Auth.Provider to every call made over a secure transport,
+	// refreshing it before it expires and retrying once on Unauthenticated (default: nil)
+	Auth *interceptors.AuthConfig
+
+	// Flags toggles logging, audit, compression, circuit breaking, retry and hedging per service at
+	// runtime, and overrides canary weights if it is also an interceptors.WeightProvider. When set,
+	// the Enable* fields provide the defaults for flags the provider has no value for (default: nil)
+	Flags interceptors.FlagProvider
+
+	// DNSCache enables a caching DNS resolver for addresses without a scheme. Lookups honor record
+	// TTLs and can serve stale entries while DNS is down (default: nil, gRPC's dns resolver)
+	DNSCache *dnscache.Config
+
+	// ResolveInterval is how often the DNS names in service addresses are resolved again. Services
+	// using DNSCache are refreshed every time; others are dialed again when their name resolves to
+	// different IPs, so that backends behind a headless service are picked up. Zero disables it (default: 0)
+	ResolveInterval time.Duration
+
+	// XDS supports xds:/// targets, resolved and balanced by the xDS control plane named in the
+	// gRPC bootstrap config, as with proxyless Istio or Traffic Director. Set it to xds.New() from
+	// the pkg/xds module; Validate checks that a bootstrap config is given. Connections to xds
+	// targets use the security configured by the control plane, falling back to
+	// TransportCredentials (default: nil, xds targets are not supported)
+	XDS XDSSupport
+
+	// HealthCheck makes HealthCheck probe Ready connections with the grpc.health.v1 Check RPC,
+	// so health reflects application-level status (default: nil, connectivity state only)
+	HealthCheck *HealthCheckConfig
+
+	// Discovery looks up the addresses of services that have no address registered, when
+	// GetConnection is called without one. Their connections follow address changes reported by
+	// the resolver and spread calls over the addresses by LoadBalancingPolicy (default: nil)
+	Discovery discovery.Resolver
+
+	// Registry is a central source of service addresses fetched at startup (default: nil)
+	Registry RegistrySource
+
+	// RegistryRefreshInterval is how often the registry is re-fetched. Zero fetches only at startup (default: 0)
+	RegistryRefreshInterval time.Duration
+
+	// FailbackInterval is how often services connected to one of their FallbackAddresses probe their
+	// primary address, reconnecting to it once it accepts connections again. Zero disables failing
+	// back (default: 30s)
+	FailbackInterval time.Duration
+
+	// ResetPolicy controls when retry and circuit breaker failure state is reset after successes (default: immediate)
+	ResetPolicy interceptors.ResetPolicy
+
+	// Clock is used by time-based components such as retry backoff, circuit breakers and quotas.
+	// If nil, the real clock is used
+	Clock clock.Clock
+
+	// Logger receives the manager's and interceptors' logs. Use logger.NewSlog, zapadapter.New or
+	// zerologadapter.New to route them through an application logger. If nil, the default logger is used
+	Logger logger.Logger
+
+	// Services holds per-service overrides keyed by service name.
+	Services map[string]ServiceConfig
+}
+
+// ServiceConfig holds per-service overrides of the global configuration.
+// Zero values fall back to the corresponding Config field.
+type ServiceConfig struct {
+	// Address is the service's address, so that GetConnection can be called with an empty address
+	// as after RegisterService (default: "")
+	Address string
+
+	// MaxMsgSize overrides Config.MaxMsgSize for this service
+	MaxMsgSize int
+
+	// MaxReconnectDelay, ReconnectBaseDelay, ReconnectMultiplier and ReconnectJitter override the
+	// Config fields of the same name for this service, e.g. to reconnect to a flaky backend less
+	// aggressively (default: 0, the Config values)
+	MaxReconnectDelay   time.Duration
+	ReconnectBaseDelay  time.Duration
+	ReconnectMultiplier float64
+	ReconnectJitter     float64
+
+	// LoadBalancingPolicy overrides Config.LoadBalancingPolicy for this service (default: "")
+	LoadBalancingPolicy string
+
+	// TransportCredentials overrides Config.TransportCredentials for this service, e.g. mTLS for an
+	// external service while internal services use plaintext (default: nil)
+	TransportCredentials credentials.TransportCredentials
+
+	// PerRPCCredentials overrides Config.PerRPCCredentials for this service (default: nil)
+	PerRPCCredentials credentials.PerRPCCredentials
+
+	// Authority is the :authority of this service's calls and the TLS server name, e.g. the
+	// virtual host when dialing a shared ingress by IP address (default: "", from the address)
+	Authority string
+
+	// ServerNameOverride is the TLS server name sent (SNI) and verified when connecting to this
+	// service, when it must differ from Authority and the address (default: "", the authority)
+	ServerNameOverride string
+
+	// ContextDialer overrides Config.ContextDialer for this service (default: nil)
+	ContextDialer func(ctx context.Context, address string) (net.Conn, error)
+
+	// Headers are added to this service's calls after Config.Headers, e.g. its API key (default: nil)
+	Headers *interceptors.HeaderConfig
+
+	// Proxy routes this service's connections through an HTTP CONNECT or SOCKS5 proxy, dialed with the
+	// service's ContextDialer if it has one (default: nil, direct)
+	Proxy *ProxyConfig
+
+	// LogLevel is the minimum level logged for this service; lower levels are dropped before
+	// reaching Config.Logger (default: debug, everything the Logger accepts)
+	LogLevel logger.Level
+
+	// LatencySLO is the service's latency objective. When set, request durations are also recorded in a
+	// histogram with buckets derived from it, and slower requests count as SLO violations. Only applies to
+	// *metrics.Metrics (default: 0, none)
+	LatencySLO time.Duration
+
+	// FallbackAddresses are tried in order when the primary address does not become Ready
+	// within MinConnectTimeout during a single GetConnection call, and the next one is dialed when
+	// the circuit breaker of the address in use opens. While a fallback is in use, the primary is
+	// probed every Config.FailbackInterval and reconnected to once it is reachable (default: nil)
+	FallbackAddresses []string
+
+	// StandbyAddress is a backup address that is kept dialed and used when the primary's
+	// circuit breaker opens or its connection fails (default: "", no standby)
+	StandbyAddress string
+
+	// CanaryAddress is the address of a canary deployment, kept dialed next to the primary, that
+	// CanaryWeight of the GetConnection calls for the service are answered with (default: "", no canary)
+	CanaryAddress string
+
+	// CanaryWeight is the fraction of GetConnection calls, between 0 and 1, answered with the canary
+	// connection while it is Ready or Idle. The interceptors.FlagCanaryWeight weight of a Config.Flags
+	// that is also an interceptors.WeightProvider overrides it at runtime (default: 0)
+	CanaryWeight float64
+
+	// Methods restricts which methods may be called or streamed on this service (default: nil, all
+	// permitted)
+	Methods *interceptors.MethodFilterConfig
+
+	// MaintenanceWindows are periods of planned downtime during which calls and new streams are
+	// rejected locally
+	MaintenanceWindows []interceptors.MaintenanceWindow
+
+	// Quota limits the number of calls to this service per time window, each new stream counting
+	// as one call (default: nil, unlimited)
+	Quota *interceptors.QuotaConfig
+
+	// RateLimit overrides Config.RateLimit for this service (default: nil)
+	RateLimit *interceptors.RateLimitConfig
+
+	// Bulkhead overrides Config.Bulkhead for this service (default: nil)
+	Bulkhead *interceptors.BulkheadConfig
+
+	// Cache overrides Config.Cache for this service (default: nil)
+	Cache *interceptors.CacheConfig
+
+	// Dedup overrides Config.Dedup for this service (default: nil)
+	Dedup *interceptors.DedupConfig
+
+	// Hedging overrides Config.Hedging for this service (default: nil)
+	Hedging *interceptors.HedgingConfig
+
+	// RetryBudget overrides Config.RetryBudget for this service (default: nil)
+	RetryBudget *interceptors.RetryBudgetConfig
+
+	// Encryption enables application-layer payload encryption for this service (default: nil)
+	Encryption *interceptors.EncryptionConfig
+
+	// HealthCheckService overrides Config.HealthCheck.Service for this service (default: "")
+	HealthCheckService string
+
+	// WaitForReady overrides Config.DefaultWaitForReady for this service (default: nil)
+	WaitForReady *bool
+
+	// MethodWaitForReady overrides WaitForReady for individual methods, keyed by full method name
+	// or a prefix ending in "*"; the most specific key wins (default: nil)
+	MethodWaitForReady map[string]bool
+}
+
+// maxMsgSize returns the maximum message size for the given service.
+func (c *Config) maxMsgSize(serviceName string) int {
+	if sc, ok := c.Services[serviceName]; ok && sc.MaxMsgSize > 0 {
+		return sc.MaxMsgSize
+	}
+	return c.MaxMsgSize
+}
+
+// reconnectBackoff returns the backoff between reconnection attempts for the given service.
+func (c *Config) reconnectBackoff(serviceName string) backoff.Config {
+	b := backoff.Config{
+		BaseDelay:  c.ReconnectBaseDelay,
+		Multiplier: c.ReconnectMultiplier,
+		Jitter:     c.ReconnectJitter,
+		MaxDelay:   c.MaxReconnectDelay,
+	}
+	if sc, ok := c.Services[serviceName]; ok {
+		if sc.ReconnectBaseDelay > 0 {
+			b.BaseDelay = sc.ReconnectBaseDelay
+		}
+		if sc.ReconnectMultiplier > 0 {
+			b.Multiplier = sc.ReconnectMultiplier
+		}
+		if sc.ReconnectJitter > 0 {
+			b.Jitter = sc.ReconnectJitter
+		}
+		if sc.MaxReconnectDelay > 0 {
+			b.MaxDelay = sc.MaxReconnectDelay
+		}
+	}
+	if b.BaseDelay == 0 {
+		b.BaseDelay = 100 * time.Millisecond
+	}
+	if b.Multiplier == 0 {
+		b.Multiplier = 1.6
+	}
+	return b
+}
+
+// loadBalancingPolicy returns the load balancing policy for the given service, or "" for gRPC's
+// default.
+func (c *Config) loadBalancingPolicy(serviceName string) string {
+	if sc, ok := c.Services[serviceName]; ok && sc.LoadBalancingPolicy != "" {
+		return sc.LoadBalancingPolicy
+	}
+	return c.LoadBalancingPolicy
+}
+
+// transportCredentials returns the transport credentials for the given service.
+func (c *Config) transportCredentials(serviceName string) credentials.TransportCredentials {
+	sc := c.Services[serviceName]
+	creds := c.TransportCredentials
+	if sc.TransportCredentials != nil {
+		creds = sc.TransportCredentials
+	}
+	if creds != nil && sc.ServerNameOverride != "" {
+		return serverNameCredentials{TransportCredentials: creds, serverName: sc.ServerNameOverride}
+	}
+	return creds
+}
+
+// perRPCCredentials returns the per-RPC credentials for the given service.
+func (c *Config) perRPCCredentials(serviceName string) credentials.PerRPCCredentials {
+	if sc, ok := c.Services[serviceName]; ok && sc.PerRPCCredentials != nil {
+		return sc.PerRPCCredentials
+	}
+	return c.PerRPCCredentials
+}
+
+// headers returns the header sets added to the service's calls, in order.
+func (c *Config) headers(serviceName string) []*interceptors.HeaderConfig {
+	var headers []*interceptors.HeaderConfig
+	if c.Headers != nil {
+		headers = append(headers, c.Headers)
+	}
+	if sc := c.Services[serviceName]; sc.Headers != nil {
+		headers = append(headers, sc.Headers)
+	}
+	return headers
+}
+
+// contextDialer returns the dialer for the given service, or nil for gRPC's.
+func (c *Config) contextDialer(serviceName string) func(context.Context, string) (net.Conn, error) {
+	if sc, ok := c.Services[serviceName]; ok && sc.ContextDialer != nil {
+		return sc.ContextDialer
+	}
+	return c.ContextDialer
+}
+
+// waitForReady returns the default WaitForReady call option for the given service.
+func (c *Config) waitForReady(serviceName string) bool {
+	if sc, ok := c.Services[serviceName]; ok && sc.WaitForReady != nil {
+		return *sc.WaitForReady
+	}
+	return c.DefaultWaitForReady
+}
+
+// circuitBreaker returns a copy of the circuit breaker configuration, with the defaults if unset.
+func (c *Config) circuitBreaker() *interceptors.CircuitBreakerConfig {
+	cbConfig := interceptors.DefaultCircuitBreakerConfig()
+	if c.CircuitBreaker != nil {
+		*cbConfig = *c.CircuitBreaker
+	}
+	return cbConfig
+}
+
+// rateLimit returns the rate limit configuration for the given service, or nil if unlimited.
+func (c *Config) rateLimit(serviceName string) *interceptors.RateLimitConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.RateLimit != nil {
+		return sc.RateLimit
+	}
+	return c.RateLimit
+}
+
+func validateRateLimit(cfg *interceptors.RateLimitConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.QPS < 0 || cfg.Burst < 0 {
+		return errors.New("QPS and Burst must not be negative")
+	}
+	for method, limit := range cfg.Methods {
+		if limit.QPS < 0 || limit.Burst < 0 {
+			return fmt.Errorf("Methods[%s] QPS and Burst must not be negative", method)
+		}
+	}
+	return nil
+}
+
+// cache returns the response cache configuration for the given service, or nil if responses are
+// not cached.
+func (c *Config) cache(serviceName string) *interceptors.CacheConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.Cache != nil {
+		return sc.Cache
+	}
+	return c.Cache
+}
+
+func validateCache(cfg *interceptors.CacheConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxEntries < 0 {
+		return errors.New("MaxEntries must not be negative")
+	}
+	for method, ttl := range cfg.Methods {
+		if ttl <= 0 {
+			return fmt.Errorf("Methods[%s] must be positive", method)
+		}
+	}
+	return nil
+}
+
+// dedup returns the call coalescing configuration for the given service, or nil if calls are not
+// coalesced.
+func (c *Config) dedup(serviceName string) *interceptors.DedupConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.Dedup != nil {
+		return sc.Dedup
+	}
+	return c.Dedup
+}
+
+// hedging returns the hedging configuration for the given service, or nil if calls are not hedged.
+func (c *Config) hedging(serviceName string) *interceptors.HedgingConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.Hedging != nil {
+		return sc.Hedging
+	}
+	return c.Hedging
+}
+
+func validateHedging(cfg *interceptors.HedgingConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Delay < 0 {
+		return errors.New("Delay must not be negative")
+	}
+	if cfg.MaxAttempts < 0 {
+		return errors.New("MaxAttempts must not be negative")
+	}
+	return nil
+}
+
+// bulkhead returns the bulkhead configuration for the given service, or nil if unlimited.
+func (c *Config) bulkhead(serviceName string) *interceptors.BulkheadConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.Bulkhead != nil {
+		return sc.Bulkhead
+	}
+	return c.Bulkhead
+}
+
+func validateBulkhead(cfg *interceptors.BulkheadConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.MaxConcurrent <= 0 {
+		return errors.New("MaxConcurrent must be greater than 0")
+	}
+	if cfg.MaxWait < 0 {
+		return errors.New("MaxWait must not be negative")
+	}
+	return nil
+}
+
+// retryBudget returns the retry budget configuration for the given service, or nil if unlimited.
+func (c *Config) retryBudget(serviceName string) *interceptors.RetryBudgetConfig {
+	if sc, ok := c.Services[serviceName]; ok && sc.RetryBudget != nil {
+		return sc.RetryBudget
+	}
+	return c.RetryBudget
+}
+
+func validateOutlierDetection(cfg *OutlierDetectionConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		return errors.New("Interval must be greater than 0")
+	}
+	if cfg.FailureRateThreshold <= 0 || cfg.FailureRateThreshold > 1 {
+		return errors.New("FailureRateThreshold must be greater than 0 and at most 1")
+	}
+	if cfg.LatencyFactor < 0 {
+		return errors.New("LatencyFactor must not be negative")
+	}
+	if cfg.BaseEjectionTime <= 0 || cfg.MaxEjectionTime < cfg.BaseEjectionTime {
+		return errors.New("BaseEjectionTime must be greater than 0 and at most MaxEjectionTime")
+	}
+	if cfg.MaxEjectionPercent < 0 || cfg.MaxEjectionPercent > 100 {
+		return errors.New("MaxEjectionPercent must be between 0 and 100")
+	}
+	if cfg.MinimumRequests < 0 || cfg.RampUp < 0 {
+		return errors.New("MinimumRequests and RampUp must not be negative")
+	}
+	return nil
+}
+
+func validateRetryBudget(cfg *interceptors.RetryBudgetConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Ratio < 0 {
+		return errors.New("Ratio must not be negative")
+	}
+	if cfg.MinRetries < 0 {
+		return errors.New("MinRetries must not be negative")
+	}
+	return nil
+}
+
+func validateFailureRate(cfg *interceptors.FailureRateConfig) error {
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		return errors.New("Threshold must be greater than 0 and at most 1")
+	}
+	if cfg.MinimumRequests < 0 {
+		return errors.New("MinimumRequests must not be negative")
+	}
+	if cfg.WindowDuration < 0 {
+		return errors.New("WindowDuration must not be negative")
+	}
+	if cfg.WindowDuration == 0 && cfg.WindowSize <= 0 {
+		return errors.New("WindowSize must be greater than 0 without a WindowDuration")
+	}
+	return nil
+}
+
+// validateHeaders checks the static header names, which is nil if there are no headers. Names
+// starting with "grpc-" are reserved by gRPC.
+func validateHeaders(cfg *interceptors.HeaderConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	for key := range cfg.Static {
+		if key == "" {
+			return errors.New("Static header names must not be empty")
+		}
+		if strings.HasPrefix(strings.ToLower(key), "grpc-") {
+			return fmt.Errorf("Static header %q uses the reserved grpc- prefix", key)
+		}
+	}
+	return nil
+}
+
+// validateInterceptorOrder checks that order names known stages, each at most once.
+func validateInterceptorOrder(order []InterceptorStage) error {
+	for i, stage := range order {
+		switch stage {
+		case InterceptorLogging, InterceptorMetrics, InterceptorCircuitBreaker, InterceptorRetry, InterceptorExtra:
+		default:
+			return fmt.Errorf("unknown stage %q", stage)
+		}
+		if slices.Contains(order[:i], stage) {
+			return fmt.Errorf("stage %q is listed twice", stage)
+		}
+	}
+	return nil
+}
+
+// validateReconnectBackoff checks the reconnect backoff fields of a Config or ServiceConfig.
+func validateReconnectBackoff(base time.Duration, multiplier, jitter float64) error {
+	if base < 0 {
+		return errors.New("ReconnectBaseDelay must not be negative")
+	}
+	if multiplier != 0 && multiplier < 1 {
+		return errors.New("ReconnectMultiplier must be at least 1")
+	}
+	if jitter < 0 || jitter > 1 {
+		return errors.New("ReconnectJitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// validateService validates the overrides for the named service.
+func validateService(name string, sc ServiceConfig) error {
+	if sc.MaxMsgSize < 0 {
+		return fmt.Errorf("Services[%s].MaxMsgSize must not be negative", name)
+	}
+	if sc.MaxReconnectDelay < 0 {
+		return fmt.Errorf("Services[%s].MaxReconnectDelay must not be negative", name)
+	}
+	if err := validateReconnectBackoff(sc.ReconnectBaseDelay, sc.ReconnectMultiplier, sc.ReconnectJitter); err != nil {
+		return fmt.Errorf("Services[%s].%w", name, err)
+	}
+	if sc.LatencySLO < 0 {
+		return fmt.Errorf("Services[%s].LatencySLO must not be negative", name)
+	}
+	if strings.ContainsAny(sc.Authority, " /") {
+		return fmt.Errorf("Services[%s].Authority %q is not a valid authority", name, sc.Authority)
+	}
+	if strings.ContainsAny(sc.ServerNameOverride, " /:") {
+		return fmt.Errorf("Services[%s].ServerNameOverride %q is not a valid host name", name, sc.ServerNameOverride)
+	}
+	if sc.LoadBalancingPolicy != "" && balancer.Get(sc.LoadBalancingPolicy) == nil {
+		return fmt.Errorf("Services[%s].LoadBalancingPolicy %q is not registered", name, sc.LoadBalancingPolicy)
+	}
+	if err := validateHeaders(sc.Headers); err != nil {
+		return fmt.Errorf("Services[%s].Headers: %w", name, err)
+	}
+	if err := validateProxy(sc.Proxy); err != nil {
+		return fmt.Errorf("Services[%s].Proxy: %w", name, err)
+	}
+	if sc.LogLevel < logger.DebugLevel || sc.LogLevel > logger.ErrorLevel {
+		return fmt.Errorf("Services[%s].LogLevel %s is not a valid level", name, sc.LogLevel)
+	}
+	for _, w := range sc.MaintenanceWindows {
+		if !w.End.After(w.Start) {
+			return fmt.Errorf("Services[%s].MaintenanceWindows must end after they start", name)
+		}
+	}
+	if sc.Quota != nil {
+		for _, w := range sc.Quota.Windows {
+			if w.Period <= 0 || w.Limit <= 0 {
+				return fmt.Errorf("Services[%s].Quota windows must have a positive Period and Limit", name)
+			}
+		}
+	}
+	if err := validateRateLimit(sc.RateLimit); err != nil {
+		return fmt.Errorf("Services[%s].RateLimit: %w", name, err)
+	}
+	if err := validateBulkhead(sc.Bulkhead); err != nil {
+		return fmt.Errorf("Services[%s].Bulkhead: %w", name, err)
+	}
+	if err := validateCache(sc.Cache); err != nil {
+		return fmt.Errorf("Services[%s].Cache: %w", name, err)
+	}
+	if err := validateHedging(sc.Hedging); err != nil {
+		return fmt.Errorf("Services[%s].Hedging: %w", name, err)
+	}
+	if err := validateRetryBudget(sc.RetryBudget); err != nil {
+		return fmt.Errorf("Services[%s].RetryBudget: %w", name, err)
+	}
+	if sc.CanaryWeight < 0 || sc.CanaryWeight > 1 {
+		return fmt.Errorf("Services[%s].CanaryWeight must be between 0 and 1", name)
+	}
+	if sc.Encryption != nil && sc.Encryption.AEAD == nil {
+		return fmt.Errorf("Services[%s].Encryption.AEAD must be set", name)
+	}
+	return nil
+}
+
+// Validate validates the configuration and returns an error if invalid.
+func (c *Config) Validate() error {
+	if c.MaxMsgSize <= 0 {
+		return errors.New("MaxMsgSize must be greater than 0")
+	}
+	if c.KeepAliveTime <= 0 {
+		return errors.New("KeepAliveTime must be greater than 0")
+	}
+	if c.KeepAliveTimeout <= 0 {
+		return errors.New("KeepAliveTimeout must be greater than 0")
+	}
+	if c.MaxReconnectDelay <= 0 {
+		return errors.New("MaxReconnectDelay must be greater than 0")
+	}
+	if err := validateReconnectBackoff(c.ReconnectBaseDelay, c.ReconnectMultiplier, c.ReconnectJitter); err != nil {
+		return err
+	}
+	if c.MinConnectTimeout <= 0 {
+		return errors.New("MinConnectTimeout must be greater than 0")
+	}
+	if c.IdleTimeout < 0 {
+		return errors.New("IdleTimeout must not be negative")
+	}
+	if c.MaxIdleTime < 0 {
+		return errors.New("MaxIdleTime must not be negative")
+	}
+	if c.FailbackInterval < 0 {
+		return errors.New("FailbackInterval must not be negative")
+	}
+	if c.MaxConnectionAge < 0 {
+		return errors.New("MaxConnectionAge must not be negative")
+	}
+	if c.MaxConnectionAgeGrace < 0 {
+		return errors.New("MaxConnectionAgeGrace must not be negative")
+	}
+	if c.RebalanceInterval < 0 {
+		return errors.New("RebalanceInterval must not be negative")
+	}
+	if c.MaxCallerLabels < 0 {
+		return errors.New("MaxCallerLabels must not be negative")
+	}
+	if c.MaxTargetLabels < 0 {
+		return errors.New("MaxTargetLabels must not be negative")
+	}
+	if err := validateInterceptorOrder(c.InterceptorOrder); err != nil {
+		return fmt.Errorf("InterceptorOrder: %w", err)
+	}
+	if c.HealthCheck != nil && c.HealthCheck.Timeout < 0 {
+		return errors.New("HealthCheck.Timeout must not be negative")
+	}
+	if c.PoolSize < 0 {
+		return errors.New("PoolSize must not be negative")
+	}
+	if c.XDS != nil {
+		if err := c.XDS.Validate(); err != nil {
+			return fmt.Errorf("XDS: %w", err)
+		}
+	}
+	if c.PoolStrategy < PoolStrategyRoundRobin || c.PoolStrategy > PoolStrategyPowerOfTwoChoices {
+		return fmt.Errorf("PoolStrategy %d is not supported", c.PoolStrategy)
+	}
+	if c.DialMode != DialModeDialContext && c.DialMode != DialModeNewClient {
+		return fmt.Errorf("DialMode %d is not supported", c.DialMode)
+	}
+	if c.ConnectMode != ConnectModeLazy && c.ConnectMode != ConnectModeWaitForReady {
+		return fmt.Errorf("ConnectMode %d is not supported", c.ConnectMode)
+	}
+	if c.AdminListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.AdminListenAddr); err != nil {
+			return fmt.Errorf("AdminListenAddr: %w", err)
+		}
+	}
+	if c.ChannelzListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.ChannelzListenAddr); err != nil {
+			return fmt.Errorf("ChannelzListenAddr: %w", err)
+		}
+	}
+	if c.AsyncMetricsQueueSize < 0 {
+		return errors.New("AsyncMetricsQueueSize must not be negative")
+	}
+	if c.LoadBalancingPolicy != "" && balancer.Get(c.LoadBalancingPolicy) == nil {
+		return fmt.Errorf("LoadBalancingPolicy %q is not registered", c.LoadBalancingPolicy)
+	}
+	if c.Compression != "" && encoding.GetCompressor(c.Compression) == nil {
+		return fmt.Errorf("compressor %q is not registered", c.Compression)
+	}
+	if c.Pushgateway != nil {
+		if err := c.Pushgateway.Validate(); err != nil {
+			return fmt.Errorf("Pushgateway: %w", err)
+		}
+	}
+	if c.DefaultRPCTimeout < 0 {
+		return errors.New("DefaultRPCTimeout must not be negative")
+	}
+	if err := validateHeaders(c.Headers); err != nil {
+		return fmt.Errorf("Headers: %w", err)
+	}
+	if c.Logging != nil && c.Logging.MaxPayloadSize < 0 {
+		return errors.New("Logging.MaxPayloadSize must not be negative")
+	}
+	if c.Logging != nil && c.Logging.SuccessSampleRate < 0 {
+		return errors.New("Logging.SuccessSampleRate must not be negative")
+	}
+	if c.Logging != nil && c.Logging.SlowThreshold < 0 {
+		return errors.New("Logging.SlowThreshold must not be negative")
+	}
+	if c.DeadlineMargin < 0 {
+		return errors.New("DeadlineMargin must not be negative")
+	}
+	for method, timeout := range c.MethodTimeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("MethodTimeouts[%s] must be greater than 0", method)
+		}
+	}
+	if c.CompressionThreshold < 0 {
+		return errors.New("CompressionThreshold must not be negative")
+	}
+	if c.ResetPolicy.Mode == interceptors.ResetAfterSuccesses && c.ResetPolicy.Successes <= 0 {
+		return errors.New("ResetPolicy.Successes must be greater than 0")
+	}
+	if c.ResetPolicy.Mode == interceptors.ResetDecay && c.ResetPolicy.HalfLife <= 0 {
+		return errors.New("ResetPolicy.HalfLife must be greater than 0")
+	}
+	if c.Retry != nil && c.Retry.MaxAttempts <= 0 {
+		return errors.New("Retry.MaxAttempts must be greater than 0")
+	}
+	if c.Retry != nil && (c.Retry.Jitter < 0 || c.Retry.Jitter > 1) {
+		return errors.New("Retry.Jitter must be between 0 and 1")
+	}
+	if c.Retry != nil && c.Retry.PerAttemptTimeout < 0 {
+		return errors.New("Retry.PerAttemptTimeout must not be negative")
+	}
+	if c.Retry != nil {
+		for method, policy := range c.Retry.Methods {
+			if policy != nil && policy.MaxAttempts <= 0 {
+				return fmt.Errorf("Retry.Methods[%s].MaxAttempts must be greater than 0", method)
+			}
+		}
+	}
+	if c.CircuitBreaker != nil && c.CircuitBreaker.FailureRate == nil && c.CircuitBreaker.FailureThreshold <= 0 {
+		return errors.New("CircuitBreaker.FailureThreshold must be greater than 0")
+	}
+	if c.CircuitBreaker != nil && (c.CircuitBreaker.Scope < interceptors.BreakerScopeMethod || c.CircuitBreaker.Scope > interceptors.BreakerScopeMethodGroup) {
+		return fmt.Errorf("CircuitBreaker.Scope %d is not a valid scope", c.CircuitBreaker.Scope)
+	}
+	if c.CircuitBreaker != nil && c.CircuitBreaker.Scope == interceptors.BreakerScopeMethodGroup && len(c.CircuitBreaker.MethodGroups) == 0 {
+		return errors.New("CircuitBreaker.MethodGroups must be set with BreakerScopeMethodGroup")
+	}
+	if c.CircuitBreaker != nil && c.CircuitBreaker.FailureRate != nil {
+		if err := validateFailureRate(c.CircuitBreaker.FailureRate); err != nil {
+			return fmt.Errorf("CircuitBreaker.FailureRate: %w", err)
+		}
+	}
+	if c.ResolveInterval < 0 {
+		return errors.New("ResolveInterval must not be negative")
+	}
+	if c.RegistryRefreshInterval < 0 {
+		return errors.New("RegistryRefreshInterval must not be negative")
+	}
+	if err := validateRateLimit(c.RateLimit); err != nil {
+		return fmt.Errorf("RateLimit: %w", err)
+	}
+	if err := validateBulkhead(c.Bulkhead); err != nil {
+		return fmt.Errorf("Bulkhead: %w", err)
+	}
+	if err := validateCache(c.Cache); err != nil {
+		return fmt.Errorf("Cache: %w", err)
+	}
+	if err := validateHedging(c.Hedging); err != nil {
+		return fmt.Errorf("Hedging: %w", err)
+	}
+	if err := validateOutlierDetection(c.OutlierDetection); err != nil {
+		return fmt.Errorf("OutlierDetection: %w", err)
+	}
+	if err := validateRetryBudget(c.RetryBudget); err != nil {
+		return fmt.Errorf("RetryBudget: %w", err)
+	}
+	if c.Auth != nil && c.Auth.Provider == nil {
+		return errors.New("Auth.Provider must be set")
+	}
+	if c.Auth != nil && c.Auth.RefreshBefore < 0 {
+		return errors.New("Auth.RefreshBefore must not be negative")
+	}
+	if c.Audit != nil && c.Audit.Sink == nil {
+		return errors.New("Audit.Sink must be set")
+	}
+	for name, sc := range c.Services {
+		if err := validateService(name, sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultConfig returns a Config with sensible defaults.
+func DefaultConfig() *Config {
+	return &Config{
+		MaxMsgSize:                   1024 * 1024 * 1024, // 1GB
+		KeepAliveTime:                30 * time.Second,
+		KeepAliveTimeout:             5 * time.Second,
+		KeepAlivePermitWithoutStream: true,
+		MaxReconnectDelay:            3 * time.Second,
+		ReconnectBaseDelay:           100 * time.Millisecond,
+		ReconnectMultiplier:          1.6,
+		ReconnectJitter:              0.2,
+		MinConnectTimeout:            10 * time.Second,
+		PoolSize:                     1,
+		IdleTimeout:                  30 * time.Minute,
+		MaxConnectionAgeGrace:        time.Minute,
+		EnableLogging:                true,
+		EnableMetrics:                false,
+		MaxCallerLabels:              metrics.DefaultMaxCallerLabels,
+		EnableRetry:                  true,
+		EnableCircuitBreaker:         true,
+		EnableRequestSizeCheck:       true,
+		CompressionThreshold:         1024, // 1KB
+		FailbackInterval:             30 * time.Second,
+	}
+}
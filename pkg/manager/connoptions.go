@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ConnOption configures a connection returned by GetConnectionWithOptions.
+type ConnOption func(*connOptions)
+
+type connOptions struct {
+	connectMode *ConnectMode
+	callOpts    []grpc.CallOption
+}
+
+// ConnConnectMode makes GetConnectionWithOptions use mode instead of Config.ConnectMode, like
+// WithConnectMode.
+func ConnConnectMode(mode ConnectMode) ConnOption {
+	return func(o *connOptions) {
+		o.connectMode = &mode
+	}
+}
+
+// ConnWaitForReady sets whether calls wait for the connection to become Ready instead of failing
+// fast while it is in TransientFailure, overriding Config.DefaultWaitForReady and the service's
+// WaitForReady, though not its MethodWaitForReady.
+func ConnWaitForReady(waitForReady bool) ConnOption {
+	return ConnCallOptions(grpc.WaitForReady(waitForReady))
+}
+
+// ConnPerRPCCredentials attaches creds to every call, in addition to Config.PerRPCCredentials and
+// the service's own.
+func ConnPerRPCCredentials(creds credentials.PerRPCCredentials) ConnOption {
+	return ConnCallOptions(grpc.PerRPCCredentials(creds))
+}
+
+// ConnAuthority sets the :authority header of every call, e.g. to reach a virtual host behind a
+// shared proxy. The transport credentials must accept the authority: TLS credentials check it
+// against the server certificate.
+func ConnAuthority(authority string) ConnOption {
+	return ConnCallOptions(grpc.CallAuthority(authority))
+}
+
+// ConnCallOptions adds opts to every call.
+func ConnCallOptions(opts ...grpc.CallOption) ConnOption {
+	return func(o *connOptions) {
+		o.callOpts = append(o.callOpts, opts...)
+	}
+}
+
+// GetConnectionWithOptions is GetConnection with options scoped to the returned connection, such
+// as ConnWaitForReady, ConnPerRPCCredentials and ConnAuthority, instead of the configuration of
+// every call to the service. The connection is shared with GetConnection; the call options apply
+// only to calls made through the grpc.ClientConnInterface returned, before the options of the
+// call itself.
+func (cm *ConnectionManager) GetConnectionWithOptions(ctx context.Context, serviceName, address string, opts ...ConnOption) (grpc.ClientConnInterface, error) {
+	var o connOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.connectMode != nil {
+		ctx = WithConnectMode(ctx, *o.connectMode)
+	}
+
+	conn, err := cm.GetConnection(ctx, serviceName, address)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.callOpts) == 0 {
+		return conn, nil
+	}
+	return &optionsConn{conn: conn, callOpts: slices.Clip(o.callOpts)}, nil
+}
+
+// optionsConn adds call options to the calls made on a connection.
+type optionsConn struct {
+	conn     *grpc.ClientConn
+	callOpts []grpc.CallOption
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (c *optionsConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return c.conn.Invoke(ctx, method, args, reply, append(c.callOpts, opts...)...)
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (c *optionsConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.conn.NewStream(ctx, desc, method, append(c.callOpts, opts...)...)
+}
@@ -0,0 +1,14 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+)
+
+// WithCaller returns a copy of ctx tagged with the name of the calling component
+// (e.g. "checkout-worker"). When metrics are enabled, the caller is recorded as a
+// bounded-cardinality label on request metrics.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return interceptors.WithCaller(ctx, caller)
+}
@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+
+	"google.golang.org/grpc"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+)
+
+// ServiceDebugState describes a service for debugging, as returned by DebugState and served on
+// the admin server's /connections.
+type ServiceDebugState struct {
+	// Address is the address the service is registered with
+	Address string `json:"address,omitempty"`
+	// Dialed is the address the current connection was dialed with, e.g. a fallback address
+	Dialed string `json:"dialed,omitempty"`
+	// State is the connectivity state, or "NotConnected"
+	State string `json:"state"`
+	// PoolSize is the number of pooled connections, if Config.PoolSize is above 1
+	PoolSize int `json:"pool_size,omitempty"`
+	// Standby reports whether calls currently go to the standby connection
+	Standby bool `json:"standby,omitempty"`
+
+	// LastError is the error of the latest failed call, and LastErrorAt when it failed
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+	// FailedCalls, Retries and RetriesExhausted count the failed calls, the retries and the calls
+	// that failed after their last attempt since the service was first used
+	FailedCalls      uint64 `json:"failed_calls"`
+	Retries          uint64 `json:"retries"`
+	RetriesExhausted uint64 `json:"retries_exhausted"`
+	// CircuitBreakers holds the state of each of the service's circuit breakers, keyed by method,
+	// or by service name when breakers are shared by the whole service
+	CircuitBreakers map[string]string `json:"circuit_breakers,omitempty"`
+}
+
+// callStats counts a service's failed calls and retries from the events of its interceptors.
+type callStats struct {
+	failedCalls      atomic.Uint64
+	retries          atomic.Uint64
+	retriesExhausted atomic.Uint64
+	lastErr          atomic.Pointer[timedError]
+}
+
+type timedError struct {
+	err string
+	at  time.Time
+}
+
+// record updates the stats of the event's service.
+func (b *eventBus) record(e interceptors.Event) {
+	if e.Service == "" {
+		return
+	}
+	var stats *callStats
+	switch e.Kind {
+	case interceptors.EventCallFailed, interceptors.EventRetry, interceptors.EventRetryExhausted:
+		v, _ := b.stats.LoadOrStore(e.Service, &callStats{})
+		stats = v.(*callStats)
+	default:
+		return
+	}
+	switch e.Kind {
+	case interceptors.EventCallFailed:
+		stats.failedCalls.Add(1)
+		if e.Err != nil {
+			stats.lastErr.Store(&timedError{err: e.Err.Error(), at: b.clock.Now()})
+		}
+	case interceptors.EventRetry:
+		stats.retries.Add(1)
+	case interceptors.EventRetryExhausted:
+		stats.retriesExhausted.Add(1)
+	}
+}
+
+// DebugState returns the state of every known service for debugging production incidents: its
+// addresses, connectivity state, latest call error, failure and retry counts and circuit breaker
+// states. Retries are counted from the retry events, so retries of a RetryConfig with its own
+// Events sink are not. For the channels, subchannels and sockets underneath, see
+// Config.ChannelzListenAddr.
+func (cm *ConnectionManager) DebugState() map[string]ServiceDebugState {
+	cm.mu.RLock()
+	states := make(map[string]ServiceDebugState, len(cm.addresses))
+	add := func(name string) {
+		s := ServiceDebugState{Address: cm.addresses[name], Dialed: cm.dialed[name], State: "NotConnected"}
+		if conn := cm.connections[name]; conn != nil {
+			s.State = conn.GetState().String()
+		}
+		if pool := cm.pools[name]; pool != nil {
+			s.PoolSize = len(pool.conns)
+		}
+		if sb := cm.standbys[name]; sb != nil {
+			if active, _ := sb.activeFor(); active {
+				s.Standby = true
+				s.State = sb.conn.GetState().String()
+			}
+		}
+		states[name] = s
+	}
+	for name := range cm.addresses {
+		add(name)
+	}
+	for name := range cm.connections {
+		if _, ok := states[name]; !ok {
+			add(name)
+		}
+	}
+	cm.mu.RUnlock()
+
+	for name, s := range states {
+		if v, ok := cm.events.stats.Load(name); ok {
+			stats := v.(*callStats)
+			s.FailedCalls = stats.failedCalls.Load()
+			s.Retries = stats.retries.Load()
+			s.RetriesExhausted = stats.retriesExhausted.Load()
+			if last := stats.lastErr.Load(); last != nil {
+				s.LastError, s.LastErrorAt = last.err, last.at
+			}
+		}
+		if group, ok := cm.breakers.Group(name); ok {
+			s.CircuitBreakers = make(map[string]string)
+			for key, state := range group.States() {
+				s.CircuitBreakers[key] = state.String()
+			}
+		}
+		states[name] = s
+	}
+	return states
+}
+
+// startChannelz serves the grpc.channelz.v1 service on Config.ChannelzListenAddr until the manager
+// is closed.
+func (cm *ConnectionManager) startChannelz(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on ChannelzListenAddr %s: %w", addr, err)
+	}
+	cm.channelz = grpc.NewServer()
+	channelzsvc.RegisterChannelzServiceToServer(cm.channelz)
+	cm.channelzAddr = lis.Addr()
+
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		if err := cm.channelz.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			cm.logger.Errorf("Channelz server on %s failed: %v", lis.Addr(), err)
+		}
+	}()
+	return nil
+}
+
+// ChannelzAddr returns the address the channelz server listens on, or nil if it is not running.
+func (cm *ConnectionManager) ChannelzAddr() net.Addr {
+	return cm.channelzAddr
+}
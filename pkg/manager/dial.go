@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// dial creates a connection for the service. If the service has fallback addresses, each address
+// is tried in order until one becomes Ready within MinConnectTimeout, starting after the address
+// after when failing over from it. It returns the connection and the address it was dialed with.
+// create dials each address: createConnection with cm.mu held, or createConnectionUnlocked.
+func (cm *ConnectionManager) dial(ctx context.Context, create connectionFunc, serviceName, address, after string) (*grpc.ClientConn, string, error) {
+	if len(cm.config().Services[serviceName].FallbackAddresses) == 0 {
+		conn, err := create(ctx, address, serviceName)
+		return conn, address, err
+	}
+
+	var lastErr error
+	for _, addr := range cm.dialOrder(serviceName, address, after) {
+		conn, err := create(ctx, addr, serviceName)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", addr, err)
+			continue
+		}
+
+		if err := waitForReady(ctx, conn, cm.config().MinConnectTimeout); err != nil {
+			_ = conn.Close()
+			lastErr = fmt.Errorf("%s: %w", addr, err)
+			cm.serviceLogger(serviceName).Warnf("Failed to connect %s at %s: %v, trying next address", serviceName, addr, err)
+			continue
+		}
+
+		if addr != address {
+			cm.serviceLogger(serviceName).Infof("Connected %s using fallback address %s", serviceName, addr)
+		}
+		return conn, addr, nil
+	}
+	return nil, "", lastErr
+}
+
+// connectionFunc is the signature of createConnection and createConnectionUnlocked.
+type connectionFunc func(ctx context.Context, address string, serviceName string) (*grpc.ClientConn, error)
+
+// newClientConn creates a connection to target with grpc.NewClient, using the configured
+// DialMode. DialModeDialContext reproduces what the deprecated grpc.DialContext does without
+// WithBlock: targets without a known scheme use the passthrough resolver, and the connection
+// starts connecting right away. Neither mode blocks; waiting for Ready is left to ConnectMode and
+// FallbackAddresses.
+func (cm *ConnectionManager) newClientConn(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if cm.config().DialMode == DialModeNewClient {
+		return grpc.NewClient(target, opts...)
+	}
+	conn, err := grpc.NewClient(cm.passthroughTarget(target), opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.Connect()
+	return conn, nil
+}
+
+// passthroughTarget returns target with the passthrough scheme unless it already names the scheme
+// of a registered resolver or of one of the manager's own, as grpc.DialContext defaults to.
+func (cm *ConnectionManager) passthroughTarget(target string) string {
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" {
+		if resolver.Get(u.Scheme) != nil ||
+			(cm.resolver != nil && u.Scheme == cm.resolver.Scheme()) ||
+			(cm.discovery != nil && u.Scheme == cm.discovery.Scheme()) {
+			return target
+		}
+	}
+	return "passthrough:///" + target
+}
+
+// loadBalancingServiceConfig returns the JSON service config selecting the load balancing policy.
+// Service configs returned by the resolver, such as from DNS TXT records, take precedence.
+func loadBalancingServiceConfig(policy string) string {
+	cfg, _ := json.Marshal(map[string][]map[string]struct{}{
+		"loadBalancingConfig": {{policy: {}}},
+	})
+	return string(cfg)
+}
+
+type connectModeKey struct{}
+
+// WithConnectMode returns a copy of ctx that makes GetConnection use mode instead of
+// Config.ConnectMode.
+func WithConnectMode(ctx context.Context, mode ConnectMode) context.Context {
+	return context.WithValue(ctx, connectModeKey{}, mode)
+}
+
+// connectMode returns the ConnectMode for a GetConnection call with ctx.
+func (cm *ConnectionManager) connectMode(ctx context.Context) ConnectMode {
+	if mode, ok := ctx.Value(connectModeKey{}).(ConnectMode); ok {
+		return mode
+	}
+	return cm.config().ConnectMode
+}
+
+// awaitReady waits until conn is Ready or ctx is done, bounded by timeout when ctx has no
+// deadline. Unlike waitForReady it keeps waiting while the connection reconnects from
+// TransientFailure.
+func awaitReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return fmt.Errorf("connection is %s", state)
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("timed out waiting for connection in state %s: %w", state, ctx.Err())
+		}
+	}
+}
+
+// waitForReady starts connecting conn and waits until it is Ready. It fails as soon as the
+// connection enters TransientFailure or Shutdown, or when timeout or ctx expires.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection is %s", state)
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("timed out waiting for connection in state %s: %w", state, ctx.Err())
+		}
+	}
+}
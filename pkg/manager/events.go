@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// subscriber receives the events of the given kinds, or all events if kinds is empty.
+type subscriber struct {
+	fn    func(interceptors.Event)
+	kinds []interceptors.EventKind
+}
+
+// eventBus is the EventSink given to the manager's interceptors. It forwards events to
+// Config.Events and to the subscribers added with Subscribe and SubscribeChan, and counts them
+// for DebugState.
+type eventBus struct {
+	sink  interceptors.EventSink
+	clock clock.Clock
+	// stats holds the *callStats of each service
+	stats sync.Map
+	// subs is replaced on every change, so that Emit does not take a lock
+	subs atomic.Pointer[[]*subscriber]
+
+	mu sync.Mutex
+	// states holds the last connectivity state reported for each service
+	states map[string]connectivity.State
+}
+
+func (b *eventBus) Emit(ctx context.Context, e interceptors.Event) {
+	b.record(e)
+	if b.sink != nil {
+		b.sink.Emit(ctx, e)
+	}
+	subs := b.subs.Load()
+	if subs == nil {
+		return
+	}
+	for _, s := range *subs {
+		if len(s.kinds) == 0 || slices.Contains(s.kinds, e.Kind) {
+			s.fn(e)
+		}
+	}
+}
+
+func (b *eventBus) subscribe(s *subscriber) (unsubscribe func()) {
+	b.update(func(subs []*subscriber) []*subscriber { return append(subs, s) })
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.update(func(subs []*subscriber) []*subscriber {
+				return slices.DeleteFunc(subs, func(other *subscriber) bool { return other == s })
+			})
+		})
+	}
+}
+
+func (b *eventBus) update(fn func([]*subscriber) []*subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var subs []*subscriber
+	if current := b.subs.Load(); current != nil {
+		subs = slices.Clone(*current)
+	}
+	subs = fn(subs)
+	b.subs.Store(&subs)
+}
+
+// observe records the state a service's connection was seen in and reports whether it just
+// became Ready or entered TransientFailure.
+func (b *eventBus) observe(serviceName string, state connectivity.State) (interceptors.EventKind, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.states == nil {
+		b.states = make(map[string]connectivity.State)
+	}
+	if last, ok := b.states[serviceName]; ok && last == state {
+		return "", false
+	}
+	b.states[serviceName] = state
+	switch state {
+	case connectivity.Ready:
+		return interceptors.EventConnReady, true
+	case connectivity.TransientFailure:
+		return interceptors.EventConnTransientFailure, true
+	}
+	return "", false
+}
+
+// forget drops the last state reported for a service whose connection was closed.
+func (b *eventBus) forget(serviceName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, serviceName)
+}
+
+// Subscribe calls fn for every event of the given kinds, or for all events if no kinds are given:
+// connection lifecycle events as well as interceptor events such as failed calls, exhausted
+// retries and circuit breaker transitions; a breaker opening is an EventCircuitBreakerTransition
+// with To set to StateOpen. Events are also sent to Config.Events.
+//
+// fn is called synchronously, on the call path or with the manager's lock held, so it must not
+// block or call back into the manager; use SubscribeChan to handle events elsewhere. The returned
+// function removes the subscription.
+func (cm *ConnectionManager) Subscribe(fn func(interceptors.Event), kinds ...interceptors.EventKind) (unsubscribe func()) {
+	return cm.events.subscribe(&subscriber{fn: fn, kinds: kinds})
+}
+
+// SubscribeChan is like Subscribe but delivers events on a channel with the given buffer size.
+// Events that do not fit in the buffer are dropped rather than delaying calls. The returned
+// function removes the subscription and closes the channel.
+func (cm *ConnectionManager) SubscribeChan(size int, kinds ...interceptors.EventKind) (<-chan interceptors.Event, func()) {
+	ch := make(chan interceptors.Event, size)
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+	unsubscribe := cm.events.subscribe(&subscriber{kinds: kinds, fn: func(e interceptors.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}})
+	return ch, func() {
+		unsubscribe()
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// connEvent emits a connection lifecycle event for the service.
+func (cm *ConnectionManager) connEvent(kind interceptors.EventKind, serviceName, address string) {
+	cm.events.Emit(context.Background(), interceptors.Event{Kind: kind, Service: serviceName, Address: address})
+}
+
+// watchState follows the state changes of a service's primary connection until it is closed,
+// updating the connection state metric, emitting EventConnReady and EventConnTransientFailure
+// and remembering in cm.wasReady that the connection has been Ready.
+// A closed connection is not reported: the service has a new connection by then, or none.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) watchState(serviceName, address string, conn *grpc.ClientConn) {
+	m := cm.metrics
+	if !cm.config().EnableMetrics {
+		m = nil
+	}
+	go func() {
+		defer cm.wasReady.Delete(conn)
+		for {
+			state := conn.GetState()
+			if state == connectivity.Shutdown {
+				return
+			}
+			if state == connectivity.Ready {
+				cm.wasReady.Store(conn, struct{}{})
+			}
+			if m != nil {
+				m.UpdateGRPCConnectionState(serviceName, address, state.String())
+			}
+			if kind, ok := cm.events.observe(serviceName, state); ok {
+				cm.connEvent(kind, serviceName, address)
+			}
+			if !conn.WaitForStateChange(cm.ctx, state) {
+				return
+			}
+		}
+	}()
+}
+
+// connClosed emits EventConnClosed for the service. Must be called with cm.mu held.
+func (cm *ConnectionManager) connClosed(serviceName string) {
+	cm.events.forget(serviceName)
+	cm.connEvent(interceptors.EventConnClosed, serviceName, cm.dialed[serviceName])
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// failover tracks a service with FallbackAddresses. tripped is set when the circuit breaker of
+// the address in use opens, which happens on the call path without cm.mu, and makes the next
+// GetConnection move on to the next address.
+type failover struct {
+	tripped atomic.Bool
+}
+
+// failover returns the service's failover state, creating it on first use, or nil if the service
+// has no fallback addresses. Must be called with cm.mu held.
+func (cm *ConnectionManager) failover(serviceName string) *failover {
+	if len(cm.config().Services[serviceName].FallbackAddresses) == 0 {
+		return nil
+	}
+	if fo := cm.failovers[serviceName]; fo != nil {
+		return fo
+	}
+	fo := &failover{}
+	cm.failovers[serviceName] = fo
+	cm.publish(serviceName)
+	return fo
+}
+
+// dialOrder returns the addresses to dial for the service: its primary address followed by its
+// fallbacks. When failing over from after, the addresses following it come first and after is
+// tried last.
+func (cm *ConnectionManager) dialOrder(serviceName, address, after string) []string {
+	addresses := append([]string{address}, cm.config().Services[serviceName].FallbackAddresses...)
+	i := slices.Index(addresses, after)
+	if i < 0 {
+		return addresses
+	}
+	return append(slices.Clone(addresses[i+1:]), addresses[:i+1]...)
+}
+
+// startFailback starts probing the primary addresses of services connected to a fallback, if
+// FailbackInterval is set.
+func (cm *ConnectionManager) startFailback() {
+	select {
+	case cm.failback <- struct{}{}:
+	default:
+	}
+}
+
+// runFailbackLoop probes primary addresses every FailbackInterval once a service has connected
+// to a fallback address. The ticker is only started then, so managers without failovers keep no
+// timer running.
+func (cm *ConnectionManager) runFailbackLoop() {
+	defer cm.wg.Done()
+
+	select {
+	case <-cm.done:
+		return
+	case <-cm.failback:
+	}
+
+	ticker := cm.clock.NewTicker(cm.config().FailbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.done:
+			return
+		case <-ticker.C():
+			cm.probePrimaries()
+		}
+	}
+}
+
+// probePrimaries checks whether the primary addresses of services connected to one of their
+// fallback addresses accept connections again, and reconnects those services to them.
+func (cm *ConnectionManager) probePrimaries() {
+	cm.mu.RLock()
+	primaries := make(map[string]string)
+	for name, dialed := range cm.dialed {
+		primary := cm.addresses[name]
+		if cm.connections[name] != nil && dialed != primary &&
+			slices.Contains(cm.config().Services[name].FallbackAddresses, dialed) {
+			primaries[name] = primary
+		}
+	}
+	cm.mu.RUnlock()
+
+	for name, primary := range primaries {
+		if !cm.probe(name, primary) {
+			continue
+		}
+		cm.serviceLogger(name).Infof("Primary address %s of %s is reachable again, failing back", primary, name)
+		ctx, cancel := context.WithTimeout(cm.ctx, cm.config().MinConnectTimeout)
+		if _, err := cm.ResetConnection(ctx, name); err != nil {
+			cm.serviceLogger(name).Warnf("Failed to fail back %s to %s: %v", name, primary, err)
+		}
+		cancel()
+	}
+}
+
+// probe reports whether a connection to address becomes Ready within MinConnectTimeout. The
+// probe connection has none of the service's interceptors, so it does not count as a call.
+func (cm *ConnectionManager) probe(serviceName, address string) bool {
+	creds := cm.config().transportCredentials(serviceName)
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	ctx, cancel := context.WithTimeout(cm.ctx, cm.config().MinConnectTimeout)
+	defer cancel()
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	dialer, err := cm.config().dialer(serviceName)
+	if err != nil {
+		return false
+	}
+	if dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+	target := address
+	if cm.resolvesAtProxy(serviceName, address) {
+		target = "passthrough:///" + address
+	}
+	conn, err := cm.newClientConn(target, opts...)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return waitForReady(ctx, conn, cm.config().MinConnectTimeout) == nil
+}
@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ConnectionHealth represents the health status of a gRPC connection.
+// When Config.IdleTimeout is set, Idle connections that have been Ready are healthy: they
+// dropped to Idle by design after a period without RPCs and reconnect on the next call.
+type ConnectionHealth struct {
+	State   string `json:"state"`             // Connection state (Idle, Connecting, Ready, TransientFailure, Shutdown)
+	Healthy bool   `json:"healthy"`           // Whether the connection is healthy
+	Error   string `json:"error"`             // Error message if unhealthy
+	Address string `json:"address,omitempty"` // Address the connection was dialed with
+
+	// HealthStatus is the serving status reported by the grpc.health.v1 Check RPC, if probed
+	HealthStatus string `json:"health_status,omitempty"`
+
+	// CheckedAt is when the health was checked
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthCheckConfig enables probing connections with the standard grpc.health.v1.Health/Check RPC.
+type HealthCheckConfig struct {
+	// Service is the service name sent in the health check request. Empty checks the server's
+	// overall health (default: ""). ServiceConfig.HealthCheckService overrides it per service
+	Service string
+
+	// Timeout bounds each health check RPC (default: 1s)
+	Timeout time.Duration
+}
+
+// DefaultHealthCheckTimeout is the health check RPC timeout used when HealthCheckConfig.Timeout is zero.
+const DefaultHealthCheckTimeout = time.Second
+
+// HealthCheck returns the health status of all managed connections.
+// If Config.HealthCheck is set, Ready connections are also probed with the grpc.health.v1 Check RPC
+// and are only healthy if the server reports SERVING. Idle connections are not probed, so health
+// checks do not keep otherwise unused connections open.
+func (cm *ConnectionManager) HealthCheck(ctx context.Context) map[string]ConnectionHealth {
+	cm.mu.RLock()
+
+	result := make(map[string]ConnectionHealth)
+	probes := make(map[string]*grpc.ClientConn)
+	now := cm.clock.Now()
+
+	for name := range cm.addresses {
+		conn := cm.connections[name]
+		if conn == nil {
+			result[name] = ConnectionHealth{
+				State:     "NotConnected",
+				Healthy:   false,
+				Error:     "connection not established yet",
+				CheckedAt: now,
+			}
+			continue
+		}
+
+		state := conn.GetState()
+		result[name] = ConnectionHealth{
+			State:     state.String(),
+			Healthy:   cm.isHealthyState(conn, state),
+			Address:   cm.dialed[name],
+			CheckedAt: now,
+		}
+		if cm.config().HealthCheck != nil && state == connectivity.Ready {
+			probes[name] = conn
+		}
+
+		if cm.config().EnableMetrics && cm.metrics != nil {
+			cm.metrics.UpdateGRPCConnectionState(name, cm.addresses[name], state.String())
+		}
+	}
+
+	for name, conn := range cm.connections {
+		if _, exists := cm.addresses[name]; !exists {
+			state := conn.GetState()
+			result[name] = ConnectionHealth{
+				State:     state.String(),
+				Healthy:   cm.isHealthyState(conn, state),
+				CheckedAt: now,
+			}
+		}
+	}
+
+	cm.mu.RUnlock()
+
+	// Probe outside the lock so slow backends do not block GetConnection.
+	for name, conn := range probes {
+		health := result[name]
+		health.HealthStatus, health.Error = cm.probeHealth(ctx, name, conn)
+		health.Healthy = health.HealthStatus == healthpb.HealthCheckResponse_SERVING.String()
+		result[name] = health
+	}
+
+	return result
+}
+
+// probeHealth calls the grpc.health.v1 Check RPC on conn and returns the reported serving
+// status, or an error message if the check failed.
+func (cm *ConnectionManager) probeHealth(ctx context.Context, serviceName string, conn *grpc.ClientConn) (string, string) {
+	timeout := cm.config().HealthCheck.Timeout
+	if timeout == 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	service := cm.config().HealthCheck.Service
+	if sc, ok := cm.config().Services[serviceName]; ok && sc.HealthCheckService != "" {
+		service = sc.HealthCheckService
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN.String(), fmt.Sprintf("health check failed: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return resp.GetStatus().String(), fmt.Sprintf("health check reported %s", resp.GetStatus())
+	}
+	return resp.GetStatus().String(), ""
+}
+
+// GetConnectionState returns the connectivity state of the connection currently used for the service,
+// or false if the service has no connection. It does not create connections or change their state.
+func (cm *ConnectionManager) GetConnectionState(serviceName string) (connectivity.State, bool) {
+	cm.mu.RLock()
+	conn := cm.connections[serviceName]
+	sb := cm.standbys[serviceName]
+	cm.mu.RUnlock()
+
+	if sb != nil {
+		if active, _ := sb.activeFor(); active {
+			return sb.conn.GetState(), true
+		}
+	}
+	if conn == nil {
+		return connectivity.Idle, false
+	}
+	return conn.GetState(), true
+}
+
+// isHealthyState reports whether conn, in the given state, is healthy. With IdleTimeout, a
+// connection that went Idle after being Ready is healthy too, but one that has never connected is
+// not.
+func (cm *ConnectionManager) isHealthyState(conn *grpc.ClientConn, state connectivity.State) bool {
+	if state == connectivity.Ready {
+		return true
+	}
+	if state != connectivity.Idle || cm.config().IdleTimeout <= 0 {
+		return false
+	}
+	_, ok := cm.wasReady.Load(conn)
+	return ok
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// serviceEntry is what GetConnection needs to return an existing connection of a service. Entries
+// are never modified once stored.
+type serviceEntry struct {
+	address  string
+	conn     *grpc.ClientConn
+	pool     *connPool
+	standby  *standbyConn
+	canary   *grpc.ClientConn
+	failover *failover
+}
+
+// serviceIndex holds a copy of each service's serviceEntry, so that GetConnection calls for
+// services that are already connected take no lock at all. cm.mu remains the lock of the
+// connection maps: entries are only written while it is held, by publish, after the maps change.
+type serviceIndex struct {
+	entries sync.Map // service name -> *serviceEntry
+}
+
+// load returns the service's entry, or the zero entry if it has none.
+func (s *serviceIndex) load(name string) *serviceEntry {
+	if e, ok := s.entries.Load(name); ok {
+		return e.(*serviceEntry)
+	}
+	return &serviceEntry{}
+}
+
+func (s *serviceIndex) store(name string, e serviceEntry) {
+	if e == (serviceEntry{}) {
+		s.entries.Delete(name)
+		return
+	}
+	s.entries.Store(name, &e)
+}
+
+func (s *serviceIndex) clear() {
+	s.entries.Clear()
+}
+
+// publish copies the service's address and connections from the connection maps to cm.services.
+// Must be called with cm.mu held, after changing any of them.
+func (cm *ConnectionManager) publish(name string) {
+	cm.services.store(name, serviceEntry{
+		address:  cm.addresses[name],
+		conn:     cm.connections[name],
+		pool:     cm.pools[name],
+		standby:  cm.standbys[name],
+		canary:   cm.canaries[name],
+		failover: cm.failovers[name],
+	})
+}
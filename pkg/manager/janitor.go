@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// connUsage tracks when a connection was created and last used, and how many calls it has in
+// flight, for MaxIdleTime, MaxConnectionAge and RebalanceInterval. Calls are also counted in the
+// manager-wide calls that Shutdown waits for.
+type connUsage struct {
+	created     time.Time
+	rebalanceAt time.Time    // zero without RebalanceInterval or while rebalancing; guarded by cm.mu
+	lastUsed    atomic.Int64 // UnixNano
+	active      atomic.Int64
+	calls       *inflightCalls
+}
+
+func newConnUsage(now time.Time, calls *inflightCalls) *connUsage {
+	u := &connUsage{created: now, calls: calls}
+	u.lastUsed.Store(now.UnixNano())
+	return u
+}
+
+func (u *connUsage) start(now time.Time) {
+	u.active.Add(1)
+	u.calls.add(1)
+	u.lastUsed.Store(now.UnixNano())
+}
+
+func (u *connUsage) finish(now time.Time) {
+	u.lastUsed.Store(now.UnixNano())
+	u.active.Add(-1)
+	u.calls.add(-1)
+}
+
+func (u *connUsage) unaryInterceptor(clk clock.Clock) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		u.start(clk.Now())
+		defer func() { u.finish(clk.Now()) }()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// streamInterceptor counts a stream as in flight until its context is done, which happens when
+// the stream ends or is canceled.
+func (u *connUsage) streamInterceptor(clk clock.Clock) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		u.start(clk.Now())
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			u.finish(clk.Now())
+			return nil, err
+		}
+		context.AfterFunc(stream.Context(), func() { u.finish(clk.Now()) })
+		return stream, nil
+	}
+}
+
+// retiredConn is a connection taken out of use by MaxConnectionAge or RebalanceInterval that is
+// closed once its calls are done or its grace period is over.
+type retiredConn struct {
+	conn     *grpc.ClientConn
+	usage    *connUsage
+	deadline time.Time
+}
+
+// tracksUsage reports whether the janitor runs, so that connection usage is kept in cm.usage.
+func (c *Config) tracksUsage() bool {
+	return c.MaxIdleTime > 0 || c.MaxConnectionAge > 0 || c.RebalanceInterval > 0
+}
+
+// janitorInterval returns how often the janitor looks for connections to evict: half the shortest
+// of MaxIdleTime, MaxConnectionAge and RebalanceInterval.
+func (c *Config) janitorInterval() time.Duration {
+	var interval time.Duration
+	for _, d := range []time.Duration{c.MaxIdleTime, c.MaxConnectionAge, c.RebalanceInterval} {
+		if d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+	return interval / 2
+}
+
+func (cm *ConnectionManager) runJanitor(interval time.Duration) {
+	defer cm.wg.Done()
+
+	ticker := cm.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.done:
+			return
+		case <-ticker.C():
+			cm.evictConnections()
+		}
+	}
+}
+
+// evictConnections closes the connections of services that have been idle for MaxIdleTime and
+// retires those older than MaxConnectionAge, so that the next GetConnection dials a fresh
+// connection, and starts replacing those due for RebalanceInterval. Standby connections are left
+// alone.
+func (cm *ConnectionManager) evictConnections() {
+	now := cm.clock.Now()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for name, primary := range cm.connections {
+		usage := cm.usage[primary]
+		if usage == nil {
+			continue
+		}
+		conns := []*grpc.ClientConn{primary}
+		if pool := cm.pools[name]; pool != nil {
+			conns = pool.conns
+		}
+
+		lastUsed, active := usage.lastUsed.Load(), int64(0)
+		for _, conn := range conns {
+			if u := cm.usage[conn]; u != nil {
+				lastUsed = max(lastUsed, u.lastUsed.Load())
+				active += u.active.Load()
+			}
+		}
+
+		switch {
+		case cm.config().MaxConnectionAge > 0 && now.Sub(usage.created) >= cm.config().MaxConnectionAge:
+			cm.serviceLogger(name).Infof("Connection for %s reached its maximum age of %v, reconnecting", name, cm.config().MaxConnectionAge)
+			cm.retire(name, conns, now)
+		case cm.config().MaxIdleTime > 0 && active == 0 && now.Sub(time.Unix(0, lastUsed)) >= cm.config().MaxIdleTime:
+			cm.serviceLogger(name).Infof("Closing connection for %s after %v without calls", name, cm.config().MaxIdleTime)
+			_ = cm.dropConnection(name)
+		case !usage.rebalanceAt.IsZero() && !now.Before(usage.rebalanceAt):
+			usage.rebalanceAt = time.Time{}
+			cm.wg.Add(1)
+			go cm.rebalance(name, primary)
+		}
+	}
+
+	cm.retired = slices.DeleteFunc(cm.retired, func(r retiredConn) bool {
+		if r.usage.active.Load() > 0 && now.Before(r.deadline) {
+			return false
+		}
+		_ = r.conn.Close()
+		return true
+	})
+
+	for conn := range cm.usage {
+		if conn.GetState() == connectivity.Shutdown {
+			delete(cm.usage, conn)
+		}
+	}
+}
+
+// retire removes the service's connections so that the next GetConnection dials new ones, and
+// keeps them open for MaxConnectionAgeGrace to let calls in flight finish. Must be called with
+// cm.mu held.
+func (cm *ConnectionManager) retire(serviceName string, conns []*grpc.ClientConn, now time.Time) {
+	if pool := cm.pools[serviceName]; pool != nil {
+		if pool.outliers != nil {
+			pool.outliers.forget(pool.conns)
+		}
+		if pool.loads != nil {
+			pool.loads.forget(pool.conns)
+		}
+	}
+	delete(cm.pools, serviceName)
+	delete(cm.connections, serviceName)
+	cm.publish(serviceName)
+	cm.connClosed(serviceName)
+
+	deadline := now.Add(cm.config().MaxConnectionAgeGrace)
+	for _, conn := range conns {
+		usage := cm.usage[conn]
+		if usage == nil {
+			usage = newConnUsage(now, &cm.calls)
+		}
+		cm.retired = append(cm.retired, retiredConn{conn: conn, usage: usage, deadline: deadline})
+	}
+}
@@ -0,0 +1,405 @@
+package manager
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// LoadConfig reads a Config from a YAML or JSON file. Keys are the names of the Config fields,
+// matched regardless of case, underscores and dashes, so "MaxMsgSize" and "max_msg_size" are the
+// same key:
+//
+//	max_msg_size: 4194304
+//	retry:
+//	  max_attempts: 5
+//	  retryable_codes: [UNAVAILABLE, RESOURCE_EXHAUSTED]
+//	services:
+//	  payments:
+//	    latency_slo: 200ms
+//
+// Durations are strings such as "30s" and status codes are their names. Fields missing from the
+// file keep their DefaultConfig values, and sections such as retry and circuit_breaker start from
+// their own defaults. Fields holding Go values, such as credentials, loggers and interceptors,
+// cannot be set from a file. The result is validated; errors name the offending key.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	cfg := DefaultConfig()
+	if err := decodeStruct(reflect.ValueOf(cfg).Elem(), raw, ""); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ConfigFromEnv reads a Config from environment variables named after the Config fields in upper
+// snake case under prefix, e.g. with prefix "GRPC": GRPC_MAX_MSG_SIZE, GRPC_RETRY_MAX_ATTEMPTS and
+// GRPC_CIRCUIT_BREAKER_TIMEOUT. Lists of values are comma-separated; maps and lists of sections,
+// such as the per-service overrides in GRPC_SERVICES, are given as YAML or JSON in the format of
+// LoadConfig. Variables that are not set keep their DefaultConfig values. Unknown variables under
+// prefix are rejected, and errors name the offending variable.
+func ConfigFromEnv(prefix string) (*Config, error) {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if prefix == "" || strings.HasPrefix(name, prefix+"_") {
+			env[name] = value
+		}
+	}
+
+	cfg := DefaultConfig()
+	used := make(map[string]bool)
+	if err := decodeEnv(reflect.ValueOf(cfg).Elem(), env, prefix, used); err != nil {
+		return nil, fmt.Errorf("invalid config from environment: %w", err)
+	}
+	if prefix != "" {
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			if !used[name] {
+				return nil, fmt.Errorf("invalid config from environment: %s: unknown variable", name)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config from environment: %w", err)
+	}
+	return cfg, nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// defaultSection returns the value a nil section starts from, so that setting one field of a
+// section keeps the defaults of the others.
+func defaultSection(t reflect.Type) reflect.Value {
+	switch t {
+	case reflect.TypeOf((*interceptors.RetryConfig)(nil)):
+		return reflect.ValueOf(interceptors.DefaultRetryConfig())
+	case reflect.TypeOf((*interceptors.RetryBudgetConfig)(nil)):
+		return reflect.ValueOf(interceptors.DefaultRetryBudgetConfig())
+	case reflect.TypeOf((*interceptors.CircuitBreakerConfig)(nil)):
+		return reflect.ValueOf(interceptors.DefaultCircuitBreakerConfig())
+	case reflect.TypeOf((*interceptors.FailureRateConfig)(nil)):
+		return reflect.ValueOf(interceptors.DefaultFailureRateConfig())
+	case reflect.TypeOf((*OutlierDetectionConfig)(nil)):
+		return reflect.ValueOf(DefaultOutlierDetectionConfig())
+	}
+	return reflect.New(t.Elem())
+}
+
+// normalizeKey lowercases a key and drops underscores and dashes.
+func normalizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, key)
+}
+
+// envName converts a field name such as "MaxMsgSize" or "QPS" to upper snake case.
+func envName(field string) string {
+	var b strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// structFields returns the exported fields of t by name, with the fields of embedded structs
+// promoted as in Go.
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if f.IsExported() && !f.Anonymous {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// isSection reports whether values of t are set field by field rather than from a single value.
+func isSection(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// isScalar reports whether values of t can be parsed from a single string.
+func isScalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return false
+	}
+	return !isSection(t)
+}
+
+func decodeStruct(v reflect.Value, raw map[string]interface{}, prefix string) error {
+	fields := make(map[string]reflect.StructField)
+	for _, f := range structFields(v.Type()) {
+		fields[normalizeKey(f.Name)] = f
+	}
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		f, ok := fields[normalizeKey(key)]
+		if !ok {
+			return fmt.Errorf("%s: unknown key", joinKey(prefix, key))
+		}
+		if err := decodeValue(v.FieldByIndex(f.Index), raw[key], joinKey(prefix, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asMap converts a decoded YAML or JSON mapping to a map with string keys.
+func asMap(raw interface{}) (map[string]interface{}, bool) {
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// decodeValue sets v from a value decoded from YAML or JSON, or from the text of an environment
+// variable. key names the value in errors.
+func decodeValue(v reflect.Value, raw interface{}, key string) error {
+	t := v.Type()
+	if raw == nil {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+	if rv := reflect.ValueOf(raw); rv.Type() == t {
+		v.Set(rv)
+		return nil
+	}
+	text, isText := raw.(string)
+
+	switch {
+	case t == durationType:
+		if !isText {
+			return fmt.Errorf("%s: want a duration such as \"30s\", got %v", key, raw)
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case isText && reflect.PointerTo(t).Implements(textUnmarshalerType):
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	case isText && reflect.PointerTo(t).Implements(jsonUnmarshalerType) && t.Kind() != reflect.Struct:
+		// Enums such as codes.Code parse their names from JSON strings.
+		if err := v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON([]byte(strconv.Quote(text))); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(defaultSection(t))
+		}
+		return decodeValue(v.Elem(), raw, key)
+	case reflect.Struct:
+		m, ok := asMap(raw)
+		if !ok {
+			return fmt.Errorf("%s: want a mapping, got %v", key, raw)
+		}
+		return decodeStruct(v, m, key)
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return fmt.Errorf("%s: cannot be set from configuration", key)
+		}
+		m, ok := asMap(raw)
+		if !ok {
+			return fmt.Errorf("%s: want a mapping, got %v", key, raw)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			elem := reflect.New(t.Elem()).Elem()
+			if existing := v.MapIndex(reflect.ValueOf(k).Convert(t.Key())); existing.IsValid() {
+				elem.Set(existing)
+			} else if t.Elem().Kind() == reflect.Pointer && m[k] != nil {
+				// Entries such as per-method retry policies inherit from their parent, not the defaults.
+				elem.Set(reflect.New(t.Elem().Elem()))
+			}
+			if err := decodeValue(elem, m[k], key+"."+k); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+		}
+		return nil
+	case reflect.Slice:
+		var items []interface{}
+		switch {
+		case isText && isScalar(t.Elem()):
+			for _, item := range strings.Split(text, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+		default:
+			var ok bool
+			if items, ok = raw.([]interface{}); !ok {
+				return fmt.Errorf("%s: want a list, got %v", key, raw)
+			}
+		}
+		s := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(s.Index(i), item, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if isText {
+			var err error
+			if b, err = strconv.ParseBool(text); err != nil {
+				return fmt.Errorf("%s: want true or false, got %q", key, text)
+			}
+		} else if !ok {
+			return fmt.Errorf("%s: want true or false, got %v", key, raw)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(fmt.Sprint(raw), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("%s: want an integer, got %v", key, raw)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(fmt.Sprint(raw), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("%s: want a non-negative integer, got %v", key, raw)
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(fmt.Sprint(raw), t.Bits())
+		if err != nil {
+			return fmt.Errorf("%s: want a number, got %v", key, raw)
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		if _, ok := asMap(raw); ok {
+			return fmt.Errorf("%s: want a string, got a mapping", key)
+		}
+		v.SetString(fmt.Sprint(raw))
+		return nil
+	}
+	return fmt.Errorf("%s: cannot be set from configuration", key)
+}
+
+// decodeEnv sets the fields of the struct v from the environment variables named after them under
+// prefix, recording the variables it used.
+func decodeEnv(v reflect.Value, env map[string]string, prefix string, used map[string]bool) error {
+	for _, f := range structFields(v.Type()) {
+		name := envName(f.Name)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		fv := v.FieldByIndex(f.Index)
+
+		if text, ok := env[name]; ok {
+			used[name] = true
+			var raw interface{} = text
+			if !isScalar(f.Type) && !(f.Type.Kind() == reflect.Slice && isScalar(f.Type.Elem())) {
+				if err := yaml.Unmarshal([]byte(text), &raw); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			if err := decodeValue(fv, raw, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isSection(f.Type) || !hasEnvPrefix(env, name+"_") {
+			continue
+		}
+		if f.Type.Kind() != reflect.Pointer {
+			if err := decodeEnv(fv, env, name, used); err != nil {
+				return err
+			}
+			continue
+		}
+		// Only set a nil section if one of its fields is actually given, since another field's
+		// variables may share its prefix.
+		section := fv
+		if fv.IsNil() {
+			section = defaultSection(f.Type)
+		}
+		before := len(used)
+		if err := decodeEnv(section.Elem(), env, name, used); err != nil {
+			return err
+		}
+		if len(used) > before {
+			fv.Set(section)
+		}
+	}
+	return nil
+}
+
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for name := range env {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
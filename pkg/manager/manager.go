@@ -0,0 +1,764 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/discovery"
+	"github.com/begenov/grpc-connection-manager/pkg/dnscache"
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ConnectionManager manages gRPC client connections with features like
+// connection pooling, automatic reconnection, circuit breaking, retry logic,
+// logging, and metrics collection.
+type ConnectionManager struct {
+	mu          sync.RWMutex
+	connections map[string]*grpc.ClientConn
+	addresses   map[string]string
+	dialed      map[string]string
+	quotas      map[string]*interceptors.Quota
+	limiters    map[string]*interceptors.RateLimiter
+	bulkheads   map[string]*interceptors.Bulkhead
+	caches      map[string]*interceptors.ResponseCache
+	dedups      map[string]*interceptors.Deduplicator
+	budgets     map[string]*interceptors.RetryBudget
+	breakers    *interceptors.CircuitBreakerRegistry
+	outliers    map[string]*outlierDetector
+	failovers   map[string]*failover
+	loads       map[string]*poolLoad
+	retriers    map[string]*retrier
+	resolved    map[string][]string
+	standbys    map[string]*standbyConn
+	canaries    map[string]*grpc.ClientConn
+	pools       map[string]*connPool
+	services    serviceIndex // copies of the above for GetConnection, see publish
+	usage       map[*grpc.ClientConn]*connUsage
+	retired     []retiredConn
+	calls       inflightCalls
+	failback    chan struct{} // starts runFailbackLoop
+	events      eventBus
+	shutdown    atomic.Bool
+	wasReady    sync.Map               // primary connections that have been Ready, see watchState
+	cfg         atomic.Pointer[Config] // replaced under mu by RegisterService and ApplyConfig
+	metrics     metrics.MetricsRecorder
+	clock       clock.Clock
+	logger      logger.Logger
+	resolver    *dnscache.Builder
+	discovery   *discovery.Builder
+	auth        *interceptors.TokenAuth
+
+	asyncMetrics    bool // async metrics recording was started by this manager, and is stopped on Close
+	registryVersion string
+	middleware      middlewareChain
+	dials           singleflight.Group // shares the dials of concurrent GetConnection calls
+	monitor         healthMonitor
+	admin           *http.Server // serves AdminHandler if Config.AdminListenAddr is set
+	adminAddr       net.Addr
+	channelz        *grpc.Server // serves channelz if Config.ChannelzListenAddr is set
+	channelzAddr    net.Addr
+
+	done      chan struct{}
+	ctx       context.Context // canceled on Close
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewConnectionManager creates a new ConnectionManager with the given configuration and metrics:
+// a *metrics.Metrics for Prometheus, or any other metrics.MetricsRecorder.
+// If cfg is nil, DefaultConfig() is used.
+// If cfg is provided, it will be validated. Returns an error if validation fails.
+func NewConnectionManager(cfg *Config, m metrics.MetricsRecorder) (*ConnectionManager, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if pm, ok := m.(*metrics.Metrics); ok && pm == nil {
+		m = nil
+	}
+	cm := &ConnectionManager{
+		connections: make(map[string]*grpc.ClientConn),
+		addresses:   make(map[string]string),
+		dialed:      make(map[string]string),
+		quotas:      make(map[string]*interceptors.Quota),
+		limiters:    make(map[string]*interceptors.RateLimiter),
+		bulkheads:   make(map[string]*interceptors.Bulkhead),
+		caches:      make(map[string]*interceptors.ResponseCache),
+		dedups:      make(map[string]*interceptors.Deduplicator),
+		budgets:     make(map[string]*interceptors.RetryBudget),
+		breakers:    interceptors.NewCircuitBreakerRegistry(),
+		outliers:    make(map[string]*outlierDetector),
+		failovers:   make(map[string]*failover),
+		failback:    make(chan struct{}, 1),
+		loads:       make(map[string]*poolLoad),
+		retriers:    make(map[string]*retrier),
+		resolved:    make(map[string][]string),
+		standbys:    make(map[string]*standbyConn),
+		canaries:    make(map[string]*grpc.ClientConn),
+		pools:       make(map[string]*connPool),
+		usage:       make(map[*grpc.ClientConn]*connUsage),
+		metrics:     m,
+		clock:       clock.OrReal(cfg.Clock),
+		logger:      logger.OrDefault(cfg.Logger),
+		done:        make(chan struct{}),
+	}
+	cm.cfg.Store(cfg)
+	cm.ctx, cm.cancel = context.WithCancel(context.Background())
+	cm.middleware.init(cm.getConnection, cm.closeConnection)
+	cm.calls.init()
+	cm.events.sink, cm.events.clock = cfg.Events, cm.clock
+
+	for name, sc := range cfg.Services {
+		if sc.Address != "" {
+			cm.addresses[name] = sc.Address
+			cm.publish(name)
+		}
+	}
+
+	if cfg.Auth != nil {
+		authConfig := *cfg.Auth
+		if authConfig.Clock == nil {
+			authConfig.Clock = cm.clock
+		}
+		if authConfig.Logger == nil {
+			authConfig.Logger = cm.logger
+		}
+		auth, err := interceptors.NewTokenAuth(&authConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth config: %w", err)
+		}
+		cm.auth = auth
+	}
+
+	if cfg.DNSCache != nil {
+		dnsConfig := *cfg.DNSCache
+		if dnsConfig.Logger == nil {
+			dnsConfig.Logger = cm.logger
+		}
+		cm.resolver = dnscache.NewBuilder(&dnsConfig)
+	}
+
+	if cfg.Discovery != nil {
+		cm.discovery = discovery.NewBuilder(cfg.Discovery)
+	}
+
+	if m != nil && cfg.MaxCallerLabels > 0 {
+		m.SetMaxCallerLabels(cfg.MaxCallerLabels)
+	}
+	if m != nil && cfg.MaxTargetLabels > 0 {
+		m.SetMaxTargetLabels(cfg.MaxTargetLabels)
+	}
+	if pm, ok := cm.prometheusMetrics(); ok {
+		if cfg.AsyncMetricsQueueSize > 0 {
+			cm.asyncMetrics = pm.StartAsync(cfg.AsyncMetricsQueueSize)
+		}
+		for name, sc := range cfg.Services {
+			if sc.LatencySLO <= 0 {
+				continue
+			}
+			if err := pm.SetServiceSLO(name, sc.LatencySLO); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.AdminListenAddr != "" {
+		if err := cm.startAdmin(cfg.AdminListenAddr); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ChannelzListenAddr != "" {
+		if err := cm.startChannelz(cfg.ChannelzListenAddr); err != nil {
+			if cm.admin != nil {
+				_ = cm.admin.Close()
+				cm.wg.Wait()
+			}
+			return nil, err
+		}
+	}
+
+	if cfg.tracksUsage() {
+		cm.wg.Add(1)
+		go cm.runJanitor(cfg.janitorInterval())
+	}
+
+	if cfg.ResolveInterval > 0 {
+		cm.wg.Add(1)
+		go cm.runResolveLoop()
+	}
+
+	if cfg.FailbackInterval > 0 {
+		cm.wg.Add(1)
+		go cm.runFailbackLoop()
+	}
+
+	if cfg.Registry != nil {
+		if err := cm.syncRegistry(); err != nil {
+			return nil, fmt.Errorf("failed to fetch service registry: %w", err)
+		}
+		if cfg.RegistryRefreshInterval > 0 {
+			cm.wg.Add(1)
+			go cm.runRegistrySync()
+		}
+	}
+
+	return cm, nil
+}
+
+// prometheusMetrics returns the manager's metrics if they are recorded to Prometheus, which alone
+// supports AsyncMetricsQueueSize and latency SLOs.
+func (cm *ConnectionManager) prometheusMetrics() (*metrics.Metrics, bool) {
+	pm, ok := cm.metrics.(*metrics.Metrics)
+	return pm, ok
+}
+
+// config returns the manager's current configuration, which must not be modified.
+func (cm *ConnectionManager) config() *Config {
+	return cm.cfg.Load()
+}
+
+// serviceLogger returns the logger for the service, filtered by its ServiceConfig.LogLevel.
+func (cm *ConnectionManager) serviceLogger(serviceName string) logger.Logger {
+	return logger.WithLevel(cm.logger, cm.config().Services[serviceName].LogLevel)
+}
+
+// GetConnection retrieves or creates a gRPC connection for the given service.
+// If address is provided, it will be used and stored for future calls.
+// If address is empty, the previously stored address for the service will be used, or else the
+// service is looked up with Config.Discovery.
+// Returns an error if the address is not available and connection cannot be established.
+// Middleware registered with Use wraps the call. With ConnectModeWaitForReady, set in Config or
+// with WithConnectMode, it also waits for the connection to become Ready.
+func (cm *ConnectionManager) GetConnection(ctx context.Context, serviceName string, address string) (*grpc.ClientConn, error) {
+	conn, err := cm.middleware.getConn()(ctx, serviceName, address)
+	if err != nil || cm.connectMode(ctx) != ConnectModeWaitForReady {
+		return conn, err
+	}
+	if err := awaitReady(ctx, conn, cm.config().MinConnectTimeout); err != nil {
+		return nil, fmt.Errorf("connection for %s is not ready: %w", serviceName, err)
+	}
+	return conn, nil
+}
+
+func (cm *ConnectionManager) getConnection(ctx context.Context, serviceName string, address string) (*grpc.ClientConn, error) {
+	if cm.shutdown.Load() {
+		return nil, fmt.Errorf("connection manager is shutting down, not connecting %s", serviceName)
+	}
+
+	entry := cm.services.load(serviceName)
+	if address == "" {
+		address = entry.address
+	}
+	if address == "" || address != entry.address {
+		cm.mu.Lock()
+		if address == "" {
+			address = cm.addresses[serviceName]
+		}
+		if address == "" && cm.discovery != nil {
+			address = discovery.Target(serviceName)
+		}
+		if address != "" {
+			cm.addresses[serviceName] = address
+			cm.publish(serviceName)
+		}
+		entry = cm.services.load(serviceName)
+		cm.mu.Unlock()
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("address not provided and service %s not registered", serviceName)
+	}
+
+	conn, sb, pool, fo := entry.conn, entry.standby, entry.pool, entry.failover
+
+	if sb != nil && cm.useStandby(serviceName, sb, conn) {
+		return sb.conn, nil
+	}
+	if entry.canary != nil && cm.useCanary(serviceName, entry.canary) {
+		return entry.canary, nil
+	}
+
+	if conn != nil && (fo == nil || !fo.tripped.Load()) {
+		state := conn.GetState()
+		if state == connectivity.Ready || state == connectivity.Idle {
+			if pool != nil {
+				if pooled := pool.pick(cm.clock.Now()); pooled != nil {
+					return pooled, nil
+				}
+			}
+			return conn, nil
+		}
+	}
+
+	cm.mu.Lock()
+	if err := cm.ensureStandby(ctx, serviceName); err != nil {
+		cm.serviceLogger(serviceName).Warnf("Failed to dial standby for %s: %v", serviceName, err)
+	}
+	sb = cm.standbys[serviceName]
+	if err := cm.ensureCanary(ctx, serviceName); err != nil {
+		cm.serviceLogger(serviceName).Warnf("Failed to dial canary for %s: %v", serviceName, err)
+	}
+
+	var after string
+	if fo := cm.failovers[serviceName]; fo != nil && fo.tripped.Swap(false) && cm.connections[serviceName] != nil {
+		after = cm.dialed[serviceName]
+		cm.serviceLogger(serviceName).Warnf("Circuit breaker for %s at %s opened, failing over to the next address", serviceName, after)
+		// The next address starts with closed breakers rather than the ones that just opened.
+		cm.breakers.Unregister(serviceName)
+		_ = cm.dropConnection(serviceName)
+	}
+
+	if conn = cm.connections[serviceName]; conn != nil {
+		state := conn.GetState()
+		if state == connectivity.Ready || state == connectivity.Idle {
+			cm.mu.Unlock()
+			return conn, nil
+		}
+
+		if sb != nil && state == connectivity.TransientFailure {
+			sb.activate(serviceName, "primary connection in TransientFailure")
+		}
+
+		_ = cm.dropConnection(serviceName)
+	}
+	cm.mu.Unlock()
+
+	// Concurrent calls share a single dial, which runs without cm.mu held so that a slow dial,
+	// e.g. waiting for FallbackAddresses, does not hold up calls to other services.
+	var (
+		newConn *grpc.ClientConn
+		err     error
+	)
+	select {
+	case res := <-cm.dials.DoChan(serviceName+"\x00"+address, func() (interface{}, error) {
+		return cm.dialPrimary(serviceName, address, after)
+	}):
+		if res.Err == nil {
+			newConn = res.Val.(*grpc.ClientConn)
+		}
+		err = res.Err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to create connection for %s: %w", serviceName, ctx.Err())
+	}
+	if err != nil {
+		if sb != nil {
+			sb.activate(serviceName, fmt.Sprintf("failed to dial primary: %v", err))
+			return sb.conn, nil
+		}
+		cm.serviceLogger(serviceName).Warnf("Failed to create connection for %s at %s: %v (will retry on next call)", serviceName, address, err)
+		return nil, fmt.Errorf("failed to create connection for %s: %w", serviceName, err)
+	}
+
+	if sb != nil {
+		if active, _ := sb.activeFor(); active {
+			return sb.conn, nil
+		}
+	}
+
+	return newConn, nil
+}
+
+// dialPrimary dials the service's primary connection, trying its FallbackAddresses after the
+// address it was connected to, if any, and installs it. It is called without cm.mu held and dials
+// with the manager's context, as the dial is shared by the concurrent GetConnection calls. A dial
+// that completes after the configuration changed is discarded and dialed again.
+func (cm *ConnectionManager) dialPrimary(serviceName, address, after string) (*grpc.ClientConn, error) {
+	for {
+		cfg := cm.config()
+		newConn, dialedAddress, err := cm.dial(cm.ctx, cm.createConnectionUnlocked, serviceName, address, after)
+		if err != nil {
+			return nil, err
+		}
+
+		cm.mu.Lock()
+		if existing := cm.connections[serviceName]; existing != nil || cm.ctx.Err() != nil || cm.config() != cfg {
+			delete(cm.usage, newConn)
+			cm.mu.Unlock()
+			_ = newConn.Close()
+			switch {
+			case existing != nil:
+				// Dialed meanwhile, e.g. to another address of the service.
+				return existing, nil
+			case cm.ctx.Err() != nil:
+				return nil, errors.New("connection manager is closed")
+			}
+			continue
+		}
+
+		cm.serviceLogger(serviceName).Infof("Created gRPC connection for service: %s", serviceName)
+		cm.installConnection(cm.ctx, serviceName, address, dialedAddress, newConn)
+		cm.mu.Unlock()
+		return newConn, nil
+	}
+}
+
+// installConnection makes conn, dialed to dialedAddress, the service's primary connection and
+// fills its pool. Must be called with cm.mu held.
+func (cm *ConnectionManager) installConnection(ctx context.Context, serviceName, address, dialedAddress string, conn *grpc.ClientConn) {
+	cm.connections[serviceName] = conn
+	cm.dialed[serviceName] = dialedAddress
+	if dialedAddress != address {
+		cm.startFailback()
+	}
+	cm.fillPool(ctx, serviceName, conn, dialedAddress)
+	cm.publish(serviceName)
+	cm.connEvent(interceptors.EventConnCreated, serviceName, dialedAddress)
+	cm.watchState(serviceName, dialedAddress, conn)
+
+	if cm.config().EnableMetrics && cm.metrics != nil {
+		cm.metrics.UpdateGRPCConnections(serviceName, len(cm.connections))
+	}
+}
+
+// ensureStandby dials the service's standby address if one is configured and not yet connected.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) ensureStandby(ctx context.Context, serviceName string) error {
+	address := cm.config().Services[serviceName].StandbyAddress
+	if address == "" || cm.standbys[serviceName] != nil {
+		return nil
+	}
+
+	conn, err := cm.createConnection(ctx, address, serviceName)
+	if err != nil {
+		return err
+	}
+	conn.Connect()
+
+	cm.standbys[serviceName] = &standbyConn{conn: conn, address: address, clock: cm.clock, logger: cm.serviceLogger(serviceName)}
+	cm.publish(serviceName)
+	cm.serviceLogger(serviceName).Infof("Created standby gRPC connection for service: %s", serviceName)
+	return nil
+}
+
+// useStandby reports whether calls for the service should go to its standby connection.
+// Traffic fails back to the primary once it is Ready and the breaker timeout has elapsed
+// since failover, so an open breaker has a chance to probe the primary again.
+func (cm *ConnectionManager) useStandby(serviceName string, sb *standbyConn, primary *grpc.ClientConn) bool {
+	active, since := sb.activeFor()
+	if !active {
+		return false
+	}
+	if since < cm.config().circuitBreaker().Timeout ||
+		primary == nil || primary.GetState() != connectivity.Ready {
+		return true
+	}
+	sb.deactivate(serviceName)
+	return false
+}
+
+// connectionOptions returns the target and dial options of a connection to address for the
+// service, and the usage tracker its interceptors report to. Must be called with cm.mu held, as it
+// creates the limiters and breakers shared by the service's connections.
+func (cm *ConnectionManager) connectionOptions(address string, serviceName string) (string, []grpc.DialOption, *connUsage, error) {
+	creds := cm.config().transportCredentials(serviceName)
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	if cm.config().XDS != nil && isXDSTarget(address) {
+		xdsCreds, err := cm.config().XDS.TransportCredentials(creds)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to create xDS credentials: %w", err)
+		}
+		creds = xdsCreds
+	}
+
+	maxMsgSize := cm.config().maxMsgSize(serviceName)
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxMsgSize),
+			grpc.MaxCallSendMsgSize(maxMsgSize),
+			grpc.WaitForReady(cm.config().waitForReady(serviceName)),
+		),
+
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cm.config().KeepAliveTime,
+			Timeout:             cm.config().KeepAliveTimeout,
+			PermitWithoutStream: cm.config().KeepAlivePermitWithoutStream,
+		}),
+
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           cm.config().reconnectBackoff(serviceName),
+			MinConnectTimeout: cm.config().MinConnectTimeout,
+		}),
+
+		grpc.WithIdleTimeout(cm.config().IdleTimeout),
+	}
+
+	if perRPC := cm.config().perRPCCredentials(serviceName); perRPC != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(perRPC))
+	}
+	if authority := cm.config().Services[serviceName].Authority; authority != "" {
+		opts = append(opts, grpc.WithAuthority(authority))
+	}
+
+	dialer, err := cm.config().dialer(serviceName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+
+	if h := cm.config().StatsHandler; h != nil {
+		opts = append(opts, grpc.WithStatsHandler(h))
+	}
+
+	if policy := cm.config().loadBalancingPolicy(serviceName); policy != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(loadBalancingServiceConfig(policy)))
+	}
+
+	target := address
+	if cm.resolver != nil {
+		opts = append(opts, grpc.WithResolvers(cm.resolver))
+	}
+	if cm.resolvesAtProxy(serviceName, address) {
+		target = "passthrough:///" + address
+	} else if cm.resolver != nil {
+		target = dnscache.Target(address)
+	}
+	if cm.discovery != nil {
+		opts = append(opts, grpc.WithResolvers(cm.discovery))
+	}
+
+	breakers := cm.circuitBreakers(serviceName, address)
+	unaryInterceptors, err := cm.unaryInterceptors(serviceName, maxMsgSize, breakers)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Usage is tracked outermost so that calls waiting in the chain count as in flight.
+	usage := newConnUsage(cm.clock.Now(), &cm.calls)
+	usage.rebalanceAt = cm.config().rebalanceAt(usage.created)
+	unaryInterceptors = append([]grpc.UnaryClientInterceptor{usage.unaryInterceptor(cm.clock)}, unaryInterceptors...)
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+	)
+
+	streamInterceptors := cm.streamInterceptors(serviceName, breakers)
+	streamInterceptors = append([]grpc.StreamClientInterceptor{usage.streamInterceptor(cm.clock)}, streamInterceptors...)
+	opts = append(opts,
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
+	)
+
+	opts = append(opts, cm.config().ExtraDialOptions...)
+
+	return target, opts, usage, nil
+}
+
+// createConnection dials address for the service. Must be called with cm.mu held.
+func (cm *ConnectionManager) createConnection(ctx context.Context, address string, serviceName string) (*grpc.ClientConn, error) {
+	target, opts, usage, err := cm.connectionOptions(address, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := cm.newClientConn(target, opts...)
+	if err == nil && cm.config().tracksUsage() {
+		cm.usage[conn] = usage
+	}
+	return conn, err
+}
+
+// createConnectionUnlocked is createConnection for callers that do not hold cm.mu. The lock is
+// only held while the dial options are built, not while dialing.
+func (cm *ConnectionManager) createConnectionUnlocked(ctx context.Context, address string, serviceName string) (*grpc.ClientConn, error) {
+	cm.mu.Lock()
+	target, opts, usage, err := cm.connectionOptions(address, serviceName)
+	cm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := cm.newClientConn(target, opts...)
+	if err == nil && cm.config().tracksUsage() {
+		cm.mu.Lock()
+		cm.usage[conn] = usage
+		cm.mu.Unlock()
+	}
+	return conn, err
+}
+
+// CloseConnection closes and removes the connection for the given service.
+// Middleware registered with UseClose wraps the call.
+func (cm *ConnectionManager) CloseConnection(serviceName string) error {
+	return cm.middleware.closeConn()(serviceName)
+}
+
+func (cm *ConnectionManager) closeConnection(serviceName string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if sb := cm.standbys[serviceName]; sb != nil {
+		_ = sb.conn.Close()
+		delete(cm.standbys, serviceName)
+		cm.publish(serviceName)
+	}
+	cm.dropCanary(serviceName)
+
+	if cm.config().EnableMetrics && cm.metrics != nil {
+		cm.metrics.DeleteService(serviceName)
+	}
+
+	err := cm.dropConnection(serviceName)
+	delete(cm.dialed, serviceName)
+	return err
+}
+
+// ResetConnection closes the current connection for the service and immediately dials a new one
+// to the stored address, re-resolving its target. Use it after backend IP changes or load balancer drains.
+func (cm *ConnectionManager) ResetConnection(ctx context.Context, serviceName string) (*grpc.ClientConn, error) {
+	cm.mu.Lock()
+	address := cm.addresses[serviceName]
+	if address == "" {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("service %s not registered", serviceName)
+	}
+	_ = cm.dropConnection(serviceName)
+	cm.mu.Unlock()
+
+	// As in GetConnection, the dial is shared with concurrent calls and runs without cm.mu held,
+	// so that waiting for FallbackAddresses does not hold up the rest of the manager.
+	var newConn *grpc.ClientConn
+	select {
+	case res := <-cm.dials.DoChan(serviceName+"\x00"+address, func() (interface{}, error) {
+		return cm.dialPrimary(serviceName, address, "")
+	}):
+		if res.Err != nil {
+			return nil, fmt.Errorf("failed to create connection for %s: %w", serviceName, res.Err)
+		}
+		newConn = res.Val.(*grpc.ClientConn)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to create connection for %s: %w", serviceName, ctx.Err())
+	}
+	newConn.Connect()
+
+	cm.serviceLogger(serviceName).Infof("Reset gRPC connection for service: %s", serviceName)
+	return newConn, nil
+}
+
+// Close closes all managed connections and cleans up resources.
+func (cm *ConnectionManager) Close() error {
+	cm.closeOnce.Do(func() {
+		close(cm.done)
+		cm.cancel()
+		if cm.admin != nil {
+			_ = cm.admin.Close()
+		}
+		if cm.channelz != nil {
+			cm.channelz.Stop()
+		}
+		if cm.auth != nil {
+			cm.auth.Close()
+		}
+	})
+	cm.wg.Wait()
+
+	cm.mu.Lock()
+
+	services := make(map[string]struct{}, len(cm.addresses))
+	for name := range cm.addresses {
+		services[name] = struct{}{}
+	}
+
+	var lastErr error
+	for name, conn := range cm.connections {
+		services[name] = struct{}{}
+		if conn != nil {
+			cm.connClosed(name)
+			if err := conn.Close(); err != nil {
+				cm.serviceLogger(name).Errorf("Failed to close %s: %v", name, err)
+				lastErr = err
+			}
+		}
+	}
+	for _, pool := range cm.pools {
+		pool.closeExtras()
+	}
+	for _, r := range cm.retired {
+		_ = r.conn.Close()
+	}
+	cm.retired = nil
+	for name, sb := range cm.standbys {
+		if err := sb.conn.Close(); err != nil {
+			cm.serviceLogger(name).Errorf("Failed to close standby for %s: %v", name, err)
+			lastErr = err
+		}
+	}
+	for name, canary := range cm.canaries {
+		if err := canary.Close(); err != nil {
+			cm.serviceLogger(name).Errorf("Failed to close canary for %s: %v", name, err)
+			lastErr = err
+		}
+	}
+	for name := range cm.quotas {
+		cm.flushQuota(name)
+	}
+	cm.connections = make(map[string]*grpc.ClientConn)
+	cm.addresses = make(map[string]string)
+	cm.dialed = make(map[string]string)
+	cm.standbys = make(map[string]*standbyConn)
+	cm.canaries = make(map[string]*grpc.ClientConn)
+	cm.pools = make(map[string]*connPool)
+	cm.services.clear()
+
+	// Metrics shared with other managers stay asynchronous until the manager that started async
+	// recording closes.
+	if pm, ok := cm.prometheusMetrics(); ok && cm.asyncMetrics {
+		pm.StopAsync()
+	}
+	// The final metrics are captured before the series of the closed services are deleted, and
+	// pushed after releasing the lock so that a slow Pushgateway does not block other calls.
+	var push *metrics.PushConfig
+	if cm.config().EnableMetrics && cm.metrics != nil {
+		if p := cm.config().Pushgateway; p != nil {
+			if pm, ok := cm.prometheusMetrics(); ok && p.Gatherer == nil {
+				withGatherer := *p
+				withGatherer.Gatherer = pm.Gatherer()
+				p = &withGatherer
+			}
+			push = p.Snapshot()
+		}
+		for name := range services {
+			cm.metrics.DeleteService(name)
+		}
+	}
+	cm.mu.Unlock()
+
+	if push != nil {
+		if err := metrics.Push(context.Background(), push); err != nil {
+			cm.logger.Warnf("Failed to push metrics to %s: %v", push.URL, err)
+		}
+	}
+	return lastErr
+}
+
+// GetConnectionsCount returns the number of currently managed connections.
+func (cm *ConnectionManager) GetConnectionsCount() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.connections)
+}
+
+// CircuitBreakers returns the registry of the manager's circuit breakers, for inspecting their
+// state, tripping or resetting them by hand and observing state changes across services.
+// Standby connections are not included.
+func (cm *ConnectionManager) CircuitBreakers() *interceptors.CircuitBreakerRegistry {
+	return cm.breakers
+}
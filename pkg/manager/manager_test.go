@@ -0,0 +1,3352 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/begenov/grpc-connection-manager/internal/testutil"
+	tokencreds "github.com/begenov/grpc-connection-manager/pkg/credentials"
+	"github.com/begenov/grpc-connection-manager/pkg/discovery"
+	"github.com/begenov/grpc-connection-manager/pkg/dnscache"
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var (
+	sharedMetrics     *metrics.Metrics
+	sharedMetricsOnce sync.Once
+)
+
+// testMetrics returns a process-wide Metrics, since metrics register with the default registry.
+func testMetrics() *metrics.Metrics {
+	sharedMetricsOnce.Do(func() { sharedMetrics = metrics.NewMetrics() })
+	return sharedMetrics
+}
+
+func TestDefaultConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg == nil {
+		t.Fatal("DefaultConfig returned nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("DefaultConfig validation failed: %v", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{
+			name: "valid config",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid MaxMsgSize",
+			config: &Config{
+				MaxMsgSize:        0,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid KeepAliveTime",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     0,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid ReconnectJitter",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+				ReconnectJitter:   1.5,
+			},
+			wantErr: true,
+		},
+		{
+			name: "non-positive Cache TTL",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+				Cache:             &interceptors.CacheConfig{Methods: map[string]time.Duration{"/users.Users/Get": 0}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown InterceptorOrder stage",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+				InterceptorOrder:  []InterceptorStage{InterceptorRetry, "tracing"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate InterceptorOrder stage",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+				InterceptorOrder:  []InterceptorStage{InterceptorRetry, InterceptorExtra, InterceptorRetry},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid service ReconnectMultiplier",
+			config: &Config{
+				MaxMsgSize:        1024,
+				KeepAliveTime:     time.Second,
+				KeepAliveTimeout:  time.Second,
+				MaxReconnectDelay: time.Second,
+				MinConnectTimeout: time.Second,
+				Services:          map[string]ServiceConfig{"users": {ReconnectMultiplier: 0.5}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ReconnectBackoff(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Services = map[string]ServiceConfig{
+		"legacy": {ReconnectBaseDelay: time.Second, MaxReconnectDelay: 30 * time.Second},
+	}
+
+	if got := cfg.reconnectBackoff("users"); got.BaseDelay != 100*time.Millisecond || got.Multiplier != 1.6 ||
+		got.Jitter != 0.2 || got.MaxDelay != 3*time.Second {
+		t.Errorf("reconnectBackoff(users) = %+v, want the Config defaults", got)
+	}
+	if got := cfg.reconnectBackoff("legacy"); got.BaseDelay != time.Second || got.Multiplier != 1.6 ||
+		got.Jitter != 0.2 || got.MaxDelay != 30*time.Second {
+		t.Errorf("reconnectBackoff(legacy) = %+v, want the service overrides", got)
+	}
+
+	// Configs built without DefaultConfig keep the previous fixed backoff
+	bare := Config{MaxReconnectDelay: time.Second}
+	if got := bare.reconnectBackoff("users"); got.BaseDelay != 100*time.Millisecond || got.Multiplier != 1.6 {
+		t.Errorf("reconnectBackoff = %+v, want 100ms and 1.6 for zero values", got)
+	}
+}
+
+func TestNewConnectionManager(t *testing.T) {
+	// Test with nil config and nil metrics
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager with nil config failed: %v", err)
+	}
+	if cm == nil {
+		t.Fatal("NewConnectionManager returned nil")
+	}
+	cm.Close()
+
+	// Test with valid config
+	cfg := DefaultConfig()
+	cm, err = NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	if cm == nil {
+		t.Fatal("NewConnectionManager returned nil")
+	}
+	cm.Close()
+
+	// Test with invalid config
+	invalidCfg := &Config{
+		MaxMsgSize: 0, // Invalid
+	}
+	cm, err = NewConnectionManager(invalidCfg, nil)
+	if err == nil {
+		t.Fatal("NewConnectionManager should fail with invalid config")
+	}
+}
+
+func TestNew(t *testing.T) {
+	base := DefaultConfig()
+	base.EnableLogging = false
+
+	retry := interceptors.DefaultRetryConfig()
+	retry.MaxAttempts = 5
+
+	cm, err := New(
+		WithConfig(base),
+		WithMetrics(testMetrics()),
+		WithRetry(retry),
+		WithoutCircuitBreaker(),
+		WithLogger(logger.Nop),
+		WithService("svc", ServiceConfig{MaxMsgSize: 1024}),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer cm.Close()
+
+	if cm.config().EnableLogging {
+		t.Error("expected WithConfig to keep EnableLogging = false")
+	}
+	if !cm.config().EnableMetrics || cm.metrics == nil {
+		t.Error("expected WithMetrics to enable metrics")
+	}
+	if got := cm.retryConfig("svc").MaxAttempts; got != 5 {
+		t.Errorf("expected 5 retry attempts, got %d", got)
+	}
+	if cm.config().EnableCircuitBreaker {
+		t.Error("expected circuit breaker to be disabled")
+	}
+	if got := cm.config().maxMsgSize("svc"); got != 1024 {
+		t.Errorf("expected MaxMsgSize 1024 for svc, got %d", got)
+	}
+	if base.Services != nil {
+		t.Error("WithService modified the config passed to WithConfig")
+	}
+
+	if _, err := New(WithRetry(&interceptors.RetryConfig{})); err == nil {
+		t.Error("expected error for retry config without attempts")
+	}
+}
+
+func TestConnectionManager_GetConnectionsCount(t *testing.T) {
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	count := cm.GetConnectionsCount()
+	if count != 0 {
+		t.Errorf("Expected 0 connections, got %d", count)
+	}
+}
+
+func TestConnectionManager_HealthCheck(t *testing.T) {
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	health := cm.HealthCheck(ctx)
+	if health == nil {
+		t.Fatal("HealthCheck returned nil")
+	}
+	if len(health) != 0 {
+		t.Errorf("Expected empty health map, got %d entries", len(health))
+	}
+}
+
+func TestConnectionManager_HealthCheckIdle(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.IdleTimeout = 100 * time.Millisecond
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cfg.Services = map[string]ServiceConfig{
+		"refused": {ContextDialer: func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("refused")
+		}},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	ready, err := cm.GetConnection(WithConnectMode(ctx, ConnectModeWaitForReady), "ready", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	refused, err := cm.GetConnection(ctx, "refused", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	waitForState(t, ready, connectivity.Idle)
+	waitForState(t, refused, connectivity.Idle)
+
+	health := cm.HealthCheck(ctx)
+	if !health["ready"].Healthy {
+		t.Errorf("Expected a connection that went Idle after being Ready to be healthy, got %+v", health["ready"])
+	}
+	if health["refused"].Healthy {
+		t.Errorf("Expected an Idle connection that never connected to be unhealthy, got %+v", health["refused"])
+	}
+}
+
+func TestConnectionManager_Registry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"orders": "localhost:50051", "payments": "localhost:50052"}`))
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Registry = &HTTPRegistrySource{URL: server.URL}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	health := cm.HealthCheck(context.Background())
+	if len(health) != 2 {
+		t.Errorf("Expected 2 registered services, got %d", len(health))
+	}
+
+	if err := cm.syncRegistry(); err != nil {
+		t.Fatalf("syncRegistry failed: %v", err)
+	}
+	if requests != 2 || cm.registryVersion != `"v1"` {
+		t.Errorf("Expected conditional refetch with version \"v1\", got requests=%d, version=%s", requests, cm.registryVersion)
+	}
+}
+
+func TestConnectionManager_GetConnectionState(t *testing.T) {
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if _, ok := cm.GetConnectionState("missing"); ok {
+		t.Error("Expected no state for unknown service")
+	}
+
+	if _, err := cm.GetConnection(context.Background(), "test-service", "localhost:0"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if _, ok := cm.GetConnectionState("test-service"); !ok {
+		t.Error("Expected state for connected service")
+	}
+}
+
+func TestConnectionManager_ResetConnection(t *testing.T) {
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	if _, err := cm.ResetConnection(ctx, "missing"); err == nil {
+		t.Error("Expected error resetting unknown service")
+	}
+
+	oldConn, err := cm.GetConnection(ctx, "test-service", "localhost:0")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	newConn, err := cm.ResetConnection(ctx, "test-service")
+	if err != nil {
+		t.Fatalf("ResetConnection failed: %v", err)
+	}
+	if newConn == oldConn {
+		t.Error("Expected ResetConnection to return a new connection")
+	}
+	if cm.GetConnectionsCount() != 1 {
+		t.Errorf("Expected 1 connection, got %d", cm.GetConnectionsCount())
+	}
+}
+
+func TestConnectionManager_FallbackAddresses(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.MinConnectTimeout = 2 * time.Second
+	cfg.Services = map[string]ServiceConfig{
+		"test-service": {FallbackAddresses: []string{lis.Addr().String()}},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	// Nothing listens on port 1, so the primary fails fast and the fallback is used
+	if _, err := cm.GetConnection(context.Background(), "test-service", "127.0.0.1:1"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+
+	health := cm.HealthCheck(context.Background())
+	if got := health["test-service"].Address; got != lis.Addr().String() {
+		t.Errorf("Expected connection via fallback %s, got %q", lis.Addr(), got)
+	}
+}
+
+func TestConnectionManager_ConcurrentDials(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	release := make(chan struct{})
+	var dialed atomic.Int32
+	cfg := DefaultConfig()
+	cfg.MinConnectTimeout = 5 * time.Second
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	// With FallbackAddresses, the dial waits until the connection is Ready
+	cfg.Services = map[string]ServiceConfig{
+		"slow": {
+			FallbackAddresses: []string{"passthrough:///fallback"},
+			ContextDialer: func(ctx context.Context, _ string) (net.Conn, error) {
+				dialed.Add(1)
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				return lis.DialContext(ctx)
+			},
+		},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	const callers = 5
+	conns := make(chan *grpc.ClientConn, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			conn, err := cm.GetConnection(context.Background(), "slow", "passthrough:///bufnet")
+			if err != nil {
+				t.Errorf("GetConnection failed: %v", err)
+			}
+			conns <- conn
+		}()
+	}
+	waitFor(t, func() bool { return dialed.Load() > 0 })
+
+	// The slow dial does not hold up other services
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := cm.GetConnection(ctx, "fast", "passthrough:///bufnet"); err != nil {
+		t.Fatalf("GetConnection for another service blocked by a slow dial: %v", err)
+	}
+
+	close(release)
+	first := <-conns
+	for i := 1; i < callers; i++ {
+		if conn := <-conns; conn != first {
+			t.Error("expected concurrent calls to share one connection")
+		}
+	}
+	if got := dialed.Load(); got != 1 {
+		t.Errorf("expected 1 dial, got %d", got)
+	}
+	if got := cm.GetConnectionsCount(); got != 2 {
+		t.Errorf("expected 2 connections, got %d", got)
+	}
+}
+
+func TestConnectionManager_ResetConnectionDialsOutsideLock(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	var primaryDown atomic.Bool
+	release := make(chan struct{})
+	var fallbackDials atomic.Int32
+	cfg := DefaultConfig()
+	cfg.MinConnectTimeout = 5 * time.Second
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cfg.Services = map[string]ServiceConfig{
+		"slow": {
+			FallbackAddresses: []string{"passthrough:///fallback"},
+			ContextDialer: func(ctx context.Context, addr string) (net.Conn, error) {
+				if addr == "fallback" {
+					fallbackDials.Add(1)
+					select {
+					case <-release:
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				} else if primaryDown.Load() {
+					return nil, errors.New("connection refused")
+				}
+				return lis.DialContext(ctx)
+			},
+		},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if _, err := cm.GetConnection(context.Background(), "slow", "passthrough:///primary"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+
+	// The reset finds the primary down and waits on the fallback, as failback probes do.
+	primaryDown.Store(true)
+	reset := make(chan error, 1)
+	go func() {
+		_, err := cm.ResetConnection(context.Background(), "slow")
+		reset <- err
+	}()
+	waitFor(t, func() bool { return fallbackDials.Load() > 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := cm.GetConnection(ctx, "fast", "passthrough:///bufnet"); err != nil {
+		t.Fatalf("GetConnection for another service blocked by a reset: %v", err)
+	}
+
+	close(release)
+	if err := <-reset; err != nil {
+		t.Errorf("Expected the reset to connect to the fallback, got %v", err)
+	}
+	if got := cm.GetConnectionsCount(); got != 2 {
+		t.Errorf("expected 2 connections, got %d", got)
+	}
+}
+
+// BenchmarkGetConnection measures GetConnection for a service that is already connected, the
+// common case of getting a connection per request.
+func BenchmarkGetConnection(b *testing.B) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.Logger = logger.Nop
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		b.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	if _, err := cm.GetConnection(ctx, "hot", "passthrough:///bufnet"); err != nil {
+		b.Fatalf("GetConnection failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cm.GetConnection(ctx, "hot", ""); err != nil {
+				b.Errorf("GetConnection failed: %v", err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkGetConnection_Contention measures GetConnection for a connected service while another
+// service is closed and dialed again in a loop.
+func BenchmarkGetConnection_Contention(b *testing.B) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.Logger = logger.Nop
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		b.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	if _, err := cm.GetConnection(ctx, "hot", "passthrough:///bufnet"); err != nil {
+		b.Fatalf("GetConnection failed: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = cm.GetConnection(ctx, "cold", "passthrough:///bufnet")
+			_ = cm.CloseConnection("cold")
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cm.GetConnection(ctx, "hot", ""); err != nil {
+				b.Errorf("GetConnection failed: %v", err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+}
+
+func TestConnectionManager_PushOnClose(t *testing.T) {
+	type push struct{ request, body string }
+	pushed := make(chan push, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushed <- push{r.Method + " " + r.URL.Path, string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	// Without a Gatherer, the registry of the manager's metrics is pushed rather than the default one.
+	private := metrics.NewMetricsWithRegistry(prometheus.NewRegistry(), "batch", nil)
+	private.IncrementGRPCRetry("orders", "/orders.Orders/Get")
+
+	tests := []struct {
+		name         string
+		metrics      *metrics.Metrics
+		want, absent string
+	}{
+		{"default registry", testMetrics(), "go_goroutines", "batch_grpc_client_retries_total"},
+		{"private registry", private, "batch_grpc_client_retries_total", "go_goroutines"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.EnableMetrics = true
+			cfg.Pushgateway = &metrics.PushConfig{
+				URL:      gateway.URL,
+				Job:      "batch",
+				Grouping: map[string]string{"instance": "test"},
+			}
+
+			cm, err := NewConnectionManager(cfg, tt.metrics)
+			if err != nil {
+				t.Fatalf("NewConnectionManager failed: %v", err)
+			}
+			if err := cm.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			select {
+			case got := <-pushed:
+				if want := "PUT /metrics/job/batch/instance/test"; got.request != want {
+					t.Errorf("push request = %q, want %q", got.request, want)
+				}
+				if !strings.Contains(got.body, tt.want) || strings.Contains(got.body, tt.absent) {
+					t.Errorf("Expected the pushed metrics to include %s and not %s", tt.want, tt.absent)
+				}
+			default:
+				t.Fatal("expected metrics to be pushed on Close")
+			}
+		})
+	}
+}
+
+func TestConnectionManager_PushAfterUnlock(t *testing.T) {
+	var cm *ConnectionManager
+	blocked := make(chan bool, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The manager must stay usable while metrics are pushed.
+		done := make(chan struct{})
+		go func() {
+			cm.GetConnectionsCount()
+			close(done)
+		}()
+		select {
+		case <-done:
+			blocked <- false
+		case <-time.After(time.Second):
+			blocked <- true
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = true
+	cfg.Pushgateway = &metrics.PushConfig{URL: gateway.URL, Job: "batch"}
+
+	cm, err := NewConnectionManager(cfg, testMetrics())
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	if err := cm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if <-blocked {
+		t.Error("Expected the push not to hold the manager's lock")
+	}
+}
+
+func TestConnectionManager_SharedAsyncMetrics(t *testing.T) {
+	m := metrics.NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil)
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = true
+	cfg.AsyncMetricsQueueSize = 16
+
+	first, err := NewConnectionManager(cfg, m)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	second, err := NewConnectionManager(cfg, m)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+
+	// StartAsync has no effect while the metrics are asynchronous, and switches them otherwise.
+	if err := second.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if m.StartAsync(1) {
+		t.Fatal("Expected closing a manager sharing the metrics to keep them asynchronous")
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !m.StartAsync(1) {
+		t.Fatal("Expected closing the manager that started async recording to stop it")
+	}
+	m.StopAsync()
+}
+
+func TestConnectionManager_MetricsRegistry(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = true
+	cfg.Services = map[string]ServiceConfig{"orders": {LatencySLO: 100 * time.Millisecond}}
+
+	// Two managers with their own registries must not collide, as they would on the global one.
+	registries := []*prometheus.Registry{prometheus.NewRegistry(), prometheus.NewRegistry()}
+	for i, reg := range registries {
+		m := metrics.NewMetricsWithRegistry(reg, "shop", prometheus.Labels{"manager": fmt.Sprint(i)})
+		cm, err := NewConnectionManager(cfg, m)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		defer cm.Close()
+		if _, err := cm.GetConnection(context.Background(), "orders", "127.0.0.1:1"); err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+	}
+
+	for i, reg := range registries {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather failed: %v", err)
+		}
+		var found bool
+		for _, f := range families {
+			if !strings.HasPrefix(f.GetName(), "shop_") {
+				t.Errorf("metric %s is not in the shop namespace", f.GetName())
+			}
+			if f.GetName() != "shop_grpc_client_connections_active" {
+				continue
+			}
+			found = true
+			for _, l := range f.GetMetric()[0].GetLabel() {
+				if l.GetName() == "manager" && l.GetValue() != fmt.Sprint(i) {
+					t.Errorf("manager label = %q, want %d", l.GetValue(), i)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("registry %d has no shop_grpc_client_connections_active", i)
+		}
+	}
+}
+
+func TestConnectionManager_MetricsRecorder(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	check := func(t *testing.T, m metrics.MetricsRecorder) {
+		t.Helper()
+		cfg := DefaultConfig()
+		cfg.EnableMetrics = true
+		cm, err := NewConnectionManager(cfg, m)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		defer cm.Close()
+		conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+
+	t.Run("OTel", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		r, err := metrics.NewOTelRecorder(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+		if err != nil {
+			t.Fatalf("NewOTelRecorder failed: %v", err)
+		}
+		check(t, r)
+
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatalf("Collect failed: %v", err)
+		}
+		var count uint64
+		for _, sm := range rm.ScopeMetrics {
+			for _, md := range sm.Metrics {
+				if h, ok := md.Data.(metricdata.Histogram[float64]); ok && md.Name == "rpc.client.duration" {
+					for _, dp := range h.DataPoints {
+						count += dp.Count
+					}
+				}
+			}
+		}
+		if count != 1 {
+			t.Errorf("rpc.client.duration count = %d, want 1", count)
+		}
+	})
+
+	t.Run("Statsd", func(t *testing.T) {
+		agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("ListenPacket failed: %v", err)
+		}
+		defer agent.Close()
+		r, err := metrics.NewStatsdRecorder(&metrics.StatsdConfig{
+			Address: agent.LocalAddr().String(),
+			Prefix:  "shop.",
+			Tags:    map[string]string{"env": "test"},
+		})
+		if err != nil {
+			t.Fatalf("NewStatsdRecorder failed: %v", err)
+		}
+		defer r.Close()
+		check(t, r)
+
+		want := "shop.grpc.client.requests:1|c|#env:test,service:health,method:/grpc.health.v1.Health/Check,code:OK,caller:unknown"
+		buf := make([]byte, 1024)
+		_ = agent.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			n, _, err := agent.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("did not receive %q: %v", want, err)
+			}
+			if string(buf[:n]) == want {
+				break
+			}
+		}
+	})
+}
+
+func TestConnectionManager_AdminServer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = true
+	cfg.AdminListenAddr = "127.0.0.1:0"
+	cfg.Services = map[string]ServiceConfig{"health": {Address: lis.Addr().String()}}
+	cm, err := NewConnectionManager(cfg, metrics.NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil))
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+	base := "http://" + cm.AdminAddr().String()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// The service is not connected yet, so it is unhealthy.
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz before connecting = %d, want 503", code)
+	}
+
+	conn, err := cm.GetConnection(context.Background(), "health", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	waitForState(t, conn, connectivity.Ready)
+
+	if code, body := get("/healthz"); code != http.StatusOK || !strings.Contains(body, `"healthy":true`) {
+		t.Errorf("/healthz = %d %s, want 200 and healthy", code, body)
+	}
+	if _, body := get("/connections"); !strings.Contains(body, `"health":{"address":"`+lis.Addr().String()+`"`) ||
+		!strings.Contains(body, `"state":"READY"`) {
+		t.Errorf("/connections = %s, want the health service's address and state", body)
+	}
+	if _, body := get("/metrics"); !strings.Contains(body, `grpc_client_connections_active{service="health"} 1`) {
+		t.Errorf("/metrics does not have the connection count:\n%s", body)
+	}
+
+	if err := cm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("expected the admin server to stop on Close")
+	}
+}
+
+func TestConnectionManager_DebugState(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.Retry = interceptors.DefaultRetryConfig()
+	cfg.Retry.MaxAttempts = 3
+	cfg.Retry.InitialBackoff = time.Millisecond
+	cfg.ChannelzListenAddr = "127.0.0.1:0"
+	cfg.Services = map[string]ServiceConfig{"orders": {Address: lis.Addr().String()}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if got := cm.DebugState()["orders"]; got.State != "NotConnected" || got.Address != lis.Addr().String() {
+		t.Errorf("DebugState before connecting = %+v, want NotConnected at the registered address", got)
+	}
+
+	conn, err := cm.GetConnection(context.Background(), "orders", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Check error = %v, want Unavailable", err)
+	}
+
+	got := cm.DebugState()["orders"]
+	if got.State != "READY" || got.Dialed != lis.Addr().String() {
+		t.Errorf("State = %s dialed %s, want READY dialed %s", got.State, got.Dialed, lis.Addr())
+	}
+	if got.Retries != 2 || got.RetriesExhausted != 1 || got.FailedCalls != 1 {
+		t.Errorf("Retries, RetriesExhausted, FailedCalls = %d, %d, %d, want 2, 1, 1", got.Retries, got.RetriesExhausted, got.FailedCalls)
+	}
+	if !strings.Contains(got.LastError, "overloaded") || got.LastErrorAt.IsZero() {
+		t.Errorf("LastError = %q at %v, want the overloaded error", got.LastError, got.LastErrorAt)
+	}
+	if len(got.CircuitBreakers) == 0 {
+		t.Error("expected the circuit breaker states")
+	}
+	for key, state := range got.CircuitBreakers {
+		if state != interceptors.StateClosed.String() {
+			t.Errorf("breaker %s is %s, want closed", key, state)
+		}
+	}
+
+	channelzConn, err := grpc.NewClient(cm.ChannelzAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer channelzConn.Close()
+	channels, err := channelzpb.NewChannelzClient(channelzConn).GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{})
+	if err != nil {
+		t.Fatalf("GetTopChannels failed: %v", err)
+	}
+	var found bool
+	for _, ch := range channels.GetChannel() {
+		found = found || strings.Contains(ch.GetData().GetTarget(), lis.Addr().String())
+	}
+	if !found {
+		t.Errorf("channelz does not list the channel to %s", lis.Addr())
+	}
+}
+
+// countingStatsHandler counts the RPCs and payloads it sees.
+type countingStatsHandler struct {
+	rpcs, sent, received atomic.Int32
+}
+
+func (h *countingStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *countingStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s.(type) {
+	case *stats.Begin:
+		h.rpcs.Add(1)
+	case *stats.OutPayload:
+		h.sent.Add(1)
+	case *stats.InPayload:
+		h.received.Add(1)
+	}
+}
+
+func (h *countingStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *countingStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestConnectionManager_StatsHandler(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	h := &countingStatsHandler{}
+	cfg := DefaultConfig()
+	cfg.StatsHandler = h
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+	if rpcs, sent, received := h.rpcs.Load(), h.sent.Load(), h.received.Load(); rpcs != 2 || sent != 2 || received != 2 {
+		t.Errorf("stats handler saw %d RPCs, %d sent and %d received payloads, want 2 of each", rpcs, sent, received)
+	}
+}
+
+func TestConnectionManager_Use(t *testing.T) {
+	cm, err := NewConnectionManager(nil, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	var order []string
+	cm.Use(
+		func(next GetConnFunc) GetConnFunc {
+			return func(ctx context.Context, serviceName, address string) (*grpc.ClientConn, error) {
+				order = append(order, "first")
+				return next(ctx, serviceName, address)
+			}
+		},
+		func(next GetConnFunc) GetConnFunc {
+			return func(ctx context.Context, serviceName, address string) (*grpc.ClientConn, error) {
+				order = append(order, "rewrite")
+				return next(ctx, serviceName, "tenant-a."+address)
+			}
+		},
+	)
+
+	var closed []string
+	cm.UseClose(func(next CloseConnFunc) CloseConnFunc {
+		return func(serviceName string) error {
+			closed = append(closed, serviceName)
+			return next(serviceName)
+		}
+	})
+
+	if _, err := cm.GetConnection(context.Background(), "users", "localhost:50051"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "rewrite" {
+		t.Errorf("unexpected middleware order: %v", order)
+	}
+	if got := cm.addresses["users"]; got != "tenant-a.localhost:50051" {
+		t.Errorf("address = %q, want rewritten address", got)
+	}
+
+	if err := cm.CloseConnection("users"); err != nil {
+		t.Fatalf("CloseConnection failed: %v", err)
+	}
+	if len(closed) != 1 || closed[0] != "users" {
+		t.Errorf("close middleware saw %v", closed)
+	}
+}
+
+func TestConnectionManager_DialModeNewClient(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "users", "localhost:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if state := conn.GetState(); state != connectivity.Idle {
+		t.Errorf("state = %s, want Idle until the first call", state)
+	}
+}
+
+func TestConnectionManager_DialModeDialContext(t *testing.T) {
+	cm, err := NewConnectionManager(DefaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "users", "localhost:1")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if got, want := conn.Target(), "passthrough:///localhost:1"; got != want {
+		t.Errorf("target = %q, want %q", got, want)
+	}
+	waitFor(t, func() bool { return conn.GetState() != connectivity.Idle })
+
+	unix, err := cm.GetConnection(context.Background(), "sidecar", "unix:///tmp/sidecar.sock")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if got, want := unix.Target(), "unix:///tmp/sidecar.sock"; got != want {
+		t.Errorf("target = %q, want %q", got, want)
+	}
+}
+
+func TestConnectionManager_PoolSize(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PoolSize = 3
+	cfg.DialMode = DialModeNewClient // connections stay Idle without a server
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	seen := make(map[*grpc.ClientConn]bool)
+	for i := 0; i < 6; i++ {
+		conn, err := cm.GetConnection(context.Background(), "users", "localhost:50051")
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		seen[conn] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected 3 distinct pooled connections, got %d", len(seen))
+	}
+
+	if err := cm.CloseConnection("users"); err != nil {
+		t.Fatalf("CloseConnection failed: %v", err)
+	}
+	if len(cm.pools) != 0 {
+		t.Error("expected pool to be removed on CloseConnection")
+	}
+}
+
+func TestConnectionManager_PoolStrategy(t *testing.T) {
+	tests := []struct {
+		strategy PoolStrategy
+		minIdle  int // of 300 picks, how many must go to the unloaded connection at least
+	}{
+		{PoolStrategyLeastRequest, 300},
+		{PoolStrategyLatency, 200},
+		{PoolStrategyPowerOfTwoChoices, 150},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.PoolSize = 3
+		cfg.PoolStrategy = tt.strategy
+		cfg.DialMode = DialModeNewClient // connections stay Idle without a server
+
+		cm, err := NewConnectionManager(cfg, nil)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		defer cm.Close()
+
+		if _, err := cm.GetConnection(context.Background(), "users", "localhost:50051"); err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		pool := cm.pools["users"]
+		for _, conn := range pool.conns[1:] {
+			load := pool.loads.conn(conn)
+			load.inflight.Store(4)
+			load.observe(100 * time.Millisecond)
+		}
+		pool.loads.conn(pool.conns[0]).observe(10 * time.Millisecond)
+
+		idle := 0
+		for range 300 {
+			conn, err := cm.GetConnection(context.Background(), "users", "")
+			if err != nil {
+				t.Fatalf("GetConnection failed: %v", err)
+			}
+			if conn == pool.conns[0] {
+				idle++
+			}
+		}
+		if idle < tt.minIdle {
+			t.Errorf("PoolStrategy %d: expected at least %d of 300 calls on the unloaded connection, got %d", tt.strategy, tt.minIdle, idle)
+		}
+	}
+}
+
+func TestConnectionManager_ExtraOptions(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	received := make(chan metadata.MD, 1)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received <- md
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.ExtraDialOptions = []grpc.DialOption{grpc.WithUserAgent("extra-agent")}
+	cfg.ExtraUnaryInterceptors = []grpc.UnaryClientInterceptor{
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, "x-tenant", "acme"), method, req, reply, cc, opts...)
+		},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	md := <-received
+	if got := md.Get("x-tenant"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("expected x-tenant header from extra interceptor, got %v", got)
+	}
+	if got := md.Get("user-agent"); len(got) == 0 || !strings.HasPrefix(got[0], "extra-agent") {
+		t.Errorf("expected user agent from extra dial option, got %v", got)
+	}
+}
+
+func TestConnectionManager_InterceptorOrder(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	calls := func(order []InterceptorStage) int32 {
+		var n atomic.Int32
+		cfg := DefaultConfig()
+		cfg.Logger = logger.Nop
+		cfg.Retry = interceptors.DefaultRetryConfig()
+		cfg.Retry.MaxAttempts = 3
+		cfg.Retry.InitialBackoff = time.Millisecond
+		cfg.ExtraUnaryInterceptors = []grpc.UnaryClientInterceptor{
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				n.Add(1)
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+		}
+		cfg.InterceptorOrder = order
+		cm, err := NewConnectionManager(cfg, nil)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		defer cm.Close()
+
+		conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("Check error = %v, want Unavailable", err)
+		}
+		return n.Load()
+	}
+
+	if got := calls(nil); got != 3 {
+		t.Errorf("extra interceptor ran %d times by default, want once per attempt (3)", got)
+	}
+	if got := calls([]InterceptorStage{InterceptorExtra, InterceptorRetry}); got != 1 {
+		t.Errorf("extra interceptor ran %d times outside retry, want 1", got)
+	}
+}
+
+func TestConnectionManager_ResponseCache(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	var calls atomic.Int32
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		calls.Add(1)
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.Cache = &interceptors.CacheConfig{Methods: map[string]time.Duration{"/grpc.health.v1.Health/Check": time.Minute}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	client := healthpb.NewHealthClient(conn)
+	for range 3 {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("Check = %v, %v, want SERVING", resp, err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server got %d calls, want 1 with the rest served from the cache", got)
+	}
+
+	cm.PurgeResponseCache("health")
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server got %d calls, want 2 after purging the cache", got)
+	}
+}
+
+func TestConnectionManager_MethodFilterStreams(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	var streams atomic.Int32
+	server := grpc.NewServer(grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streams.Add(1)
+		return handler(srv, ss)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.Services = map[string]ServiceConfig{
+		"health": {Methods: &interceptors.MethodFilterConfig{Deny: []string{"/grpc.health.v1.Health/Watch"}}},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	client := healthpb.NewHealthClient(conn)
+	if _, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected the denied stream to fail with PermissionDenied, got %v", err)
+	}
+	if got := streams.Load(); got != 0 {
+		t.Errorf("server got %d streams, want the denied one to fail locally", got)
+	}
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Expected permitted calls to pass, got %v", err)
+	}
+}
+
+func TestReorderStages(t *testing.T) {
+	// Stages are logging [1, 2), metrics [3, 3) (disabled), retry [4, 6) and extra [6, 7).
+	chain := []string{"correlation", "logging", "events", "deadline", "retry", "retry-budget", "extra"}
+	spans := []stageSpan{
+		{InterceptorLogging, 1, 2},
+		{InterceptorMetrics, 3, 3},
+		{InterceptorRetry, 4, 6},
+		{InterceptorExtra, 6, 7},
+	}
+
+	tests := []struct {
+		order []InterceptorStage
+		want  []string
+	}{
+		{nil, chain},
+		{[]InterceptorStage{InterceptorExtra, InterceptorRetry}, []string{"correlation", "logging", "events", "deadline", "extra", "retry", "retry-budget"}},
+		{[]InterceptorStage{InterceptorRetry, InterceptorLogging}, []string{"correlation", "retry", "retry-budget", "events", "deadline", "logging", "extra"}},
+		{[]InterceptorStage{InterceptorExtra, InterceptorMetrics, InterceptorLogging}, []string{"correlation", "extra", "events", "deadline", "retry", "retry-budget", "logging"}},
+	}
+	for _, tt := range tests {
+		if got := reorderStages(chain, spans, tt.order); !slices.Equal(got, tt.want) {
+			t.Errorf("reorderStages(%v) = %v, want %v", tt.order, got, tt.want)
+		}
+	}
+}
+
+// countingCreds wraps transport credentials and counts client handshakes.
+type countingCreds struct {
+	credentials.TransportCredentials
+	handshakes atomic.Int32
+}
+
+func (c *countingCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.handshakes.Add(1)
+	return c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+}
+
+func (c *countingCreds) Clone() credentials.TransportCredentials { return c }
+
+func TestConnectionManager_PerServiceCredentials(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	global := &countingCreds{TransportCredentials: insecure.NewCredentials()}
+	external := &countingCreds{TransportCredentials: insecure.NewCredentials()}
+
+	cfg := DefaultConfig()
+	cfg.TransportCredentials = global
+	cfg.Services = map[string]ServiceConfig{
+		"external": {TransportCredentials: external},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	for _, service := range []string{"internal", "external"} {
+		conn, err := cm.GetConnection(context.Background(), service, lis.Addr().String())
+		if err != nil {
+			t.Fatalf("GetConnection(%s) failed: %v", service, err)
+		}
+		if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check(%s) failed: %v", service, err)
+		}
+	}
+
+	if got := global.handshakes.Load(); got != 1 {
+		t.Errorf("expected 1 handshake with the global credentials, got %d", got)
+	}
+	if got := external.handshakes.Load(); got != 1 {
+		t.Errorf("expected 1 handshake with the per-service credentials, got %d", got)
+	}
+}
+
+// tokenCreds attaches a fixed token to calls, without requiring transport security.
+type tokenCreds string
+
+func (c tokenCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"x-token": string(c)}, nil
+}
+
+func (tokenCreds) RequireTransportSecurity() bool { return false }
+
+func TestConnectionManager_GetConnectionWithOptions(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	seen := make(chan metadata.MD, 1)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := cm.GetConnectionWithOptions(ctx, "health", "passthrough:///bufnet",
+		ConnConnectMode(ConnectModeWaitForReady),
+		ConnWaitForReady(true),
+		ConnPerRPCCredentials(tokenCreds("secret")),
+		ConnAuthority("health.internal"),
+	)
+	if err != nil {
+		t.Fatalf("GetConnectionWithOptions failed: %v", err)
+	}
+	plain, err := cm.GetConnection(ctx, "health", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if state := plain.GetState(); state != connectivity.Ready {
+		t.Errorf("state = %s, want Ready with ConnConnectMode(ConnectModeWaitForReady)", state)
+	}
+
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	md := <-seen
+	if got := md.Get("x-token"); len(got) != 1 || got[0] != "secret" {
+		t.Errorf("x-token = %v, want the per-call credentials", got)
+	}
+	if got := md.Get(":authority"); len(got) != 1 || got[0] != "health.internal" {
+		t.Errorf(":authority = %v, want health.internal", got)
+	}
+
+	// The options only apply to calls through the returned connection
+	if _, err := healthpb.NewHealthClient(plain).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if got := (<-seen).Get("x-token"); len(got) != 0 {
+		t.Errorf("x-token = %v, want none on calls through GetConnection", got)
+	}
+}
+
+// authorityCreds records the authority handshakes are made with.
+type authorityCreds struct {
+	credentials.TransportCredentials
+	authorities chan string
+}
+
+func (c *authorityCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.authorities <- authority
+	return c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+}
+
+func (c *authorityCreds) Clone() credentials.TransportCredentials { return c }
+
+func TestConnectionManager_AuthorityOverride(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	seen := make(chan metadata.MD, 2)
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	creds := &authorityCreds{TransportCredentials: insecure.NewCredentials(), authorities: make(chan string, 2)}
+	cfg := DefaultConfig()
+	cfg.TransportCredentials = creds
+	cfg.Services = map[string]ServiceConfig{
+		"ingress": {Authority: "api.example.com"},
+		"sni":     {Authority: "api.example.com", ServerNameOverride: "ingress.example.com"},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	for service, wantServerName := range map[string]string{"ingress": "api.example.com", "sni": "ingress.example.com"} {
+		conn, err := cm.GetConnection(context.Background(), service, lis.Addr().String())
+		if err != nil {
+			t.Fatalf("GetConnection(%s) failed: %v", service, err)
+		}
+		if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check(%s) failed: %v", service, err)
+		}
+		if got := <-creds.authorities; got != wantServerName {
+			t.Errorf("%s: handshake server name = %q, want %q", service, got, wantServerName)
+		}
+		if got := (<-seen).Get(":authority"); len(got) != 1 || got[0] != "api.example.com" {
+			t.Errorf("%s: :authority = %v, want api.example.com", service, got)
+		}
+	}
+
+	bad := DefaultConfig()
+	bad.Services = map[string]ServiceConfig{"sni": {ServerNameOverride: "ingress.example.com:443"}}
+	if err := bad.Validate(); err == nil {
+		t.Error("expected a ServerNameOverride with a port to be rejected")
+	}
+}
+
+func TestConnectionManager_HealthCheckProtocol(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.HealthCheck = &HealthCheckConfig{Service: "users.Users"}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "users", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if err := waitForReady(context.Background(), conn, 2*time.Second); err != nil {
+		t.Fatalf("connection not ready: %v", err)
+	}
+
+	healthServer.SetServingStatus("users.Users", healthpb.HealthCheckResponse_NOT_SERVING)
+	if h := cm.HealthCheck(context.Background())["users"]; h.Healthy || h.HealthStatus != "NOT_SERVING" {
+		t.Errorf("expected NOT_SERVING to be unhealthy, got %+v", h)
+	}
+
+	healthServer.SetServingStatus("users.Users", healthpb.HealthCheckResponse_SERVING)
+	if h := cm.HealthCheck(context.Background())["users"]; !h.Healthy || h.HealthStatus != "SERVING" {
+		t.Errorf("expected SERVING to be healthy, got %+v", h)
+	}
+}
+
+func TestConnectionManager_HealthMonitorReconnectsStuckConnections(t *testing.T) {
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = fake
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	// Nothing listens on port 1, so the connection goes to TransientFailure.
+	conn, err := cm.GetConnection(context.Background(), "test-service", "127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	waitForState(t, conn, connectivity.TransientFailure)
+
+	if err := cm.StartHealthMonitor(time.Second); err != nil {
+		t.Fatalf("StartHealthMonitor failed: %v", err)
+	}
+	if err := cm.StartHealthMonitor(time.Second); err == nil {
+		t.Error("expected starting the monitor twice to fail")
+	}
+	fake.BlockUntil(1)
+
+	fake.Advance(time.Second)
+	waitFor(t, func() bool { return cm.LastHealthCheck() != nil })
+	if h := cm.LastHealthCheck()["test-service"]; h.CheckedAt.IsZero() {
+		t.Error("expected CheckedAt to be set")
+	}
+
+	waitForState(t, conn, connectivity.TransientFailure)
+	fake.Advance(time.Second)
+	waitFor(t, func() bool {
+		cm.mu.RLock()
+		defer cm.mu.RUnlock()
+		return cm.connections["test-service"] != conn
+	})
+}
+
+func waitForState(t *testing.T, conn *grpc.ClientConn, want connectivity.State) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for state := conn.GetState(); state != want; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			t.Fatalf("timed out waiting for %s, state is %s", want, state)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutlierDetector_EjectsAndReadmits(t *testing.T) {
+	cfg := DefaultOutlierDetectionConfig()
+	cfg.MinimumRequests = 2
+	cfg.RampUp = 0
+	d := newOutlierDetector("svc", cfg, nil, nil)
+	good, bad := new(grpc.ClientConn), new(grpc.ClientConn)
+	conns := []*grpc.ClientConn{good, bad}
+
+	now := time.Now()
+	d.admit(conns, good, now)
+	for range 4 {
+		d.record(good, nil, time.Millisecond)
+		d.record(bad, status.Error(codes.Unavailable, "down"), time.Millisecond)
+	}
+
+	now = now.Add(cfg.Interval)
+	if !d.admit(conns, good, now) {
+		t.Error("Expected healthy connection to stay in rotation")
+	}
+	if d.admit(conns, bad, now) {
+		t.Error("Expected failing connection to be ejected")
+	}
+
+	now = now.Add(cfg.BaseEjectionTime)
+	if !d.admit(conns, bad, now) {
+		t.Error("Expected ejected connection to be re-admitted after BaseEjectionTime")
+	}
+
+	// A second ejection lasts twice as long.
+	for range 4 {
+		d.record(bad, status.Error(codes.Unavailable, "down"), time.Millisecond)
+	}
+	now = now.Add(cfg.Interval)
+	d.admit(conns, good, now)
+	if d.admit(conns, bad, now.Add(cfg.BaseEjectionTime)) {
+		t.Error("Expected repeated ejection to last longer than BaseEjectionTime")
+	}
+	if !d.admit(conns, bad, now.Add(2*cfg.BaseEjectionTime)) {
+		t.Error("Expected connection to be re-admitted after twice BaseEjectionTime")
+	}
+}
+
+func TestOutlierDetector_LatencyFromClock(t *testing.T) {
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultOutlierDetectionConfig()
+	cfg.MinimumRequests = 2
+	cfg.LatencyFactor = 3
+	cfg.RampUp = 0
+	d := newOutlierDetector("svc", cfg, clk, nil)
+	fast, slow, other := new(grpc.ClientConn), new(grpc.ClientConn), new(grpc.ClientConn)
+	conns := []*grpc.ClientConn{fast, slow, other}
+
+	// Calls on the slow connection take 100ms of the manager's clock, the others 10ms.
+	interceptor := d.unaryInterceptor()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if cc == slow {
+			clk.Advance(100 * time.Millisecond)
+		} else {
+			clk.Advance(10 * time.Millisecond)
+		}
+		return nil
+	}
+	d.admit(conns, fast, clk.Now())
+	for range 2 {
+		for _, conn := range conns {
+			_ = interceptor(context.Background(), "/svc.Svc/Get", nil, nil, conn, invoker)
+		}
+	}
+
+	clk.Advance(cfg.Interval)
+	if d.admit(conns, slow, clk.Now()) {
+		t.Error("Expected the connection that is slow on the manager's clock to be ejected")
+	}
+	if !d.admit(conns, fast, clk.Now()) {
+		t.Error("Expected the fast connection to stay in rotation")
+	}
+}
+
+func TestOutlierDetector_KeepsOneConnection(t *testing.T) {
+	cfg := DefaultOutlierDetectionConfig()
+	cfg.MinimumRequests = 1
+	cfg.MaxEjectionPercent = 100
+	d := newOutlierDetector("svc", cfg, nil, nil)
+	a, b := new(grpc.ClientConn), new(grpc.ClientConn)
+	conns := []*grpc.ClientConn{a, b}
+
+	now := time.Now()
+	d.admit(conns, a, now)
+	d.record(a, status.Error(codes.Unavailable, "down"), time.Millisecond)
+	d.record(b, status.Error(codes.Unavailable, "down"), time.Millisecond)
+
+	now = now.Add(cfg.Interval)
+	if d.admit(conns, a, now) == d.admit(conns, b, now) {
+		t.Error("Expected exactly one of two failing connections to be ejected")
+	}
+}
+
+func TestConnectionManager_RegisterService(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if err := cm.RegisterService("users", "localhost:50051", WithServiceMaxMsgSize(-1)); err == nil {
+		t.Error("expected RegisterService to reject an invalid MaxMsgSize")
+	}
+	if len(cm.ListServices()) != 0 {
+		t.Error("expected a rejected registration to leave no service behind")
+	}
+
+	if err := cm.RegisterService("users", "localhost:50051", WithCredentials(insecure.NewCredentials()), WithServiceMaxMsgSize(1024)); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	if err := cm.RegisterService("orders", "localhost:50052"); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	if got := cm.ListServices(); len(got) != 2 || got[0] != "orders" || got[1] != "users" {
+		t.Errorf("expected [orders users], got %v", got)
+	}
+	if cfg.Services != nil {
+		t.Error("expected RegisterService not to modify the caller's config")
+	}
+	if got := cm.config().maxMsgSize("users"); got != 1024 {
+		t.Errorf("expected registered MaxMsgSize 1024, got %d", got)
+	}
+
+	if _, err := cm.GetConnection(context.Background(), "users", ""); err != nil {
+		t.Fatalf("GetConnection for a registered service failed: %v", err)
+	}
+
+	if err := cm.UnregisterService("users"); err != nil {
+		t.Fatalf("UnregisterService failed: %v", err)
+	}
+	if _, err := cm.GetConnection(context.Background(), "users", ""); err == nil {
+		t.Error("expected GetConnection to fail for an unregistered service")
+	}
+	if err := cm.UnregisterService("users"); err == nil {
+		t.Error("expected UnregisterService to fail for an unknown service")
+	}
+}
+
+func TestConnectionManager_WarmUp(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cfg.MinConnectTimeout = 2 * time.Second
+	cfg.PreconnectOnRegister = true
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if err := cm.RegisterService("up", lis.Addr().String()); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	// Nothing listens on port 1
+	if err := cm.RegisterService("down", "127.0.0.1:1"); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	if cm.GetConnectionsCount() != 2 {
+		t.Errorf("expected PreconnectOnRegister to create 2 connections, got %d", cm.GetConnectionsCount())
+	}
+
+	results := cm.WarmUp(context.Background())
+	if len(results) != 2 {
+		t.Fatalf("expected a result for both services, got %v", results)
+	}
+	if err := results["up"]; err != nil {
+		t.Errorf("expected up to warm up, got %v", err)
+	}
+	if results["down"] == nil {
+		t.Error("expected down to fail to warm up")
+	}
+}
+
+func TestConnectionManager_WarmUpAfterFailedAttempt(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	var dials atomic.Int32
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cfg.MinConnectTimeout = 5 * time.Second
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		if dials.Add(1) == 1 {
+			return nil, errors.New("not listening yet")
+		}
+		return lis.DialContext(ctx)
+	}
+	cfg.Services = map[string]ServiceConfig{"orders": {Address: "passthrough:///bufnet"}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	// The first attempt fails, and the warm-up waits for the connection to reconnect.
+	if err := cm.WarmUp(context.Background())["orders"]; err != nil {
+		t.Errorf("expected orders to warm up after a failed attempt, got %v", err)
+	}
+	if got := dials.Load(); got < 2 {
+		t.Errorf("expected the failed attempt to be retried, got %d dials", got)
+	}
+}
+
+func TestConnectionManager_ConnectModeWaitForReady(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cfg.ConnectMode = ConnectModeWaitForReady
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := cm.GetConnection(ctx, "up", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Errorf("expected a Ready connection, got %s", state)
+	}
+
+	// Nothing listens on port 1, so the connection never becomes Ready
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := cm.GetConnection(ctx, "down", "127.0.0.1:1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected GetConnection to fail with the context deadline, got %v", err)
+	}
+
+	// The per-call mode overrides the config
+	lazy := WithConnectMode(context.Background(), ConnectModeLazy)
+	if _, err := cm.GetConnection(lazy, "down", ""); err != nil {
+		t.Errorf("expected a lazy GetConnection to succeed, got %v", err)
+	}
+}
+
+func TestConnectionManager_MaxIdleTime(t *testing.T) {
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = fake
+	cfg.DialMode = DialModeNewClient
+	cfg.MaxIdleTime = time.Minute
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+	fake.BlockUntil(1)
+
+	conn, err := cm.GetConnection(context.Background(), "test-service", "localhost:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+
+	// A call in flight keeps the connection from being evicted
+	cm.mu.RLock()
+	usage := cm.usage[conn]
+	cm.mu.RUnlock()
+	usage.start(fake.Now())
+	fake.Advance(time.Minute)
+	cm.evictConnections()
+	if cm.GetConnectionsCount() != 1 {
+		t.Fatal("expected a connection with a call in flight to be kept")
+	}
+	usage.finish(fake.Now())
+
+	fake.Advance(30 * time.Second)
+	cm.evictConnections()
+	if cm.GetConnectionsCount() != 1 {
+		t.Fatal("expected a recently used connection to be kept")
+	}
+	fake.Advance(30 * time.Second)
+	waitFor(t, func() bool { return cm.GetConnectionsCount() == 0 })
+	waitForState(t, conn, connectivity.Shutdown)
+}
+
+func TestConnectionManager_MaxConnectionAge(t *testing.T) {
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = fake
+	cfg.DialMode = DialModeNewClient
+	cfg.MaxConnectionAge = time.Minute
+	cfg.MaxConnectionAgeGrace = 10 * time.Second
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+	fake.BlockUntil(1)
+
+	old, err := cm.GetConnection(context.Background(), "test-service", "localhost:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	cm.mu.RLock()
+	usage := cm.usage[old]
+	cm.mu.RUnlock()
+	usage.start(fake.Now())
+
+	fake.Advance(time.Minute)
+	waitFor(t, func() bool { return cm.GetConnectionsCount() == 0 })
+	conn, err := cm.GetConnection(context.Background(), "test-service", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if conn == old {
+		t.Fatal("expected a new connection after MaxConnectionAge")
+	}
+	if state := old.GetState(); state == connectivity.Shutdown {
+		t.Fatal("expected the retired connection to stay open for its call in flight")
+	}
+
+	fake.Advance(10 * time.Second)
+	cm.evictConnections()
+	waitForState(t, old, connectivity.Shutdown)
+}
+
+func TestConnectionManager_RebalanceInterval(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = fake
+	cfg.RebalanceInterval = time.Minute
+	cfg.MaxConnectionAgeGrace = 10 * time.Second
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+	fake.BlockUntil(1)
+
+	old, err := cm.GetConnection(context.Background(), "test-service", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	waitForState(t, old, connectivity.Ready)
+	cm.mu.RLock()
+	usage := cm.usage[old]
+	cm.mu.RUnlock()
+	usage.start(fake.Now())
+
+	fake.Advance(2 * time.Minute)
+	waitFor(t, func() bool {
+		conn, _ := cm.GetConnection(context.Background(), "test-service", "")
+		return conn != old
+	})
+	conn, err := cm.GetConnection(context.Background(), "test-service", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Errorf("state = %s, want the new connection to be Ready when it takes over", state)
+	}
+	if state := old.GetState(); state == connectivity.Shutdown {
+		t.Fatal("expected the replaced connection to stay open for its call in flight")
+	}
+
+	fake.Advance(10 * time.Second)
+	cm.evictConnections()
+	waitForState(t, old, connectivity.Shutdown)
+}
+
+// blockingHealth is a health server whose Check blocks until release is closed.
+type blockingHealth struct {
+	healthpb.UnimplementedHealthServer
+	release chan struct{}
+}
+
+func (h *blockingHealth) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	select {
+	case <-h.release:
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func TestConnectionManager_Shutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	blocking := &blockingHealth{release: make(chan struct{})}
+	healthpb.RegisterHealthServer(server, blocking)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	newManager := func() (*ConnectionManager, healthpb.HealthClient) {
+		t.Helper()
+		cfg := DefaultConfig()
+		cfg.EnableRetry = false
+		cm, err := NewConnectionManager(cfg, nil)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		conn, err := cm.GetConnection(context.Background(), "test-service", lis.Addr().String())
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		return cm, healthpb.NewHealthClient(conn)
+	}
+
+	// A call that outlives the shutdown context is canceled
+	cm, client := newManager()
+	go func() { _, _ = client.Check(context.Background(), &healthpb.HealthCheckRequest{}) }()
+	waitFor(t, func() bool { return cm.calls.n.Load() == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cm.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Shutdown to report the canceled call, got %v", err)
+	}
+
+	// A call that finishes in time is drained
+	cm, client = newManager()
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		callErr <- err
+	}()
+	waitFor(t, func() bool { return cm.calls.n.Load() == 1 })
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- cm.Shutdown(context.Background()) }()
+	waitFor(t, func() bool {
+		_, err := cm.GetConnection(context.Background(), "test-service", "")
+		return err != nil
+	})
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("expected Shutdown to wait for the call in flight, returned %v", err)
+	default:
+	}
+
+	close(blocking.release)
+	if err := <-callErr; err != nil {
+		t.Errorf("expected the call in flight to complete, got %v", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestConnectionManager_Subscribe(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	events, unsubscribe := cm.SubscribeChan(16, interceptors.EventConnCreated, interceptors.EventConnReady, interceptors.EventConnClosed)
+	var calls atomic.Int32
+	stop := cm.Subscribe(func(interceptors.Event) { calls.Add(1) })
+	stop()
+
+	conn, err := cm.GetConnection(context.Background(), "test-service", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	conn.Connect()
+
+	var kinds []interceptors.EventKind
+	for e := range events {
+		if e.Kind == interceptors.EventConnReady {
+			if err := cm.CloseConnection("test-service"); err != nil {
+				t.Fatalf("CloseConnection failed: %v", err)
+			}
+		}
+		if e.Kind == interceptors.EventConnClosed {
+			unsubscribe()
+		}
+		if e.Service != "test-service" || e.Address != lis.Addr().String() {
+			t.Errorf("unexpected event %+v", e)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	want := []interceptors.EventKind{interceptors.EventConnCreated, interceptors.EventConnReady, interceptors.EventConnClosed}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("expected events %v, got %v", want, kinds)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("expected no events after unsubscribing, got %d", calls.Load())
+	}
+}
+
+func TestConnectionManager_WatchesConnectionState(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.EnableMetrics = true
+	cm, err := NewConnectionManager(cfg, testMetrics())
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	events, unsubscribe := cm.SubscribeChan(1, interceptors.EventConnTransientFailure)
+	defer unsubscribe()
+
+	// Nothing listens on port 1. No HealthCheck is needed to notice the failure.
+	if _, err := cm.GetConnection(context.Background(), "watched-service", "127.0.0.1:1"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	select {
+	case e := <-events:
+		if e.Service != "watched-service" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for EventConnTransientFailure")
+	}
+}
+
+func TestClient(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cm, err := NewConnectionManager(DefaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if _, err := Client(context.Background(), cm, "health", healthpb.NewHealthClient); err == nil {
+		t.Error("expected Client to fail for an unknown service")
+	}
+	if err := cm.RegisterService("health", lis.Addr().String()); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	client, err := Client(context.Background(), cm, "health", healthpb.NewHealthClient)
+	if err != nil {
+		t.Fatalf("Client failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+}
+
+func TestConnectionManager_ServiceConn(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cm, err := NewConnectionManager(DefaultConfig(), nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	unknown := healthpb.NewHealthClient(cm.ServiceConn("unknown"))
+	if _, err := unknown.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable for an unknown service, got %v", err)
+	}
+
+	if err := cm.RegisterService("health", lis.Addr().String()); err != nil {
+		t.Fatalf("RegisterService failed: %v", err)
+	}
+	client := healthpb.NewHealthClient(cm.ServiceConn("health"))
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	// The client keeps working after the manager replaces the connection
+	if err := cm.CloseConnection("health"); err != nil {
+		t.Fatalf("CloseConnection failed: %v", err)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check after CloseConnection failed: %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`
+max_msg_size: 4194304
+KeepAliveTime: 1m
+retry:
+  max_attempts: 5
+  retryable_codes: [UNAVAILABLE, RESOURCE_EXHAUSTED]
+circuit_breaker:
+  failure_threshold: 3
+services:
+  payments:
+    latency_slo: 200ms
+    log_level: warn
+    fallback_addresses: [payments-b:443]
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxMsgSize != 4194304 || cfg.KeepAliveTime != time.Minute {
+		t.Errorf("unexpected top-level values: %d, %v", cfg.MaxMsgSize, cfg.KeepAliveTime)
+	}
+	if cfg.MinConnectTimeout != DefaultConfig().MinConnectTimeout {
+		t.Errorf("expected unset fields to keep their defaults, got MinConnectTimeout %v", cfg.MinConnectTimeout)
+	}
+	if cfg.Retry.MaxAttempts != 5 || !slices.Equal(cfg.Retry.RetryableCodes, []codes.Code{codes.Unavailable, codes.ResourceExhausted}) {
+		t.Errorf("unexpected retry config: %+v", cfg.Retry)
+	}
+	if cfg.Retry.InitialBackoff != interceptors.DefaultRetryConfig().InitialBackoff {
+		t.Error("expected the retry section to start from its defaults")
+	}
+	if cfg.CircuitBreaker.FailureThreshold != 3 || cfg.CircuitBreaker.Timeout != interceptors.DefaultCircuitBreakerConfig().Timeout {
+		t.Errorf("unexpected circuit breaker config: %+v", cfg.CircuitBreaker)
+	}
+	sc := cfg.Services["payments"]
+	if sc.LatencySLO != 200*time.Millisecond || sc.LogLevel != logger.WarnLevel || len(sc.FallbackAddresses) != 1 {
+		t.Errorf("unexpected service config: %+v", sc)
+	}
+
+	for data, want := range map[string]string{
+		"retry:\n  max_atempts: 5\n":                   "retry.max_atempts: unknown key",
+		"keep_alive_time: 30\n":                        "keep_alive_time: want a duration",
+		"services:\n  users:\n    max_msg_size: big\n": "services.users.max_msg_size: want an integer",
+		"logger: zap\n":                                "logger: cannot be set",
+		"retry:\n  max_attempts: 0\n":                  "Retry.MaxAttempts must be greater than 0",
+	} {
+		writeConfig(data)
+		if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadConfig(%q): expected error containing %q, got %v", data, want, err)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GRPCCM_MAX_MSG_SIZE", "1024")
+	t.Setenv("GRPCCM_ENABLE_RETRY", "false")
+	t.Setenv("GRPCCM_RETRY_BUDGET_RATIO", "0.5")
+	t.Setenv("GRPCCM_CIRCUIT_BREAKER_TIMEOUT", "5s")
+	t.Setenv("GRPCCM_RETRY_RETRYABLE_CODES", "UNAVAILABLE,ABORTED")
+	t.Setenv("GRPCCM_SERVICES", `{"users": {"max_msg_size": 2048}}`)
+
+	cfg, err := ConfigFromEnv("GRPCCM")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv failed: %v", err)
+	}
+	if cfg.MaxMsgSize != 1024 || cfg.EnableRetry {
+		t.Errorf("unexpected top-level values: %d, %v", cfg.MaxMsgSize, cfg.EnableRetry)
+	}
+	if cfg.RetryBudget == nil || cfg.RetryBudget.Ratio != 0.5 || cfg.RetryBudget.MinRetries != interceptors.DefaultRetryBudgetConfig().MinRetries {
+		t.Errorf("unexpected retry budget: %+v", cfg.RetryBudget)
+	}
+	if cfg.Retry == nil || len(cfg.Retry.RetryableCodes) != 2 || cfg.Retry.Budget != nil {
+		t.Errorf("unexpected retry config: %+v", cfg.Retry)
+	}
+	if cfg.CircuitBreaker.Timeout != 5*time.Second {
+		t.Errorf("expected circuit breaker timeout 5s, got %v", cfg.CircuitBreaker.Timeout)
+	}
+	if cfg.Services["users"].MaxMsgSize != 2048 {
+		t.Errorf("unexpected services: %+v", cfg.Services)
+	}
+
+	t.Setenv("GRPCCM_MAX_MSG_SIZ", "1")
+	if _, err := ConfigFromEnv("GRPCCM"); err == nil || !strings.Contains(err.Error(), "GRPCCM_MAX_MSG_SIZ: unknown variable") {
+		t.Errorf("expected an unknown variable error, got %v", err)
+	}
+}
+
+func TestConnectionManager_ApplyConfig(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	var attempts atomic.Int32
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		attempts.Add(1)
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	address := lis.Addr().String()
+	cfg := DefaultConfig()
+	cfg.Retry = interceptors.DefaultRetryConfig()
+	cfg.Retry.MaxAttempts = 2
+	cfg.Retry.InitialBackoff = time.Millisecond
+	cfg.Services = map[string]ServiceConfig{
+		"orders":   {Address: address},
+		"payments": {Address: address},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	orders, err := cm.GetConnection(ctx, "orders", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	payments, err := cm.GetConnection(ctx, "payments", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	check := func() int32 {
+		attempts.Store(0)
+		_, _ = healthpb.NewHealthClient(orders).Check(ctx, &healthpb.HealthCheckRequest{})
+		return attempts.Load()
+	}
+	if got := check(); got != 2 {
+		t.Fatalf("expected 2 attempts, got %d", got)
+	}
+
+	newCfg := cm.Config()
+	newCfg.Retry.MaxAttempts = 3
+	newCfg.Services["payments"] = ServiceConfig{Address: address, MaxMsgSize: 1024}
+	if err := cm.ApplyConfig(newCfg); err != nil {
+		t.Fatalf("ApplyConfig failed: %v", err)
+	}
+	if cfg.Retry.MaxAttempts != 2 {
+		t.Error("Config must return a copy of the retry settings")
+	}
+	if got := check(); got != 3 {
+		t.Errorf("expected the existing connection to retry 3 times, got %d", got)
+	}
+	if conn, _ := cm.GetConnection(ctx, "orders", ""); conn != orders {
+		t.Error("expected orders to keep its connection")
+	}
+	if conn, _ := cm.GetConnection(ctx, "payments", ""); conn == payments {
+		t.Error("expected payments to reconnect after its message size changed")
+	}
+
+	invalid := cm.Config()
+	invalid.MaxMsgSize = 0
+	if err := cm.ApplyConfig(invalid); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+
+	newCfg = cm.Config()
+	delete(newCfg.Services, "payments")
+	if err := cm.ApplyConfig(newCfg); err != nil {
+		t.Fatalf("ApplyConfig failed: %v", err)
+	}
+	if services := cm.ListServices(); !slices.Equal(services, []string{"orders"}) {
+		t.Errorf("expected payments to be unregistered, got %v", services)
+	}
+}
+
+func TestConnectionManager_ApplyConfigUnchanged(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cfg.ExtraUnaryInterceptors = []grpc.UnaryClientInterceptor{
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	}
+	cb := interceptors.DefaultCircuitBreakerConfig()
+	cb.OnStateChange = func(string, interceptors.CircuitBreakerState, interceptors.CircuitBreakerState) {}
+	cb.Fallbacks = map[string]interceptors.FallbackFunc{
+		"/grpc.health.v1.Health/Check": func(context.Context, string, interface{}, interface{}, error) error { return nil },
+	}
+	cfg.CircuitBreaker = cb
+	cfg.ConnectMode = ConnectModeWaitForReady
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	conn, err := cm.GetConnection(ctx, "health", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if err := cm.ApplyConfig(cm.Config()); err != nil {
+		t.Fatalf("ApplyConfig failed: %v", err)
+	}
+	if got, _ := cm.GetConnection(ctx, "health", ""); got != conn {
+		t.Error("expected an unchanged config to keep the connection")
+	}
+
+	newCfg := cm.Config()
+	newCfg.ExtraUnaryInterceptors = append(slices.Clone(newCfg.ExtraUnaryInterceptors), newCfg.ExtraUnaryInterceptors[0])
+	if err := cm.ApplyConfig(newCfg); err != nil {
+		t.Fatalf("ApplyConfig failed: %v", err)
+	}
+	if got, _ := cm.GetConnection(ctx, "health", ""); got == conn {
+		t.Error("expected a changed interceptor chain to reconnect")
+	}
+}
+
+func TestConnectionManager_Refresh(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	if err := cm.Refresh("orders"); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+
+	ctx := context.Background()
+	conn, err := cm.GetConnection(ctx, "orders", "orders.internal:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if err := cm.Refresh("orders"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if newConn, _ := cm.GetConnection(ctx, "orders", ""); newConn == conn {
+		t.Error("expected Refresh to dial the service again")
+	}
+}
+
+func TestConnectionManager_ResolveInterval(t *testing.T) {
+	var (
+		lookups atomic.Int32
+		ips     atomic.Value
+	)
+	ips.Store([]string{"10.0.0.1", "10.0.0.2"})
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups.Add(1)
+		return ips.Load().([]string), nil
+	}
+	defer func() { lookupHost = net.DefaultResolver.LookupHost }()
+
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.DialMode = DialModeNewClient
+	cfg.Clock = fake
+	cfg.ResolveInterval = time.Minute
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "orders", "orders.internal:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if _, err := cm.GetConnection(context.Background(), "local", "127.0.0.1:50051"); err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	current := func() *grpc.ClientConn {
+		cm.mu.RLock()
+		defer cm.mu.RUnlock()
+		return cm.connections["orders"]
+	}
+
+	fake.BlockUntil(1)
+	for i, want := range []int32{1, 2} {
+		fake.Advance(time.Minute)
+		waitFor(t, func() bool { return lookups.Load() == want })
+		if i == 1 && current() != conn {
+			t.Error("expected the connection to be kept while its addresses are unchanged")
+		}
+	}
+
+	ips.Store([]string{"10.0.0.3"})
+	fake.Advance(time.Minute)
+	waitFor(t, func() bool { return current() != conn })
+	if lookups.Load() != 3 {
+		t.Errorf("expected only the DNS name to be resolved, got %d lookups", lookups.Load())
+	}
+}
+
+func TestConnectionManager_Discovery(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	_ = closed.Close()
+
+	cfg := DefaultConfig()
+	cfg.Discovery = discovery.Static{"health": {closed.Addr().String(), lis.Addr().String()}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if services := cm.ListServices(); !slices.Equal(services, []string{"health"}) {
+		t.Errorf("expected the discovered service to be listed, got %v", services)
+	}
+}
+
+func TestConnectionManager_LoadBalancingPolicy(t *testing.T) {
+	var served [2]atomic.Int32
+	var addresses []string
+	for i := range served {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			served[i].Add(1)
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() { _ = server.Serve(lis) }()
+		defer server.Stop()
+		addresses = append(addresses, lis.Addr().String())
+	}
+
+	cfg := DefaultConfig()
+	cfg.Discovery = discovery.Static{"health": addresses}
+	cfg.Services = map[string]ServiceConfig{"health": {LoadBalancingPolicy: "round_robin"}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for range 10 {
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+	}
+	// round_robin starts picking once the first backend is Ready, so not all calls may be spread.
+	waitFor(t, func() bool {
+		_, _ = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return served[0].Load() > 0 && served[1].Load() > 0
+	})
+
+	cfg = DefaultConfig()
+	cfg.LoadBalancingPolicy = "least_loaded"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an unregistered policy")
+	}
+}
+
+func TestConnectionManager_Failover(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var addresses []string
+	for i := range 2 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if i == 0 && failing.Load() {
+				return nil, status.Error(codes.Unavailable, "primary is down")
+			}
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() { _ = server.Serve(lis) }()
+		defer server.Stop()
+		addresses = append(addresses, lis.Addr().String())
+	}
+	primary, fallback := addresses[0], addresses[1]
+
+	fake := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = fake
+	cfg.EnableRetry = false
+	cfg.CircuitBreaker = interceptors.DefaultCircuitBreakerConfig()
+	cfg.CircuitBreaker.FailureThreshold = 2
+	cfg.Services = map[string]ServiceConfig{"health": {FallbackAddresses: []string{fallback}}}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	check := func() error {
+		conn, err := cm.GetConnection(ctx, "health", primary)
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		return err
+	}
+
+	for range 2 {
+		if err := check(); status.Code(err) != codes.Unavailable {
+			t.Fatalf("expected the primary to fail, got %v", err)
+		}
+	}
+	if err := check(); err != nil {
+		t.Fatalf("expected the call to fail over, got %v", err)
+	}
+	if got := cm.HealthCheck(ctx)["health"].Address; got != fallback {
+		t.Errorf("expected to be connected to the fallback %s, got %s", fallback, got)
+	}
+
+	// The primary recovers and is picked up by the next probe.
+	failing.Store(false)
+	fake.BlockUntil(1)
+	fake.Advance(cfg.FailbackInterval)
+	waitFor(t, func() bool { return cm.HealthCheck(ctx)["health"].Address == primary })
+	if err := check(); err != nil {
+		t.Errorf("expected calls to the primary to succeed after failing back, got %v", err)
+	}
+}
+
+func TestConnectionManager_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	cfg := DefaultConfig()
+	cfg.DNSCache = &dnscache.Config{} // unix addresses must bypass the cached resolver
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	for name, address := range map[string]string{"absolute": "unix://" + path, "plain": "unix:" + path} {
+		conn, err := cm.GetConnection(context.Background(), name, address)
+		if err != nil {
+			t.Fatalf("GetConnection(%s) failed: %v", address, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("Check over %s failed: %v", address, err)
+		}
+		cancel()
+	}
+}
+
+func TestConnectionManager_AuthRequiresTransportSecurity(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	var received atomic.Value
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		received.Store(strings.Join(md.Get("authorization"), ","))
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	for _, allowInsecure := range []bool{false, true} {
+		cfg := DefaultConfig()
+		cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}
+		cfg.Auth = interceptors.DefaultAuthConfig(tokencreds.StaticToken("secret"))
+		cfg.Auth.AllowInsecure = allowInsecure
+		cm, err := NewConnectionManager(cfg, nil)
+		if err != nil {
+			t.Fatalf("NewConnectionManager failed: %v", err)
+		}
+		conn, err := cm.GetConnection(context.Background(), "health", "passthrough:///bufnet")
+		if err != nil {
+			t.Fatalf("GetConnection failed: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		cancel()
+		_ = cm.Close()
+
+		if allowInsecure {
+			if err != nil || received.Load() != "Bearer secret" {
+				t.Errorf("Expected the token to be sent with AllowInsecure, got %v, %v", received.Load(), err)
+			}
+		} else if status.Code(err) != codes.Unauthenticated || received.Load() != nil {
+			t.Errorf("Expected the token not to be sent over an insecure connection, got %v", err)
+		}
+	}
+}
+
+func TestConnectionManager_StandbyFailoverAndFailback(t *testing.T) {
+	listeners := map[string]*bufconn.Listener{}
+	var primaryDown atomic.Bool
+	for _, name := range []string{"primary", "standby"} {
+		lis := bufconn.Listen(1 << 20)
+		listeners[name] = lis
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if name == "primary" && primaryDown.Load() {
+				return nil, status.Error(codes.Unavailable, "down")
+			}
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() { _ = server.Serve(lis) }()
+		defer server.Stop()
+	}
+
+	clk := testutil.NewFakeClock(time.Now())
+	cfg := DefaultConfig()
+	cfg.Clock = clk
+	cfg.EnableRetry = false
+	cfg.ConnectMode = ConnectModeWaitForReady
+	cfg.ContextDialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	}
+	cb := interceptors.DefaultCircuitBreakerConfig()
+	cb.FailureThreshold = 1
+	cb.Timeout = 10 * time.Second
+	cfg.CircuitBreaker = cb
+	cfg.Services = map[string]ServiceConfig{
+		"orders": {Address: "passthrough:///primary", StandbyAddress: "passthrough:///standby"},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	primary, err := cm.GetConnection(ctx, "orders", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	primaryDown.Store(true)
+	if _, err := healthpb.NewHealthClient(primary).Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected the primary to fail, got %v", err)
+	}
+	primaryDown.Store(false)
+
+	standby, err := cm.GetConnection(ctx, "orders", "")
+	if err != nil || standby == primary {
+		t.Fatalf("Expected the standby once the primary's breaker opened, got %v", err)
+	}
+	if _, err := healthpb.NewHealthClient(standby).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check on the standby failed: %v", err)
+	}
+
+	// Traffic stays on the standby until the configured breaker timeout has elapsed.
+	clk.Advance(9 * time.Second)
+	if conn, _ := cm.GetConnection(ctx, "orders", ""); conn != standby {
+		t.Error("Expected the standby before the breaker timeout elapsed")
+	}
+	clk.Advance(time.Second)
+	if conn, _ := cm.GetConnection(ctx, "orders", ""); conn != primary {
+		t.Error("Expected to fail back to the primary after the breaker timeout")
+	}
+}
+
+func TestConnectionManager_Canary(t *testing.T) {
+	listeners := map[string]*bufconn.Listener{}
+	served := map[string]*atomic.Int32{}
+	for _, name := range []string{"primary", "canary"} {
+		lis := bufconn.Listen(1 << 20)
+		listeners[name] = lis
+		served[name] = &atomic.Int32{}
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			served[name].Add(1)
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() { _ = server.Serve(lis) }()
+		defer server.Stop()
+	}
+
+	flags := interceptors.NewMemoryFlags()
+	cfg := DefaultConfig()
+	cfg.Flags = flags
+	cfg.ConnectMode = ConnectModeWaitForReady
+	cfg.ContextDialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	}
+	cfg.Services = map[string]ServiceConfig{
+		"orders": {Address: "passthrough:///primary", CanaryAddress: "passthrough:///canary"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	ctx := context.Background()
+	primary, err := cm.GetConnection(ctx, "orders", "")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if conn, _ := cm.GetConnection(ctx, "orders", ""); conn != primary {
+		t.Error("Expected no calls to go to the canary with a zero weight")
+	}
+
+	// The weight flag sends every call to the canary once it is Ready.
+	flags.SetWeight("orders", interceptors.FlagCanaryWeight, 1)
+	var canary *grpc.ClientConn
+	waitFor(t, func() bool {
+		canary, _ = cm.GetConnection(ctx, "orders", "")
+		return canary != primary
+	})
+	if _, err := healthpb.NewHealthClient(canary).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check on the canary failed: %v", err)
+	}
+	if served["canary"].Load() != 1 || served["primary"].Load() != 0 {
+		t.Errorf("Expected the call to reach the canary, served %d by the canary and %d by the primary",
+			served["canary"].Load(), served["primary"].Load())
+	}
+
+	flags.SetWeight("orders", interceptors.FlagCanaryWeight, 0)
+	if conn, _ := cm.GetConnection(ctx, "orders", ""); conn != primary {
+		t.Error("Expected calls to go back to the primary once the weight is zero")
+	}
+
+	if err := cm.CloseConnection("orders"); err != nil {
+		t.Fatalf("CloseConnection failed: %v", err)
+	}
+	if state := canary.GetState(); state != connectivity.Shutdown {
+		t.Errorf("Expected CloseConnection to close the canary, got %v", state)
+	}
+
+	cfg.Services = map[string]ServiceConfig{"orders": {CanaryWeight: 2}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for a CanaryWeight above 1")
+	}
+}
+
+func TestConnectionManager_HedgingFlag(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	var calls atomic.Int32
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// Every other call hangs until it is canceled.
+		if calls.Add(1)%2 == 1 {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	flags := interceptors.NewMemoryFlags()
+	cfg := DefaultConfig()
+	cfg.Flags = flags
+	cfg.EnableRetry = false
+	cfg.ConnectMode = ConnectModeWaitForReady
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	cfg.Hedging = &interceptors.HedgingConfig{Methods: []string{"/grpc.health.v1.Health/*"}, Delay: 20 * time.Millisecond}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "orders", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	check := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	if err := check(); err != nil {
+		t.Errorf("Expected the hedged attempt to answer the call, got %v", err)
+	}
+	flags.Set("orders", interceptors.FlagHedging, false)
+	if err := check(); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected the call to hang with hedging turned off, got %v", err)
+	}
+}
+
+func TestConnectionManager_ContextDialer(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	var dialed atomic.Int32
+	cfg := DefaultConfig()
+	cfg.ContextDialer = func(ctx context.Context, _ string) (net.Conn, error) {
+		dialed.Add(1)
+		return lis.DialContext(ctx)
+	}
+	cfg.Services = map[string]ServiceConfig{
+		"refused": {ContextDialer: func(context.Context, string) (net.Conn, error) {
+			return nil, errors.New("refused")
+		}},
+	}
+	cfg.ConnectMode = ConnectModeWaitForReady
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "health", "passthrough:///bufnet")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+	if dialed.Load() == 0 {
+		t.Error("expected the connection to be made by ContextDialer")
+	}
+
+	refusedCtx, refusedCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer refusedCancel()
+	if _, err := cm.GetConnection(refusedCtx, "refused", "passthrough:///bufnet"); err == nil {
+		t.Error("expected the service's own ContextDialer to be used")
+	}
+}
+
+// startProxy serves a proxy that tunnels every connection to backend after handshake accepts it.
+func startProxy(t *testing.T, backend string, handshake func(conn net.Conn, r *bufio.Reader) bool) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if !handshake(conn, r) {
+					return
+				}
+				upstream, err := net.Dial("tcp", backend)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go func() { _, _ = io.Copy(upstream, r) }()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestConnectionManager_Proxy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	// The backend's name only resolves behind the proxies.
+	var targets sync.Map
+	httpProxy := startProxy(t, lis.Addr().String(), func(conn net.Conn, r *bufio.Reader) bool {
+		req, err := http.ReadRequest(r)
+		if err != nil || req.Method != http.MethodConnect {
+			return false
+		}
+		if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("egress:secret")) {
+			_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return false
+		}
+		targets.Store("http", req.Host)
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		return true
+	})
+	socksProxy := startProxy(t, lis.Addr().String(), func(conn net.Conn, r *bufio.Reader) bool {
+		read := func(n int) []byte {
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil
+			}
+			return b
+		}
+		// Method selection, username/password authentication and CONNECT to a domain name.
+		greeting := read(2)
+		if greeting == nil || read(int(greeting[1])) == nil {
+			return false
+		}
+		_, _ = conn.Write([]byte{5, 2})
+		auth := read(2)
+		user := read(int(auth[1]))
+		password := read(int(read(1)[0]))
+		if string(user) != "egress" || string(password) != "secret" {
+			_, _ = conn.Write([]byte{1, 1})
+			return false
+		}
+		_, _ = conn.Write([]byte{1, 0})
+		req := read(5)
+		host := read(int(req[4]))
+		port := read(2)
+		targets.Store("socks5", fmt.Sprintf("%s:%d", host, int(port[0])<<8|int(port[1])))
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		return true
+	})
+
+	cfg := DefaultConfig()
+	cfg.Services = map[string]ServiceConfig{
+		"http":     {Proxy: &ProxyConfig{URL: "http://egress:secret@" + httpProxy}},
+		"socks5":   {Proxy: &ProxyConfig{URL: "socks5://" + socksProxy, Username: "egress", Password: "secret"}},
+		"rejected": {Proxy: &ProxyConfig{URL: "http://" + httpProxy}},
+	}
+	cm, err := NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	for _, name := range []string{"http", "socks5"} {
+		conn, err := cm.GetConnection(context.Background(), name, "orders.internal:50051")
+		if err != nil {
+			t.Fatalf("GetConnection(%s) failed: %v", name, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("Check through the %s proxy failed: %v", name, err)
+		}
+		cancel()
+		if target, _ := targets.Load(name); target != "orders.internal:50051" {
+			t.Errorf("expected the %s proxy to be asked for orders.internal:50051, got %v", name, target)
+		}
+	}
+
+	conn, err := cm.GetConnection(context.Background(), "rejected", "orders.internal:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Error("expected calls to fail without proxy credentials")
+	}
+
+	cfg.Services = map[string]ServiceConfig{"ftp": {Proxy: &ProxyConfig{URL: "ftp://" + httpProxy}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an unsupported proxy scheme")
+	}
+}
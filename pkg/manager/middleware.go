@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// GetConnFunc has the signature of ConnectionManager.GetConnection.
+type GetConnFunc func(ctx context.Context, serviceName, address string) (*grpc.ClientConn, error)
+
+// CloseConnFunc has the signature of ConnectionManager.CloseConnection.
+type CloseConnFunc func(serviceName string) error
+
+// middlewareChain holds the GetConnection and CloseConnection handlers wrapped by middleware.
+// The wrapped handlers are read without locking; mu serializes Use and UseClose.
+type middlewareChain struct {
+	mu        sync.Mutex
+	baseGet   GetConnFunc
+	baseClose CloseConnFunc
+	getMW     []func(next GetConnFunc) GetConnFunc
+	closeMW   []func(next CloseConnFunc) CloseConnFunc
+	get       atomic.Pointer[GetConnFunc]
+	close     atomic.Pointer[CloseConnFunc]
+}
+
+func (c *middlewareChain) init(get GetConnFunc, closeConn CloseConnFunc) {
+	c.baseGet, c.baseClose = get, closeConn
+	c.get.Store(&get)
+	c.close.Store(&closeConn)
+}
+
+func (c *middlewareChain) getConn() GetConnFunc {
+	return *c.get.Load()
+}
+
+func (c *middlewareChain) closeConn() CloseConnFunc {
+	return *c.close.Load()
+}
+
+// Use wraps GetConnection with middleware, e.g. to rewrite addresses per tenant, audit connection
+// acquisition or inject faults in tests. Middleware runs in the order it was added: the first
+// middleware sees each call first and the last one calls the manager.
+func (cm *ConnectionManager) Use(mw ...func(next GetConnFunc) GetConnFunc) {
+	c := &cm.middleware
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.getMW = append(c.getMW, mw...)
+	get := c.baseGet
+	for i := len(c.getMW) - 1; i >= 0; i-- {
+		get = c.getMW[i](get)
+	}
+	c.get.Store(&get)
+}
+
+// UseClose wraps CloseConnection with middleware. Ordering is the same as for Use.
+func (cm *ConnectionManager) UseClose(mw ...func(next CloseConnFunc) CloseConnFunc) {
+	c := &cm.middleware
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closeMW = append(c.closeMW, mw...)
+	closeConn := c.baseClose
+	for i := len(c.closeMW) - 1; i >= 0; i-- {
+		closeConn = c.closeMW[i](closeConn)
+	}
+	c.close.Store(&closeConn)
+}
@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// healthMonitor holds the state of the background health monitor.
+type healthMonitor struct {
+	mu      sync.Mutex
+	started bool
+	last    map[string]ConnectionHealth
+	// failing holds the services that were in TransientFailure at the previous check.
+	failing map[string]bool
+}
+
+// StartHealthMonitor starts a background goroutine that runs HealthCheck every interval until the
+// manager is closed, updating connection state metrics. Connections found in TransientFailure on two
+// consecutive checks are closed and re-dialed, instead of waiting for the next GetConnection call.
+// Results of the latest check are available from LastHealthCheck.
+func (cm *ConnectionManager) StartHealthMonitor(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("health monitor interval must be greater than 0")
+	}
+
+	cm.monitor.mu.Lock()
+	defer cm.monitor.mu.Unlock()
+	if cm.monitor.started {
+		return errors.New("health monitor already started")
+	}
+	cm.monitor.started = true
+	cm.monitor.failing = make(map[string]bool)
+
+	cm.wg.Add(1)
+	go cm.runHealthMonitor(interval)
+	return nil
+}
+
+// LastHealthCheck returns the results of the health monitor's latest check, each with the time
+// it was taken in CheckedAt, or nil if no check has completed yet.
+func (cm *ConnectionManager) LastHealthCheck() map[string]ConnectionHealth {
+	cm.monitor.mu.Lock()
+	defer cm.monitor.mu.Unlock()
+
+	if cm.monitor.last == nil {
+		return nil
+	}
+	result := make(map[string]ConnectionHealth, len(cm.monitor.last))
+	for name, health := range cm.monitor.last {
+		result[name] = health
+	}
+	return result
+}
+
+func (cm *ConnectionManager) runHealthMonitor(interval time.Duration) {
+	defer cm.wg.Done()
+
+	ticker := cm.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.done:
+			return
+		case <-ticker.C():
+			cm.monitorOnce(interval)
+		}
+	}
+}
+
+// monitorOnce runs a single health check and re-dials connections stuck in TransientFailure.
+func (cm *ConnectionManager) monitorOnce(interval time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+
+	results := cm.HealthCheck(ctx)
+
+	cm.monitor.mu.Lock()
+	cm.monitor.last = results
+	var stuck []string
+	failing := make(map[string]bool)
+	for name, health := range results {
+		if health.State != connectivity.TransientFailure.String() {
+			continue
+		}
+		if cm.monitor.failing[name] {
+			stuck = append(stuck, name)
+		} else {
+			failing[name] = true
+		}
+	}
+	cm.monitor.failing = failing
+	cm.monitor.mu.Unlock()
+
+	for _, name := range stuck {
+		cm.serviceLogger(name).Warnf("Connection for %s is stuck in TransientFailure, reconnecting", name)
+		if _, err := cm.ResetConnection(ctx, name); err != nil {
+			cm.serviceLogger(name).Warnf("Failed to reconnect %s: %v", name, err)
+		}
+	}
+}
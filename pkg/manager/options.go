@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+	"maps"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Option configures a ConnectionManager created with New.
+type Option func(*options)
+
+type options struct {
+	config  *Config
+	metrics metrics.MetricsRecorder
+}
+
+// New creates a ConnectionManager from DefaultConfig() modified by opts, which are applied in order.
+// It is equivalent to building a Config and calling NewConnectionManager.
+func New(opts ...Option) (*ConnectionManager, error) {
+	o := &options{config: DefaultConfig()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return NewConnectionManager(o.config, o.metrics)
+}
+
+// WithConfig replaces the configuration with a copy of cfg. Options after it modify the copy,
+// so it should come first.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) {
+		c := *cfg
+		c.Services = maps.Clone(cfg.Services)
+		c.ExtraDialOptions = slices.Clip(cfg.ExtraDialOptions)
+		c.ExtraUnaryInterceptors = slices.Clip(cfg.ExtraUnaryInterceptors)
+		c.ExtraStreamInterceptors = slices.Clip(cfg.ExtraStreamInterceptors)
+		o.config = &c
+	}
+}
+
+// WithTLS sets the transport credentials used for all connections.
+func WithTLS(creds credentials.TransportCredentials) Option {
+	return func(o *options) {
+		o.config.TransportCredentials = creds
+	}
+}
+
+// WithPerRPCCredentials attaches creds to every call.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return func(o *options) {
+		o.config.PerRPCCredentials = creds
+	}
+}
+
+// WithAuth attaches bearer tokens from cfg.Provider to every call.
+func WithAuth(cfg *interceptors.AuthConfig) Option {
+	return func(o *options) {
+		o.config.Auth = cfg
+	}
+}
+
+// WithMetrics records metrics to m, e.g. a *metrics.Metrics for Prometheus, and enables metrics collection.
+func WithMetrics(m metrics.MetricsRecorder) Option {
+	return func(o *options) {
+		o.metrics = m
+		o.config.EnableMetrics = m != nil
+	}
+}
+
+// WithRetry enables retries using cfg. If cfg is nil, interceptors.DefaultRetryConfig() is used.
+func WithRetry(cfg *interceptors.RetryConfig) Option {
+	return func(o *options) {
+		o.config.EnableRetry = true
+		o.config.Retry = cfg
+	}
+}
+
+// WithoutRetry disables retries.
+func WithoutRetry() Option {
+	return func(o *options) {
+		o.config.EnableRetry = false
+	}
+}
+
+// WithCircuitBreaker enables circuit breaking using cfg.
+// If cfg is nil, interceptors.DefaultCircuitBreakerConfig() is used.
+func WithCircuitBreaker(cfg *interceptors.CircuitBreakerConfig) Option {
+	return func(o *options) {
+		o.config.EnableCircuitBreaker = true
+		o.config.CircuitBreaker = cfg
+	}
+}
+
+// WithoutCircuitBreaker disables circuit breaking.
+func WithoutCircuitBreaker() Option {
+	return func(o *options) {
+		o.config.EnableCircuitBreaker = false
+	}
+}
+
+// WithLogger routes the manager's and interceptors' logs to l.
+func WithLogger(l logger.Logger) Option {
+	return func(o *options) {
+		o.config.Logger = l
+	}
+}
+
+// WithClock sets the clock used by time-based components.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.config.Clock = c
+	}
+}
+
+// WithDialOptions appends opts to Config.ExtraDialOptions.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.config.ExtraDialOptions = append(o.config.ExtraDialOptions, opts...)
+	}
+}
+
+// WithUnaryInterceptors appends interceptors to Config.ExtraUnaryInterceptors.
+func WithUnaryInterceptors(unary ...grpc.UnaryClientInterceptor) Option {
+	return func(o *options) {
+		o.config.ExtraUnaryInterceptors = append(o.config.ExtraUnaryInterceptors, unary...)
+	}
+}
+
+// WithStreamInterceptors appends interceptors to Config.ExtraStreamInterceptors.
+func WithStreamInterceptors(stream ...grpc.StreamClientInterceptor) Option {
+	return func(o *options) {
+		o.config.ExtraStreamInterceptors = append(o.config.ExtraStreamInterceptors, stream...)
+	}
+}
+
+// WithService sets the per-service overrides for the named service.
+func WithService(name string, sc ServiceConfig) Option {
+	return func(o *options) {
+		if o.config.Services == nil {
+			o.config.Services = make(map[string]ServiceConfig)
+		}
+		o.config.Services[name] = sc
+	}
+}
@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OutlierDetectionConfig enables ejecting pooled connections that fail or respond much more
+// slowly than the rest of their pool, similar to Envoy's outlier detection. It has no effect
+// unless PoolSize is greater than 1.
+type OutlierDetectionConfig struct {
+	// Interval is how often the connections of a pool are evaluated (default: 10s)
+	Interval time.Duration
+	// FailureRateThreshold ejects a connection when this share of its calls in an interval fail (default: 0.5)
+	FailureRateThreshold float64
+	// LatencyFactor ejects a connection whose mean latency in an interval is more than this many
+	// times the median of the pool. Zero disables latency-based ejection (default: 0)
+	LatencyFactor float64
+	// MinimumRequests is the number of calls a connection must make in an interval to be evaluated (default: 10)
+	MinimumRequests int
+	// FailureCodes are the status codes counted as failures
+	// (default: Unavailable, DeadlineExceeded, Internal, Unknown)
+	FailureCodes []codes.Code
+	// BaseEjectionTime is how long a connection is ejected the first time. Each further ejection
+	// adds another BaseEjectionTime, and every healthy interval takes one away again (default: 30s)
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the ejection time (default: 5m)
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent is the largest share of a pool that may be ejected at once. At least one
+	// connection always stays in rotation (default: 50)
+	MaxEjectionPercent int
+	// RampUp is how long a re-admitted connection takes to get back its full share of traffic,
+	// rising linearly from none (default: 10s)
+	RampUp time.Duration
+}
+
+// DefaultOutlierDetectionConfig returns an OutlierDetectionConfig with sensible defaults.
+func DefaultOutlierDetectionConfig() *OutlierDetectionConfig {
+	return &OutlierDetectionConfig{
+		Interval:             10 * time.Second,
+		FailureRateThreshold: 0.5,
+		MinimumRequests:      10,
+		FailureCodes:         []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown},
+		BaseEjectionTime:     30 * time.Second,
+		MaxEjectionTime:      5 * time.Minute,
+		MaxEjectionPercent:   50,
+		RampUp:               10 * time.Second,
+	}
+}
+
+// connOutlierStats holds the outcomes of one pooled connection's calls.
+type connOutlierStats struct {
+	total    int
+	failures int
+	latency  time.Duration
+
+	// ejections grows with every ejection and shrinks with every healthy interval
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// outlierDetector tracks the calls of every connection in a service's pool and decides which
+// are in rotation. It outlives the pool, like the service's rate limiter and bulkhead.
+type outlierDetector struct {
+	serviceName string
+	cfg         *OutlierDetectionConfig
+	clock       clock.Clock
+	metrics     metrics.MetricsRecorder
+
+	mu        sync.Mutex
+	stats     map[*grpc.ClientConn]*connOutlierStats
+	evaluated time.Time
+}
+
+func newOutlierDetector(serviceName string, cfg *OutlierDetectionConfig, clk clock.Clock, m metrics.MetricsRecorder) *outlierDetector {
+	return &outlierDetector{
+		serviceName: serviceName,
+		cfg:         cfg,
+		clock:       clock.OrReal(clk),
+		metrics:     m,
+		stats:       make(map[*grpc.ClientConn]*connOutlierStats),
+	}
+}
+
+// connStats returns the stats for conn, creating them on first use. Must be called with d.mu held.
+func (d *outlierDetector) connStats(conn *grpc.ClientConn) *connOutlierStats {
+	s := d.stats[conn]
+	if s == nil {
+		s = &connOutlierStats{}
+		d.stats[conn] = s
+	}
+	return s
+}
+
+func (d *outlierDetector) record(conn *grpc.ClientConn, err error, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.connStats(conn)
+	s.total++
+	s.latency += latency
+	if err != nil && slices.Contains(d.cfg.FailureCodes, status.Code(err)) {
+		s.failures++
+	}
+}
+
+// forget drops the stats of connections that are no longer pooled.
+func (d *outlierDetector) forget(conns []*grpc.ClientConn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range conns {
+		delete(d.stats, conn)
+	}
+}
+
+// admit reports whether conn may receive the next call at now, evaluating the pool first if an
+// interval has passed. A connection ramping up after re-admission is admitted with a probability
+// growing over RampUp.
+func (d *outlierDetector) admit(conns []*grpc.ClientConn, conn *grpc.ClientConn, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.evaluated.IsZero() {
+		d.evaluated = now
+	} else if now.Sub(d.evaluated) >= d.cfg.Interval {
+		d.evaluate(conns, now)
+		d.evaluated = now
+	}
+
+	s := d.connStats(conn)
+	if now.Before(s.ejectedUntil) {
+		return false
+	}
+	if since := now.Sub(s.ejectedUntil); !s.ejectedUntil.IsZero() && since < d.cfg.RampUp {
+		return rand.Float64() < float64(since)/float64(d.cfg.RampUp)
+	}
+	return true
+}
+
+// evaluate ejects the outliers among conns based on the calls since the last evaluation and
+// starts a new interval. Must be called with d.mu held.
+func (d *outlierDetector) evaluate(conns []*grpc.ClientConn, now time.Time) {
+	ejected := 0
+	var latencies []time.Duration
+	for _, conn := range conns {
+		s := d.connStats(conn)
+		if now.Before(s.ejectedUntil) {
+			ejected++
+		}
+		if s.total >= d.cfg.MinimumRequests && s.total > 0 {
+			latencies = append(latencies, s.latency/time.Duration(s.total))
+		}
+	}
+	var median time.Duration
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		median = latencies[len(latencies)/2]
+	}
+	maxEjected := min(len(conns)*d.cfg.MaxEjectionPercent/100, len(conns)-1)
+
+	for _, conn := range conns {
+		s := d.connStats(conn)
+		if !now.Before(s.ejectedUntil) && s.total >= d.cfg.MinimumRequests && s.total > 0 {
+			failing := float64(s.failures)/float64(s.total) >= d.cfg.FailureRateThreshold
+			slow := d.cfg.LatencyFactor > 0 && median > 0 &&
+				float64(s.latency/time.Duration(s.total)) > d.cfg.LatencyFactor*float64(median)
+			switch {
+			case (failing || slow) && ejected < maxEjected:
+				s.ejections++
+				s.ejectedUntil = now.Add(min(d.cfg.BaseEjectionTime*time.Duration(s.ejections), d.cfg.MaxEjectionTime))
+				ejected++
+				if d.metrics != nil {
+					d.metrics.IncrementOutlierEjection(d.serviceName)
+				}
+			case !failing && !slow && s.ejections > 0:
+				s.ejections--
+			}
+		}
+		s.total, s.failures, s.latency = 0, 0, 0
+	}
+}
+
+func (d *outlierDetector) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := d.clock.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		d.record(cc, err, d.clock.Since(start))
+		return err
+	}
+}
+
+// streamInterceptor records whether streams could be created; how long they run says nothing
+// about the connection.
+func (d *outlierDetector) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := d.clock.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		d.record(cc, err, d.clock.Since(start))
+		return stream, err
+	}
+}
+
+// outlierDetector returns the service's outlier detector, or nil if outlier detection is
+// disabled. Must be called with cm.mu held.
+func (cm *ConnectionManager) outlierDetector(serviceName string) *outlierDetector {
+	if cm.config().OutlierDetection == nil || cm.config().PoolSize <= 1 {
+		return nil
+	}
+	if d := cm.outliers[serviceName]; d != nil {
+		return d
+	}
+	d := newOutlierDetector(serviceName, cm.config().OutlierDetection, cm.clock, cm.metrics)
+	cm.outliers[serviceName] = d
+	return d
+}
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// connPool holds the connections of a service with PoolSize > 1. conns[0] is the service's
+// primary connection in cm.connections; the others are additional connections to the same address.
+type connPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+	// outliers takes ejected connections out of rotation, if outlier detection is enabled
+	outliers *outlierDetector
+	// strategy chooses among the usable connections using their loads, which are nil for
+	// PoolStrategyRoundRobin
+	strategy PoolStrategy
+	loads    *poolLoad
+}
+
+// pick returns a usable connection chosen by the pool's strategy, or nil if none is usable.
+// Connections ejected by outlier detection are skipped unless no other connection is usable.
+func (p *connPool) pick(now time.Time) *grpc.ClientConn {
+	if p.loads == nil {
+		n := uint64(len(p.conns))
+		start := p.next.Add(1)
+		var fallback *grpc.ClientConn
+		for i := uint64(0); i < n; i++ {
+			conn := p.conns[(start+i)%n]
+			if state := conn.GetState(); state != connectivity.Ready && state != connectivity.Idle {
+				continue
+			}
+			if p.outliers == nil || p.outliers.admit(p.conns, conn, now) {
+				return conn
+			}
+			if fallback == nil {
+				fallback = conn
+			}
+		}
+		return fallback
+	}
+
+	candidates := p.usable(now)
+	if len(candidates) <= 1 {
+		if len(candidates) == 0 {
+			return nil
+		}
+		return candidates[0]
+	}
+	switch p.strategy {
+	case PoolStrategyLeastRequest:
+		return p.leastRequest(candidates)
+	case PoolStrategyLatency:
+		return p.fastest(candidates)
+	default:
+		i := rand.IntN(len(candidates))
+		j := rand.IntN(len(candidates) - 1)
+		if j >= i {
+			j++
+		}
+		return p.leastRequest([]*grpc.ClientConn{candidates[i], candidates[j]})
+	}
+}
+
+// usable returns the connections that may receive the next call, starting from the next one in
+// round-robin order so that ties between them rotate; or the first one usable but ejected by
+// outlier detection if there are none.
+func (p *connPool) usable(now time.Time) []*grpc.ClientConn {
+	n := uint64(len(p.conns))
+	start := p.next.Add(1)
+	candidates := make([]*grpc.ClientConn, 0, n)
+	var fallback *grpc.ClientConn
+	for i := uint64(0); i < n; i++ {
+		conn := p.conns[(start+i)%n]
+		if state := conn.GetState(); state != connectivity.Ready && state != connectivity.Idle {
+			continue
+		}
+		if p.outliers == nil || p.outliers.admit(p.conns, conn, now) {
+			candidates = append(candidates, conn)
+		} else if fallback == nil {
+			fallback = conn
+		}
+	}
+	if len(candidates) == 0 && fallback != nil {
+		candidates = append(candidates, fallback)
+	}
+	return candidates
+}
+
+// leastRequest returns the first of candidates with the fewest calls in flight.
+func (p *connPool) leastRequest(candidates []*grpc.ClientConn) *grpc.ClientConn {
+	best, fewest := candidates[0], p.loads.conn(candidates[0]).inflight.Load()
+	for _, conn := range candidates[1:] {
+		if n := p.loads.conn(conn).inflight.Load(); n < fewest {
+			best, fewest = conn, n
+		}
+	}
+	return best
+}
+
+// fastest picks one of candidates at random with a probability proportional to the inverse of
+// its EWMA latency times one more than its calls in flight. Connections without a measured
+// latency are assumed to be as fast as the fastest one, so that new connections get calls.
+func (p *connPool) fastest(candidates []*grpc.ClientConn) *grpc.ClientConn {
+	loads := make([]*connLoad, len(candidates))
+	fastest := 0.0
+	for i, conn := range candidates {
+		loads[i] = p.loads.conn(conn)
+		if l := loads[i].latency(); l > 0 && (fastest == 0 || l < fastest) {
+			fastest = l
+		}
+	}
+	if fastest == 0 {
+		fastest = 1
+	}
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, load := range loads {
+		l := load.latency()
+		if l == 0 {
+			l = fastest
+		}
+		weights[i] = 1 / (l * float64(load.inflight.Load()+1))
+		total += weights[i]
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r -= w; r < 0 {
+			return candidates[i]
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// latencyEWMAWeight is the weight of each unary call's latency in its connection's average.
+const latencyEWMAWeight = 0.2
+
+// connLoad is the load on one pooled connection.
+type connLoad struct {
+	inflight atomic.Int64
+	ewma     atomic.Uint64 // math.Float64bits of the latency in nanoseconds, 0 before the first call
+}
+
+func (l *connLoad) latency() float64 {
+	return math.Float64frombits(l.ewma.Load())
+}
+
+func (l *connLoad) observe(latency time.Duration) {
+	for {
+		old := l.ewma.Load()
+		avg := float64(latency)
+		if old != 0 {
+			avg = latencyEWMAWeight*avg + (1-latencyEWMAWeight)*math.Float64frombits(old)
+		}
+		if l.ewma.CompareAndSwap(old, math.Float64bits(avg)) {
+			return
+		}
+	}
+}
+
+// poolLoad tracks the load on every connection in a service's pool for pool strategies other
+// than round-robin. Like outlierDetector it outlives the pool.
+type poolLoad struct {
+	conns sync.Map // *grpc.ClientConn -> *connLoad
+}
+
+// conn returns the load on conn, creating it on first use.
+func (p *poolLoad) conn(conn *grpc.ClientConn) *connLoad {
+	if l, ok := p.conns.Load(conn); ok {
+		return l.(*connLoad)
+	}
+	l, _ := p.conns.LoadOrStore(conn, &connLoad{})
+	return l.(*connLoad)
+}
+
+// forget drops the loads of connections that are no longer pooled.
+func (p *poolLoad) forget(conns []*grpc.ClientConn) {
+	for _, conn := range conns {
+		p.conns.Delete(conn)
+	}
+}
+
+func (p *poolLoad) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		load := p.conn(cc)
+		load.inflight.Add(1)
+		defer load.inflight.Add(-1)
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		load.observe(time.Since(start))
+		return err
+	}
+}
+
+// streamInterceptor counts a stream as in flight until its context is done. Stream durations are
+// not latencies, so they are left out of the average.
+func (p *poolLoad) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		load := p.conn(cc)
+		load.inflight.Add(1)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			load.inflight.Add(-1)
+			return nil, err
+		}
+		context.AfterFunc(stream.Context(), func() { load.inflight.Add(-1) })
+		return stream, nil
+	}
+}
+
+// poolLoad returns the service's pool load tracker, or nil if its pool is picked round-robin.
+// Must be called with cm.mu held.
+func (cm *ConnectionManager) poolLoad(serviceName string) *poolLoad {
+	if cm.config().PoolStrategy == PoolStrategyRoundRobin || cm.config().PoolSize <= 1 {
+		return nil
+	}
+	if l := cm.loads[serviceName]; l != nil {
+		return l
+	}
+	l := &poolLoad{}
+	cm.loads[serviceName] = l
+	return l
+}
+
+// closeExtras closes every connection in the pool except the primary.
+func (p *connPool) closeExtras() {
+	for _, conn := range p.conns[1:] {
+		_ = conn.Close()
+	}
+}
+
+// fillPool dials the additional pooled connections for a service whose primary was just created.
+// Connections that fail to dial are skipped, leaving a smaller pool. Must be called with cm.mu held.
+func (cm *ConnectionManager) fillPool(ctx context.Context, serviceName string, primary *grpc.ClientConn, address string) {
+	if cm.config().PoolSize <= 1 {
+		return
+	}
+
+	pool := &connPool{
+		conns:    []*grpc.ClientConn{primary},
+		outliers: cm.outlierDetector(serviceName),
+		strategy: cm.config().PoolStrategy,
+		loads:    cm.poolLoad(serviceName),
+	}
+	for i := 1; i < cm.config().PoolSize; i++ {
+		conn, err := cm.createConnection(ctx, address, serviceName)
+		if err != nil {
+			cm.serviceLogger(serviceName).Warnf("Failed to create pooled connection %d for %s: %v", i, serviceName, err)
+			continue
+		}
+		pool.conns = append(pool.conns, conn)
+	}
+	cm.pools[serviceName] = pool
+}
+
+// dropConnection closes and removes the service's primary connection and any pooled connections,
+// returning the error from closing the primary. Must be called with cm.mu held.
+func (cm *ConnectionManager) dropConnection(serviceName string) error {
+	if pool := cm.pools[serviceName]; pool != nil {
+		pool.closeExtras()
+		if pool.outliers != nil {
+			pool.outliers.forget(pool.conns)
+		}
+		if pool.loads != nil {
+			pool.loads.forget(pool.conns)
+		}
+		delete(cm.pools, serviceName)
+	}
+
+	conn := cm.connections[serviceName]
+	delete(cm.connections, serviceName)
+	cm.publish(serviceName)
+	if conn != nil {
+		cm.connClosed(serviceName)
+		return conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/begenov/grpc-connection-manager/pkg/dnscache"
+)
+
+// ProxyConfig routes a service's connections through an egress proxy. The proxy is given the
+// service's host name, so names that only resolve behind the proxy can be dialed.
+type ProxyConfig struct {
+	// URL is the proxy: "http://host:port" or "https://host:port" for an HTTP CONNECT proxy, or
+	// "socks5://host:port" for a SOCKS5 proxy. Credentials may be given as "user:password@"
+	URL string
+	// Username authenticates to the proxy, taking precedence over the URL's (default: "", none)
+	Username string
+	// Password is Username's password
+	Password string
+	// TLSConfig is used to connect to an https proxy (default: nil, system roots)
+	TLSConfig *tls.Config
+}
+
+// validateProxy checks the proxy URL, which is nil if there is no proxy.
+func validateProxy(cfg *ProxyConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("URL scheme %q is not http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL %q has no host", cfg.URL)
+	}
+	return nil
+}
+
+// credentials returns the username and password to authenticate with, and whether there are any.
+func (cfg *ProxyConfig) credentials(u *url.URL) (string, string, bool) {
+	if cfg.Username != "" {
+		return cfg.Username, cfg.Password, true
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		return u.User.Username(), password, true
+	}
+	return "", "", false
+}
+
+// resolvesAtProxy reports whether the host name in address is left to the service's proxy to
+// resolve, as it may not resolve here. Addresses with a scheme are resolved as usual.
+func (cm *ConnectionManager) resolvesAtProxy(serviceName, address string) bool {
+	return cm.config().Services[serviceName].Proxy != nil && dnscache.Target(address) != address
+}
+
+// contextDialer is the signature of Config.ContextDialer.
+type contextDialer = func(ctx context.Context, address string) (net.Conn, error)
+
+// dialer returns the dialer for the service's connections: its ContextDialer, through its proxy
+// if it has one. It returns nil to use gRPC's dialer.
+func (c *Config) dialer(serviceName string) (contextDialer, error) {
+	base := c.contextDialer(serviceName)
+	cfg := c.Services[serviceName].Proxy
+	if cfg == nil {
+		return base, nil
+	}
+	if base == nil {
+		var d net.Dialer
+		base = func(ctx context.Context, address string) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", address)
+		}
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Scheme == "socks5" {
+		return socks5Dialer(cfg, u, base)
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		return connectProxy(ctx, cfg, u, base, address)
+	}, nil
+}
+
+// forwardDialer lets the SOCKS5 dialer reach the proxy through another dialer.
+type forwardDialer contextDialer
+
+func (d forwardDialer) Dial(network, address string) (net.Conn, error) {
+	return d(context.Background(), address)
+}
+
+func (d forwardDialer) DialContext(ctx context.Context, _, address string) (net.Conn, error) {
+	return d(ctx, address)
+}
+
+func socks5Dialer(cfg *ProxyConfig, u *url.URL, base contextDialer) (contextDialer, error) {
+	var auth *proxy.Auth
+	if user, password, ok := cfg.credentials(u); ok {
+		auth = &proxy.Auth{User: user, Password: password}
+	}
+	d, err := proxy.SOCKS5("tcp", u.Host, auth, forwardDialer(base))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
+	}
+	socks := d.(proxy.ContextDialer)
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		conn, err := socks.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("SOCKS5 proxy %s: %w", u.Host, err)
+		}
+		return conn, nil
+	}, nil
+}
+
+// connectProxy opens a tunnel to address through an HTTP CONNECT proxy.
+func connectProxy(ctx context.Context, cfg *ProxyConfig, u *url.URL, base contextDialer, address string) (_ net.Conn, err error) {
+	conn, err := base(ctx, u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %w", u.Host, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	if u.Scheme == "https" {
+		tlsCfg := &tls.Config{}
+		if cfg.TLSConfig != nil {
+			tlsCfg = cfg.TLSConfig.Clone()
+		}
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsCfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("TLS handshake with proxy %s failed: %w", u.Host, err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user, password, ok := cfg.credentials(u); ok {
+		req.SetBasicAuth(user, password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to write CONNECT to proxy %s: %w", u.Host, err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy %s: %w", u.Host, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy %s refused CONNECT to %s: %s", u.Host, address, resp.Status)
+	}
+	if r.Buffered() > 0 {
+		// The server may have spoken first, e.g. its HTTP/2 settings.
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what was buffered while reading the CONNECT response before reading from
+// the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
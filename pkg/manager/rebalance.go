@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// rebalanceJitter is the fraction by which RebalanceInterval is randomized for each connection, so
+// that connections dialed together, e.g. by WarmUp, are not all replaced at once.
+const rebalanceJitter = 0.1
+
+// rebalanceAt returns when a connection created at created is due to be replaced, or the zero time
+// if RebalanceInterval is not set.
+func (c *Config) rebalanceAt(created time.Time) time.Time {
+	if c.RebalanceInterval <= 0 {
+		return time.Time{}
+	}
+	jitter := time.Duration((rand.Float64()*2 - 1) * rebalanceJitter * float64(c.RebalanceInterval))
+	return created.Add(c.RebalanceInterval + jitter)
+}
+
+// rebalance replaces the service's connection old by a new one to the same address, so that
+// connections pinned to one backend behind an L4 load balancer spread over its backends over
+// time. The new connection is installed once it is Ready and old is retired like after
+// MaxConnectionAge, staying open for MaxConnectionAgeGrace to let its calls in flight finish. If
+// the new connection does not become Ready, old is kept and tried again after another
+// RebalanceInterval.
+func (cm *ConnectionManager) rebalance(serviceName string, old *grpc.ClientConn) {
+	defer cm.wg.Done()
+
+	cm.mu.RLock()
+	address, dialedAddress := cm.addresses[serviceName], cm.dialed[serviceName]
+	cm.mu.RUnlock()
+	if dialedAddress == "" {
+		dialedAddress = address
+	}
+
+	conn, err := cm.createConnectionUnlocked(cm.ctx, dialedAddress, serviceName)
+	if err == nil {
+		err = waitForReady(cm.ctx, conn, cm.config().MinConnectTimeout)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	now := cm.clock.Now()
+	if err != nil || cm.connections[serviceName] != old || cm.ctx.Err() != nil {
+		if conn != nil {
+			delete(cm.usage, conn)
+			_ = conn.Close()
+		}
+		if err != nil && cm.ctx.Err() == nil {
+			cm.serviceLogger(serviceName).Warnf("Failed to rebalance %s, keeping its connection: %v", serviceName, err)
+			if usage := cm.usage[old]; usage != nil && cm.connections[serviceName] == old {
+				usage.rebalanceAt = cm.config().rebalanceAt(now)
+			}
+		}
+		return
+	}
+
+	conns := []*grpc.ClientConn{old}
+	if pool := cm.pools[serviceName]; pool != nil {
+		conns = pool.conns
+	}
+	cm.retire(serviceName, conns, now)
+	cm.serviceLogger(serviceName).Infof("Rebalanced gRPC connection for service: %s", serviceName)
+	cm.installConnection(cm.ctx, serviceName, address, dialedAddress, conn)
+}
@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/begenov/grpc-connection-manager/pkg/dnscache"
+)
+
+// lookupHost resolves host names for ResolveInterval. Tests replace it.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// dnsHost returns the host name in address if it is resolved through DNS: a host:port without a
+// scheme, or a dns target. IP addresses and targets with other schemes, such as unix sockets, are
+// not.
+func dnsHost(address string) (string, bool) {
+	endpoint := address
+	if scheme, rest, ok := strings.Cut(address, "://"); ok {
+		if scheme != "dns" {
+			return "", false
+		}
+		// Skip the authority, which names the DNS server to use.
+		_, endpoint, _ = strings.Cut(rest, "/")
+	} else if strings.HasPrefix(address, "unix:") || strings.HasPrefix(address, "unix-abstract:") {
+		return "", false
+	}
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		host = endpoint
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return "", false
+	}
+	return host, true
+}
+
+// Refresh makes the service's connections pick up the current DNS records of its address, e.g. when
+// the pods behind a headless Kubernetes service have changed. With DNSCache the cached records are
+// expired and the connections' resolvers look them up again; otherwise the service is dialed again,
+// since gRPC's own resolvers cannot be asked to re-resolve. A service without a connection is left
+// alone, as the next GetConnection resolves its address anyway.
+func (cm *ConnectionManager) Refresh(serviceName string) error {
+	cm.mu.RLock()
+	_, registered := cm.addresses[serviceName]
+	address, connected := cm.dialed[serviceName], cm.connections[serviceName] != nil
+	cm.mu.RUnlock()
+
+	if !registered {
+		return fmt.Errorf("service %s not registered", serviceName)
+	}
+	if !connected {
+		return nil
+	}
+	if host, ok := dnsHost(address); ok && cm.cachesDNS(serviceName, address) {
+		cm.resolver.ResolveNow(host)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(cm.ctx, cm.config().MinConnectTimeout)
+	defer cancel()
+	_, err := cm.ResetConnection(ctx, serviceName)
+	return err
+}
+
+// cachesDNS reports whether the service's connections to address use the DNSCache resolver.
+func (cm *ConnectionManager) cachesDNS(serviceName, address string) bool {
+	return cm.resolver != nil && dnscache.Target(address) != address && !cm.resolvesAtProxy(serviceName, address)
+}
+
+func (cm *ConnectionManager) runResolveLoop() {
+	defer cm.wg.Done()
+
+	ticker := cm.clock.NewTicker(cm.config().ResolveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.done:
+			return
+		case <-ticker.C():
+			cm.refreshAddresses()
+		}
+	}
+}
+
+// refreshAddresses re-resolves the DNS-backed addresses of connected services. Services using
+// DNSCache are refreshed every time; the others are dialed again only when their host resolves to
+// different IPs than the last time. Host names resolved by a service's proxy are left alone.
+func (cm *ConnectionManager) refreshAddresses() {
+	cm.mu.RLock()
+	dialed := maps.Clone(cm.dialed)
+	cm.mu.RUnlock()
+
+	for name, address := range dialed {
+		host, ok := dnsHost(address)
+		if !ok || cm.resolvesAtProxy(name, address) {
+			continue
+		}
+		if cm.cachesDNS(name, address) {
+			cm.resolver.ResolveNow(host)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(cm.ctx, cm.config().MinConnectTimeout)
+		ips, err := lookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			cm.serviceLogger(name).Warnf("Failed to resolve %s for %s: %v", host, name, err)
+			continue
+		}
+		slices.Sort(ips)
+
+		cm.mu.Lock()
+		last, seen := cm.resolved[name]
+		cm.resolved[name] = ips
+		cm.mu.Unlock()
+
+		if seen && !slices.Equal(last, ips) {
+			cm.serviceLogger(name).Infof("%s now resolves to %v, reconnecting %s", host, ips, name)
+			if err := cm.Refresh(name); err != nil {
+				cm.serviceLogger(name).Warnf("Failed to reconnect %s: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// registryFetchTimeout bounds each registry fetch.
+const registryFetchTimeout = 10 * time.Second
+
+// RegistrySource fetches the service-to-address registry from a central config service.
+type RegistrySource interface {
+	// Fetch returns the registry and its version. version is the version returned by the
+	// previous fetch (empty on the first call); if the registry is unchanged the source
+	// returns a nil map and the same version.
+	Fetch(ctx context.Context, version string) (map[string]string, string, error)
+}
+
+// HTTPRegistrySource fetches the registry as a JSON object mapping service names to addresses.
+// The ETag response header is used as the version and sent back as If-None-Match.
+type HTTPRegistrySource struct {
+	// URL is the registry endpoint
+	URL string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used
+	Client *http.Client
+}
+
+// Fetch implements RegistrySource.
+func (s *HTTPRegistrySource) Fetch(ctx context.Context, version string) (map[string]string, string, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if version != "" {
+		req.Header.Set("If-None-Match", version)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, version, nil
+	case http.StatusOK:
+	default:
+		return nil, "", fmt.Errorf("registry returned status %d", resp.StatusCode)
+	}
+
+	var registry map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&registry); err != nil {
+		return nil, "", fmt.Errorf("failed to decode registry: %w", err)
+	}
+	return registry, resp.Header.Get("ETag"), nil
+}
+
+// syncRegistry fetches the registry once and applies any changes.
+func (cm *ConnectionManager) syncRegistry() error {
+	ctx, cancel := context.WithTimeout(context.Background(), registryFetchTimeout)
+	defer cancel()
+
+	registry, version, err := cm.config().Registry.Fetch(ctx, cm.registryVersion)
+	if err != nil {
+		return err
+	}
+	cm.registryVersion = version
+	if registry == nil {
+		return nil
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for name, address := range registry {
+		if cm.addresses[name] == address {
+			continue
+		}
+		cm.addresses[name] = address
+		cm.publish(name)
+
+		// Drop the existing connection so the next GetConnection dials the new address.
+		if cm.connections[name] != nil {
+			cm.serviceLogger(name).Infof("Registry address changed for %s, reconnecting to %s", name, address)
+			_ = cm.dropConnection(name)
+		}
+	}
+	return nil
+}
+
+// runRegistrySync refreshes the registry every RegistryRefreshInterval until the manager is closed.
+func (cm *ConnectionManager) runRegistrySync() {
+	defer cm.wg.Done()
+
+	ticker := cm.clock.NewTicker(cm.config().RegistryRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.done:
+			return
+		case <-ticker.C():
+			if err := cm.syncRegistry(); err != nil {
+				cm.logger.Warnf("Failed to refresh service registry: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+	"github.com/begenov/grpc-connection-manager/pkg/metrics"
+
+	"google.golang.org/grpc"
+)
+
+// retrier holds a service's retry interceptors behind an indirection, so that connections that are
+// already dialed pick up new retry settings.
+type retrier struct {
+	unary  atomic.Pointer[grpc.UnaryClientInterceptor]
+	stream atomic.Pointer[grpc.StreamClientInterceptor]
+}
+
+// update replaces the interceptors with ones using cfg. Calls that are already retrying finish
+// with the old settings.
+func (r *retrier) update(cfg *interceptors.RetryConfig, serviceName string, m metrics.MetricsRecorder) {
+	unary := interceptors.RetryInterceptor(cfg, serviceName, m)
+	stream := interceptors.RetryStreamInterceptor(cfg, serviceName, m)
+	r.unary.Store(&unary)
+	r.stream.Store(&stream)
+}
+
+func (r *retrier) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return (*r.unary.Load())(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+func (r *retrier) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return (*r.stream.Load())(ctx, desc, cc, method, streamer, opts...)
+	}
+}
+
+// dialedConfig returns the parts of c that a connection to the service is built from when it is
+// dialed: its dial options, the interceptors in its chain and the limiters and breakers they share.
+// Retry settings, retry budgets and circuit breaker thresholds are left out, since ApplyConfig
+// updates them in place, as are settings that are read on every use.
+func (c *Config) dialedConfig(serviceName string) Config {
+	d := *c
+	d.Retry, d.RetryBudget = nil, nil
+	d.ConnectMode, d.PreconnectOnRegister = ConnectModeLazy, false
+	d.HealthCheck, d.Pushgateway = nil, nil
+	d.AdminListenAddr, d.ChannelzListenAddr = "", ""
+	d.MaxConnectionAgeGrace = 0
+
+	cb := c.circuitBreaker()
+	cb.FailureThreshold, cb.SuccessThreshold, cb.MaxHalfOpenRequests = 0, 0, 0
+	cb.Timeout, cb.RetryableCodes = 0, nil
+	d.CircuitBreaker = cb
+
+	sc := c.Services[serviceName]
+	sc.Address, sc.LatencySLO, sc.RetryBudget, sc.HealthCheckService = "", 0, nil, ""
+	sc.CanaryWeight = 0
+	d.Services = map[string]ServiceConfig{serviceName: sc}
+	return d
+}
+
+// configEqual reports whether a and b are deeply equal, as reflect.DeepEqual does, except that
+// funcs are equal when they are the same function. reflect.DeepEqual never considers non-nil funcs
+// equal, so a configuration with interceptors, a dialer or callbacks would always look changed.
+// Funcs are compared by their code, so a closure replaced by another made from the same function
+// literal does not count as a change.
+func configEqual[T any](a, b T) bool {
+	return valuesEqual(reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem(), make(map[visit]bool))
+}
+
+// visit is a pair of pointers already being compared, to stop at cycles.
+type visit struct {
+	a, b unsafe.Pointer
+	typ  reflect.Type
+}
+
+func valuesEqual(a, b reflect.Value, visited map[visit]bool) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		if a.UnsafePointer() == b.UnsafePointer() && (a.Kind() != reflect.Slice || a.Len() == b.Len()) {
+			return true
+		}
+		v := visit{a.UnsafePointer(), b.UnsafePointer(), a.Type()}
+		if visited[v] {
+			return true
+		}
+		visited[v] = true
+	}
+
+	switch a.Kind() {
+	case reflect.Func:
+		return a.Pointer() == b.Pointer()
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return valuesEqual(a.Elem(), b.Elem(), visited)
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := range a.Len() {
+			if !valuesEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for iter := a.MapRange(); iter.Next(); {
+			if !valuesEqual(iter.Value(), b.MapIndex(iter.Key()), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := range a.NumField() {
+			if !valuesEqual(a.Field(i), b.Field(i), visited) {
+				return false
+			}
+		}
+		return true
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.UnsafePointer() == b.UnsafePointer()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	}
+	return false
+}
+
+// Config returns a copy of the manager's current configuration, e.g. to change and pass to
+// ApplyConfig. Its Services and sections such as Retry and CircuitBreaker are copies too, so they
+// may be modified; lists and maps within the sections are shared and must be replaced instead.
+func (cm *ConnectionManager) Config() *Config {
+	cfg := *cm.config()
+	cfg.Services = maps.Clone(cfg.Services)
+	cfg.Retry = clonePtr(cfg.Retry)
+	cfg.RetryBudget = clonePtr(cfg.RetryBudget)
+	cfg.CircuitBreaker = clonePtr(cfg.CircuitBreaker)
+	cfg.RateLimit = clonePtr(cfg.RateLimit)
+	cfg.Bulkhead = clonePtr(cfg.Bulkhead)
+	cfg.OutlierDetection = clonePtr(cfg.OutlierDetection)
+	return &cfg
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+// ApplyConfig replaces the manager's configuration at runtime, changing only what differs:
+//
+//   - Services whose connections are built from changed settings, such as their address,
+//     credentials, message size, keepalive or the interceptors in their chain, are disconnected
+//     and dial again on their next GetConnection, as after RegisterService. Their rate limiters,
+//     bulkheads, quotas, response caches and circuit breakers start anew. Funcs such as
+//     ContextDialer, the extra interceptors and circuit breaker callbacks count as changed only
+//     when they are replaced by a different function.
+//   - Retry settings, retry budgets and circuit breaker thresholds are updated in place on the
+//     connections of the other services, which stay connected.
+//   - Services given an Address in newCfg.Services are registered, and services whose Address was
+//     removed are unregistered.
+//
+// newCfg replaces the whole configuration, including the overrides given to RegisterService, so
+// it is best derived from Config. Clock, Logger, Events, Auth, DNSCache, Discovery, Registry,
+// RegistryRefreshInterval, ResolveInterval, FailbackInterval, MaxIdleTime, MaxConnectionAge,
+// RebalanceInterval, AdminListenAddr, ChannelzListenAddr and
+// the metrics settings MaxCallerLabels, MaxTargetLabels and AsyncMetricsQueueSize are fixed when
+// the manager is created and keep their values. newCfg is validated before anything changes and must not be
+// modified afterwards.
+func (cm *ConnectionManager) ApplyConfig(newCfg *Config) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	old := cm.config()
+	cfg := *newCfg
+	cfg.Clock, cfg.Logger, cfg.Events = old.Clock, old.Logger, old.Events
+	cfg.Auth, cfg.DNSCache, cfg.Discovery = old.Auth, old.DNSCache, old.Discovery
+	cfg.Registry, cfg.RegistryRefreshInterval = old.Registry, old.RegistryRefreshInterval
+	cfg.ResolveInterval, cfg.FailbackInterval = old.ResolveInterval, old.FailbackInterval
+	cfg.MaxIdleTime, cfg.MaxConnectionAge = old.MaxIdleTime, old.MaxConnectionAge
+	cfg.MaxCallerLabels, cfg.MaxTargetLabels = old.MaxCallerLabels, old.MaxTargetLabels
+	cfg.AsyncMetricsQueueSize, cfg.AdminListenAddr = old.AsyncMetricsQueueSize, old.AdminListenAddr
+	cfg.ChannelzListenAddr, cfg.RebalanceInterval = old.ChannelzListenAddr, old.RebalanceInterval
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	cm.cfg.Store(&cfg)
+
+	services := make(map[string]struct{})
+	for _, names := range []iter.Seq[string]{
+		maps.Keys(cm.addresses), maps.Keys(cm.connections), maps.Keys(cm.standbys),
+		maps.Keys(cm.canaries), maps.Keys(old.Services), maps.Keys(cfg.Services),
+	} {
+		for name := range names {
+			services[name] = struct{}{}
+		}
+	}
+
+	for name := range services {
+		oldSC, newSC := old.Services[name], cfg.Services[name]
+		if newSC.Address == "" && oldSC.Address != "" && cm.addresses[name] == oldSC.Address {
+			cm.serviceLogger(name).Infof("Service %s removed from the configuration, closing its connections", name)
+			cm.disconnect(name)
+			delete(cm.addresses, name)
+			delete(cm.dialed, name)
+			cm.publish(name)
+			if cfg.EnableMetrics && cm.metrics != nil {
+				cm.metrics.DeleteService(name)
+			}
+			continue
+		}
+
+		moved := newSC.Address != "" && newSC.Address != cm.addresses[name]
+		if moved {
+			cm.addresses[name] = newSC.Address
+			cm.publish(name)
+		}
+		if moved || !configEqual(old.dialedConfig(name), cfg.dialedConfig(name)) {
+			if cm.connections[name] != nil {
+				cm.serviceLogger(name).Infof("Configuration of %s changed, reconnecting to %s", name, cm.addresses[name])
+			}
+			cm.disconnect(name)
+			continue
+		}
+
+		if !configEqual(old.retryBudget(name), cfg.retryBudget(name)) {
+			delete(cm.budgets, name)
+		}
+		if r := cm.retriers[name]; r != nil {
+			r.update(cm.retryConfig(name), name, cm.metrics)
+		}
+		// Standby connections have breakers of their own that keep the thresholds they were dialed with.
+		if group, ok := cm.breakers.Group(name); ok {
+			group.UpdateConfig(cfg.circuitBreaker())
+		}
+		if pm, ok := cm.prometheusMetrics(); ok && newSC.LatencySLO > 0 && newSC.LatencySLO != oldSC.LatencySLO {
+			if err := pm.SetServiceSLO(name, newSC.LatencySLO); err != nil {
+				cm.serviceLogger(name).Warnf("Failed to update the latency SLO of %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// disconnect closes the service's connections, including its standby and canary, and drops the state shared
+// by them, so that the next GetConnection dials it from the current configuration. Must be called
+// with cm.mu held.
+func (cm *ConnectionManager) disconnect(name string) {
+	cm.forgetServiceState(name)
+	if sb := cm.standbys[name]; sb != nil {
+		_ = sb.conn.Close()
+		delete(cm.standbys, name)
+	}
+	cm.dropCanary(name)
+	_ = cm.dropConnection(name)
+	cm.publish(name)
+}
@@ -0,0 +1,26 @@
+package manager
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// serverNameCredentials are transport credentials that handshake with ServiceConfig's
+// ServerNameOverride instead of the connection's authority, which TLS credentials use as the
+// server name to send and verify.
+type serverNameCredentials struct {
+	credentials.TransportCredentials
+	serverName string
+}
+
+// ClientHandshake implements credentials.TransportCredentials.
+func (c serverNameCredentials) ClientHandshake(ctx context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.TransportCredentials.ClientHandshake(ctx, c.serverName, conn)
+}
+
+// Clone implements credentials.TransportCredentials.
+func (c serverNameCredentials) Clone() credentials.TransportCredentials {
+	return serverNameCredentials{TransportCredentials: c.TransportCredentials.Clone(), serverName: c.serverName}
+}
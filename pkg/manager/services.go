@@ -0,0 +1,229 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ServiceOption configures a service registered with RegisterService.
+type ServiceOption func(*ServiceConfig)
+
+// WithServiceConfig replaces the service's overrides with sc. Options after it modify sc.
+func WithServiceConfig(sc ServiceConfig) ServiceOption {
+	return func(c *ServiceConfig) {
+		*c = sc
+	}
+}
+
+// WithCredentials sets the transport credentials used for the service, e.g. mTLS for an
+// external service while internal services use plaintext.
+func WithCredentials(creds credentials.TransportCredentials) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.TransportCredentials = creds
+	}
+}
+
+// WithServicePerRPCCredentials sets the per-RPC credentials used for the service.
+func WithServicePerRPCCredentials(creds credentials.PerRPCCredentials) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.PerRPCCredentials = creds
+	}
+}
+
+// WithServiceMaxMsgSize sets the maximum message size for the service.
+func WithServiceMaxMsgSize(size int) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.MaxMsgSize = size
+	}
+}
+
+// WithFallbackAddresses sets the addresses tried in order when the primary does not become Ready.
+func WithFallbackAddresses(addresses ...string) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.FallbackAddresses = addresses
+	}
+}
+
+// WithStandbyAddress sets a backup address that is kept dialed for failover.
+func WithStandbyAddress(address string) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.StandbyAddress = address
+	}
+}
+
+// WithCanary sets the address of a canary deployment that receives weight of the GetConnection
+// calls for the service.
+func WithCanary(address string, weight float64) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.CanaryAddress, c.CanaryWeight = address, weight
+	}
+}
+
+// WithLatencySLO sets the service's latency objective.
+func WithLatencySLO(slo time.Duration) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.LatencySLO = slo
+	}
+}
+
+// WithServiceLogLevel sets the minimum level logged for the service.
+func WithServiceLogLevel(level logger.Level) ServiceOption {
+	return func(c *ServiceConfig) {
+		c.LogLevel = level
+	}
+}
+
+// RegisterService declares a service and its address, so that it can be used with GetConnection
+// and an empty address. Options are applied on top of the service's existing entry in
+// Config.Services, and the result is validated before anything changes. Registering a service
+// again replaces its address and options and closes its current connection, so the next
+// GetConnection dials it with the new settings. With Config.PreconnectOnRegister the service
+// starts connecting right away, without waiting for the connection to become Ready.
+//
+// Services are meant to be registered at startup, before their connections are in use.
+func (cm *ConnectionManager) RegisterService(name, address string, opts ...ServiceOption) error {
+	if name == "" {
+		return errors.New("service name must not be empty")
+	}
+	if address == "" {
+		return fmt.Errorf("address for service %s must not be empty", name)
+	}
+	if err := cm.registerService(name, address, opts); err != nil {
+		return err
+	}
+	if cm.config().PreconnectOnRegister {
+		cm.preconnect(name)
+	}
+	return nil
+}
+
+// preconnect creates the service's connections and starts connecting them. Failures are only
+// logged, since GetConnection dials again.
+func (cm *ConnectionManager) preconnect(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cm.config().MinConnectTimeout)
+	defer cancel()
+	if _, err := cm.GetConnection(ctx, name, ""); err != nil {
+		cm.serviceLogger(name).Warnf("Failed to preconnect %s: %v", name, err)
+		return
+	}
+	for _, conn := range cm.serviceConns(name) {
+		conn.Connect()
+	}
+}
+
+func (cm *ConnectionManager) registerService(name, address string, opts []ServiceOption) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	sc := cm.config().Services[name]
+	for _, opt := range opts {
+		opt(&sc)
+	}
+	if err := validateService(name, sc); err != nil {
+		return err
+	}
+
+	// Copy the config rather than writing to the caller's Services map.
+	config := *cm.config()
+	config.Services = maps.Clone(config.Services)
+	if config.Services == nil {
+		config.Services = make(map[string]ServiceConfig)
+	}
+	config.Services[name] = sc
+	cm.cfg.Store(&config)
+
+	_, existed := cm.addresses[name]
+	cm.addresses[name] = address
+	cm.publish(name)
+	if existed {
+		if cm.connections[name] != nil {
+			cm.serviceLogger(name).Infof("Service %s re-registered, reconnecting to %s", name, address)
+		}
+		cm.disconnect(name)
+	}
+	return nil
+}
+
+// UnregisterService closes the service's connections and forgets its address and options.
+func (cm *ConnectionManager) UnregisterService(name string) error {
+	cm.mu.RLock()
+	_, ok := cm.addresses[name]
+	cm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("service %s is not registered", name)
+	}
+
+	err := cm.CloseConnection(name)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.addresses, name)
+	if _, ok := cm.config().Services[name]; ok {
+		config := *cm.config()
+		config.Services = maps.Clone(config.Services)
+		delete(config.Services, name)
+		cm.cfg.Store(&config)
+	}
+	cm.forgetServiceState(name)
+	cm.events.stats.Delete(name)
+	return err
+}
+
+// ListServices returns the names of known services in sorted order: those registered with
+// RegisterService or given an Address in Config.Services, those given an address in
+// GetConnection, and those found in the remote registry.
+func (cm *ConnectionManager) ListServices() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return slices.Sorted(maps.Keys(cm.addresses))
+}
+
+// PurgeResponseCache drops the responses cached for the service, e.g. after a write that makes
+// them stale.
+func (cm *ConnectionManager) PurgeResponseCache(serviceName string) {
+	cm.mu.RLock()
+	cache := cm.caches[serviceName]
+	cm.mu.RUnlock()
+	if cache != nil {
+		cache.Purge()
+	}
+}
+
+// flushQuota saves the counters of the service's quota, if it has one. Must be called with cm.mu
+// held.
+func (cm *ConnectionManager) flushQuota(name string) {
+	if quota := cm.quotas[name]; quota != nil {
+		if err := quota.Flush(); err != nil {
+			cm.serviceLogger(name).Warnf("Failed to save quota counters for %s: %v", name, err)
+		}
+	}
+}
+
+// forgetServiceState drops the quotas, limiters, breakers, retry interceptors and other per-service
+// state that outlive connections, so that they are recreated from the current options. Must be
+// called with cm.mu held.
+func (cm *ConnectionManager) forgetServiceState(name string) {
+	// The quota that replaces this one loads its counters from the store, so they are saved first.
+	cm.flushQuota(name)
+	delete(cm.quotas, name)
+	delete(cm.limiters, name)
+	delete(cm.bulkheads, name)
+	delete(cm.caches, name)
+	delete(cm.dedups, name)
+	delete(cm.budgets, name)
+	delete(cm.outliers, name)
+	delete(cm.loads, name)
+	delete(cm.failovers, name)
+	delete(cm.retriers, name)
+	delete(cm.resolved, name)
+	cm.breakers.Unregister(name)
+	cm.publish(name)
+}
@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// inflightCalls counts the calls and streams in flight on all of the manager's connections.
+type inflightCalls struct {
+	n atomic.Int64
+	// drained receives a value whenever the count drops to zero
+	drained chan struct{}
+}
+
+func (c *inflightCalls) init() {
+	c.drained = make(chan struct{}, 1)
+}
+
+func (c *inflightCalls) add(delta int64) {
+	if c.n.Add(delta) == 0 {
+		select {
+		case c.drained <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks until no calls are in flight or ctx is done.
+func (c *inflightCalls) wait(ctx context.Context) error {
+	for c.n.Load() > 0 {
+		select {
+		case <-c.drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown stops handing out connections, waits for the calls and streams in flight to finish
+// and then closes the manager like Close. If ctx is done first, the connections are closed anyway,
+// canceling the remaining calls, and an error reporting how many were cut off is returned.
+// Streams count as in flight until they end or their context is canceled.
+func (cm *ConnectionManager) Shutdown(ctx context.Context) error {
+	cm.shutdown.Store(true)
+
+	waitErr := cm.calls.wait(ctx)
+	remaining := cm.calls.n.Load()
+	closeErr := cm.Close()
+	if waitErr != nil {
+		return fmt.Errorf("shutdown canceled %d calls in flight: %w", remaining, waitErr)
+	}
+	return closeErr
+}
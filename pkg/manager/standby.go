@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"github.com/begenov/grpc-connection-manager/pkg/clock"
+	"github.com/begenov/grpc-connection-manager/pkg/logger"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// standbyConn is a pre-dialed, normally unused connection to a service's backup address.
+// It becomes active when the primary's circuit breaker opens or its connection fails.
+type standbyConn struct {
+	conn    *grpc.ClientConn
+	address string
+	clock   clock.Clock
+	logger  logger.Logger
+
+	mu          sync.Mutex
+	active      bool
+	activatedAt time.Time
+}
+
+// activate switches traffic for the service to the standby connection.
+func (s *standbyConn) activate(serviceName, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		s.logger.Warnf("Failing over %s to standby %s: %s", serviceName, s.address, reason)
+	}
+	s.active = true
+	s.activatedAt = s.clock.Now()
+}
+
+// activeFor reports whether the standby is active and, if so, how long ago it was activated.
+func (s *standbyConn) activeFor() (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active, s.clock.Since(s.activatedAt)
+}
+
+// deactivate switches traffic for the service back to the primary connection.
+func (s *standbyConn) deactivate(serviceName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		s.logger.Infof("Failing back %s from standby %s to primary", serviceName, s.address)
+	}
+	s.active = false
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// WarmUp dials every known service concurrently and waits for its connections to become Ready,
+// so that the first requests do not pay for connection setup. Each service is given up to
+// MinConnectTimeout, or until ctx is done. It returns the outcome for every service, with a nil
+// error for those that are Ready; services that failed are dialed again by GetConnection as usual.
+func (cm *ConnectionManager) WarmUp(ctx context.Context) map[string]error {
+	services := cm.ListServices()
+
+	var (
+		mu      sync.Mutex
+		results = make(map[string]error, len(services))
+		wg      sync.WaitGroup
+	)
+	for _, name := range services {
+		wg.Go(func() {
+			err := cm.warmUp(ctx, name)
+			if err != nil {
+				cm.serviceLogger(name).Warnf("Failed to warm up connection for %s: %v", name, err)
+			}
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// warmUp dials the service and waits until its primary and pooled connections are Ready, while
+// they reconnect after failed attempts, for up to MinConnectTimeout.
+func (cm *ConnectionManager) warmUp(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, cm.config().MinConnectTimeout)
+	defer cancel()
+	if _, err := cm.GetConnection(ctx, name, ""); err != nil {
+		return err
+	}
+
+	for _, conn := range cm.serviceConns(name) {
+		if err := awaitReady(ctx, conn, cm.config().MinConnectTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceConns returns the service's primary connection and any pooled connections.
+func (cm *ConnectionManager) serviceConns(name string) []*grpc.ClientConn {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if pool := cm.pools[name]; pool != nil {
+		return slices.Clone(pool.conns)
+	}
+	if conn := cm.connections[name]; conn != nil {
+		return []*grpc.ClientConn{conn}
+	}
+	return nil
+}
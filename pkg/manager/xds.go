@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// XDSSupport resolves xds:/// targets through an xDS control plane. It is implemented by the
+// pkg/xds module, which registers gRPC's xds resolver, so that applications that do not use xDS
+// do not link it.
+type XDSSupport interface {
+	// Validate checks that xds targets can be resolved, e.g. that a bootstrap config is given
+	Validate() error
+	// TransportCredentials returns the credentials of connections to xds targets, given those
+	// configured for the service
+	TransportCredentials(fallback credentials.TransportCredentials) (credentials.TransportCredentials, error)
+}
+
+// isXDSTarget reports whether address is resolved through xDS.
+func isXDSTarget(address string) bool {
+	return strings.HasPrefix(address, "xds:")
+}
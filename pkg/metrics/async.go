@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultAsyncQueueSize is the async queue size used when StartAsync is given a size <= 0.
+const DefaultAsyncQueueSize = 8192
+
+// requestObservation is a request queued for recording by the async recorder.
+type requestObservation struct {
+	service, method, code, caller, target string
+	duration                              time.Duration
+}
+
+// asyncRecorder records request observations from a bounded queue on a background goroutine.
+type asyncRecorder struct {
+	queue    chan requestObservation
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// StartAsync switches request recording to asynchronous mode: RecordGRPCRequest enqueues
+// observations into a bounded queue of the given size that a background goroutine records,
+// keeping histogram observations off the call path. When the queue is full, observations are
+// dropped and counted in grpc_client_metrics_dropped_total. Calling StartAsync while already
+// asynchronous has no effect. It reports whether it switched to asynchronous mode, so that
+// users sharing the Metrics only call StopAsync if they started it.
+func (m *Metrics) StartAsync(size int) bool {
+	if size <= 0 {
+		size = DefaultAsyncQueueSize
+	}
+	a := &asyncRecorder{
+		queue: make(chan requestObservation, size),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if !m.async.CompareAndSwap(nil, a) {
+		return false
+	}
+	go m.runAsync(a)
+	return true
+}
+
+// StopAsync records all queued observations and switches back to synchronous recording.
+// Observations enqueued concurrently with StopAsync may be lost.
+func (m *Metrics) StopAsync() {
+	a := m.async.Swap(nil)
+	if a == nil {
+		return
+	}
+	a.stopOnce.Do(func() { close(a.stop) })
+	<-a.done
+}
+
+func (m *Metrics) runAsync(a *asyncRecorder) {
+	defer close(a.done)
+	for {
+		select {
+		case o := <-a.queue:
+			m.recordGRPCRequest(o)
+		case <-a.stop:
+			for {
+				select {
+				case o := <-a.queue:
+					m.recordGRPCRequest(o)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue adds an observation to the queue without blocking, counting it as dropped if the queue is full.
+func (m *Metrics) enqueue(a *asyncRecorder, o requestObservation) {
+	select {
+	case a.queue <- o:
+	default:
+		m.metricsDroppedTotal.Inc()
+	}
+}
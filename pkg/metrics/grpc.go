@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RecordGRPCRequest records a gRPC request with its duration, status code, calling component
+// and target address. The target is only recorded when enabled with SetMaxTargetLabels.
+// In async mode (see StartAsync) the request is queued and recorded in the background.
+func (m *Metrics) RecordGRPCRequest(service, method, code, caller, target string, duration time.Duration) {
+	o := requestObservation{service: service, method: method, code: code, caller: caller, target: target, duration: duration}
+	if a := m.async.Load(); a != nil {
+		m.enqueue(a, o)
+		return
+	}
+	m.recordGRPCRequest(o)
+}
+
+func (m *Metrics) recordGRPCRequest(o requestObservation) {
+	caller := m.callerLabel(o.caller)
+	target := m.targetLabel(o.target)
+	m.recordSLO(o.service, o.method, o.duration)
+
+	if m.naming == NamingOTel {
+		rpcService, rpcMethod := splitMethod(o.method)
+		m.rpcClientDuration.WithLabelValues(o.service, rpcService, rpcMethod, otelStatusCode(o.code), caller, target).
+			Observe(float64(o.duration) / float64(time.Millisecond))
+		return
+	}
+	m.grpcRequestsTotal.WithLabelValues(o.service, o.method, o.code, caller, target).Inc()
+	m.grpcRequestDuration.WithLabelValues(o.service, o.method, caller, target).Observe(o.duration.Seconds())
+}
+
+// UpdateGRPCConnections updates the count of active gRPC connections for a service.
+func (m *Metrics) UpdateGRPCConnections(service string, count int) {
+	m.grpcConnectionsActive.WithLabelValues(service).Set(float64(count))
+}
+
+// UpdateGRPCConnectionState updates the connection state metric for a service and its target address.
+// The target is only recorded when enabled with SetMaxTargetLabels.
+func (m *Metrics) UpdateGRPCConnectionState(service, target, state string) {
+	target = m.targetLabel(target)
+
+	m.grpcConnectionState.WithLabelValues(service, "Idle", target).Set(0)
+	m.grpcConnectionState.WithLabelValues(service, "Connecting", target).Set(0)
+	m.grpcConnectionState.WithLabelValues(service, "Ready", target).Set(0)
+	m.grpcConnectionState.WithLabelValues(service, "TransientFailure", target).Set(0)
+	m.grpcConnectionState.WithLabelValues(service, "Shutdown", target).Set(0)
+
+	m.grpcConnectionState.WithLabelValues(service, state, target).Set(1)
+}
+
+// IncrementGRPCRetry increments the retry counter for a gRPC method.
+func (m *Metrics) IncrementGRPCRetry(service, method string) {
+	m.grpcRetriesTotal.WithLabelValues(service, method).Inc()
+}
+
+// RecordGRPCAttempt counts an attempt of a gRPC call by its status code and attempt number, 1
+// being the first try, so that first-try failures can be told apart from failed retries.
+func (m *Metrics) RecordGRPCAttempt(service, method, code string, attempt int) {
+	m.grpcAttemptsTotal.WithLabelValues(service, method, code, strconv.Itoa(attempt)).Inc()
+}
+
+// IncrementGRPCRetryExhausted counts a gRPC call that failed on its last allowed attempt.
+func (m *Metrics) IncrementGRPCRetryExhausted(service, method string) {
+	m.grpcRetryExhausted.WithLabelValues(service, method).Inc()
+}
+
+// IncrementGRPCRetryBudgetExhausted counts a retry skipped because the retry budget was exhausted.
+func (m *Metrics) IncrementGRPCRetryBudgetExhausted(service, method string) {
+	m.grpcRetryBudgetExceeded.WithLabelValues(service, method).Inc()
+}
+
+// IncrementOutlierEjection counts a pooled connection ejected by outlier detection.
+func (m *Metrics) IncrementOutlierEjection(service string) {
+	m.grpcOutlierEjections.WithLabelValues(service).Inc()
+}
+
+// RecordGRPCStreamMessage counts a message sent or received on a gRPC stream.
+func (m *Metrics) RecordGRPCStreamMessage(service, method, direction string) {
+	m.grpcStreamMessagesTotal.WithLabelValues(service, method, direction).Inc()
+}
+
+// RecordGRPCMessageSize records the size of a message sent or received by a call. Direction is
+// DirectionSent for requests or DirectionReceived for responses.
+func (m *Metrics) RecordGRPCMessageSize(service, method, direction string, size int) {
+	if direction == DirectionSent {
+		m.grpcRequestBytes.WithLabelValues(service, method).Observe(float64(size))
+	} else {
+		m.grpcResponseBytes.WithLabelValues(service, method).Observe(float64(size))
+	}
+}
+
+// AddGRPCInflight adds delta to the number of calls in flight.
+func (m *Metrics) AddGRPCInflight(service, method string, delta int) {
+	m.grpcInflightRequests.add(service, method, delta)
+}
+
+// RecordGRPCStream records a finished stream: its status code, how long it was open and the
+// number of messages sent and received on it.
+func (m *Metrics) RecordGRPCStream(service, method, code string, duration time.Duration, sent, received int) {
+	m.grpcStreamDuration.WithLabelValues(service, method, code).Observe(duration.Seconds())
+	m.grpcStreamMessages.WithLabelValues(service, method, DirectionSent).Observe(float64(sent))
+	m.grpcStreamMessages.WithLabelValues(service, method, DirectionReceived).Observe(float64(received))
+}
+
+// RecordGRPCAttempts records how many attempts a completed gRPC call took.
+func (m *Metrics) RecordGRPCAttempts(service, method string, attempts int) {
+	m.grpcAttemptsPerCall.WithLabelValues(service, method).Observe(float64(attempts))
+}
+
+// UpdateGRPCCircuitBreaker updates the circuit breaker state metric for a gRPC method.
+func (m *Metrics) UpdateGRPCCircuitBreaker(service, method string, state int) {
+	m.grpcCircuitBreakerState.WithLabelValues(service, method).Set(float64(state))
+}
+
+// RecordGRPCFallback counts a call rejected by a circuit breaker and passed to a fallback, with
+// result "served" if the fallback answered it or "failed" if it returned an error.
+func (m *Metrics) RecordGRPCFallback(service, method string, served bool) {
+	m.grpcFallbacksTotal.WithLabelValues(service, method, fallbackResult(served)).Inc()
+}
+
+// RecordGRPCCache counts a call to a cached method with result "hit" if it was answered from the
+// cache or "miss" if it was sent.
+func (m *Metrics) RecordGRPCCache(service, method string, hit bool) {
+	m.grpcCacheRequestsTotal.WithLabelValues(service, method, cacheResult(hit)).Inc()
+}
+
+// IncrementGRPCDeduplicated counts a gRPC call that shared the RPC of an identical call in flight.
+func (m *Metrics) IncrementGRPCDeduplicated(service, method string) {
+	m.grpcDeduplicatedTotal.WithLabelValues(service, method).Inc()
+}
+
+// RecordGRPCCompression records whether a gRPC request was sent compressed.
+func (m *Metrics) RecordGRPCCompression(service, method string, compressed bool) {
+	if compressed {
+		m.grpcCompressedTotal.WithLabelValues(service, method).Inc()
+		return
+	}
+	m.grpcUncompressedTotal.WithLabelValues(service, method).Inc()
+}
+
+// RecordGRPCEncryptedBytes records payload bytes processed by application-layer encryption.
+// Operation is either "encrypt" or "decrypt".
+func (m *Metrics) RecordGRPCEncryptedBytes(service, method, operation string, n int) {
+	m.grpcEncryptedBytesTotal.WithLabelValues(service, method, operation).Add(float64(n))
+}
+
+// IncrementGRPCBlocked increments the counter of calls rejected locally for the given reason.
+func (m *Metrics) IncrementGRPCBlocked(service, method, reason string) {
+	m.grpcBlockedTotal.WithLabelValues(service, method, reason).Inc()
+}
+
+// RecordGRPCThrottled records a call that waited for the rate limiter before being sent.
+func (m *Metrics) RecordGRPCThrottled(service, method string, wait time.Duration) {
+	m.grpcThrottledTotal.WithLabelValues(service, method).Inc()
+	m.grpcThrottleWait.WithLabelValues(service, method).Observe(wait.Seconds())
+}
+
+// IncrementGRPCCallerAborted increments the counter of calls aborted by the caller's context.
+// These calls are not recorded in the request counters.
+func (m *Metrics) IncrementGRPCCallerAborted(service, method, reason string) {
+	m.grpcCallerAbortedTotal.WithLabelValues(service, method, reason).Inc()
+}
+
+// IncrementGRPCDefaultTimeout increments the counter of calls given a default deadline.
+func (m *Metrics) IncrementGRPCDefaultTimeout(service, method string) {
+	m.grpcDefaultTimeouts.WithLabelValues(service, method).Inc()
+}
+
+// RecordCredentialsRefresh records the latency of a credential token refresh and whether it failed.
+func (m *Metrics) RecordCredentialsRefresh(name string, duration time.Duration, err error) {
+	m.credentialsRefreshDuration.WithLabelValues(name).Observe(duration.Seconds())
+	if err != nil {
+		m.credentialsRefreshFailures.WithLabelValues(name).Inc()
+	}
+}
+
+// DeleteService removes every label series recorded for a service, so dashboards stop
+// showing stale values after it is unregistered or its manager is closed. The in-flight series
+// of calls still running are deleted once those calls finish.
+func (m *Metrics) DeleteService(service string) {
+	labels := prometheus.Labels{"service": service}
+	for _, vec := range m.serviceVecs() {
+		vec.DeletePartialMatch(labels)
+	}
+	m.grpcInflightRequests.deleteService(service)
+	if m.naming == NamingOTel {
+		m.rpcClientDuration.DeletePartialMatch(labels)
+	} else {
+		m.grpcRequestsTotal.DeletePartialMatch(labels)
+		m.grpcRequestDuration.DeletePartialMatch(labels)
+	}
+
+	m.slos.mu.RLock()
+	slo := m.slos.services[service]
+	m.slos.mu.RUnlock()
+	if slo != nil {
+		slo.duration.Reset()
+	}
+}
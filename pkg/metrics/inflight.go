@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// inflightGauge counts the calls in flight per service and method. Unlike the other series of a
+// service, those of a deleted service are kept until its calls finish, as their deferred
+// decrements would otherwise drive a new series negative.
+type inflightGauge struct {
+	mu       sync.Mutex
+	gauge    *prometheus.GaugeVec
+	counts   map[[2]string]int
+	draining map[string]bool
+}
+
+func newInflightGauge(gauge *prometheus.GaugeVec) *inflightGauge {
+	return &inflightGauge{
+		gauge:    gauge,
+		counts:   make(map[[2]string]int),
+		draining: make(map[string]bool),
+	}
+}
+
+// add adds delta to the calls in flight, deleting the series once a deleted service drains.
+func (g *inflightGauge) add(service, method string, delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// New calls mean the service is in use again.
+	if delta > 0 {
+		delete(g.draining, service)
+	}
+	key := [2]string{service, method}
+	n := g.counts[key] + delta
+	if n == 0 && g.draining[service] {
+		delete(g.counts, key)
+		g.gauge.DeleteLabelValues(service, method)
+		for k := range g.counts {
+			if k[0] == service {
+				return
+			}
+		}
+		delete(g.draining, service)
+		return
+	}
+	g.counts[key] = n
+	g.gauge.WithLabelValues(service, method).Set(float64(n))
+}
+
+// deleteService deletes the idle series of a service, and those with calls in flight once they finish.
+func (g *inflightGauge) deleteService(service string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for key, n := range g.counts {
+		if key[0] != service {
+			continue
+		}
+		if n == 0 {
+			delete(g.counts, key)
+			g.gauge.DeleteLabelValues(key[0], key[1])
+		} else {
+			g.draining[service] = true
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import "sync"
+
+// boundedLabel limits the number of distinct values recorded for a label
+// to keep metric cardinality under control.
+type boundedLabel struct {
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	max   int
+	other string
+}
+
+func newBoundedLabel(max int, other string) *boundedLabel {
+	return &boundedLabel{
+		seen:  make(map[string]struct{}),
+		max:   max,
+		other: other,
+	}
+}
+
+func (l *boundedLabel) setMax(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = n
+}
+
+func (l *boundedLabel) enabled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max > 0
+}
+
+// value returns v if it is already tracked or there is room to track it, and the overflow value otherwise.
+func (l *boundedLabel) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return l.other
+	}
+	l.seen[v] = struct{}{}
+	return v
+}
+
+// labelLimits bounds the caller and target labels of a recorder.
+type labelLimits struct {
+	callers *boundedLabel
+	targets *boundedLabel
+}
+
+func newLabelLimits() labelLimits {
+	return labelLimits{
+		callers: newBoundedLabel(DefaultMaxCallerLabels, CallerOther),
+		targets: newBoundedLabel(0, TargetOther),
+	}
+}
+
+// SetMaxCallerLabels sets the maximum number of distinct caller label values.
+// Callers seen after the limit is reached are recorded as CallerOther.
+func (l *labelLimits) SetMaxCallerLabels(n int) {
+	l.callers.setMax(n)
+}
+
+// SetMaxTargetLabels enables the target label on request and connection metrics with at most n
+// distinct values. Targets seen after the limit is reached are recorded as TargetOther.
+// Zero (the default) disables the label, leaving it empty.
+func (l *labelLimits) SetMaxTargetLabels(n int) {
+	l.targets.setMax(n)
+}
+
+// TargetLabelsEnabled reports whether the target label is recorded.
+func (l *labelLimits) TargetLabelsEnabled() bool {
+	return l.targets.enabled()
+}
+
+// callerLabel maps a caller name to a bounded set of label values.
+func (l *labelLimits) callerLabel(caller string) string {
+	if caller == "" {
+		return CallerUnknown
+	}
+	return l.callers.value(caller)
+}
+
+// targetLabel maps a target address to a bounded set of label values, or "" if disabled.
+func (l *labelLimits) targetLabel(target string) string {
+	if target == "" || !l.targets.enabled() {
+		return ""
+	}
+	return l.targets.value(target)
+}
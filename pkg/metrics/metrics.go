@@ -0,0 +1,447 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics collects Prometheus metrics for gRPC connections and calls.
+type Metrics struct {
+	// gRPC metrics
+	grpcRequestsTotal       *prometheus.CounterVec
+	grpcRequestDuration     *prometheus.HistogramVec
+	rpcClientDuration       *prometheus.HistogramVec
+	grpcConnectionsActive   *prometheus.GaugeVec
+	grpcConnectionState     *prometheus.GaugeVec
+	grpcRetriesTotal        *prometheus.CounterVec
+	grpcAttemptsTotal       *prometheus.CounterVec
+	grpcRetryExhausted      *prometheus.CounterVec
+	grpcRetryBudgetExceeded *prometheus.CounterVec
+	grpcOutlierEjections    *prometheus.CounterVec
+	grpcStreamMessagesTotal *prometheus.CounterVec
+	grpcAttemptsPerCall     *prometheus.HistogramVec
+	grpcCircuitBreakerState *prometheus.GaugeVec
+	grpcFallbacksTotal      *prometheus.CounterVec
+	grpcCacheRequestsTotal  *prometheus.CounterVec
+	grpcDeduplicatedTotal   *prometheus.CounterVec
+	grpcCompressedTotal     *prometheus.CounterVec
+	grpcUncompressedTotal   *prometheus.CounterVec
+	grpcEncryptedBytesTotal *prometheus.CounterVec
+	grpcBlockedTotal        *prometheus.CounterVec
+	grpcThrottledTotal      *prometheus.CounterVec
+	grpcThrottleWait        *prometheus.HistogramVec
+	grpcCallerAbortedTotal  *prometheus.CounterVec
+	grpcDefaultTimeouts     *prometheus.CounterVec
+	grpcRequestBytes        *prometheus.HistogramVec
+	grpcResponseBytes       *prometheus.HistogramVec
+	grpcInflightRequests    *inflightGauge
+	grpcStreamDuration      *prometheus.HistogramVec
+	grpcStreamMessages      *prometheus.HistogramVec
+
+	// Credentials metrics
+	credentialsRefreshDuration *prometheus.HistogramVec
+	credentialsRefreshFailures *prometheus.CounterVec
+
+	// Pipeline metrics
+	metricsDroppedTotal prometheus.Counter
+
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+	naming     Naming
+	async      atomic.Pointer[asyncRecorder]
+	slos       *sloRegistry
+	labelLimits
+}
+
+const (
+	// DefaultMaxCallerLabels is the default number of distinct caller label values tracked.
+	DefaultMaxCallerLabels = 50
+
+	// CallerUnknown is the caller label value used when no caller is set in the context.
+	CallerUnknown = "unknown"
+	// CallerOther is the caller label value used once the caller label limit is reached.
+	CallerOther = "other"
+
+	// TargetOther is the target label value used once the target label limit is reached.
+	TargetOther = "other"
+
+	// DirectionSent and DirectionReceived are the direction label values of stream message counts.
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+
+	// FallbackServed and FallbackFailed are the result label values of fallback counts.
+	FallbackServed = "served"
+	FallbackFailed = "failed"
+
+	// CacheHit and CacheMiss are the result label values of response cache lookups.
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// fallbackResult returns the result label value of a fallback.
+func fallbackResult(served bool) string {
+	if served {
+		return FallbackServed
+	}
+	return FallbackFailed
+}
+
+// cacheResult returns the result label value of a response cache lookup.
+func cacheResult(hit bool) string {
+	if hit {
+		return CacheHit
+	}
+	return CacheMiss
+}
+
+// messageSizeBuckets are the buckets of the message size histograms, from 64B to 16MiB.
+var messageSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+// Options configures where Metrics are registered and how they are named.
+type Options struct {
+	// Registerer registers the metrics. If nil, prometheus.DefaultRegisterer is used, which allows
+	// a single Metrics per process
+	Registerer prometheus.Registerer
+	// Namespace and Subsystem prefix every metric name, e.g. "shop" and "checkout" turn
+	// grpc_client_requests_total into shop_checkout_grpc_client_requests_total (default: "", none)
+	Namespace string
+	Subsystem string
+	// ConstLabels are added to every metric, e.g. {"app": "checkout"} (default: nil)
+	ConstLabels prometheus.Labels
+	// Naming selects how request metrics are named (default: NamingPrometheus)
+	Naming Naming
+}
+
+// NewMetrics creates a new Metrics instance with all Prometheus metrics initialized.
+func NewMetrics() *Metrics {
+	return NewMetricsWithNaming(NamingPrometheus)
+}
+
+// NewMetricsWithNaming creates a new Metrics instance whose request metrics follow the given naming.
+func NewMetricsWithNaming(naming Naming) *Metrics {
+	return NewMetricsWithOptions(&Options{Naming: naming})
+}
+
+// NewMetricsWithRegistry creates a new Metrics instance registered on reg, with metric names
+// prefixed by namespace and constLabels added to every metric. Unlike NewMetrics, which uses the
+// global registry, it can be called once per registry, e.g. for several managers in one process.
+func NewMetricsWithRegistry(reg prometheus.Registerer, namespace string, constLabels prometheus.Labels) *Metrics {
+	return NewMetricsWithOptions(&Options{Registerer: reg, Namespace: namespace, ConstLabels: constLabels})
+}
+
+// NewMetricsWithOptions creates a new Metrics instance configured by opts. It panics if the
+// metrics are already registered on the Registerer, as promauto does.
+func NewMetricsWithOptions(opts *Options) *Metrics {
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	gatherer := prometheus.DefaultGatherer
+	if g, ok := reg.(prometheus.Gatherer); ok {
+		gatherer = g
+	}
+	// Wrappers prefix from the outside in, so the namespace is wrapped first to end up in front.
+	for _, prefix := range []string{opts.Namespace, opts.Subsystem} {
+		if prefix != "" {
+			reg = prometheus.WrapRegistererWithPrefix(prefix+"_", reg)
+		}
+	}
+	if len(opts.ConstLabels) > 0 {
+		reg = prometheus.WrapRegistererWith(opts.ConstLabels, reg)
+	}
+	f := promauto.With(reg)
+
+	naming := opts.Naming
+	m := &Metrics{
+		registerer:  reg,
+		gatherer:    gatherer,
+		naming:      naming,
+		labelLimits: newLabelLimits(),
+		slos: &sloRegistry{
+			services: make(map[string]*serviceSLO),
+			violations: f.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "grpc_client_slo_violations_total",
+					Help: "Total number of gRPC requests slower than the service latency SLO",
+				},
+				[]string{"service", "method"},
+			),
+		},
+		grpcConnectionsActive: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "grpc_client_connections_active",
+				Help: "Number of active gRPC connections",
+			},
+			[]string{"service"},
+		),
+		grpcConnectionState: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "grpc_client_connection_state",
+				Help: "gRPC connection state (0=Idle, 1=Connecting, 2=Ready, 3=TransientFailure, 4=Shutdown)",
+			},
+			[]string{"service", "state", "target"},
+		),
+		grpcRetriesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_retries_total",
+				Help: "Total number of gRPC retry attempts",
+			},
+			[]string{"service", "method"},
+		),
+		grpcAttemptsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_attempts_total",
+				Help: "Total number of attempts of gRPC calls by the retry interceptor, by attempt number and status code",
+			},
+			[]string{"service", "method", "code", "attempt"},
+		),
+		grpcRetryExhausted: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_retry_exhausted_total",
+				Help: "Total number of gRPC calls that failed on their last allowed attempt",
+			},
+			[]string{"service", "method"},
+		),
+		grpcRetryBudgetExceeded: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_retry_budget_exhausted_total",
+				Help: "Total number of gRPC retries skipped because the retry budget was exhausted",
+			},
+			[]string{"service", "method"},
+		),
+		grpcOutlierEjections: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_outlier_ejections_total",
+				Help: "Total number of pooled connections ejected by outlier detection",
+			},
+			[]string{"service"},
+		),
+		grpcStreamMessagesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_stream_messages_total",
+				Help: "Total number of messages sent and received on gRPC streams",
+			},
+			[]string{"service", "method", "direction"},
+		),
+		grpcAttemptsPerCall: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_attempts_per_call",
+				Help:    "Number of attempts each completed gRPC call took, 1 meaning no retry",
+				Buckets: []float64{1, 2, 3, 4, 5, 7, 10},
+			},
+			[]string{"service", "method"},
+		),
+		grpcCircuitBreakerState: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "grpc_client_circuit_breaker_state",
+				Help: "Circuit breaker state (0=Closed, 1=Open, 2=HalfOpen)",
+			},
+			[]string{"service", "method"},
+		),
+		grpcFallbacksTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_fallbacks_total",
+				Help: "Total number of gRPC calls rejected by a circuit breaker and passed to a fallback, by result (served or failed)",
+			},
+			[]string{"service", "method", "result"},
+		),
+		grpcCacheRequestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_cache_requests_total",
+				Help: "Total number of gRPC calls to cached methods, by result (hit or miss)",
+			},
+			[]string{"service", "method", "result"},
+		),
+		grpcDeduplicatedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_deduplicated_total",
+				Help: "Total number of gRPC calls that shared the RPC of an identical call in flight",
+			},
+			[]string{"service", "method"},
+		),
+		grpcCompressedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_messages_compressed_total",
+				Help: "Total number of gRPC requests sent compressed",
+			},
+			[]string{"service", "method"},
+		),
+		grpcUncompressedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_messages_uncompressed_total",
+				Help: "Total number of gRPC requests sent uncompressed because they were below the compression threshold",
+			},
+			[]string{"service", "method"},
+		),
+		grpcEncryptedBytesTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_encryption_bytes_total",
+				Help: "Total number of plaintext payload bytes encrypted or decrypted",
+			},
+			[]string{"service", "method", "operation"},
+		),
+		grpcBlockedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_blocked_total",
+				Help: "Total number of gRPC calls rejected locally before being sent",
+			},
+			[]string{"service", "method", "reason"},
+		),
+		grpcThrottledTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_throttled_total",
+				Help: "Total number of gRPC calls delayed by the client-side rate limiter",
+			},
+			[]string{"service", "method"},
+		),
+		grpcThrottleWait: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_throttle_wait_seconds",
+				Help:    "Time gRPC calls waited for the client-side rate limiter",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"service", "method"},
+		),
+		grpcCallerAbortedTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_caller_aborted_total",
+				Help: "Total number of gRPC calls aborted by the caller's context (canceled or deadline already exceeded)",
+			},
+			[]string{"service", "method", "reason"},
+		),
+		grpcDefaultTimeouts: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_default_timeouts_total",
+				Help: "Total number of gRPC calls made without a deadline that were given a default one",
+			},
+			[]string{"service", "method"},
+		),
+		grpcRequestBytes: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_request_bytes",
+				Help:    "Size of gRPC requests and sent stream messages in bytes",
+				Buckets: messageSizeBuckets,
+			},
+			[]string{"service", "method"},
+		),
+		grpcResponseBytes: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_response_bytes",
+				Help:    "Size of gRPC responses and received stream messages in bytes",
+				Buckets: messageSizeBuckets,
+			},
+			[]string{"service", "method"},
+		),
+		grpcInflightRequests: newInflightGauge(f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "grpc_client_inflight_requests",
+				Help: "Number of gRPC calls in flight, including open streams",
+			},
+			[]string{"service", "method"},
+		)),
+		grpcStreamDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_stream_duration_seconds",
+				Help:    "Duration of gRPC streams from opening to their end in seconds",
+				Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 1800, 3600},
+			},
+			[]string{"service", "method", "code"},
+		),
+		grpcStreamMessages: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_stream_messages",
+				Help:    "Number of messages sent or received per gRPC stream",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+			},
+			[]string{"service", "method", "direction"},
+		),
+		credentialsRefreshDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_credentials_refresh_duration_seconds",
+				Help:    "Duration of credential token refreshes in seconds",
+				Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"name"},
+		),
+		credentialsRefreshFailures: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_credentials_refresh_failures_total",
+				Help: "Total number of failed credential token refreshes",
+			},
+			[]string{"name"},
+		),
+		metricsDroppedTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "grpc_client_metrics_dropped_total",
+				Help: "Total number of request observations dropped because the async metrics queue was full",
+			},
+		),
+	}
+
+	switch naming {
+	case NamingOTel:
+		m.rpcClientDuration = newOTelClientDuration(f)
+	default:
+		m.grpcRequestsTotal = f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_client_requests_total",
+				Help: "Total number of gRPC requests",
+			},
+			[]string{"service", "method", "code", "caller", "target"},
+		)
+		m.grpcRequestDuration = f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_client_request_duration_seconds",
+				Help:    "gRPC request duration in seconds",
+				Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			[]string{"service", "method", "caller", "target"},
+		)
+	}
+	return m
+}
+
+// serviceVecs returns the metric vectors partitioned by the service label.
+func (m *Metrics) serviceVecs() []interface {
+	DeletePartialMatch(labels prometheus.Labels) int
+} {
+	return []interface {
+		DeletePartialMatch(labels prometheus.Labels) int
+	}{
+		m.grpcConnectionsActive,
+		m.grpcConnectionState,
+		m.grpcRetriesTotal,
+		m.grpcAttemptsTotal,
+		m.grpcRetryExhausted,
+		m.grpcRetryBudgetExceeded,
+		m.grpcOutlierEjections,
+		m.grpcStreamMessagesTotal,
+		m.grpcAttemptsPerCall,
+		m.grpcCircuitBreakerState,
+		m.grpcFallbacksTotal,
+		m.grpcCacheRequestsTotal,
+		m.grpcDeduplicatedTotal,
+		m.grpcCompressedTotal,
+		m.grpcUncompressedTotal,
+		m.grpcEncryptedBytesTotal,
+		m.grpcBlockedTotal,
+		m.grpcThrottledTotal,
+		m.grpcThrottleWait,
+		m.grpcCallerAbortedTotal,
+		m.grpcDefaultTimeouts,
+		m.grpcRequestBytes,
+		m.grpcResponseBytes,
+		m.grpcStreamDuration,
+		m.grpcStreamMessages,
+		m.slos.violations,
+	}
+}
+
+// Gatherer returns the registry the metrics are registered on, for serving or pushing them. It is
+// prometheus.DefaultGatherer unless the Registerer the metrics were created with is a Gatherer,
+// such as a *prometheus.Registry.
+func (m *Metrics) Gatherer() prometheus.Gatherer {
+	return m.gatherer
+}
@@ -0,0 +1,315 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_CallerLabel(t *testing.T) {
+	m := NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil)
+	m.SetMaxCallerLabels(2)
+
+	for _, caller := range []string{"checkout", "billing", "checkout", "search", "", "reports"} {
+		m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", caller, "", time.Millisecond)
+	}
+
+	// Callers past the limit share the overflow bucket, and calls without one are unknown.
+	want := map[string]float64{"checkout": 2, "billing": 1, CallerOther: 2, CallerUnknown: 1}
+	for caller, n := range want {
+		if got := testutil.ToFloat64(m.grpcRequestsTotal.WithLabelValues("orders", "/orders.Orders/Get", "OK", caller, "")); got != n {
+			t.Errorf("requests{caller=%q} = %v, want %v", caller, got, n)
+		}
+	}
+	if got := testutil.CollectAndCount(m.grpcRequestsTotal); got != len(want) {
+		t.Errorf("Expected %d caller series, got %d", len(want), got)
+	}
+}
+
+func TestMetrics_TargetLabel(t *testing.T) {
+	m := NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil)
+	m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "checkout", "10.0.0.1:443", time.Millisecond)
+	if got := testutil.ToFloat64(m.grpcRequestsTotal.WithLabelValues("orders", "/orders.Orders/Get", "OK", "checkout", "")); got != 1 {
+		t.Errorf("Expected the target label to be empty by default, got %v requests without one", got)
+	}
+
+	m = NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil)
+	m.SetMaxTargetLabels(2)
+	for _, target := range []string{"10.0.0.1:443", "10.0.0.2:443", "10.0.0.1:443", "10.0.0.3:443", "10.0.0.4:443"} {
+		m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "checkout", target, time.Millisecond)
+	}
+
+	// Targets past the limit share the overflow value instead of creating new series.
+	want := map[string]float64{"10.0.0.1:443": 2, "10.0.0.2:443": 1, TargetOther: 2}
+	for target, n := range want {
+		if got := testutil.ToFloat64(m.grpcRequestsTotal.WithLabelValues("orders", "/orders.Orders/Get", "OK", "checkout", target)); got != n {
+			t.Errorf("requests{target=%q} = %v, want %v", target, got, n)
+		}
+	}
+	if got := testutil.CollectAndCount(m.grpcRequestsTotal); got != len(want) {
+		t.Errorf("Expected %d target series, got %d", len(want), got)
+	}
+	if got := testutil.CollectAndCount(m.grpcRequestDuration); got != len(want) {
+		t.Errorf("Expected %d target duration series, got %d", len(want), got)
+	}
+}
+
+// histogram returns the sample count and sum of the series of the histogram name with labels.
+func histogram(t *testing.T, reg *prometheus.Registry, name string, labels prometheus.Labels) (uint64, float64) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range f.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue series
+				}
+			}
+			return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+		}
+	}
+	return 0, 0
+}
+
+func TestMetrics_RecordGRPCAttempts(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry(reg, "", nil)
+
+	for _, attempts := range []int{1, 1, 3} {
+		m.RecordGRPCAttempts("orders", "/orders.Orders/Get", attempts)
+	}
+	m.RecordGRPCAttempts("orders", "/orders.Orders/Create", 2)
+
+	if count, sum := histogram(t, reg, "grpc_client_attempts_per_call", prometheus.Labels{"method": "/orders.Orders/Get"}); count != 3 || sum != 5 {
+		t.Errorf("Get attempts: count = %d, sum = %v, want 3 calls taking 5 attempts", count, sum)
+	}
+	if count, sum := histogram(t, reg, "grpc_client_attempts_per_call", prometheus.Labels{"method": "/orders.Orders/Create"}); count != 1 || sum != 2 {
+		t.Errorf("Create attempts: count = %d, sum = %v, want 1 call taking 2 attempts", count, sum)
+	}
+}
+
+func TestMetrics_OTelNaming(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithOptions(&Options{Registerer: reg, Naming: NamingOTel})
+
+	m.RecordGRPCRequest("orders", "/shop.v1.Orders/Get", "OK", "checkout", "", 20*time.Millisecond)
+	m.RecordGRPCRequest("orders", "/shop.v1.Orders/Get", "OK", "checkout", "", 30*time.Millisecond)
+	m.RecordGRPCRequest("orders", "/shop.v1.Orders/Get", "Unavailable", "checkout", "", time.Second)
+
+	labels := prometheus.Labels{
+		"rpc_system":           "grpc",
+		"service":              "orders",
+		"rpc_service":          "shop.v1.Orders",
+		"rpc_method":           "Get",
+		"rpc_grpc_status_code": "0",
+		"caller":               "checkout",
+	}
+	if count, sum := histogram(t, reg, "rpc_client_duration_milliseconds", labels); count != 2 || sum != 50 {
+		t.Errorf("OK calls: count = %d, sum = %vms, want 2 calls taking 50ms", count, sum)
+	}
+	labels["rpc_grpc_status_code"] = "14"
+	if count, sum := histogram(t, reg, "rpc_client_duration_milliseconds", labels); count != 1 || sum != 1000 {
+		t.Errorf("Unavailable calls: count = %d, sum = %vms, want 1 call taking 1000ms", count, sum)
+	}
+
+	// The Prometheus-named request metrics are not registered.
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() == "grpc_client_requests_total" || f.GetName() == "grpc_client_request_duration_seconds" {
+			t.Errorf("Expected %s not to be emitted with NamingOTel", f.GetName())
+		}
+	}
+}
+
+func TestSplitMethod(t *testing.T) {
+	tests := []struct {
+		fullMethod, service, method string
+	}{
+		{"/shop.v1.Orders/Get", "shop.v1.Orders", "Get"},
+		{"shop.v1.Orders/Get", "shop.v1.Orders", "Get"},
+		{"Get", "", "Get"},
+	}
+	for _, tt := range tests {
+		if service, method := splitMethod(tt.fullMethod); service != tt.service || method != tt.method {
+			t.Errorf("splitMethod(%q) = %q, %q, want %q, %q", tt.fullMethod, service, method, tt.service, tt.method)
+		}
+	}
+}
+
+func TestPushConfig_Snapshot(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry(reg, "", nil)
+	m.IncrementGRPCRetry("orders", "/orders.Orders/Get")
+
+	snapshot := (&PushConfig{URL: "http://pushgateway:9091", Job: "batch", Gatherer: reg}).Snapshot()
+	m.IncrementGRPCRetry("orders", "/orders.Orders/Get")
+
+	// The snapshot keeps the metrics gathered when it was taken.
+	want := `
+# HELP grpc_client_retries_total Total number of gRPC retry attempts
+# TYPE grpc_client_retries_total counter
+grpc_client_retries_total{method="/orders.Orders/Get",service="orders"} 1
+`
+	if err := testutil.GatherAndCompare(snapshot.Gatherer, strings.NewReader(want), "grpc_client_retries_total"); err != nil {
+		t.Error(err)
+	}
+	if snapshot.URL != "http://pushgateway:9091" || snapshot.Job != "batch" {
+		t.Errorf("Expected the snapshot to keep the configuration, got %+v", snapshot)
+	}
+}
+
+func TestMetrics_DeleteServiceDrainsInflight(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry(reg, "", nil)
+
+	m.AddGRPCInflight("orders", "/orders.Orders/Get", 1)
+	m.AddGRPCInflight("orders", "/orders.Orders/Create", 1)
+	m.AddGRPCInflight("orders", "/orders.Orders/Create", -1)
+	m.DeleteService("orders")
+
+	// The idle series is deleted, the one with a call in flight is kept until the call finishes.
+	want := `
+# HELP grpc_client_inflight_requests Number of gRPC calls in flight, including open streams
+# TYPE grpc_client_inflight_requests gauge
+grpc_client_inflight_requests{method="/orders.Orders/Get",service="orders"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "grpc_client_inflight_requests"); err != nil {
+		t.Error(err)
+	}
+	m.AddGRPCInflight("orders", "/orders.Orders/Get", -1)
+	if got := testutil.CollectAndCount(m.grpcInflightRequests.gauge); got != 0 {
+		t.Errorf("Expected the drained series to be deleted instead of going negative, got %d series", got)
+	}
+
+	// Calls started after re-registration are counted again.
+	m.AddGRPCInflight("orders", "/orders.Orders/Get", 1)
+	m.AddGRPCInflight("orders", "/orders.Orders/Get", -1)
+	if got := testutil.ToFloat64(m.grpcInflightRequests.gauge.WithLabelValues("orders", "/orders.Orders/Get")); got != 0 {
+		t.Errorf("Expected no calls in flight, got %v", got)
+	}
+}
+
+func TestSLOBuckets(t *testing.T) {
+	buckets := SLOBuckets(200 * time.Millisecond)
+	if len(buckets) != len(sloBucketFactors) {
+		t.Fatalf("Expected %d buckets, got %d", len(sloBucketFactors), len(buckets))
+	}
+	for i, want := range []float64{0.02, 0.05, 0.1, 0.15, 0.18, 0.2, 0.22, 0.25, 0.3, 0.4, 0.6, 1} {
+		if diff := buckets[i] - want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("bucket %d = %v, want %v", i, buckets[i], want)
+		}
+	}
+}
+
+func TestMetrics_SetServiceSLO(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetricsWithRegistry(reg, "", nil)
+	if err := m.SetServiceSLO("orders", 0); err == nil {
+		t.Error("Expected an SLO of 0 to be rejected")
+	}
+	if err := m.SetServiceSLO("orders", 100*time.Millisecond); err != nil {
+		t.Fatalf("SetServiceSLO failed: %v", err)
+	}
+	if err := m.SetServiceSLO("billing", time.Second); err != nil {
+		t.Fatalf("SetServiceSLO failed: %v", err)
+	}
+
+	m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "", "", 50*time.Millisecond)
+	m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "", "", 150*time.Millisecond)
+	m.RecordGRPCRequest("billing", "/billing.Billing/Charge", "OK", "", "", 500*time.Millisecond)
+	m.RecordGRPCRequest("search", "/search.Search/Query", "OK", "", "", 5*time.Second)
+
+	// Only the call above its service's objective is a violation, and services without an SLO
+	// are not tracked.
+	if got := testutil.CollectAndCount(m.slos.violations, "grpc_client_slo_violations_total"); got != 1 {
+		t.Errorf("Expected 1 violation series, got %d", got)
+	}
+	if got := testutil.ToFloat64(m.slos.violations.WithLabelValues("orders", "/orders.Orders/Get")); got != 1 {
+		t.Errorf("orders violations = %v, want 1", got)
+	}
+
+	// Each service's histogram has buckets derived from its own SLO.
+	buckets := func(service string) []float64 {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("Gather failed: %v", err)
+		}
+		for _, f := range families {
+			if f.GetName() != "grpc_client_slo_request_duration_seconds" {
+				continue
+			}
+			for _, metric := range f.GetMetric() {
+				for _, l := range metric.GetLabel() {
+					if l.GetName() == "service" && l.GetValue() == service {
+						var bounds []float64
+						for _, b := range metric.GetHistogram().GetBucket() {
+							bounds = append(bounds, b.GetUpperBound())
+						}
+						return bounds
+					}
+				}
+			}
+		}
+		return nil
+	}
+	for service, slo := range map[string]time.Duration{"orders": 100 * time.Millisecond, "billing": time.Second} {
+		got, want := buckets(service), SLOBuckets(slo)
+		if len(got) != len(want) || got[0] != want[0] || got[len(got)-1] != want[len(want)-1] {
+			t.Errorf("%s buckets = %v, want %v", service, got, want)
+		}
+	}
+	if count, sum := histogram(t, reg, "grpc_client_slo_request_duration_seconds", prometheus.Labels{"service": "orders"}); count != 2 || sum < 0.199 || sum > 0.201 {
+		t.Errorf("orders SLO histogram: count = %d, sum = %v, want 2 calls taking 200ms", count, sum)
+	}
+	if got := testutil.CollectAndCount(reg, "grpc_client_slo_request_duration_seconds"); got != 2 {
+		t.Errorf("Expected SLO histograms for the 2 services with an SLO, got %d series", got)
+	}
+}
+
+func TestMetrics_Async(t *testing.T) {
+	m := NewMetricsWithRegistry(prometheus.NewRegistry(), "", nil)
+	if !m.StartAsync(1) {
+		t.Fatal("Expected StartAsync to switch to asynchronous mode")
+	}
+	if m.StartAsync(1) {
+		t.Error("Expected StartAsync to have no effect while already asynchronous")
+	}
+
+	// Block the background goroutine on the SLO lock, so that it records at most one observation
+	// while the others fill the queue.
+	m.slos.mu.Lock()
+	for i := 0; i < 10; i++ {
+		m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "checkout", "", time.Millisecond)
+	}
+	dropped := testutil.ToFloat64(m.metricsDroppedTotal)
+	if dropped < 8 {
+		t.Errorf("Expected the observations past the queue size to be dropped, got %v dropped", dropped)
+	}
+	m.slos.mu.Unlock()
+
+	// Stopping records the queued observations before returning.
+	m.StopAsync()
+	requests := m.grpcRequestsTotal.WithLabelValues("orders", "/orders.Orders/Get", "OK", "checkout", "")
+	if got := testutil.ToFloat64(requests); got+dropped != 10 {
+		t.Errorf("Expected the %v observations not dropped to be recorded, got %v", 10-dropped, got)
+	}
+
+	// Once stopped, requests are recorded synchronously again.
+	m.RecordGRPCRequest("orders", "/orders.Orders/Get", "OK", "checkout", "", time.Millisecond)
+	if got := testutil.ToFloat64(requests); got+dropped != 11 {
+		t.Errorf("Expected the request to be recorded synchronously, got %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+)
+
+// Naming selects how request metrics are named.
+type Naming int
+
+const (
+	// NamingPrometheus emits grpc_client_requests_total and grpc_client_request_duration_seconds.
+	NamingPrometheus Naming = iota
+	// NamingOTel emits the OpenTelemetry RPC client semantic conventions as translated to
+	// Prometheus: rpc_client_duration_milliseconds with rpc_system, rpc_service, rpc_method,
+	// rpc_grpc_status_code and server_address labels, plus the manager's service and caller labels.
+	// Call counts are the histogram's _count.
+	// Metrics without a semantic convention keep their grpc_client_* names.
+	NamingOTel
+)
+
+// otelDurationBuckets are the OpenTelemetry SDK's default explicit bucket boundaries in milliseconds.
+var otelDurationBuckets = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+func newOTelClientDuration(f promauto.Factory) *prometheus.HistogramVec {
+	return f.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        "rpc_client_duration_milliseconds",
+			Help:        "Measures the duration of outbound RPC",
+			Buckets:     otelDurationBuckets,
+			ConstLabels: prometheus.Labels{"rpc_system": "grpc"},
+		},
+		[]string{"service", "rpc_service", "rpc_method", "rpc_grpc_status_code", "caller", "server_address"},
+	)
+}
+
+// otelStatusCodes maps status code names to their numeric values, as rpc.grpc.status_code is numeric.
+var otelStatusCodes = func() map[string]string {
+	m := make(map[string]string)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		m[c.String()] = strconv.Itoa(int(c))
+	}
+	return m
+}()
+
+// splitMethod splits a full method name ("/pkg.Service/Method") into its service and method.
+func splitMethod(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "", fullMethod
+}
+
+func otelStatusCode(code string) string {
+	if n, ok := otelStatusCodes[code]; ok {
+		return n
+	}
+	return code
+}
@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OTelInstrumentationName is the name of the OpenTelemetry meter used by OTelRecorder.
+const OTelInstrumentationName = "grpc-connection-manager"
+
+// OTelRecorder is a MetricsRecorder that records to OpenTelemetry instruments, for exporting
+// with any OpenTelemetry metric exporter. Request durations follow the RPC client semantic
+// conventions as rpc.client.duration in milliseconds; the other measurements are named after
+// their Prometheus counterparts, e.g. grpc.client.retries for grpc_client_retries_total.
+//
+// OpenTelemetry cannot delete recorded series, so DeleteService does nothing.
+type OTelRecorder struct {
+	rpcClientDuration          metric.Float64Histogram
+	requestSize                metric.Int64Histogram
+	responseSize               metric.Int64Histogram
+	connectionsActive          metric.Int64Gauge
+	connectionState            metric.Int64Gauge
+	retries                    metric.Int64Counter
+	attempts                   metric.Int64Counter
+	retryExhausted             metric.Int64Counter
+	retryBudgetExhausted       metric.Int64Counter
+	outlierEjections           metric.Int64Counter
+	streamMessagesTotal        metric.Int64Counter
+	streamMessages             metric.Int64Histogram
+	streamDuration             metric.Float64Histogram
+	inflight                   metric.Int64UpDownCounter
+	attemptsPerCall            metric.Int64Histogram
+	circuitBreakerState        metric.Int64Gauge
+	fallbacks                  metric.Int64Counter
+	cacheRequests              metric.Int64Counter
+	deduplicated               metric.Int64Counter
+	compressed                 metric.Int64Counter
+	uncompressed               metric.Int64Counter
+	encryptedBytes             metric.Int64Counter
+	blocked                    metric.Int64Counter
+	throttled                  metric.Int64Counter
+	throttleWait               metric.Float64Histogram
+	callerAborted              metric.Int64Counter
+	defaultTimeouts            metric.Int64Counter
+	credentialsRefreshDuration metric.Float64Histogram
+	credentialsRefreshFailures metric.Int64Counter
+	labelLimits
+}
+
+// NewOTelRecorder creates an OTelRecorder whose instruments come from the provider's
+// OTelInstrumentationName meter, e.g. otel.GetMeterProvider().
+func NewOTelRecorder(provider metric.MeterProvider) (*OTelRecorder, error) {
+	meter := provider.Meter(OTelInstrumentationName)
+	r := &OTelRecorder{labelLimits: newLabelLimits()}
+
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	counter := func(name, description string) metric.Int64Counter {
+		c, err := meter.Int64Counter(name, metric.WithDescription(description))
+		check(err)
+		return c
+	}
+	gauge := func(name, description string) metric.Int64Gauge {
+		g, err := meter.Int64Gauge(name, metric.WithDescription(description))
+		check(err)
+		return g
+	}
+	seconds := func(name, description string) metric.Float64Histogram {
+		h, err := meter.Float64Histogram(name, metric.WithDescription(description), metric.WithUnit("s"))
+		check(err)
+		return h
+	}
+	histogram := func(name, description, unit string, buckets []float64) metric.Int64Histogram {
+		h, err := meter.Int64Histogram(name, metric.WithDescription(description), metric.WithUnit(unit),
+			metric.WithExplicitBucketBoundaries(buckets...))
+		check(err)
+		return h
+	}
+
+	var err error
+	r.rpcClientDuration, err = meter.Float64Histogram("rpc.client.duration",
+		metric.WithDescription("Measures the duration of outbound RPC"), metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(otelDurationBuckets...))
+	check(err)
+	r.requestSize = histogram("rpc.client.request.size", "Size of gRPC requests and sent stream messages", "By", messageSizeBuckets)
+	r.responseSize = histogram("rpc.client.response.size", "Size of gRPC responses and received stream messages", "By", messageSizeBuckets)
+	r.connectionsActive = gauge("grpc.client.connections.active", "Number of active gRPC connections")
+	r.connectionState = gauge("grpc.client.connection.state", "gRPC connection state, 1 for the current state and 0 for the others")
+	r.retries = counter("grpc.client.retries", "Number of gRPC retry attempts")
+	r.attempts = counter("grpc.client.attempts", "Number of attempts of gRPC calls by the retry interceptor, by attempt number and status code")
+	r.retryExhausted = counter("grpc.client.retry.exhausted", "Number of gRPC calls that failed on their last allowed attempt")
+	r.retryBudgetExhausted = counter("grpc.client.retry_budget.exhausted", "Number of gRPC retries skipped because the retry budget was exhausted")
+	r.outlierEjections = counter("grpc.client.outlier_ejections", "Number of pooled connections ejected by outlier detection")
+	r.streamMessagesTotal = counter("grpc.client.stream.messages", "Number of messages sent and received on gRPC streams")
+	r.streamMessages = histogram("grpc.client.stream.messages_per_stream", "Number of messages sent or received per gRPC stream", "{message}",
+		[]float64{1, 4, 16, 64, 256, 1024, 4096, 16384})
+	r.streamDuration = seconds("grpc.client.stream.duration", "Duration of gRPC streams from opening to their end")
+	r.inflight, err = meter.Int64UpDownCounter("grpc.client.inflight_requests",
+		metric.WithDescription("Number of gRPC calls in flight, including open streams"))
+	check(err)
+	r.attemptsPerCall = histogram("grpc.client.attempts_per_call", "Number of attempts each completed gRPC call took, 1 meaning no retry", "{attempt}",
+		[]float64{1, 2, 3, 4, 5, 7, 10})
+	r.circuitBreakerState = gauge("grpc.client.circuit_breaker.state", "Circuit breaker state (0=Closed, 1=Open, 2=HalfOpen)")
+	r.fallbacks = counter("grpc.client.fallbacks", "Number of gRPC calls rejected by a circuit breaker and passed to a fallback, by result (served or failed)")
+	r.cacheRequests = counter("grpc.client.cache.requests", "Number of gRPC calls to cached methods, by result (hit or miss)")
+	r.deduplicated = counter("grpc.client.deduplicated", "Number of gRPC calls that shared the RPC of an identical call in flight")
+	r.compressed = counter("grpc.client.messages.compressed", "Number of gRPC requests sent compressed")
+	r.uncompressed = counter("grpc.client.messages.uncompressed", "Number of gRPC requests sent uncompressed because they were below the compression threshold")
+	r.encryptedBytes = counter("grpc.client.encryption.bytes", "Number of plaintext payload bytes encrypted or decrypted")
+	r.blocked = counter("grpc.client.blocked", "Number of gRPC calls rejected locally before being sent")
+	r.throttled = counter("grpc.client.throttled", "Number of gRPC calls delayed by the client-side rate limiter")
+	r.throttleWait = seconds("grpc.client.throttle.wait", "Time gRPC calls waited for the client-side rate limiter")
+	r.callerAborted = counter("grpc.client.caller_aborted", "Number of gRPC calls aborted by the caller's context")
+	r.defaultTimeouts = counter("grpc.client.default_timeouts", "Number of gRPC calls made without a deadline that were given a default one")
+	r.credentialsRefreshDuration = seconds("grpc.client.credentials.refresh.duration", "Duration of credential token refreshes")
+	r.credentialsRefreshFailures = counter("grpc.client.credentials.refresh.failures", "Number of failed credential token refreshes")
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// methodAttrs returns the attributes of a service's method.
+func methodAttrs(service, method string, kvs ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributes(append([]attribute.KeyValue{
+		attribute.String("service", service),
+		attribute.String("method", method),
+	}, kvs...)...)
+}
+
+// RecordGRPCRequest implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCRequest(service, method, code, caller, target string, duration time.Duration) {
+	rpcService, rpcMethod := splitMethod(method)
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", rpcService),
+		attribute.String("rpc.method", rpcMethod),
+		attribute.String("service", service),
+		attribute.String("caller", r.callerLabel(caller)),
+	}
+	if n, err := strconv.Atoi(otelStatusCode(code)); err == nil {
+		attrs = append(attrs, attribute.Int("rpc.grpc.status_code", n))
+	}
+	if target = r.targetLabel(target); target != "" {
+		attrs = append(attrs, attribute.String("server.address", target))
+	}
+	r.rpcClientDuration.Record(context.Background(), float64(duration)/float64(time.Millisecond), metric.WithAttributes(attrs...))
+}
+
+// UpdateGRPCConnections implements MetricsRecorder.
+func (r *OTelRecorder) UpdateGRPCConnections(service string, count int) {
+	r.connectionsActive.Record(context.Background(), int64(count), metric.WithAttributes(attribute.String("service", service)))
+}
+
+// UpdateGRPCConnectionState implements MetricsRecorder.
+func (r *OTelRecorder) UpdateGRPCConnectionState(service, target, state string) {
+	target = r.targetLabel(target)
+	for _, s := range []string{"Idle", "Connecting", "Ready", "TransientFailure", "Shutdown"} {
+		var v int64
+		if s == state {
+			v = 1
+		}
+		r.connectionState.Record(context.Background(), v, metric.WithAttributes(
+			attribute.String("service", service),
+			attribute.String("state", s),
+			attribute.String("target", target),
+		))
+	}
+}
+
+// IncrementGRPCRetry implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCRetry(service, method string) {
+	r.retries.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// RecordGRPCAttempt implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCAttempt(service, method, code string, attempt int) {
+	r.attempts.Add(context.Background(), 1, methodAttrs(service, method,
+		attribute.String("code", code), attribute.Int("attempt", attempt)))
+}
+
+// IncrementGRPCRetryExhausted implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCRetryExhausted(service, method string) {
+	r.retryExhausted.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// IncrementGRPCRetryBudgetExhausted implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCRetryBudgetExhausted(service, method string) {
+	r.retryBudgetExhausted.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// IncrementOutlierEjection implements MetricsRecorder.
+func (r *OTelRecorder) IncrementOutlierEjection(service string) {
+	r.outlierEjections.Add(context.Background(), 1, metric.WithAttributes(attribute.String("service", service)))
+}
+
+// RecordGRPCStreamMessage implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCStreamMessage(service, method, direction string) {
+	r.streamMessagesTotal.Add(context.Background(), 1, methodAttrs(service, method, attribute.String("direction", direction)))
+}
+
+// RecordGRPCMessageSize implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCMessageSize(service, method, direction string, size int) {
+	if direction == DirectionSent {
+		r.requestSize.Record(context.Background(), int64(size), methodAttrs(service, method))
+	} else {
+		r.responseSize.Record(context.Background(), int64(size), methodAttrs(service, method))
+	}
+}
+
+// AddGRPCInflight implements MetricsRecorder.
+func (r *OTelRecorder) AddGRPCInflight(service, method string, delta int) {
+	r.inflight.Add(context.Background(), int64(delta), methodAttrs(service, method))
+}
+
+// RecordGRPCStream implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCStream(service, method, code string, duration time.Duration, sent, received int) {
+	ctx := context.Background()
+	r.streamDuration.Record(ctx, duration.Seconds(), methodAttrs(service, method, attribute.String("code", code)))
+	r.streamMessages.Record(ctx, int64(sent), methodAttrs(service, method, attribute.String("direction", DirectionSent)))
+	r.streamMessages.Record(ctx, int64(received), methodAttrs(service, method, attribute.String("direction", DirectionReceived)))
+}
+
+// RecordGRPCAttempts implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCAttempts(service, method string, attempts int) {
+	r.attemptsPerCall.Record(context.Background(), int64(attempts), methodAttrs(service, method))
+}
+
+// UpdateGRPCCircuitBreaker implements MetricsRecorder.
+func (r *OTelRecorder) UpdateGRPCCircuitBreaker(service, method string, state int) {
+	r.circuitBreakerState.Record(context.Background(), int64(state), methodAttrs(service, method))
+}
+
+// RecordGRPCFallback implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCFallback(service, method string, served bool) {
+	r.fallbacks.Add(context.Background(), 1, methodAttrs(service, method, attribute.String("result", fallbackResult(served))))
+}
+
+// RecordGRPCCache implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCCache(service, method string, hit bool) {
+	r.cacheRequests.Add(context.Background(), 1, methodAttrs(service, method, attribute.String("result", cacheResult(hit))))
+}
+
+// IncrementGRPCDeduplicated implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCDeduplicated(service, method string) {
+	r.deduplicated.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// RecordGRPCCompression implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCCompression(service, method string, compressed bool) {
+	if compressed {
+		r.compressed.Add(context.Background(), 1, methodAttrs(service, method))
+		return
+	}
+	r.uncompressed.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// RecordGRPCEncryptedBytes implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCEncryptedBytes(service, method, operation string, n int) {
+	r.encryptedBytes.Add(context.Background(), int64(n), methodAttrs(service, method, attribute.String("operation", operation)))
+}
+
+// IncrementGRPCBlocked implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCBlocked(service, method, reason string) {
+	r.blocked.Add(context.Background(), 1, methodAttrs(service, method, attribute.String("reason", reason)))
+}
+
+// RecordGRPCThrottled implements MetricsRecorder.
+func (r *OTelRecorder) RecordGRPCThrottled(service, method string, wait time.Duration) {
+	r.throttled.Add(context.Background(), 1, methodAttrs(service, method))
+	r.throttleWait.Record(context.Background(), wait.Seconds(), methodAttrs(service, method))
+}
+
+// IncrementGRPCCallerAborted implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCCallerAborted(service, method, reason string) {
+	r.callerAborted.Add(context.Background(), 1, methodAttrs(service, method, attribute.String("reason", reason)))
+}
+
+// IncrementGRPCDefaultTimeout implements MetricsRecorder.
+func (r *OTelRecorder) IncrementGRPCDefaultTimeout(service, method string) {
+	r.defaultTimeouts.Add(context.Background(), 1, methodAttrs(service, method))
+}
+
+// RecordCredentialsRefresh implements MetricsRecorder.
+func (r *OTelRecorder) RecordCredentialsRefresh(name string, duration time.Duration, err error) {
+	attrs := metric.WithAttributes(attribute.String("name", name))
+	r.credentialsRefreshDuration.Record(context.Background(), duration.Seconds(), attrs)
+	if err != nil {
+		r.credentialsRefreshFailures.Add(context.Background(), 1, attrs)
+	}
+}
+
+// DeleteService implements MetricsRecorder. It does nothing, as OpenTelemetry instruments keep
+// their series until the exporter drops them.
+func (r *OTelRecorder) DeleteService(string) {}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PushConfig configures pushing metrics to a Prometheus Pushgateway, for short-lived
+// jobs that are never scraped.
+type PushConfig struct {
+	// URL is the Pushgateway address, e.g. "http://pushgateway:9091"
+	URL string
+
+	// Job is the job label the metrics are grouped under
+	Job string
+
+	// Grouping holds additional grouping key labels, e.g. {"instance": "batch-7"} (default: nil)
+	Grouping map[string]string
+
+	// Timeout bounds a single push (default: 10s)
+	Timeout time.Duration
+
+	// Client is the HTTP client used for pushing (default: http.DefaultClient)
+	Client *http.Client
+
+	// Gatherer provides the metrics to push, e.g. the registry given to NewMetricsWithRegistry
+	// (default: prometheus.DefaultGatherer)
+	Gatherer prometheus.Gatherer
+}
+
+// DefaultPushTimeout is the push timeout used when PushConfig.Timeout is zero.
+const DefaultPushTimeout = 10 * time.Second
+
+// Validate checks the push configuration.
+func (c *PushConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("URL must not be empty")
+	}
+	if c.Job == "" {
+		return errors.New("Job must not be empty")
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the configuration that pushes the metrics gathered now rather than
+// when Push is called, so that metrics can be captured under a lock and pushed after releasing it.
+func (c *PushConfig) Snapshot() *PushConfig {
+	gatherer := c.Gatherer
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+	families, err := gatherer.Gather()
+
+	snapshot := *c
+	snapshot.Gatherer = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, err
+	})
+	return &snapshot
+}
+
+// Push sends all metrics in the Gatherer's registry to the Pushgateway, replacing any
+// previously pushed metrics with the same grouping key.
+func Push(ctx context.Context, cfg *PushConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultPushTimeout
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	gatherer := cfg.Gatherer
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pusher := push.New(cfg.URL, cfg.Job).
+		Gatherer(gatherer).
+		Client(client)
+	for name, value := range cfg.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.PushContext(ctx)
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import "time"
+
+// MetricsRecorder records the metrics of a connection manager and its interceptors. Metrics, the
+// Prometheus implementation, is the default; OTelRecorder and StatsdRecorder send the same
+// measurements to OpenTelemetry and statsd.
+//
+// Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	// RecordGRPCRequest records a completed call with its duration, status code, calling
+	// component and target address.
+	RecordGRPCRequest(service, method, code, caller, target string, duration time.Duration)
+	// UpdateGRPCConnections sets the number of active connections of a service.
+	UpdateGRPCConnections(service string, count int)
+	// UpdateGRPCConnectionState sets the connectivity state of a service's connection to target.
+	UpdateGRPCConnectionState(service, target, state string)
+	// IncrementGRPCRetry counts a retry attempt.
+	IncrementGRPCRetry(service, method string)
+	// RecordGRPCAttempt records one attempt of a call retried by the retry interceptor with its
+	// status code, attempt being 1 for the first try.
+	RecordGRPCAttempt(service, method, code string, attempt int)
+	// IncrementGRPCRetryExhausted counts a call that failed on its last allowed attempt.
+	IncrementGRPCRetryExhausted(service, method string)
+	// IncrementGRPCRetryBudgetExhausted counts a retry skipped because the retry budget was exhausted.
+	IncrementGRPCRetryBudgetExhausted(service, method string)
+	// IncrementOutlierEjection counts a pooled connection ejected by outlier detection.
+	IncrementOutlierEjection(service string)
+	// RecordGRPCStreamMessage counts a message sent or received on a stream.
+	RecordGRPCStreamMessage(service, method, direction string)
+	// RecordGRPCMessageSize records the size of a message sent or received by a call.
+	RecordGRPCMessageSize(service, method, direction string, size int)
+	// AddGRPCInflight adds delta to the number of calls in flight.
+	AddGRPCInflight(service, method string, delta int)
+	// RecordGRPCStream records a finished stream.
+	RecordGRPCStream(service, method, code string, duration time.Duration, sent, received int)
+	// RecordGRPCAttempts records how many attempts a completed call took.
+	RecordGRPCAttempts(service, method string, attempts int)
+	// UpdateGRPCCircuitBreaker sets the circuit breaker state of a method.
+	UpdateGRPCCircuitBreaker(service, method string, state int)
+	// RecordGRPCFallback records a call rejected by a circuit breaker that was answered by a
+	// fallback, and whether the fallback served a response.
+	RecordGRPCFallback(service, method string, served bool)
+	// RecordGRPCCache records whether a call to a cached method was answered from the cache.
+	RecordGRPCCache(service, method string, hit bool)
+	// IncrementGRPCDeduplicated counts a call that shared the RPC of an identical call in flight.
+	IncrementGRPCDeduplicated(service, method string)
+	// RecordGRPCCompression records whether a request was sent compressed.
+	RecordGRPCCompression(service, method string, compressed bool)
+	// RecordGRPCEncryptedBytes records payload bytes encrypted or decrypted.
+	RecordGRPCEncryptedBytes(service, method, operation string, n int)
+	// IncrementGRPCBlocked counts a call rejected locally for the given reason.
+	IncrementGRPCBlocked(service, method, reason string)
+	// RecordGRPCThrottled records a call that waited for the rate limiter.
+	RecordGRPCThrottled(service, method string, wait time.Duration)
+	// IncrementGRPCCallerAborted counts a call aborted by the caller's context.
+	IncrementGRPCCallerAborted(service, method, reason string)
+	// IncrementGRPCDefaultTimeout counts a call given a default deadline.
+	IncrementGRPCDefaultTimeout(service, method string)
+	// RecordCredentialsRefresh records a credential token refresh and whether it failed.
+	RecordCredentialsRefresh(name string, duration time.Duration, err error)
+	// DeleteService forgets what was recorded for a service, where the backend allows it.
+	DeleteService(service string)
+
+	// SetMaxCallerLabels limits the number of distinct callers recorded.
+	SetMaxCallerLabels(n int)
+	// SetMaxTargetLabels enables recording targets, with at most n distinct values.
+	SetMaxTargetLabels(n int)
+	// TargetLabelsEnabled reports whether targets are recorded, so callers can skip looking them up.
+	TargetLabelsEnabled() bool
+}
+
+var (
+	_ MetricsRecorder = (*Metrics)(nil)
+	_ MetricsRecorder = (*OTelRecorder)(nil)
+	_ MetricsRecorder = (*StatsdRecorder)(nil)
+)
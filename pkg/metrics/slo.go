@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sloBucketFactors are multiples of the SLO used as histogram bucket boundaries,
+// giving resolution around the objective where burn-rate alerting needs it.
+var sloBucketFactors = []float64{0.1, 0.25, 0.5, 0.75, 0.9, 1, 1.1, 1.25, 1.5, 2, 3, 5}
+
+// SLOBuckets returns histogram bucket boundaries in seconds derived from a latency SLO.
+func SLOBuckets(slo time.Duration) []float64 {
+	buckets := make([]float64, len(sloBucketFactors))
+	for i, f := range sloBucketFactors {
+		buckets[i] = slo.Seconds() * f
+	}
+	return buckets
+}
+
+type serviceSLO struct {
+	objective time.Duration
+	duration  *prometheus.HistogramVec
+}
+
+// sloRegistry holds the per-service SLO histograms.
+type sloRegistry struct {
+	mu         sync.RWMutex
+	services   map[string]*serviceSLO
+	violations *prometheus.CounterVec
+}
+
+// SetServiceSLO declares a latency SLO for a service. Requests to the service are additionally
+// recorded in grpc_client_slo_request_duration_seconds with buckets derived from the SLO, and
+// requests slower than the SLO increment grpc_client_slo_violations_total.
+func (m *Metrics) SetServiceSLO(service string, slo time.Duration) error {
+	if slo <= 0 {
+		return errors.New("SLO must be greater than 0")
+	}
+
+	histogram := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        "grpc_client_slo_request_duration_seconds",
+			Help:        "gRPC request duration in seconds with buckets derived from the service latency SLO",
+			Buckets:     SLOBuckets(slo),
+			ConstLabels: prometheus.Labels{"service": service, "slo": slo.String()},
+		},
+		[]string{"method"},
+	)
+	if err := m.registerer.Register(histogram); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return fmt.Errorf("failed to register SLO histogram for %s: %w", service, err)
+		}
+		histogram = are.ExistingCollector.(*prometheus.HistogramVec)
+	}
+
+	m.slos.mu.Lock()
+	defer m.slos.mu.Unlock()
+	m.slos.services[service] = &serviceSLO{objective: slo, duration: histogram}
+	return nil
+}
+
+// recordSLO records a request against the service's SLO, if one is set.
+func (m *Metrics) recordSLO(service, method string, duration time.Duration) {
+	m.slos.mu.RLock()
+	slo := m.slos.services[service]
+	m.slos.mu.RUnlock()
+
+	if slo == nil {
+		return
+	}
+	slo.duration.WithLabelValues(method).Observe(duration.Seconds())
+	if duration > slo.objective {
+		m.slos.violations.WithLabelValues(service, method).Inc()
+	}
+}
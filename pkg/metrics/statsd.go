@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsdConfig configures a StatsdRecorder.
+type StatsdConfig struct {
+	// Address is the statsd agent's UDP address, e.g. "127.0.0.1:8125"
+	Address string
+	// Prefix is prepended to every metric name, e.g. "checkout." (default: "", none)
+	Prefix string
+	// Tags are added to every metric, e.g. {"env": "prod"} (default: nil)
+	Tags map[string]string
+}
+
+// StatsdRecorder is a MetricsRecorder that sends measurements to a statsd agent over UDP, with
+// labels as DogStatsD tags ("|#service:orders,method:/pkg.Svc/Get"), as understood by the Datadog
+// agent, Telegraf and statsd_exporter. Metrics are named after their Prometheus counterparts with
+// dots, e.g. grpc.client.retries for grpc_client_retries_total. Durations are sent as timings in
+// milliseconds.
+//
+// Packets that cannot be sent are dropped, and DeleteService does nothing, as statsd keeps no
+// series.
+type StatsdRecorder struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+	labelLimits
+}
+
+// NewStatsdRecorder creates a StatsdRecorder sending to cfg.Address. Call Close to release its socket.
+func NewStatsdRecorder(cfg *StatsdConfig) (*StatsdRecorder, error) {
+	if cfg == nil || cfg.Address == "" {
+		return nil, errors.New("statsd address must be set")
+	}
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %w", cfg.Address, err)
+	}
+	var tags []string
+	for k, v := range cfg.Tags {
+		tags = append(tags, statsdTag(k, v))
+	}
+	slices.Sort(tags)
+	return &StatsdRecorder{
+		conn:        conn,
+		prefix:      cfg.Prefix,
+		tags:        strings.Join(tags, ","),
+		labelLimits: newLabelLimits(),
+	}, nil
+}
+
+// Close closes the recorder's socket.
+func (r *StatsdRecorder) Close() error {
+	return r.conn.Close()
+}
+
+// statsdTag formats a tag, replacing the characters that delimit tags and metrics.
+func statsdTag(k, v string) string {
+	return statsdTagReplacer.Replace(k) + ":" + statsdTagReplacer.Replace(v)
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// send sends one measurement: value is already formatted and kind is the statsd type, e.g. "c".
+// tags alternate keys and values.
+func (r *StatsdRecorder) send(name, value, kind string, tags ...string) {
+	var b strings.Builder
+	b.WriteString(r.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	sep := "|#"
+	if r.tags != "" {
+		b.WriteString(sep + r.tags)
+		sep = ","
+	}
+	for i := 0; i+1 < len(tags); i += 2 {
+		if tags[i+1] == "" {
+			continue
+		}
+		b.WriteString(sep + statsdTag(tags[i], tags[i+1]))
+		sep = ","
+	}
+	_, _ = r.conn.Write([]byte(b.String()))
+}
+
+func (r *StatsdRecorder) count(name string, n int, tags ...string) {
+	r.send(name, strconv.Itoa(n), "c", tags...)
+}
+
+func (r *StatsdRecorder) gauge(name string, v int, tags ...string) {
+	r.send(name, strconv.Itoa(v), "g", tags...)
+}
+
+func (r *StatsdRecorder) timing(name string, d time.Duration, tags ...string) {
+	r.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms", tags...)
+}
+
+func (r *StatsdRecorder) histogram(name string, v int, tags ...string) {
+	r.send(name, strconv.Itoa(v), "h", tags...)
+}
+
+// RecordGRPCRequest implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCRequest(service, method, code, caller, target string, duration time.Duration) {
+	tags := []string{"service", service, "method", method, "code", code, "caller", r.callerLabel(caller), "target", r.targetLabel(target)}
+	r.count("grpc.client.requests", 1, tags...)
+	r.timing("grpc.client.request.duration", duration, tags...)
+}
+
+// UpdateGRPCConnections implements MetricsRecorder.
+func (r *StatsdRecorder) UpdateGRPCConnections(service string, count int) {
+	r.gauge("grpc.client.connections.active", count, "service", service)
+}
+
+// UpdateGRPCConnectionState implements MetricsRecorder.
+func (r *StatsdRecorder) UpdateGRPCConnectionState(service, target, state string) {
+	target = r.targetLabel(target)
+	for _, s := range []string{"Idle", "Connecting", "Ready", "TransientFailure", "Shutdown"} {
+		v := 0
+		if s == state {
+			v = 1
+		}
+		r.gauge("grpc.client.connection.state", v, "service", service, "state", s, "target", target)
+	}
+}
+
+// IncrementGRPCRetry implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCRetry(service, method string) {
+	r.count("grpc.client.retries", 1, "service", service, "method", method)
+}
+
+// RecordGRPCAttempt implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCAttempt(service, method, code string, attempt int) {
+	r.count("grpc.client.attempts", 1, "service", service, "method", method, "code", code, "attempt", strconv.Itoa(attempt))
+}
+
+// IncrementGRPCRetryExhausted implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCRetryExhausted(service, method string) {
+	r.count("grpc.client.retry.exhausted", 1, "service", service, "method", method)
+}
+
+// IncrementGRPCRetryBudgetExhausted implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCRetryBudgetExhausted(service, method string) {
+	r.count("grpc.client.retry_budget.exhausted", 1, "service", service, "method", method)
+}
+
+// IncrementOutlierEjection implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementOutlierEjection(service string) {
+	r.count("grpc.client.outlier_ejections", 1, "service", service)
+}
+
+// RecordGRPCStreamMessage implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCStreamMessage(service, method, direction string) {
+	r.count("grpc.client.stream.messages", 1, "service", service, "method", method, "direction", direction)
+}
+
+// RecordGRPCMessageSize implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCMessageSize(service, method, direction string, size int) {
+	name := "grpc.client.response.bytes"
+	if direction == DirectionSent {
+		name = "grpc.client.request.bytes"
+	}
+	r.histogram(name, size, "service", service, "method", method)
+}
+
+// AddGRPCInflight implements MetricsRecorder. It sends a relative gauge ("+1|g").
+func (r *StatsdRecorder) AddGRPCInflight(service, method string, delta int) {
+	value := strconv.Itoa(delta)
+	if delta >= 0 {
+		value = "+" + value
+	}
+	r.send("grpc.client.inflight_requests", value, "g", "service", service, "method", method)
+}
+
+// RecordGRPCStream implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCStream(service, method, code string, duration time.Duration, sent, received int) {
+	r.timing("grpc.client.stream.duration", duration, "service", service, "method", method, "code", code)
+	r.histogram("grpc.client.stream.messages_per_stream", sent, "service", service, "method", method, "direction", DirectionSent)
+	r.histogram("grpc.client.stream.messages_per_stream", received, "service", service, "method", method, "direction", DirectionReceived)
+}
+
+// RecordGRPCAttempts implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCAttempts(service, method string, attempts int) {
+	r.histogram("grpc.client.attempts_per_call", attempts, "service", service, "method", method)
+}
+
+// UpdateGRPCCircuitBreaker implements MetricsRecorder.
+func (r *StatsdRecorder) UpdateGRPCCircuitBreaker(service, method string, state int) {
+	r.gauge("grpc.client.circuit_breaker.state", state, "service", service, "method", method)
+}
+
+// RecordGRPCFallback implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCFallback(service, method string, served bool) {
+	r.count("grpc.client.fallbacks", 1, "service", service, "method", method, "result", fallbackResult(served))
+}
+
+// RecordGRPCCache implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCCache(service, method string, hit bool) {
+	r.count("grpc.client.cache.requests", 1, "service", service, "method", method, "result", cacheResult(hit))
+}
+
+// IncrementGRPCDeduplicated implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCDeduplicated(service, method string) {
+	r.count("grpc.client.deduplicated", 1, "service", service, "method", method)
+}
+
+// RecordGRPCCompression implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCCompression(service, method string, compressed bool) {
+	if compressed {
+		r.count("grpc.client.messages.compressed", 1, "service", service, "method", method)
+		return
+	}
+	r.count("grpc.client.messages.uncompressed", 1, "service", service, "method", method)
+}
+
+// RecordGRPCEncryptedBytes implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCEncryptedBytes(service, method, operation string, n int) {
+	r.count("grpc.client.encryption.bytes", n, "service", service, "method", method, "operation", operation)
+}
+
+// IncrementGRPCBlocked implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCBlocked(service, method, reason string) {
+	r.count("grpc.client.blocked", 1, "service", service, "method", method, "reason", reason)
+}
+
+// RecordGRPCThrottled implements MetricsRecorder.
+func (r *StatsdRecorder) RecordGRPCThrottled(service, method string, wait time.Duration) {
+	r.count("grpc.client.throttled", 1, "service", service, "method", method)
+	r.timing("grpc.client.throttle.wait", wait, "service", service, "method", method)
+}
+
+// IncrementGRPCCallerAborted implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCCallerAborted(service, method, reason string) {
+	r.count("grpc.client.caller_aborted", 1, "service", service, "method", method, "reason", reason)
+}
+
+// IncrementGRPCDefaultTimeout implements MetricsRecorder.
+func (r *StatsdRecorder) IncrementGRPCDefaultTimeout(service, method string) {
+	r.count("grpc.client.default_timeouts", 1, "service", service, "method", method)
+}
+
+// RecordCredentialsRefresh implements MetricsRecorder.
+func (r *StatsdRecorder) RecordCredentialsRefresh(name string, duration time.Duration, err error) {
+	r.timing("grpc.client.credentials.refresh.duration", duration, "name", name)
+	if err != nil {
+		r.count("grpc.client.credentials.refresh.failures", 1, "name", name)
+	}
+}
+
+// DeleteService implements MetricsRecorder. It does nothing, as statsd keeps no series.
+func (r *StatsdRecorder) DeleteService(string) {}
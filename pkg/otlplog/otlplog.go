@@ -0,0 +1,116 @@
+// Package otlplog exports interceptor events as OpenTelemetry logs.
+package otlplog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+)
+
+// InstrumentationName is the name of the OpenTelemetry logger used for events.
+const InstrumentationName = "grpc-connection-manager"
+
+// Exporter is an interceptors.EventSink that emits events as OpenTelemetry log records.
+// Records are emitted with the call's context, so the SDK attaches the active trace and span IDs.
+type Exporter struct {
+	logger log.Logger
+}
+
+// NewExporter creates an Exporter that emits records through the given logger provider.
+func NewExporter(provider log.LoggerProvider) *Exporter {
+	return &Exporter{logger: provider.Logger(InstrumentationName)}
+}
+
+// Emit implements interceptors.EventSink.
+func (e *Exporter) Emit(ctx context.Context, ev interceptors.Event) {
+	var r log.Record
+	r.SetTimestamp(time.Now())
+	r.SetEventName("grpc.client." + string(ev.Kind))
+	r.AddAttributes(
+		log.String("rpc.system", "grpc"),
+		log.String("rpc.service", ev.Service),
+		log.String("rpc.method", ev.Method),
+	)
+
+	switch ev.Kind {
+	case interceptors.EventCallFailed:
+		r.SetSeverity(log.SeverityWarn)
+		r.SetBody(log.StringValue(fmt.Sprintf("gRPC call failed: %v", ev.Err)))
+		r.AddAttributes(
+			log.String("rpc.grpc.status_code", ev.Code.String()),
+			log.Float64("duration_seconds", ev.Duration.Seconds()),
+		)
+	case interceptors.EventRetry:
+		r.SetSeverity(log.SeverityWarn)
+		r.SetBody(log.StringValue(fmt.Sprintf("gRPC call failed, retrying: %v", ev.Err)))
+		r.AddAttributes(
+			log.String("rpc.grpc.status_code", ev.Code.String()),
+			log.Int("attempt", ev.Attempt),
+			log.Float64("backoff_seconds", ev.Duration.Seconds()),
+		)
+	case interceptors.EventCircuitBreakerTransition:
+		severity := log.SeverityInfo
+		if ev.To == interceptors.StateOpen {
+			severity = log.SeverityWarn
+		}
+		r.SetSeverity(severity)
+		r.SetBody(log.StringValue(fmt.Sprintf("Circuit breaker transitioned from %s to %s", ev.From, ev.To)))
+		r.AddAttributes(
+			log.String("circuit_breaker.from", ev.From.String()),
+			log.String("circuit_breaker.to", ev.To.String()),
+		)
+	case interceptors.EventRetryExhausted:
+		r.SetSeverity(log.SeverityError)
+		r.SetBody(log.StringValue(fmt.Sprintf("gRPC call failed after %d attempts: %v", ev.Attempt, ev.Err)))
+		r.AddAttributes(
+			log.String("rpc.grpc.status_code", ev.Code.String()),
+			log.Int("attempt", ev.Attempt),
+		)
+	case interceptors.EventConnCreated, interceptors.EventConnReady, interceptors.EventConnClosed:
+		r.SetSeverity(log.SeverityInfo)
+		r.SetBody(log.StringValue(fmt.Sprintf("Connection %s: %s", strings.TrimPrefix(string(ev.Kind), "conn_"), ev.Address)))
+		r.AddAttributes(log.String("server.address", ev.Address))
+	case interceptors.EventConnTransientFailure:
+		r.SetSeverity(log.SeverityWarn)
+		r.SetBody(log.StringValue(fmt.Sprintf("Connection in transient failure: %s", ev.Address)))
+		r.AddAttributes(log.String("server.address", ev.Address))
+	}
+	r.SetSeverityText(r.Severity().String())
+
+	e.logger.Emit(ctx, r)
+}
+
+// Config holds configuration for exporting logs to an OTLP/gRPC endpoint.
+type Config struct {
+	// Endpoint is the collector address, e.g. "otel-collector:4317"
+	Endpoint string
+	// Insecure disables TLS for the exporter connection (default: false)
+	Insecure bool
+	// Headers are sent with every export request, e.g. for authentication (default: nil)
+	Headers map[string]string
+}
+
+// NewLoggerProvider creates a batching logger provider exporting to the configured OTLP endpoint.
+// The caller must call Shutdown on the returned provider to flush pending records.
+func NewLoggerProvider(ctx context.Context, cfg Config) (*sdklog.LoggerProvider, error) {
+	opts := []otlploggrpc.Option{otlploggrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlploggrpc.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlploggrpc.WithHeaders(cfg.Headers))
+	}
+
+	exporter, err := otlploggrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+	}
+	return sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter))), nil
+}
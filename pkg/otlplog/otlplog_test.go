@@ -0,0 +1,68 @@
+package otlplog
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+
+	"github.com/begenov/grpc-connection-manager/pkg/interceptors"
+)
+
+type recordingProcessor struct {
+	records []sdklog.Record
+}
+
+func (p *recordingProcessor) OnEmit(_ context.Context, r *sdklog.Record) error {
+	p.records = append(p.records, r.Clone())
+	return nil
+}
+
+func (p *recordingProcessor) Shutdown(context.Context) error   { return nil }
+func (p *recordingProcessor) ForceFlush(context.Context) error { return nil }
+
+func TestExporter_Emit(t *testing.T) {
+	processor := &recordingProcessor{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(processor))
+	exporter := NewExporter(provider)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	exporter.Emit(ctx, interceptors.Event{
+		Kind:    interceptors.EventRetry,
+		Service: "users",
+		Method:  "/users.Users/Get",
+		Code:    codes.Unavailable,
+		Err:     errors.New("unavailable"),
+		Attempt: 1,
+	})
+
+	if len(processor.records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(processor.records))
+	}
+	r := processor.records[0]
+	if r.EventName() != "grpc.client.retry" {
+		t.Errorf("event name = %q, want grpc.client.retry", r.EventName())
+	}
+	if r.TraceID() != sc.TraceID() || r.SpanID() != sc.SpanID() {
+		t.Errorf("record not correlated with trace: trace=%s span=%s", r.TraceID(), r.SpanID())
+	}
+
+	attrs := make(map[string]string)
+	r.WalkAttributes(func(kv log.KeyValue) bool {
+		attrs[kv.Key] = kv.Value.String()
+		return true
+	})
+	if attrs["rpc.service"] != "users" || attrs["rpc.grpc.status_code"] != "Unavailable" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+}
@@ -0,0 +1,65 @@
+// Package xds lets a ConnectionManager dial xds:/// targets, resolved and balanced by an xDS
+// control plane such as proxyless Istio or Traffic Director.
+//
+// Importing it registers gRPC's xds resolver and balancers. It is a module of its own so that
+// applications that do not use xDS do not link them.
+package xds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/begenov/grpc-connection-manager/pkg/manager"
+
+	"google.golang.org/grpc/credentials"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+	_ "google.golang.org/grpc/xds" // registers the xds resolver
+)
+
+// support implements manager.XDSSupport with gRPC's xds resolver and credentials.
+type support struct{}
+
+// New returns the xDS support to set as manager.Config.XDS.
+func New() manager.XDSSupport {
+	return support{}
+}
+
+// bootstrap is the part of the gRPC xDS bootstrap config checked by Validate.
+type bootstrap struct {
+	XDSServers []json.RawMessage `json:"xds_servers"`
+}
+
+// Validate checks that the bootstrap config, read by gRPC from the GRPC_XDS_BOOTSTRAP_CONFIG or
+// GRPC_XDS_BOOTSTRAP environment variables, names an xDS server.
+func (support) Validate() error {
+	data := []byte(os.Getenv("GRPC_XDS_BOOTSTRAP_CONFIG"))
+	source := "GRPC_XDS_BOOTSTRAP_CONFIG"
+	if len(data) == 0 {
+		path := os.Getenv("GRPC_XDS_BOOTSTRAP")
+		if path == "" {
+			return errors.New("no bootstrap config, set GRPC_XDS_BOOTSTRAP or GRPC_XDS_BOOTSTRAP_CONFIG")
+		}
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read bootstrap file: %w", err)
+		}
+		source = path
+	}
+
+	var b bootstrap
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("invalid bootstrap config in %s: %w", source, err)
+	}
+	if len(b.XDSServers) == 0 {
+		return fmt.Errorf("bootstrap config in %s has no xds_servers", source)
+	}
+	return nil
+}
+
+// TransportCredentials returns credentials that use the security configured by the xDS control
+// plane, or fallback when it configures none.
+func (support) TransportCredentials(fallback credentials.TransportCredentials) (credentials.TransportCredentials, error) {
+	return xdscreds.NewClientCredentials(xdscreds.ClientOptions{FallbackCreds: fallback})
+}
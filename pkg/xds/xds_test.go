@@ -0,0 +1,51 @@
+package xds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/begenov/grpc-connection-manager/pkg/manager"
+)
+
+func TestXDS(t *testing.T) {
+	t.Setenv("GRPC_XDS_BOOTSTRAP", "")
+	t.Setenv("GRPC_XDS_BOOTSTRAP_CONFIG", "")
+	cfg := manager.DefaultConfig()
+	cfg.XDS = New()
+	cfg.DialMode = manager.DialModeNewClient // connections stay Idle without a control plane
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error without a bootstrap config")
+	}
+
+	path := filepath.Join(t.TempDir(), "bootstrap.json")
+	if err := os.WriteFile(path, []byte(`{"node": {"id": "test"}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("GRPC_XDS_BOOTSTRAP", path)
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a bootstrap config without xds_servers")
+	}
+
+	bootstrap := `{
+		"xds_servers": [{"server_uri": "127.0.0.1:1", "channel_creds": [{"type": "insecure"}], "server_features": ["xds_v3"]}],
+		"node": {"id": "test"}
+	}`
+	if err := os.WriteFile(path, []byte(bootstrap), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	cm, err := manager.NewConnectionManager(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewConnectionManager failed: %v", err)
+	}
+	defer cm.Close()
+
+	conn, err := cm.GetConnection(context.Background(), "orders", "xds:///orders.shop.svc.cluster.local:50051")
+	if err != nil {
+		t.Fatalf("GetConnection failed: %v", err)
+	}
+	if target := conn.Target(); target != "xds:///orders.shop.svc.cluster.local:50051" {
+		t.Errorf("expected the xds target to be dialed as is, got %s", target)
+	}
+}